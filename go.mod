@@ -10,6 +10,8 @@ require (
 	github.com/prometheus/client_golang v1.13.0
 	github.com/tchap/zapext v1.0.0
 	github.com/tidwall/gjson v1.14.3
+	github.com/vishvananda/netlink v1.1.0
+	github.com/vishvananda/netns v0.0.4
 	go.temporal.io/sdk v1.20.0
 	go.uber.org/zap v1.23.0
 	google.golang.org/grpc v1.51.0
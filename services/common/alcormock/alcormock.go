@@ -0,0 +1,327 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+// Package alcormock is an in-memory stand-in for the Alcor REST API used by
+// merak-network and merak-agent. It keeps the created resources, hands out
+// IPs and MACs and can be told to slow down or fail requests, so network and
+// compute flows can be exercised without a Kubernetes cluster.
+package alcormock
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resource names as they appear in Alcor's REST paths
+const (
+	VPCS                 = "vpcs"
+	SUBNETS              = "subnets"
+	ROUTERS              = "routers"
+	SECURITY_GROUPS      = "security-groups"
+	SECURITY_GROUP_RULES = "security-group-rules"
+	PORTS                = "ports"
+	NODES                = "nodes"
+)
+
+// Ports the Alcor micro services are exposed on in a Merak deployment
+var DefaultPorts = []int{30001, 30002, 30003, 30004, 30005, 30006, 30007, 30008}
+
+// JSON key wrapping a single object of each resource
+var resourceKeys = map[string]string{
+	VPCS:                 "network",
+	SUBNETS:              "subnet",
+	ROUTERS:              "router",
+	SECURITY_GROUPS:      "security_group",
+	SECURITY_GROUP_RULES: "security_group_rule",
+	PORTS:                "port",
+	NODES:                "host_info",
+}
+
+type Config struct {
+	// Delay added before every response
+	Latency time.Duration
+	// Fraction of requests, between 0 and 1, answered with a 500
+	ErrorRate float64
+	// Seed for the error rate, 0 picks a random one
+	Seed int64
+}
+
+// Status of a fault whose request goes through but gets no reply
+const dropReply = -1
+
+type fault struct {
+	method    string
+	resource  string
+	status    int
+	remaining int
+}
+
+type object map[string]interface{}
+
+type Server struct {
+	mu        sync.Mutex
+	latency   time.Duration
+	errorRate float64
+	rand      *rand.Rand
+	faults    []*fault
+	lastID    uint64
+	lastMac   uint64
+	objects   map[string]map[string]object
+	pools     map[string]*ipPool
+	requests  map[string]int
+}
+
+// Creates a new mock with no resources
+func New(config Config) *Server {
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s := &Server{
+		latency:   config.Latency,
+		errorRate: config.ErrorRate,
+		rand:      rand.New(rand.NewSource(seed)),
+	}
+	s.Reset()
+	return s
+}
+
+// Drops every resource, fault and request count
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+	s.objects = make(map[string]map[string]object)
+	for resource := range resourceKeys {
+		s.objects[resource] = make(map[string]object)
+	}
+	s.pools = make(map[string]*ipPool)
+	s.requests = make(map[string]int)
+}
+
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+func (s *Server) SetErrorRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorRate = rate
+}
+
+// Makes the next count requests with the given method on resource fail with
+// status. An empty method or resource matches any.
+func (s *Server) InjectError(method, resource string, status, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault{method: method, resource: resource, status: status, remaining: count})
+}
+
+// Makes the next count requests with the given method on resource go
+// through, but closes the connection instead of replying, like a reply lost
+// to a timeout. An empty method or resource matches any.
+func (s *Server) DropReply(method, resource string, count int) {
+	s.InjectError(method, resource, dropReply, count)
+}
+
+// Number of live objects of a resource
+func (s *Server) Count(resource string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects[resource])
+}
+
+// Returns a copy of one object, or nil if it does not exist
+func (s *Server) Get(resource, id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[resource][id]
+	if !ok {
+		return nil
+	}
+	return obj.copy()
+}
+
+// Number of requests received for a method and resource, failed ones included
+func (s *Server) Requests(method, resource string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method+" "+resource]
+}
+
+// Serves the mock on every given port of host, the way the Alcor micro
+// services are exposed. Blocks until one of the listeners fails.
+func (s *Server) ListenAndServe(host string, ports []int) error {
+	errs := make(chan error, len(ports))
+	for _, port := range ports {
+		srv := &http.Server{Addr: net.JoinHostPort(host, strconv.Itoa(port)), Handler: s}
+		log.Println("Alcor mock listening on", srv.Addr)
+		go func(srv *http.Server) { errs <- srv.ListenAndServe() }(srv)
+	}
+	return <-errs
+}
+
+// Starts serving on every given port of host in the background. Fails if
+// any port can't be bound. The returned function stops all listeners.
+func (s *Server) Start(host string, ports []int) (func(), error) {
+	var servers []*http.Server
+	stop := func() {
+		for _, srv := range servers {
+			srv.Close()
+		}
+	}
+	for _, port := range ports {
+		lis, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		srv := &http.Server{Handler: s}
+		servers = append(servers, srv)
+		go srv.Serve(lis)
+	}
+	return stop, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var project, resource string
+	var rest []string
+	switch {
+	case len(parts) >= 3 && parts[0] == "project":
+		project, resource, rest = parts[1], parts[2], parts[3:]
+	case parts[0] == NODES:
+		resource, rest = NODES, parts[1:]
+	}
+	if _, ok := resourceKeys[resource]; !ok {
+		writeError(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests[r.Method+" "+resource]++
+	latency := s.latency
+	status := s.injectedStatus(r.Method, resource)
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(latency):
+		}
+	}
+	if status > 0 {
+		writeError(w, status, "injected error")
+		return
+	}
+
+	var body map[string]json.RawMessage
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+			return
+		}
+	}
+
+	code, resp := s.serve(r.Method, project, resource, rest, body)
+
+	if status == dropReply {
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			conn.Close()
+		}
+		return
+	}
+	if code >= 400 {
+		writeError(w, code, fmt.Sprint(resp))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if resp != nil {
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func (s *Server) serve(method, project, resource string, rest []string, body map[string]json.RawMessage) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handle(method, project, resource, rest, body)
+}
+
+// Returns the status of a matching injected fault, or 0 if the request
+// should go through. Must be called with the lock held.
+func (s *Server) injectedStatus(method, resource string) int {
+	for i, f := range s.faults {
+		if (f.method == "" || f.method == method) && (f.resource == "" || f.resource == resource) {
+			f.remaining--
+			if f.remaining <= 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+			return f.status
+		}
+	}
+	if s.errorRate > 0 && s.rand.Float64() < s.errorRate {
+		return http.StatusInternalServerError
+	}
+	return 0
+}
+
+// Alcor style ids, unique for the lifetime of the server
+func (s *Server) newID() string {
+	s.lastID++
+	return fmt.Sprintf("%08x-%04x-4%03x-%04x-%012x", s.rand.Uint32(), s.rand.Intn(0x10000), s.rand.Intn(0x1000), 0x8000|s.rand.Intn(0x4000), s.lastID)
+}
+
+func (s *Server) newMac() string {
+	s.lastMac++
+	return fmt.Sprintf("fa:16:3e:%02x:%02x:%02x", s.lastMac>>16&0xff, s.lastMac>>8&0xff, s.lastMac&0xff)
+}
+
+func (o object) copy() object {
+	raw, _ := json.Marshal(o)
+	var dup object
+	json.Unmarshal(raw, &dup)
+	return dup
+}
+
+func (o object) str(key string) string {
+	value, _ := o[key].(string)
+	return value
+}
+
+func (o object) list(key string) ([]interface{}, bool) {
+	value, ok := o[key].([]interface{})
+	return value, ok
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    status,
+		"error":     http.StatusText(status),
+		"message":   message,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,274 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package alcormock
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func call(t *testing.T, url, method, path string, body interface{}) (int, string) {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequest(method, url+path, bytes.NewReader(payload))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	return resp.StatusCode, buf.String()
+}
+
+// Creates a vpc with one subnet and returns their ids
+func newNetwork(t *testing.T, url, cidr string) (string, string) {
+	code, resp := call(t, url, http.MethodPost, "/project/p1/vpcs", map[string]interface{}{
+		"network": map[string]interface{}{"name": "vpc", "cidr": "10.0.0.0/16"},
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	vpcId := gjson.Get(resp, "network.id").Str
+
+	code, resp = call(t, url, http.MethodPost, "/project/p1/subnets", map[string]interface{}{
+		"subnet": map[string]interface{}{"name": "subnet", "cidr": cidr, "network_id": vpcId, "ip_version": 4},
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, vpcId, gjson.Get(resp, "subnet.network_id").Str)
+	return vpcId, gjson.Get(resp, "subnet.id").Str
+}
+
+func TestNetworkLifecycle(t *testing.T) {
+	mock := New(Config{Seed: 1})
+	ts := httptest.NewServer(mock)
+	defer ts.Close()
+
+	vpcId, subnetId := newNetwork(t, ts.URL, "10.0.1.0/24")
+	code, resp := call(t, ts.URL, http.MethodGet, "/project/p1/subnets/"+subnetId, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "10.0.1.1", gjson.Get(resp, "subnet.gateway_ip").Str)
+	assert.Equal(t, "", gjson.Get(resp, "subnet.attached_router_id").Str)
+
+	code, resp = call(t, ts.URL, http.MethodPost, "/project/p1/routers", map[string]interface{}{"router": map[string]interface{}{"name": "router"}})
+	assert.Equal(t, http.StatusCreated, code)
+	routerId := gjson.Get(resp, "router.id").Str
+
+	code, _ = call(t, ts.URL, http.MethodPut, "/project/p1/routers/"+routerId+"/add_router_interface", map[string]string{"subnet_id": subnetId})
+	assert.Equal(t, http.StatusOK, code)
+	_, resp = call(t, ts.URL, http.MethodGet, "/project/p1/subnets/"+subnetId, nil)
+	assert.Equal(t, routerId, gjson.Get(resp, "subnet.attached_router_id").Str)
+
+	// Resources that are still in use can't be removed
+	code, _ = call(t, ts.URL, http.MethodDelete, "/project/p1/routers/"+routerId, nil)
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = call(t, ts.URL, http.MethodDelete, "/project/p1/subnets/"+subnetId, nil)
+	assert.Equal(t, http.StatusConflict, code)
+	code, _ = call(t, ts.URL, http.MethodDelete, "/project/p1/vpcs/"+vpcId, nil)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, _ = call(t, ts.URL, http.MethodPut, "/project/p1/routers/"+routerId+"/remove_router_interface", map[string]string{"subnet_id": subnetId})
+	assert.Equal(t, http.StatusOK, code)
+	for _, path := range []string{"/routers/" + routerId, "/subnets/" + subnetId, "/vpcs/" + vpcId} {
+		code, _ = call(t, ts.URL, http.MethodDelete, "/project/p1"+path, nil)
+		assert.Equal(t, http.StatusOK, code, path)
+	}
+	assert.Equal(t, 0, mock.Count(VPCS))
+	assert.Equal(t, 0, mock.Count(SUBNETS))
+	assert.Equal(t, 0, mock.Count(ROUTERS))
+
+	code, _ = call(t, ts.URL, http.MethodGet, "/project/p1/vpcs/"+vpcId, nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestReadOnlyLists(t *testing.T) {
+	mock := New(Config{Seed: 1})
+	ts := httptest.NewServer(mock)
+	defer ts.Close()
+
+	vpcId, subnetId := newNetwork(t, ts.URL, "10.0.1.0/24")
+	_, resp := call(t, ts.URL, http.MethodPost, "/project/p1/routers", map[string]interface{}{"router": map[string]interface{}{"name": "router"}})
+	routerId := gjson.Get(resp, "router.id").Str
+	_, resp = call(t, ts.URL, http.MethodPost, "/project/p1/security-groups", map[string]interface{}{"security_group": map[string]interface{}{"name": "sg"}})
+	sgId := gjson.Get(resp, "security_group.id").Str
+
+	// Lists kept by the mock itself can't be overwritten
+	for path, body := range map[string]interface{}{
+		"/vpcs/" + vpcId:           map[string]interface{}{"network": map[string]interface{}{"subnets": "broken"}},
+		"/routers/" + routerId:     map[string]interface{}{"router": map[string]interface{}{"subnet_ids": 1}},
+		"/security-groups/" + sgId: map[string]interface{}{"security_group": map[string]interface{}{"security_group_rules": "broken"}},
+	} {
+		code, _ := call(t, ts.URL, http.MethodPut, "/project/p1"+path, body)
+		assert.Equal(t, http.StatusOK, code, path)
+	}
+
+	for _, path := range []string{"/routers/" + routerId, "/security-groups/" + sgId, "/subnets/" + subnetId, "/vpcs/" + vpcId} {
+		code, _ := call(t, ts.URL, http.MethodDelete, "/project/p1"+path, nil)
+		assert.Equal(t, http.StatusOK, code, path)
+	}
+	assert.Equal(t, 0, mock.Count(VPCS))
+}
+
+func TestPortAllocation(t *testing.T) {
+	mock := New(Config{Seed: 1})
+	ts := httptest.NewServer(mock)
+	defer ts.Close()
+
+	vpcId, subnetId := newNetwork(t, ts.URL, "10.0.1.0/29")
+	newPort := func() (int, string) {
+		return call(t, ts.URL, http.MethodPost, "/project/p1/ports", map[string]interface{}{
+			"port": map[string]interface{}{
+				"network_id": vpcId,
+				"device_id":  "vm",
+				"fixed_ips":  []map[string]string{{"subnet_id": subnetId}},
+			},
+		})
+	}
+
+	// A /29 leaves 5 addresses once the gateway is taken
+	ips := map[string]bool{}
+	macs := map[string]bool{}
+	var portIds []string
+	for i := 0; i < 5; i++ {
+		code, resp := newPort()
+		assert.Equal(t, http.StatusCreated, code)
+		ips[gjson.Get(resp, "port.fixed_ips.0.ip_address").Str] = true
+		macs[gjson.Get(resp, "port.mac_address").Str] = true
+		portIds = append(portIds, gjson.Get(resp, "port.id").Str)
+		assert.Greater(t, len(portIds[i]), 11)
+	}
+	assert.Equal(t, map[string]bool{"10.0.1.2": true, "10.0.1.3": true, "10.0.1.4": true, "10.0.1.5": true, "10.0.1.6": true}, ips)
+	assert.Len(t, macs, 5)
+
+	code, _ := newPort()
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, resp := call(t, ts.URL, http.MethodPut, "/project/p1/ports/"+portIds[0], map[string]interface{}{
+		"port": map[string]interface{}{"binding:host_id": "node1", "fixed_ips": nil},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ACTIVE", gjson.Get(resp, "port.status").Str)
+	assert.Equal(t, "10.0.1.2", gjson.Get(resp, "port.fixed_ips.0.ip_address").Str)
+
+	// Deleting a port gives its address back to the subnet
+	code, _ = call(t, ts.URL, http.MethodDelete, "/project/p1/ports/"+portIds[0], nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, resp = newPort()
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "10.0.1.2", gjson.Get(resp, "port.fixed_ips.0.ip_address").Str)
+	assert.Equal(t, 5, mock.Count(PORTS))
+}
+
+func TestSecurityGroupRules(t *testing.T) {
+	mock := New(Config{Seed: 1})
+	ts := httptest.NewServer(mock)
+	defer ts.Close()
+
+	code, resp := call(t, ts.URL, http.MethodPost, "/project/p1/security-groups", map[string]interface{}{
+		"security_group": map[string]interface{}{"name": "sg"},
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	sgId := gjson.Get(resp, "security_group.id").Str
+
+	code, _ = call(t, ts.URL, http.MethodPost, "/project/p1/security-group-rules", map[string]interface{}{
+		"security_group_rule": map[string]interface{}{"security_group_id": sgId, "direction": "sideways"},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, resp = call(t, ts.URL, http.MethodPost, "/project/p1/security-group-rules", map[string]interface{}{
+		"security_group_rule": map[string]interface{}{
+			"security_group_id": sgId,
+			"direction":         "ingress",
+			"protocol":          "tcp",
+			"port_range_min":    22,
+			"port_range_max":    22,
+		},
+	})
+	assert.Equal(t, http.StatusCreated, code)
+	ruleId := gjson.Get(resp, "security_group_rule.id").Str
+	assert.Equal(t, "IPv4", gjson.Get(resp, "security_group_rule.ethertype").Str)
+
+	_, resp = call(t, ts.URL, http.MethodGet, "/project/p1/security-groups/"+sgId, nil)
+	assert.Equal(t, ruleId, gjson.Get(resp, "security_group.security_group_rules.0.id").Str)
+
+	code, _ = call(t, ts.URL, http.MethodDelete, "/project/p1/security-groups/"+sgId, nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 0, mock.Count(SECURITY_GROUP_RULES))
+}
+
+func TestNodes(t *testing.T) {
+	mock := New(Config{Seed: 1})
+	ts := httptest.NewServer(mock)
+	defer ts.Close()
+
+	hosts := map[string]interface{}{"host_infos": []map[string]interface{}{
+		{"node_id": "n1", "node_name": "vhost-1", "local_ip": "10.0.0.1", "server_port": 50001},
+		{"node_id": "n2", "node_name": "vhost-2", "local_ip": "10.0.0.2", "server_port": 50001},
+	}}
+	code, resp := call(t, ts.URL, http.MethodPost, "/nodes/bulk", hosts)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "10.0.0.2:50001", gjson.Get(resp, "1.ncm_uri").Str)
+	assert.Equal(t, 2, mock.Count(NODES))
+
+	code, _ = call(t, ts.URL, http.MethodPost, "/nodes/bulk", hosts)
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, _ = call(t, ts.URL, http.MethodDelete, "/nodes/n1", nil)
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = call(t, ts.URL, http.MethodGet, "/nodes/n1", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestInjectedErrors(t *testing.T) {
+	mock := New(Config{Seed: 1})
+	ts := httptest.NewServer(mock)
+	defer ts.Close()
+
+	vpc := map[string]interface{}{"network": map[string]interface{}{"cidr": "10.0.0.0/16"}}
+	mock.InjectError(http.MethodPost, VPCS, http.StatusServiceUnavailable, 2)
+	for i := 0; i < 2; i++ {
+		code, resp := call(t, ts.URL, http.MethodPost, "/project/p1/vpcs", vpc)
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "injected error", gjson.Get(resp, "message").Str)
+	}
+	code, _ := call(t, ts.URL, http.MethodPost, "/project/p1/vpcs", vpc)
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, 3, mock.Requests(http.MethodPost, VPCS))
+	assert.Equal(t, 1, mock.Count(VPCS))
+
+	// The vpc is created even though the reply never arrives
+	mock.DropReply(http.MethodPost, VPCS, 1)
+	payload, _ := json.Marshal(vpc)
+	_, err := http.Post(ts.URL+"/project/p1/vpcs", "application/json", bytes.NewReader(payload))
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, mock.Count(VPCS))
+
+	mock.SetErrorRate(1)
+	code, _ = call(t, ts.URL, http.MethodGet, "/project/p1/vpcs", nil)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	mock.SetErrorRate(0)
+
+	mock.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	code, _ = call(t, ts.URL, http.MethodGet, "/project/p1/vpcs", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
@@ -0,0 +1,423 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package alcormock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Serves one request against the in-memory state. Returns the status code
+// and either the response body or, for codes >= 400, the error message.
+// Must be called with the lock held.
+func (s *Server) handle(method, project, resource string, rest []string, body map[string]json.RawMessage) (int, interface{}) {
+	if resource == NODES {
+		return s.handleNodes(method, rest, body)
+	}
+	key := resourceKeys[resource]
+	switch {
+	case len(rest) == 0 && method == http.MethodPost:
+		obj, err := decodeObject(body, key)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		return s.create(project, resource, obj)
+	case len(rest) == 0 && method == http.MethodGet:
+		var list []object
+		for _, obj := range s.objects[resource] {
+			if obj.str("project_id") == project {
+				list = append(list, obj.copy())
+			}
+		}
+		return http.StatusOK, map[string]interface{}{key + "s": list}
+	case len(rest) == 1:
+		obj, ok := s.objects[resource][rest[0]]
+		if !ok {
+			return http.StatusNotFound, fmt.Sprintf("%s %s not found", key, rest[0])
+		}
+		switch method {
+		case http.MethodGet:
+			return http.StatusOK, map[string]interface{}{key: obj.copy()}
+		case http.MethodPut:
+			update, err := decodeObject(body, key)
+			if err != nil {
+				return http.StatusBadRequest, err
+			}
+			return s.update(resource, obj, update)
+		case http.MethodDelete:
+			return s.delete(resource, obj)
+		}
+	case len(rest) == 2 && resource == ROUTERS && method == http.MethodPut:
+		router, ok := s.objects[ROUTERS][rest[0]]
+		if !ok {
+			return http.StatusNotFound, fmt.Sprintf("router %s not found", rest[0])
+		}
+		var subnetId string
+		json.Unmarshal(body["subnet_id"], &subnetId)
+		switch rest[1] {
+		case "add_router_interface":
+			return s.attachSubnet(router, subnetId)
+		case "remove_router_interface":
+			return s.detachSubnet(router, subnetId)
+		}
+	}
+	return http.StatusMethodNotAllowed, fmt.Sprintf("%s is not supported on %s", method, resource)
+}
+
+func (s *Server) create(project, resource string, obj object) (int, interface{}) {
+	id := obj.str("id")
+	if id == "" {
+		id = s.newID()
+		obj["id"] = id
+	} else if _, ok := s.objects[resource][id]; ok {
+		return http.StatusConflict, fmt.Sprintf("%s %s already exists", resourceKeys[resource], id)
+	}
+	if obj.str("project_id") == "" {
+		obj["project_id"] = project
+	}
+	if obj.str("tenant_id") == "" {
+		obj["tenant_id"] = obj["project_id"]
+	}
+
+	switch resource {
+	case VPCS:
+		obj["subnets"] = []interface{}{}
+		obj["status"] = "ACTIVE"
+	case SUBNETS:
+		vpc, ok := s.objects[VPCS][obj.str("network_id")]
+		if !ok {
+			return http.StatusBadRequest, fmt.Sprintf("network %s not found", obj.str("network_id"))
+		}
+		subnets, ok := vpc.list("subnets")
+		if !ok {
+			return http.StatusBadRequest, fmt.Sprintf("network %s has invalid subnets", vpc.str("id"))
+		}
+		pool, err := newIPPool(obj.str("cidr"), obj.str("gateway_ip"))
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if _, ok := obj["ip_version"]; !ok {
+			obj["ip_version"] = 4
+		}
+		obj["gateway_ip"] = pool.gateway
+		obj["attached_router_id"] = ""
+		s.pools[id] = pool
+		vpc["subnets"] = append(subnets, id)
+	case ROUTERS:
+		obj["subnet_ids"] = []interface{}{}
+	case SECURITY_GROUPS:
+		obj["security_group_rules"] = []interface{}{}
+	case SECURITY_GROUP_RULES:
+		sg, ok := s.objects[SECURITY_GROUPS][obj.str("security_group_id")]
+		if !ok {
+			return http.StatusBadRequest, fmt.Sprintf("security group %s not found", obj.str("security_group_id"))
+		}
+		if direction := obj.str("direction"); direction != "ingress" && direction != "egress" {
+			return http.StatusBadRequest, fmt.Sprintf("invalid direction %q", direction)
+		}
+		if obj.str("ethertype") == "" {
+			obj["ethertype"] = "IPv4"
+		}
+		rules, ok := sg.list("security_group_rules")
+		if !ok {
+			return http.StatusBadRequest, fmt.Sprintf("security group %s has invalid security_group_rules", sg.str("id"))
+		}
+		sg["security_group_rules"] = append(rules, obj)
+	case PORTS:
+		if code, err := s.allocatePort(obj); err != nil {
+			return code, err
+		}
+	}
+
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	obj["create_at"] = now
+	obj["update_at"] = now
+	s.objects[resource][id] = obj
+	return http.StatusCreated, map[string]interface{}{resourceKeys[resource]: obj.copy()}
+}
+
+// Fills in the fixed IPs and MAC of a new port. Without fixed IPs the port
+// lands on the first subnet of its network.
+func (s *Server) allocatePort(port object) (int, error) {
+	vpc, ok := s.objects[VPCS][port.str("network_id")]
+	if !ok {
+		return http.StatusBadRequest, fmt.Errorf("network %s not found", port.str("network_id"))
+	}
+	fixedIps, _ := port["fixed_ips"].([]interface{})
+	if len(fixedIps) == 0 {
+		subnets, _ := vpc.list("subnets")
+		if len(subnets) == 0 {
+			return http.StatusBadRequest, fmt.Errorf("network %s has no subnet", port.str("network_id"))
+		}
+		fixedIps = []interface{}{map[string]interface{}{"subnet_id": subnets[0]}}
+	}
+
+	var allocated []object
+	release := func() {
+		for _, fixedIp := range allocated {
+			s.pools[fixedIp.str("subnet_id")].release(fixedIp.str("ip_address"))
+		}
+	}
+	for _, entry := range fixedIps {
+		fixedIp, _ := entry.(map[string]interface{})
+		subnetId := object(fixedIp).str("subnet_id")
+		subnet, ok := s.objects[SUBNETS][subnetId]
+		if !ok || subnet.str("network_id") != port.str("network_id") {
+			release()
+			return http.StatusBadRequest, fmt.Errorf("subnet %q not found in network %s", subnetId, port.str("network_id"))
+		}
+		pool := s.pools[subnetId]
+		ip := object(fixedIp).str("ip_address")
+		var err error
+		if ip == "" {
+			ip, err = pool.allocate()
+		} else {
+			err = pool.reserve(ip)
+		}
+		if err != nil {
+			release()
+			return http.StatusConflict, err
+		}
+		allocated = append(allocated, object{"subnet_id": subnetId, "ip_address": ip})
+	}
+
+	ips := make([]interface{}, len(allocated))
+	for i, fixedIp := range allocated {
+		ips[i] = fixedIp
+	}
+	port["fixed_ips"] = ips
+	if port.str("mac_address") == "" {
+		port["mac_address"] = s.newMac()
+	}
+	port["status"] = "DOWN"
+	return 0, nil
+}
+
+func (s *Server) update(resource string, obj object, update object) (int, interface{}) {
+	for field, value := range update {
+		switch field {
+		case "id", "project_id", "fixed_ips", "mac_address", "network_id", "cidr",
+			"subnets", "subnet_ids", "security_group_rules":
+			continue
+		}
+		obj[field] = value
+	}
+	if resource == PORTS && obj.str("binding:host_id") != "" {
+		obj["status"] = "ACTIVE"
+	}
+	obj["update_at"] = time.Now().UTC().Format("2006-01-02 15:04:05")
+	return http.StatusOK, map[string]interface{}{resourceKeys[resource]: obj.copy()}
+}
+
+func (s *Server) delete(resource string, obj object) (int, interface{}) {
+	id := obj.str("id")
+	switch resource {
+	case VPCS:
+		subnets, ok := obj.list("subnets")
+		if !ok {
+			return http.StatusBadRequest, fmt.Sprintf("network %s has invalid subnets", id)
+		}
+		if len(subnets) > 0 {
+			return http.StatusConflict, fmt.Sprintf("network %s still has subnets", id)
+		}
+	case SUBNETS:
+		if obj.str("attached_router_id") != "" {
+			return http.StatusConflict, fmt.Sprintf("subnet %s is attached to router %s", id, obj.str("attached_router_id"))
+		}
+		if s.pools[id].inUse() > 0 {
+			return http.StatusConflict, fmt.Sprintf("subnet %s still has ports", id)
+		}
+		if vpc, ok := s.objects[VPCS][obj.str("network_id")]; ok {
+			subnets, ok := vpc.list("subnets")
+			if !ok {
+				return http.StatusBadRequest, fmt.Sprintf("network %s has invalid subnets", vpc.str("id"))
+			}
+			vpc["subnets"] = without(subnets, id)
+		}
+		delete(s.pools, id)
+	case ROUTERS:
+		subnetIds, ok := obj.list("subnet_ids")
+		if !ok {
+			return http.StatusBadRequest, fmt.Sprintf("router %s has invalid subnet_ids", id)
+		}
+		if len(subnetIds) > 0 {
+			return http.StatusConflict, fmt.Sprintf("router %s still has interfaces", id)
+		}
+	case SECURITY_GROUPS:
+		rules, ok := obj.list("security_group_rules")
+		if !ok {
+			return http.StatusBadRequest, fmt.Sprintf("security group %s has invalid security_group_rules", id)
+		}
+		for _, rule := range rules {
+			if rule, ok := rule.(object); ok {
+				delete(s.objects[SECURITY_GROUP_RULES], rule.str("id"))
+			}
+		}
+	case SECURITY_GROUP_RULES:
+		if sg, ok := s.objects[SECURITY_GROUPS][obj.str("security_group_id")]; ok {
+			sgRules, ok := sg.list("security_group_rules")
+			if !ok {
+				return http.StatusBadRequest, fmt.Sprintf("security group %s has invalid security_group_rules", sg.str("id"))
+			}
+			var rules []interface{}
+			for _, rule := range sgRules {
+				if rule, ok := rule.(object); !ok || rule.str("id") != id {
+					rules = append(rules, rule)
+				}
+			}
+			sg["security_group_rules"] = append([]interface{}{}, rules...)
+		}
+	case PORTS:
+		fixedIps, _ := obj.list("fixed_ips")
+		for _, entry := range fixedIps {
+			fixedIp, _ := entry.(object)
+			if pool, ok := s.pools[fixedIp.str("subnet_id")]; ok {
+				pool.release(fixedIp.str("ip_address"))
+			}
+		}
+	}
+	delete(s.objects[resource], id)
+	return http.StatusOK, nil
+}
+
+func (s *Server) attachSubnet(router object, subnetId string) (int, interface{}) {
+	subnet, ok := s.objects[SUBNETS][subnetId]
+	if !ok {
+		return http.StatusBadRequest, fmt.Sprintf("subnet %q not found", subnetId)
+	}
+	if subnet.str("attached_router_id") != "" {
+		return http.StatusConflict, fmt.Sprintf("subnet %s is already attached to router %s", subnetId, subnet.str("attached_router_id"))
+	}
+	subnetIds, ok := router.list("subnet_ids")
+	if !ok {
+		return http.StatusBadRequest, fmt.Sprintf("router %s has invalid subnet_ids", router.str("id"))
+	}
+	subnet["attached_router_id"] = router.str("id")
+	router["subnet_ids"] = append(subnetIds, subnetId)
+	return http.StatusOK, s.routerInterface(router, subnet)
+}
+
+func (s *Server) detachSubnet(router object, subnetId string) (int, interface{}) {
+	subnet, ok := s.objects[SUBNETS][subnetId]
+	if !ok || subnet.str("attached_router_id") != router.str("id") {
+		return http.StatusNotFound, fmt.Sprintf("subnet %q is not attached to router %s", subnetId, router.str("id"))
+	}
+	subnetIds, ok := router.list("subnet_ids")
+	if !ok {
+		return http.StatusBadRequest, fmt.Sprintf("router %s has invalid subnet_ids", router.str("id"))
+	}
+	subnet["attached_router_id"] = ""
+	router["subnet_ids"] = without(subnetIds, subnetId)
+	return http.StatusOK, s.routerInterface(router, subnet)
+}
+
+func (s *Server) routerInterface(router, subnet object) object {
+	subnetIds, _ := router.list("subnet_ids")
+	return object{
+		"id":         router.str("id"),
+		"network_id": subnet.str("network_id"),
+		"port_id":    s.newID(),
+		"subnet_id":  subnet.str("id"),
+		"subnet_ids": append([]interface{}{}, subnetIds...),
+		"project_id": router.str("project_id"),
+		"tenant_id":  router.str("tenant_id"),
+		"tags":       []interface{}{},
+	}
+}
+
+// Node manager endpoints: /nodes, /nodes/bulk and /nodes/{id}
+func (s *Server) handleNodes(method string, rest []string, body map[string]json.RawMessage) (int, interface{}) {
+	switch {
+	case method == http.MethodPost && len(rest) == 1 && rest[0] == "bulk":
+		var nodes []object
+		if err := json.Unmarshal(body["host_infos"], &nodes); err != nil || len(nodes) == 0 {
+			return http.StatusBadRequest, "missing host_infos"
+		}
+		for _, node := range nodes {
+			if code, err := s.checkNode(node); err != nil {
+				return code, err
+			}
+		}
+		var created []object
+		for _, node := range nodes {
+			created = append(created, s.addNode(node))
+		}
+		return http.StatusOK, created
+	case method == http.MethodPost && len(rest) == 0:
+		node, err := decodeObject(body, resourceKeys[NODES])
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if code, err := s.checkNode(node); err != nil {
+			return code, err
+		}
+		return http.StatusCreated, map[string]interface{}{resourceKeys[NODES]: s.addNode(node)}
+	case len(rest) == 1 && rest[0] != "bulk":
+		node, ok := s.objects[NODES][rest[0]]
+		if !ok {
+			return http.StatusNotFound, fmt.Sprintf("node %s not found", rest[0])
+		}
+		switch method {
+		case http.MethodGet:
+			return http.StatusOK, map[string]interface{}{resourceKeys[NODES]: node.copy()}
+		case http.MethodDelete:
+			delete(s.objects[NODES], rest[0])
+			return http.StatusOK, nil
+		}
+	}
+	return http.StatusMethodNotAllowed, fmt.Sprintf("%s is not supported on nodes", method)
+}
+
+func (s *Server) checkNode(node object) (int, error) {
+	id := node.str("node_id")
+	if id == "" {
+		return http.StatusBadRequest, fmt.Errorf("node without node_id")
+	}
+	if _, ok := s.objects[NODES][id]; ok {
+		return http.StatusConflict, fmt.Errorf("node %s already exists", id)
+	}
+	return 0, nil
+}
+
+func (s *Server) addNode(node object) object {
+	if _, ok := node["ncm_uri"]; !ok {
+		node["ncm_uri"] = fmt.Sprintf("%s:%v", node.str("local_ip"), node["server_port"])
+	}
+	s.objects[NODES][node.str("node_id")] = node
+	return node.copy()
+}
+
+func decodeObject(body map[string]json.RawMessage, key string) (object, error) {
+	raw, ok := body[key]
+	if !ok {
+		return nil, fmt.Errorf("missing %q in request body", key)
+	}
+	var obj object
+	if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+		return nil, fmt.Errorf("invalid %q in request body", key)
+	}
+	return obj, nil
+}
+
+func without(list []interface{}, id string) []interface{} {
+	kept := []interface{}{}
+	for _, item := range list {
+		if item != id {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,114 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package alcormock
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+// Addresses of one IPv4 subnet. The network and broadcast addresses are
+// never handed out and the gateway is reserved when the pool is created.
+type ipPool struct {
+	network *net.IPNet
+	base    uint32
+	size    uint32
+	next    uint32
+	gateway string
+	used    map[uint32]bool
+}
+
+func newIPPool(cidr, gateway string) (*ipPool, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid IPv4 cidr %q", cidr)
+	}
+	ones, bits := network.Mask.Size()
+	if bits-ones < 2 {
+		return nil, fmt.Errorf("cidr %q has no room for hosts", cidr)
+	}
+	pool := &ipPool{
+		network: network,
+		base:    binary.BigEndian.Uint32(network.IP.To4()),
+		size:    1 << uint(bits-ones),
+		next:    1,
+		used:    make(map[uint32]bool),
+	}
+	if gateway == "" {
+		gateway = pool.ip(1)
+	}
+	if err := pool.reserve(gateway); err != nil {
+		return nil, err
+	}
+	pool.gateway = gateway
+	return pool, nil
+}
+
+func (p *ipPool) ip(offset uint32) string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, p.base+offset)
+	return ip.String()
+}
+
+func (p *ipPool) offset(address string) (uint32, error) {
+	ip := net.ParseIP(address).To4()
+	if ip == nil || !p.network.Contains(ip) {
+		return 0, fmt.Errorf("%q is not in %s", address, p.network)
+	}
+	offset := binary.BigEndian.Uint32(ip) - p.base
+	if offset == 0 || offset == p.size-1 {
+		return 0, fmt.Errorf("%q is not a host address of %s", address, p.network)
+	}
+	return offset, nil
+}
+
+// Marks a specific address as used
+func (p *ipPool) reserve(address string) error {
+	offset, err := p.offset(address)
+	if err != nil {
+		return err
+	}
+	if p.used[offset] {
+		return fmt.Errorf("%q is already in use", address)
+	}
+	p.used[offset] = true
+	return nil
+}
+
+// Hands out the next free address, wrapping around once the end is reached
+// so released addresses are reused last.
+func (p *ipPool) allocate() (string, error) {
+	hosts := p.size - 2
+	for i := uint32(0); i < hosts; i++ {
+		offset := (p.next-1+i)%hosts + 1
+		if !p.used[offset] {
+			p.used[offset] = true
+			p.next = offset%hosts + 1
+			return p.ip(offset), nil
+		}
+	}
+	return "", fmt.Errorf("no free address left in %s", p.network)
+}
+
+func (p *ipPool) release(address string) {
+	if offset, err := p.offset(address); err == nil && address != p.gateway {
+		delete(p.used, offset)
+	}
+}
+
+// Number of addresses handed out, the gateway excluded
+func (p *ipPool) inUse() int {
+	return len(p.used) - 1
+}
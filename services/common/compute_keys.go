@@ -0,0 +1,81 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package constants
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// Every compute config keeps its pods and VMs in Redis under keys of its
+// own, so that several deployments can share one merak-compute. An empty
+// config ID gives the global keys used before deployments were scoped.
+
+// Set of the pod IDs of a compute config
+func ComputeNodeIPSetKey(configID string) string {
+	return scopedComputeKey(COMPUTE_REDIS_NODE_IP_SET, configID)
+}
+
+// Set of the VM IDs of a compute config
+func ComputeVMSetKey(configID string) string {
+	return scopedComputeKey(COMPUTE_REDIS_VM_SET, configID)
+}
+
+// Hash with the details of a pod as seen by a compute config
+func ComputePodKey(configID, podID string) string {
+	if configID == "" {
+		return podID
+	}
+	return configID + ":" + podID
+}
+
+// List of the VM IDs a compute config placed on a pod
+func ComputePodVMListKey(configID, podID string) string {
+	return "l" + ComputePodKey(configID, podID)
+}
+
+// ID, and Redis hash key, of a VM of a compute config
+func ComputeVMID(configID, podID, suffix string) string {
+	return ComputePodKey(configID, podID+suffix)
+}
+
+// Name, and network namespace, of a VM of a compute config on its pod. The
+// agent names the tap of the VM "tap" and the VM name, which has to fit in
+// 15 characters, so the config only shows as a short hash of its ID.
+func ComputeVMName(configID, suffix string) string {
+	if configID == "" {
+		return "v" + suffix
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(configID))
+	return fmt.Sprintf("v%04x%s", hash.Sum32()&0xffff, suffix)
+}
+
+// Hash of the VM name prefixes in use on a pod, ComputeVMName with an empty
+// suffix, each with the compute config using it. The hash in the names is
+// short enough for two configs to share a prefix, which mustn't happen on
+// the same pod.
+func ComputePodVMNamesKey(podID string) string {
+	return "n" + podID
+}
+
+// Matches every name given by ComputeVMName
+const COMPUTE_VM_NAME_PATTERN = "^v[0-9a-f]+$"
+
+func scopedComputeKey(key, configID string) string {
+	if configID == "" {
+		return key
+	}
+	return key + ":" + configID
+}
@@ -39,6 +39,8 @@ const (
 	NETWORK_GRPC_SERVER_ADDRESS = "merak-network-service.merak.svc.cluster.local"
 	AGENT_GRPC_SERVER_PORT      = 40054
 	COMPUTE_GRPC_SERVER_PORT    = 40051
+	NTEST_GRPC_SERVER_PORT      = 40055
+	NTEST_GRPC_SERVER_ADDRESS   = "merak-ntest-service.merak.svc.cluster.local"
 	PROMETHEUS_PORT             = 9001
 
 	COMPUTE_REDIS_ADDRESS = "compute-redis-main.merak.svc.cluster.local"
@@ -67,11 +69,29 @@ const (
 	MODE_STANDALONE = "STANDALONE"
 	MODE_ALCOR      = "ALCOR"
 
+	AGENT_EVM_BACKEND_ENV = "EVM_BACKEND"
+
+	AGENT_OVSDB_ENV            = "OVSDB"
+	AGENT_OVSDB_DEFAULT        = "unix:/var/run/openvswitch/db.sock"
+	AGENT_OVSDB_OFPORT_TIMEOUT = 10 // Seconds to wait for vswitchd to plug a port
+
+	AGENT_INVENTORY_ENV     = "INVENTORY"
+	AGENT_INVENTORY_DEFAULT = "/var/lib/merak/inventory.json"
+	// Host directory with the inventory of every vhost pod, by pod UID
+	AGENT_INVENTORY_HOST_PATH = "/var/lib/merak/agent"
+	AGENT_RECONCILE_RETRIES   = 30 // Tries to list the host's devices while OVS starts
+	AGENT_RECONCILE_RETRY_GAP = 1  // Seconds between tries
+
 	AGENT_STANDALONE_IP        = "10.0.0.2"
 	AGENT_STANDALONE_MAC       = "aa:bb:cc:dd:ee:ff"
 	AGENT_STANDALONE_REMOTE_ID = "NO ALCOR"
 	AGENT_STANDALONE_GW        = "10.0.0.1"
 	AGENT_STANDALONE_CIDR      = "10.0.0.0/8"
+	AGENT_MAX_DEVICE_NAME      = 15 // IFNAMSIZ less the terminating NUL
+
+	AGENT_PING_COUNT       = 3
+	AGENT_PING_TIMEOUT     = 1 // Seconds to wait for each reply
+	AGENT_TEST_CONCURRENCY = 10
 
 	WORKER_IMAGE_ENV                    = "WORKER_IMAGE"
 	WORKER_DEFAULT_IMAGE                = "meraksim/merak-compute-vm-worker:dev"
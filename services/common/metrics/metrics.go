@@ -83,3 +83,31 @@ func getCallerName(skipFrames int) string {
 	frame, _ := runtime.CallersFrames(pc).Next()
 	return frame.Function
 }
+
+// Latency of the stages the items of a service go through, such as the
+// stages of creating a VM, by stage and host
+type StageMetrics struct {
+	StageLatency *prometheus.HistogramVec
+}
+
+// Creates new stage metrics, with buckets from 1ms to about 9 minutes
+func NewStageMetrics(reg *prometheus.Registry, serviceName string) *StageMetrics {
+	m := StageMetrics{
+		StageLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    serviceName + "_stage_latency_milliseconds",
+			Help:    "stage_latency",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 20),
+		}, []string{"stage", "host"}),
+	}
+	reg.MustRegister(m.StageLatency)
+	return &m
+}
+
+// Records how long a stage took on a host. Does nothing before the metrics
+// are set up.
+func (stageMetrics *StageMetrics) Observe(stage string, host string, latency time.Duration) {
+	if stageMetrics == nil {
+		return
+	}
+	stageMetrics.StageLatency.With(prometheus.Labels{"stage": stage, "host": host}).Observe(float64(latency.Milliseconds()))
+}
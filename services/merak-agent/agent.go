@@ -30,7 +30,9 @@ import (
 	"github.com/futurewei-cloud/merak/services/common/logger"
 	"github.com/futurewei-cloud/merak/services/common/metrics"
 
+	"github.com/futurewei-cloud/merak/services/merak-agent/evm"
 	"github.com/futurewei-cloud/merak/services/merak-agent/handler"
+	"github.com/futurewei-cloud/merak/services/merak-agent/inventory"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
@@ -54,15 +56,33 @@ func main() {
 		handler.MerakLogger.Fatal("Failed to create logger\n", "err", err)
 	}
 
-	val, ok = os.LookupEnv(constants.MODE_ENV)
+	mode, ok := os.LookupEnv(constants.MODE_ENV)
 	if !ok {
 		// Default to Alcor mode
-		val = constants.MODE_ALCOR
+		mode = constants.MODE_ALCOR
 	}
-	if val == constants.MODE_ALCOR {
+	if mode == constants.MODE_ALCOR {
 		startPlugin()
 	}
 
+	val, ok = os.LookupEnv(constants.AGENT_EVM_BACKEND_ENV)
+	if !ok {
+		val = evm.BACKEND_BASH
+	}
+	if err := evm.SetBackend(val); err != nil {
+		handler.MerakLogger.Fatal("Invalid EVM backend\n", "err", err)
+	}
+	handler.MerakLogger.Info("Using EVM backend", "backend", evm.GetBackend())
+
+	// Talk to ovsdb-server directly instead of through ovs-vsctl
+	if val, ok = os.LookupEnv(constants.AGENT_OVSDB_ENV); ok {
+		if val == "" {
+			val = constants.AGENT_OVSDB_DEFAULT
+		}
+		evm.SetOvsdb(val)
+		handler.MerakLogger.Info("Using OVSDB endpoint", "endpoint", val)
+	}
+
 	// Start gRPC Server
 	flag.Parse()
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *gRPCPort))
@@ -79,6 +99,26 @@ func main() {
 		Timeout: 90 * time.Second,
 	}
 
+	hostname, err := os.Hostname()
+	if err != nil {
+		handler.MerakLogger.Fatal("Unable to get hostname!\n")
+	}
+	// Prometheus no hyphens allowed
+	hostname = "vhost" + strings.Split(hostname, "-")[1]
+
+	handler.PrometheusRegistry = prometheus.NewRegistry()
+	handler.MerakMetrics = metrics.NewMetrics(handler.PrometheusRegistry, "merak_agent_"+hostname)
+
+	val, ok = os.LookupEnv(constants.AGENT_INVENTORY_ENV)
+	if !ok {
+		val = constants.AGENT_INVENTORY_DEFAULT
+	}
+	handler.Inventory, err = inventory.Open(val)
+	if err != nil {
+		handler.MerakLogger.Fatal("Failed to open inventory\n", "err", err)
+	}
+	reconcile(mode)
+
 	gRPCServer := grpc.NewServer(
 		grpc.MaxSendMsgSize(constants.GRPC_MAX_SEND_MSG_SIZE),
 		grpc.MaxRecvMsgSize(constants.GRPC_MAX_RECV_MSG_SIZE),
@@ -86,15 +126,6 @@ func main() {
 		grpc.KeepaliveParams(kpServerParam))
 
 	go func() {
-		hostname, err := os.Hostname()
-		if err != nil {
-			handler.MerakLogger.Fatal("Unable to get hostname!\n")
-		}
-		// Prometheus no hyphens allowed
-		hostname = "vhost" + strings.Split(hostname, "-")[1]
-
-		handler.PrometheusRegistry = prometheus.NewRegistry()
-		handler.MerakMetrics = metrics.NewMetrics(handler.PrometheusRegistry, "merak_agent_"+hostname)
 		http.Handle("/metrics", promhttp.HandlerFor(
 			handler.PrometheusRegistry,
 			promhttp.HandlerOpts{Registry: handler.PrometheusRegistry}))
@@ -108,6 +139,32 @@ func main() {
 	}
 }
 
+// Fixes up the host from the inventory before any request is served. In
+// Alcor mode OVS is still starting, so listing its ports is retried.
+func reconcile(mode string) {
+	var report *handler.ReconcileReport
+	var err error
+	for i := 0; i < constants.AGENT_RECONCILE_RETRIES; i++ {
+		report, err = handler.Reconcile(mode)
+		if err == nil {
+			break
+		}
+		handler.MerakLogger.Info("Host not ready to reconcile, retrying", "err", err)
+		time.Sleep(constants.AGENT_RECONCILE_RETRY_GAP * time.Second)
+	}
+	if err != nil {
+		handler.MerakLogger.Error("Failed to reconcile inventory", "err", err)
+		return
+	}
+	handler.MerakLogger.Info("Reconciled inventory",
+		"kept", len(report.Kept),
+		"recreated", report.Recreated,
+		"removed", report.Removed,
+		"orphanNamespaces", report.OrphanNamespaces,
+		"orphanDevices", report.OrphanDevices,
+		"failed", report.Failed)
+}
+
 func startPlugin() {
 	if len(os.Args) < 3 {
 		handler.MerakLogger.Fatal("Not enough arguments")
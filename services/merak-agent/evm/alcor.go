@@ -16,6 +16,7 @@ package evm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -65,6 +66,10 @@ type updatePort struct {
 	DeviceOwner   string `json:"device_owner"`
 	FastPath      bool   `json:"fast_path"`
 	BindingHostID string `json:"binding:host_id"`
+	// Only sent when changing an existing port
+	SG         []string            `json:"security_groups,omitempty"`
+	FixIPs     []map[string]string `json:"fixed_ips,omitempty"`
+	MacAddress string              `json:"mac_address,omitempty"`
 }
 
 var _ Evm = (*AlcorEvm)(nil)
@@ -115,6 +120,9 @@ func NewEvm(name, ip, mac, remoteID, deviceID, cidr, gw string, status common_pb
 	if err != nil {
 		return nil, err
 	}
+	if backend == BACKEND_NETLINK {
+		return &NetlinkEvm{AlcorEvm: *evm}, nil
+	}
 	return evm, nil
 }
 
@@ -176,23 +184,78 @@ func UpdatePort(url string, in *pb.InternalPortConfig, m metrics.Metrics, evm Ev
 	var err error
 	defer m.GetMetrics(&err)()
 
-	updatePortBody := updatePortMain{
-		updatePort{
-			ProjectID:     in.Projectid,
-			ID:            evm.GetRemoteId(),
-			Name:          in.Name,
-			Description:   "",
-			NetworkID:     in.Vpcid,
-			TenantID:      in.Tenantid,
-			AdminState:    true,
-			VethName:      "in" + in.Name,
-			DeviceID:      in.Name,
-			DeviceOwner:   "compute:nova",
-			FastPath:      true,
-			BindingHostID: in.Hostname,
-		},
+	err = putPort(url, updatePortMain{newUpdatePort(in, evm)}, evm)
+	return err
+}
+
+// Sends an update port request to Alcor that moves an existing port to
+// the given security group and to the EVM's IP and MAC address. A new IP
+// without a subnet stays in the port's current subnet.
+func ChangePort(url string, in *pb.InternalPortConfig, m metrics.Metrics, evm Evm) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	port := newUpdatePort(in, evm)
+	if in.Sg != "" {
+		port.SG = []string{in.Sg}
+	}
+	if in.Ip != "" {
+		subnetID := in.Subnetid
+		if subnetID == "" {
+			subnetID, err = portSubnet(url)
+			if err != nil {
+				return err
+			}
+		}
+		port.FixIPs = []map[string]string{{"subnet_id": subnetID, "ip_address": evm.GetIP()}}
+	}
+	if in.Mac != "" {
+		port.MacAddress = evm.GetMac()
+	}
+	err = putPort(url, updatePortMain{port}, evm)
+	return err
+}
+
+// Gets the subnet of the port's first fixed IP from Alcor
+func portSubnet(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		log.Println("Failed to get port from Alcor!", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != constants.HTTP_OK {
+		return "", errors.New("Failed to get port! Response Code: " + strconv.Itoa(resp.StatusCode))
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	subnetID := gjson.GetBytes(respBody, "port.fixed_ips.0.subnet_id").Str
+	if subnetID == "" {
+		return "", errors.New("Port has no subnet")
+	}
+	return subnetID, nil
+}
+
+func newUpdatePort(in *pb.InternalPortConfig, evm Evm) updatePort {
+	return updatePort{
+		ProjectID:     in.Projectid,
+		ID:            evm.GetRemoteId(),
+		Name:          in.Name,
+		Description:   "",
+		NetworkID:     in.Vpcid,
+		TenantID:      in.Tenantid,
+		AdminState:    true,
+		VethName:      "in" + in.Name,
+		DeviceID:      in.Name,
+		DeviceOwner:   "compute:nova",
+		FastPath:      true,
+		BindingHostID: in.Hostname,
 	}
+}
 
+func putPort(url string, updatePortBody updatePortMain, evm Evm) error {
 	body, err := json.Marshal(updatePortBody)
 	if err != nil {
 		return err
@@ -252,6 +315,19 @@ func (evm AlcorEvm) CreateDevice(m metrics.Metrics) error {
 	var err error
 	defer m.GetMetrics(&err)()
 
+	client, err := getOvsdb()
+	if err != nil {
+		log.Println("Failed to connect to ovsdb! ", err)
+		return err
+	}
+	if client != nil {
+		err = ovsdbAddPorts(client, []string{evm.deviceID})
+		if err != nil {
+			log.Println("ovsdb add port failed! ", err)
+			return err
+		}
+		return nil
+	}
 	stdout, err := BashExec("ovs-vsctl add-port br-int " + evm.deviceID + " -- set Interface " + evm.deviceID + " type=internal")
 	if err != nil {
 		log.Println("ovs-vsctl failed! " + string(stdout))
@@ -278,6 +354,19 @@ func (evm AlcorEvm) DeleteDevice(m metrics.Metrics) error {
 	var err error
 	defer m.GetMetrics(&err)()
 
+	client, err := getOvsdb()
+	if err != nil {
+		log.Println("Failed to connect to ovsdb! ", err)
+		return err
+	}
+	if client != nil {
+		err = client.DeletePorts(context.Background(), "br-int", []string{evm.deviceID})
+		if err != nil {
+			log.Println("Failed to delete tap ", err)
+			return err
+		}
+		return nil
+	}
 	stdout, err := BashExec("ovs-vsctl del-port br-int " + evm.deviceID)
 	if err != nil {
 		log.Println("Failed to delete tap " + string(stdout))
@@ -414,6 +503,34 @@ func (evm AlcorEvm) AddGateway(m metrics.Metrics) error {
 	return nil
 }
 
+// Points the default route inside the network namespace at the gateway,
+// adding it if there is none
+func (evm AlcorEvm) ReplaceGateway(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	stdout, err := BashExec("ip netns exec " + evm.name + " ip r replace default via " + evm.gw)
+	if err != nil {
+		log.Println("Failed to replace default gw! " + string(stdout))
+		return err
+	}
+	return nil
+}
+
+// Removes every address from the inner veth, along with the routes
+// through them
+func (evm AlcorEvm) FlushIP(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	stdout, err := BashExec("ip netns exec " + evm.name + " ip addr flush dev " + evm.deviceID)
+	if err != nil {
+		log.Println("Failed to flush tap IP! " + string(stdout))
+		return err
+	}
+	return nil
+}
+
 // Brings the tap device up
 func (evm AlcorEvm) BringDeviceUp(m metrics.Metrics) error {
 	var err error
@@ -431,6 +548,19 @@ func Ovsdbbulk(taps []string, m metrics.Metrics) error {
 	// Create Device
 	var err error
 	defer m.GetMetrics(&err)()
+	client, err := getOvsdb()
+	if err != nil {
+		log.Println("Failed to connect to ovsdb! ", err)
+		return err
+	}
+	if client != nil {
+		err = ovsdbAddPorts(client, taps)
+		if err != nil {
+			log.Println("Failed to bulk add tap devices ", err)
+			return err
+		}
+		return nil
+	}
 	ovsCmd := "ovs-vsctl "
 	for _, tap := range taps {
 		ovsCmd += " -- add-port br-int " + tap + " -- set Interface " + tap + " type=internal"
@@ -544,8 +674,17 @@ func (evm *AlcorEvm) SetStatus(status common_pb.Status) {
 
 var BashExec = BashExecute
 
+var CommandExec = CommandExecute
+
 // Executes the given Bash command
 func BashExecute(cmd string) ([]byte, error) {
 	log.Println("Executing command " + cmd)
 	return exec.Command("bash", "-c", cmd).Output()
 }
+
+// Executes the given program with its arguments, without a shell, for
+// commands built from values a caller sent
+func CommandExecute(name string, args ...string) ([]byte, error) {
+	log.Println("Executing command " + name + " " + strings.Join(args, " "))
+	return exec.Command(name, args...).Output()
+}
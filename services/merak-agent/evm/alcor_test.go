@@ -1,6 +1,7 @@
 package evm
 
 import (
+	"bytes"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -8,10 +9,12 @@ import (
 
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
 	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	"github.com/futurewei-cloud/merak/services/common/alcormock"
 	"github.com/futurewei-cloud/merak/services/common/metrics"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
 )
 
 type mockMetrics struct {
@@ -330,6 +333,50 @@ func TestDeletePort(t *testing.T) {
 	}
 }
 
+func TestPortLifecycleAlcorMock(t *testing.T) {
+	mock := alcormock.New(alcormock.Config{Seed: 1})
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	metrics := &mockMetrics{ServiceName: "fake"}
+
+	resp, err := http.Post(server.URL+"/project/1234567/vpcs", "application/json",
+		bytes.NewBufferString(`{"network":{"cidr":"10.0.0.0/16"}}`))
+	assert.Nil(t, err)
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	vpcID := gjson.Get(body.String(), "network.id").Str
+	resp, err = http.Post(server.URL+"/project/1234567/subnets", "application/json",
+		bytes.NewBufferString(`{"subnet":{"cidr":"10.0.0.0/16","network_id":"`+vpcID+`"}}`))
+	assert.Nil(t, err)
+	body.Reset()
+	body.ReadFrom(resp.Body)
+	subnetID := gjson.Get(body.String(), "subnet.id").Str
+
+	in := &pb.InternalPortConfig{
+		Name:      "vm1",
+		Vpcid:     vpcID,
+		Tenantid:  "1234567",
+		Projectid: "1234567",
+		Subnetid:  subnetID,
+		Cidr:      "10.0.0.0/16",
+		Gw:        "10.0.0.1",
+		Hostname:  "node1",
+	}
+	portsURL := server.URL + "/project/" + in.Projectid + "/ports"
+
+	vm, err := CreateMinimalPort(portsURL, in, metrics)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.2", vm.GetIP())
+	assert.Equal(t, "tap"+vm.GetRemoteId()[:11], vm.GetDeviceId())
+	assert.Nil(t, UpdatePort(portsURL+"/"+vm.GetRemoteId(), in, metrics, vm))
+	assert.Equal(t, "ACTIVE", mock.Get(alcormock.PORTS, vm.GetRemoteId())["status"])
+
+	mock.InjectError(http.MethodDelete, alcormock.PORTS, http.StatusInternalServerError, 1)
+	assert.NotNil(t, DeletePort(portsURL+"/"+vm.GetRemoteId(), in, metrics, vm))
+	assert.Nil(t, DeletePort(portsURL+"/"+vm.GetRemoteId(), in, metrics, vm))
+	assert.Equal(t, 0, mock.Count(alcormock.PORTS))
+}
+
 func TestCreateStandaloneDevice(t *testing.T) {
 	metrics := mockMetrics{
 		ServiceName:     "fake",
@@ -15,6 +15,8 @@ Copyright(c) 2022 Futurewei Cloud
 package evm
 
 import (
+	"fmt"
+
 	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
 	"github.com/futurewei-cloud/merak/services/common/metrics"
 )
@@ -30,6 +32,8 @@ type Evm interface {
 	BringLoUp(m metrics.Metrics) error
 	AssignMac(m metrics.Metrics) error
 	AddGateway(m metrics.Metrics) error
+	ReplaceGateway(m metrics.Metrics) error
+	FlushIP(m metrics.Metrics) error
 	BringDeviceUp(m metrics.Metrics) error
 	GetName() string
 	GetIP() string
@@ -52,3 +56,26 @@ type Evm interface {
 	CreateStandaloneDevice(m metrics.Metrics) error
 	CreateNamespace(m metrics.Metrics) error
 }
+
+const (
+	BACKEND_BASH    = "bash"
+	BACKEND_NETLINK = "netlink"
+)
+
+// The EVM implementation returned by NewEvm
+var backend = BACKEND_BASH
+
+// Selects the EVM implementation used for new EVMs, bash or netlink
+func SetBackend(name string) error {
+	switch name {
+	case BACKEND_BASH, BACKEND_NETLINK:
+		backend = name
+		return nil
+	}
+	return fmt.Errorf("unknown evm backend %q", name)
+}
+
+// Returns the EVM implementation used for new EVMs
+func GetBackend() string {
+	return backend
+}
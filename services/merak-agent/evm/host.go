@@ -0,0 +1,81 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package evm
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// Returns the names of the network namespaces on this host
+func ListNamespaces() ([]string, error) {
+	stdout, err := BashExec("ip netns list")
+	if err != nil {
+		log.Println("Failed to list namespaces " + string(stdout))
+		return nil, err
+	}
+	names := []string{}
+	for _, line := range strings.Split(string(stdout), "\n") {
+		// Each line is "<name>" or "<name> (id: <n>)"
+		if fields := strings.Fields(line); len(fields) > 0 {
+			names = append(names, fields[0])
+		}
+	}
+	return names, nil
+}
+
+// Returns the names of the devices in the root network namespace
+func ListDevices() ([]string, error) {
+	stdout, err := BashExec("ip -o link show")
+	if err != nil {
+		log.Println("Failed to list devices " + string(stdout))
+		return nil, err
+	}
+	names := []string{}
+	for _, line := range strings.Split(string(stdout), "\n") {
+		// Each line is "<index>: <name>[@<peer>]: <flags> ..."
+		fields := strings.SplitN(line, ": ", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		name, _, _ := strings.Cut(fields[1], "@")
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Reports whether the device is in the network namespace
+func DeviceInNetns(namespace, device string) bool {
+	_, err := BashExec("ip netns exec " + namespace + " ip link show dev " + device)
+	return err == nil
+}
+
+// Returns the names of the ports on br-int
+func ListOvsPorts() ([]string, error) {
+	client, err := getOvsdb()
+	if err != nil {
+		log.Println("Failed to connect to ovsdb! ", err)
+		return nil, err
+	}
+	if client != nil {
+		return client.ListPorts(context.Background(), "br-int")
+	}
+	stdout, err := BashExec("ovs-vsctl list-ports br-int")
+	if err != nil {
+		log.Println("Failed to list ovs ports " + string(stdout))
+		return nil, err
+	}
+	return strings.Fields(string(stdout)), nil
+}
@@ -0,0 +1,363 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package evm
+
+import (
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/futurewei-cloud/merak/services/common/metrics"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+var _ Evm = (*NetlinkEvm)(nil)
+
+// An EVM that sets up its namespace and devices with netlink and netns
+// syscalls instead of forking ip for every step. The OVS bridge is still
+// managed with ovs-vsctl through BashExec.
+type NetlinkEvm struct {
+	AlcorEvm
+}
+
+// Runs fn in a netlink handle inside the EVM's namespace
+func (evm NetlinkEvm) inNetnsHandle(fn func(handle *netlink.Handle) error) error {
+	ns, err := netns.GetFromName(evm.name)
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return err
+	}
+	defer handle.Delete()
+	return fn(handle)
+}
+
+// Runs fn on a thread that is switched into the EVM's namespace, for the
+// few settings that have no netlink call. The thread is only handed back
+// to the runtime once it is in its own namespace again.
+func (evm NetlinkEvm) inNetns(fn func() error) error {
+	runtime.LockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer origin.Close()
+	ns, err := netns.GetFromName(evm.name)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	defer ns.Close()
+	if err := netns.Set(ns); err != nil {
+		runtime.UnlockOSThread()
+		return err
+	}
+	err = fn()
+	if restoreErr := netns.Set(origin); restoreErr != nil {
+		// Leave the thread locked so that it exits with this goroutine
+		return restoreErr
+	}
+	runtime.UnlockOSThread()
+	return err
+}
+
+// Creates a tap device for testing without Alcor
+func (evm NetlinkEvm) CreateStandaloneDevice(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	tap := &netlink.Tuntap{
+		LinkAttrs: netlink.LinkAttrs{Name: evm.deviceID},
+		Mode:      netlink.TUNTAP_MODE_TAP,
+	}
+	err = netlink.LinkAdd(tap)
+	for _, fd := range tap.Fds {
+		fd.Close()
+	}
+	if err != nil {
+		log.Println("Tap creation failed! ", err)
+		return err
+	}
+	return nil
+}
+
+// Deletes the tap device created for testing without Alcor
+func (evm NetlinkEvm) DeleteStandaloneDevice(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	link, err := netlink.LinkByName(evm.deviceID)
+	if err != nil {
+		log.Println("Failed to find tap ", err)
+		return err
+	}
+	err = netlink.LinkDel(link)
+	if err != nil {
+		log.Println("Failed to delete tap ", err)
+		return err
+	}
+	return nil
+}
+
+// Creates a new named network namespace, like ip netns add
+func (evm NetlinkEvm) CreateNamespace(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	// NewNamed also switches the calling thread into the new namespace
+	runtime.LockOSThread()
+	origin, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		log.Println("Namespace creation failed! ", err)
+		return err
+	}
+	defer origin.Close()
+	ns, err := netns.NewNamed(evm.name)
+	if err != nil {
+		netns.Set(origin)
+		runtime.UnlockOSThread()
+		log.Println("Namespace creation failed! ", err)
+		return err
+	}
+	ns.Close()
+	if err = netns.Set(origin); err != nil {
+		log.Println("Failed to return from new namespace! ", err)
+		return err
+	}
+	runtime.UnlockOSThread()
+	return nil
+}
+
+// Deletes a named network namespace
+func (evm NetlinkEvm) DeleteNamespace(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = netns.DeleteNamed(evm.name)
+	if err != nil {
+		log.Println("Namespace deletion failed! ", err)
+		return err
+	}
+	return nil
+}
+
+func (evm NetlinkEvm) MoveDeviceToNetns(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.moveDeviceToNetns()
+	if err != nil {
+		log.Println("Move tap into namespace failed! ", err)
+		return err
+	}
+	return nil
+}
+
+func (evm NetlinkEvm) moveDeviceToNetns() error {
+	link, err := netlink.LinkByName(evm.deviceID)
+	if err != nil {
+		return err
+	}
+	ns, err := netns.GetFromName(evm.name)
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+	return netlink.LinkSetNsFd(link, int(ns))
+}
+
+func (evm NetlinkEvm) MoveDeviceToRootNetns(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.inNetnsHandle(func(handle *netlink.Handle) error {
+		link, err := handle.LinkByName(evm.deviceID)
+		if err != nil {
+			return err
+		}
+		// The namespace of PID 1, as with ip link set netns 1
+		return handle.LinkSetNsPid(link, 1)
+	})
+	if err != nil {
+		log.Println("Move tap to root namespace failed! ", err)
+		return err
+	}
+	return nil
+}
+
+// Assigns an IP address to the inner veth-pair
+func (evm NetlinkEvm) AssignIP(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.inNetnsHandle(func(handle *netlink.Handle) error {
+		addr, err := netlink.ParseAddr(evm.ip + "/" + strings.Split(evm.cidr, "/")[1])
+		if err != nil {
+			return err
+		}
+		link, err := handle.LinkByName(evm.deviceID)
+		if err != nil {
+			return err
+		}
+		return handle.AddrAdd(link, addr)
+	})
+	if err != nil {
+		log.Println("Failed to give tap IP! ", err)
+		return err
+	}
+	return nil
+}
+
+// Sets MTU probing for the inner veth
+func (evm NetlinkEvm) SetMTUProbing(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.inNetns(func() error {
+		return os.WriteFile("/proc/sys/net/ipv4/tcp_mtu_probing", []byte("2"), 0644)
+	})
+	if err != nil {
+		log.Println("Failed to set MTU probing! ", err)
+		return err
+	}
+	return nil
+}
+
+// Brings the loopback device inside the network namespace up
+func (evm NetlinkEvm) BringLoUp(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.inNetnsHandle(func(handle *netlink.Handle) error {
+		link, err := handle.LinkByName("lo")
+		if err != nil {
+			return err
+		}
+		return handle.LinkSetUp(link)
+	})
+	if err != nil {
+		log.Println("Failed to bring up loopback! ", err)
+		return err
+	}
+	return nil
+}
+
+// Assigns a mac address to the inner veth
+func (evm NetlinkEvm) AssignMac(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.inNetnsHandle(func(handle *netlink.Handle) error {
+		mac, err := net.ParseMAC(evm.mac)
+		if err != nil {
+			return err
+		}
+		link, err := handle.LinkByName(evm.deviceID)
+		if err != nil {
+			return err
+		}
+		return handle.LinkSetHardwareAddr(link, mac)
+	})
+	if err != nil {
+		log.Println("Assign mac! ", err)
+		return err
+	}
+	return nil
+}
+
+// Adds a gateway inside the network namespace
+func (evm NetlinkEvm) AddGateway(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.inNetnsHandle(func(handle *netlink.Handle) error {
+		return handle.RouteAdd(&netlink.Route{Gw: net.ParseIP(evm.gw)})
+	})
+	if err != nil {
+		log.Println("Failed to add default gw! ", err)
+		return err
+	}
+	return nil
+}
+
+// Points the default route inside the network namespace at the gateway,
+// adding it if there is none
+func (evm NetlinkEvm) ReplaceGateway(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.inNetnsHandle(func(handle *netlink.Handle) error {
+		return handle.RouteReplace(&netlink.Route{Gw: net.ParseIP(evm.gw)})
+	})
+	if err != nil {
+		log.Println("Failed to replace default gw! ", err)
+		return err
+	}
+	return nil
+}
+
+// Removes every address from the inner veth
+func (evm NetlinkEvm) FlushIP(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.inNetnsHandle(func(handle *netlink.Handle) error {
+		link, err := handle.LinkByName(evm.deviceID)
+		if err != nil {
+			return err
+		}
+		addrs, err := handle.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return err
+		}
+		for i := range addrs {
+			if err := handle.AddrDel(link, &addrs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("Failed to flush tap IP! ", err)
+		return err
+	}
+	return nil
+}
+
+// Brings the tap device up
+func (evm NetlinkEvm) BringDeviceUp(m metrics.Metrics) error {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	err = evm.inNetnsHandle(func(handle *netlink.Handle) error {
+		link, err := handle.LinkByName(evm.deviceID)
+		if err != nil {
+			return err
+		}
+		return handle.LinkSetUp(link)
+	})
+	if err != nil {
+		log.Println("Failed to bring up tap device ", err)
+		return err
+	}
+	return nil
+}
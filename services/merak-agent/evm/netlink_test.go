@@ -0,0 +1,180 @@
+package evm
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"testing"
+
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+func requireRoot(tb testing.TB) {
+	if os.Geteuid() != 0 {
+		tb.Skip("creating namespaces and taps needs root")
+	}
+	probe := &NetlinkEvm{AlcorEvm{name: "merak-probe"}}
+	if err := probe.CreateNamespace(&mockMetrics{}); err != nil {
+		tb.Skip("unable to create namespaces: ", err)
+	}
+	probe.DeleteNamespace(&mockMetrics{})
+}
+
+// Runs the standalone create and delete steps the agent handler runs
+func standaloneLifecycle(evm Evm) error {
+	m := &mockMetrics{}
+	create := []func() error{
+		func() error { return evm.CreateNamespace(m) },
+		func() error { return evm.CreateStandaloneDevice(m) },
+		func() error { return evm.MoveDeviceToNetns(m) },
+		func() error { return evm.AssignIP(m) },
+		func() error { return evm.SetMTUProbing(m) },
+		func() error { return evm.BringLoUp(m) },
+		func() error { return evm.AssignMac(m) },
+		func() error { return evm.BringDeviceUp(m) },
+		func() error { return evm.AddGateway(m) },
+	}
+	for _, step := range create {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	if err := evm.MoveDeviceToRootNetns(m); err != nil {
+		return err
+	}
+	if err := evm.DeleteStandaloneDevice(m); err != nil {
+		return err
+	}
+	return evm.DeleteNamespace(m)
+}
+
+func newTestEvm(tb testing.TB, backend, name string) Evm {
+	SetBackend(backend)
+	defer SetBackend(BACKEND_BASH)
+	evm, err := NewEvm(name, "10.0.0.2", "aa:bb:cc:dd:ee:ff", "remote", "tap"+name, "10.0.0.0/8", "10.0.0.1", common_pb.Status_DEPLOYING)
+	assert.Nil(tb, err)
+	return evm
+}
+
+func TestSetBackend(t *testing.T) {
+	defer SetBackend(BACKEND_BASH)
+	assert.Nil(t, SetBackend(BACKEND_NETLINK))
+	assert.Equal(t, BACKEND_NETLINK, GetBackend())
+	assert.NotNil(t, SetBackend("ip"))
+	assert.Equal(t, BACKEND_NETLINK, GetBackend())
+
+	evm := newTestEvm(t, BACKEND_NETLINK, "vm1")
+	assert.IsType(t, &NetlinkEvm{}, evm)
+	assert.Equal(t, "tapvm1", evm.GetDeviceId())
+	evm = newTestEvm(t, BACKEND_BASH, "vm1")
+	assert.IsType(t, &AlcorEvm{}, evm)
+}
+
+func TestNetlinkEvm(t *testing.T) {
+	requireRoot(t)
+	evm := newTestEvm(t, BACKEND_NETLINK, "merak-nl0")
+	m := &mockMetrics{}
+	origin, err := netns.Get()
+	assert.Nil(t, err)
+	defer origin.Close()
+
+	assert.Nil(t, evm.CreateNamespace(m))
+	defer netns.DeleteNamed(evm.GetName())
+	assert.Nil(t, evm.CreateStandaloneDevice(m))
+	assert.Nil(t, evm.MoveDeviceToNetns(m))
+	assert.Nil(t, evm.AssignIP(m))
+	assert.Nil(t, evm.SetMTUProbing(m))
+	assert.Nil(t, evm.BringLoUp(m))
+	assert.Nil(t, evm.AssignMac(m))
+	assert.Nil(t, evm.BringDeviceUp(m))
+	assert.Nil(t, evm.AddGateway(m))
+
+	ns, err := netns.GetFromName(evm.GetName())
+	assert.Nil(t, err)
+	defer ns.Close()
+	assert.False(t, origin.Equal(ns))
+	handle, err := netlink.NewHandleAt(ns)
+	assert.Nil(t, err)
+	defer handle.Delete()
+
+	link, err := handle.LinkByName(evm.GetDeviceId())
+	assert.Nil(t, err)
+	assert.Equal(t, evm.GetMac(), link.Attrs().HardwareAddr.String())
+	addrs, err := handle.AddrList(link, netlink.FAMILY_V4)
+	assert.Nil(t, err)
+	assert.Len(t, addrs, 1)
+	assert.Equal(t, "10.0.0.2/8", addrs[0].IPNet.String())
+	routes, err := handle.RouteList(nil, netlink.FAMILY_V4)
+	assert.Nil(t, err)
+	gateway := false
+	for _, route := range routes {
+		if route.Dst == nil && route.Gw.Equal(net.ParseIP(evm.GetGw())) {
+			gateway = true
+		}
+	}
+	assert.True(t, gateway)
+	lo, err := handle.LinkByName("lo")
+	assert.Nil(t, err)
+	assert.NotZero(t, lo.Attrs().Flags&net.FlagUp)
+
+	// Re-address the tap the way a port update does
+	assert.Nil(t, evm.SetIP("192.168.1.5"))
+	assert.Nil(t, evm.SetCidr("192.168.1.0/24"))
+	assert.Nil(t, evm.SetGw("192.168.1.1"))
+	assert.Nil(t, evm.FlushIP(m))
+	assert.Nil(t, evm.AssignIP(m))
+	assert.Nil(t, evm.ReplaceGateway(m))
+	assert.Nil(t, evm.ReplaceGateway(m))
+	addrs, err = handle.AddrList(link, netlink.FAMILY_V4)
+	assert.Nil(t, err)
+	assert.Len(t, addrs, 1)
+	assert.Equal(t, "192.168.1.5/24", addrs[0].IPNet.String())
+	routes, err = handle.RouteList(nil, netlink.FAMILY_V4)
+	assert.Nil(t, err)
+	gateways := 0
+	for _, route := range routes {
+		if route.Dst == nil {
+			assert.Equal(t, "192.168.1.1", route.Gw.String())
+			gateways++
+		}
+	}
+	assert.Equal(t, 1, gateways)
+
+	// Failed steps must not leave the caller inside the namespace
+	assert.NotNil(t, evm.CreateNamespace(m))
+	assert.NotNil(t, evm.MoveDeviceToNetns(m))
+	current, err := netns.Get()
+	assert.Nil(t, err)
+	defer current.Close()
+	assert.True(t, origin.Equal(current))
+
+	assert.Nil(t, evm.MoveDeviceToRootNetns(m))
+	_, err = netlink.LinkByName(evm.GetDeviceId())
+	assert.Nil(t, err)
+	assert.Nil(t, evm.DeleteStandaloneDevice(m))
+	assert.Nil(t, evm.DeleteNamespace(m))
+	_, err = netns.GetFromName(evm.GetName())
+	assert.NotNil(t, err)
+}
+
+// Compares a full standalone EVM lifecycle with ip commands against netlink
+func BenchmarkEvm(b *testing.B) {
+	requireRoot(b)
+	exec := BashExec
+	BashExec = BashExecute
+	defer func() { BashExec = exec }()
+	for _, backend := range []string{BACKEND_BASH, BACKEND_NETLINK} {
+		b.Run(backend, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				evm := newTestEvm(b, backend, fmt.Sprintf("merak-bm%d", i))
+				if err := standaloneLifecycle(evm); err != nil {
+					netns.DeleteNamed(evm.GetName())
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package evm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-agent/ovsdb"
+)
+
+var (
+	ovsdbMu       sync.Mutex
+	ovsdbEndpoint string
+	ovsdbClient   *ovsdb.Client
+)
+
+// Adds and removes OVS ports through the OVSDB server at endpoint instead
+// of ovs-vsctl. An empty endpoint goes back to ovs-vsctl.
+func SetOvsdb(endpoint string) {
+	ovsdbMu.Lock()
+	defer ovsdbMu.Unlock()
+	ovsdbEndpoint = endpoint
+	if ovsdbClient != nil {
+		ovsdbClient.Close()
+		ovsdbClient = nil
+	}
+}
+
+// Returns the connection to the OVSDB server, dialing it on first use and
+// again after it drops, since the server may restart with the plugin.
+// Returns nil if no endpoint is set.
+func getOvsdb() (*ovsdb.Client, error) {
+	ovsdbMu.Lock()
+	defer ovsdbMu.Unlock()
+	if ovsdbEndpoint == "" {
+		return nil, nil
+	}
+	if ovsdbClient != nil {
+		select {
+		case <-ovsdbClient.Done():
+			ovsdbClient = nil
+		default:
+			return ovsdbClient, nil
+		}
+	}
+	client, err := ovsdb.Dial(ovsdbEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	ovsdbClient = client
+	return client, nil
+}
+
+// Adds internal ports to br-int in one transaction and waits for them to
+// get an ofport
+func ovsdbAddPorts(client *ovsdb.Client, taps []string) error {
+	ctx := context.Background()
+	if err := client.AddPorts(ctx, "br-int", taps); err != nil {
+		return err
+	}
+	_, err := client.WaitOfports(ctx, taps, constants.AGENT_OVSDB_OFPORT_TIMEOUT*time.Second)
+	return err
+}
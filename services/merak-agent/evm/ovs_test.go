@@ -0,0 +1,47 @@
+package evm
+
+import (
+	"testing"
+
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	"github.com/futurewei-cloud/merak/services/merak-agent/ovsdb/ovsdbmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOvsdbPorts(t *testing.T) {
+	mock := ovsdbmock.New(ovsdbmock.Config{}, "br-int")
+	endpoint, stop, err := mock.Start()
+	assert.Nil(t, err)
+	defer stop()
+	SetOvsdb(endpoint)
+	defer SetOvsdb("")
+	exec := BashExec
+	BashExec = func(cmd string) ([]byte, error) {
+		t.Error("unexpected command ", cmd)
+		return nil, nil
+	}
+	defer func() { BashExec = exec }()
+
+	m := &mockMetrics{}
+	evm, err := NewEvm("vm1", "10.0.0.2", "aa:bb:cc:dd:ee:ff", "remote", "tap1", "10.0.0.0/8", "10.0.0.1", common_pb.Status_DEPLOYING)
+	assert.Nil(t, err)
+	assert.Nil(t, evm.CreateDevice(m))
+	assert.NotNil(t, evm.CreateDevice(m))
+	assert.Nil(t, Ovsdbbulk([]string{"tap2", "tap3"}, m))
+	assert.Equal(t, []string{"tap1", "tap2", "tap3"}, mock.Ports("br-int"))
+	_, ok := mock.Ofport("tap3")
+	assert.True(t, ok)
+
+	assert.Nil(t, evm.DeleteDevice(m))
+	assert.NotNil(t, evm.DeleteDevice(m))
+	assert.Equal(t, []string{"tap2", "tap3"}, mock.Ports("br-int"))
+
+	// A dropped connection is dialed again
+	ovsdbMu.Lock()
+	ovsdbClient.Close()
+	done := ovsdbClient.Done()
+	ovsdbMu.Unlock()
+	<-done
+	assert.Nil(t, Ovsdbbulk([]string{"tap4"}, m))
+	assert.Equal(t, []string{"tap2", "tap3", "tap4"}, mock.Ports("br-int"))
+}
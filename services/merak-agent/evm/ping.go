@@ -0,0 +1,89 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package evm
+
+import (
+	"errors"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+
+	"github.com/futurewei-cloud/merak/services/common/metrics"
+)
+
+var (
+	netnsNameRegex   = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	pingPacketsRegex = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+	pingRttRegex     = regexp.MustCompile(`= ([\d.]+)/([\d.]+)/([\d.]+)`)
+)
+
+// Results of pinging a single destination
+type PingStats struct {
+	Dest        string
+	Transmitted int
+	Received    int
+	PacketLoss  float64 // Percentage of packets lost
+	RttMin      float64 // Milliseconds
+	RttAvg      float64 // Milliseconds
+	RttMax      float64 // Milliseconds
+}
+
+// Pings dest from inside the network namespace netns.
+// ping exits non-zero when no replies come back, so the error is only
+// returned if the summary can't be found in its output.
+func Ping(netns, dest string, count, timeout int, m metrics.Metrics) (PingStats, error) {
+	var err error
+	defer m.GetMetrics(&err)()
+
+	if !netnsNameRegex.MatchString(netns) {
+		err = evmError{errors.New("Invalid namespace name"), netns}
+		return PingStats{Dest: dest}, err
+	}
+	if net.ParseIP(dest) == nil {
+		err = evmError{errors.New("Invalid IP Address"), dest}
+		return PingStats{Dest: dest}, err
+	}
+	stdout, execErr := CommandExec("ip", "netns", "exec", netns, "ping", "-q", "-c", strconv.Itoa(count), "-W", strconv.Itoa(timeout), dest)
+	stats, err := parsePing(dest, string(stdout))
+	if err != nil {
+		log.Println("Failed to ping " + dest + " from " + netns + "! " + string(stdout))
+		if execErr != nil {
+			err = evmError{Err: execErr, Message: err.Error()}
+		}
+		return stats, err
+	}
+	return stats, nil
+}
+
+// Parses the summary printed by iputils ping
+func parsePing(dest, out string) (PingStats, error) {
+	stats := PingStats{Dest: dest}
+	packets := pingPacketsRegex.FindStringSubmatch(out)
+	if packets == nil {
+		return stats, errors.New("no ping summary in output")
+	}
+	stats.Transmitted, _ = strconv.Atoi(packets[1])
+	stats.Received, _ = strconv.Atoi(packets[2])
+	if stats.Transmitted > 0 {
+		stats.PacketLoss = float64(stats.Transmitted-stats.Received) * 100 / float64(stats.Transmitted)
+	}
+	// The rtt line is omitted when nothing was received
+	if rtt := pingRttRegex.FindStringSubmatch(out); rtt != nil {
+		stats.RttMin, _ = strconv.ParseFloat(rtt[1], 64)
+		stats.RttAvg, _ = strconv.ParseFloat(rtt[2], 64)
+		stats.RttMax, _ = strconv.ParseFloat(rtt[3], 64)
+	}
+	return stats, nil
+}
@@ -0,0 +1,126 @@
+package evm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	pingSuccess = `PING 10.0.0.3 (10.0.0.3) 56(84) bytes of data.
+
+--- 10.0.0.3 ping statistics ---
+3 packets transmitted, 3 received, 0% packet loss, time 2045ms
+rtt min/avg/max/mdev = 0.045/0.060/0.071/0.011 ms
+`
+	pingPartial = `PING 10.0.0.3 (10.0.0.3) 56(84) bytes of data.
+
+--- 10.0.0.3 ping statistics ---
+4 packets transmitted, 1 received, 75% packet loss, time 3061ms
+rtt min/avg/max/mdev = 1.500/1.500/1.500/0.000 ms
+`
+	pingUnreachable = `PING 10.0.0.3 (10.0.0.3) 56(84) bytes of data.
+
+--- 10.0.0.3 ping statistics ---
+3 packets transmitted, 0 received, 100% packet loss, time 2049ms
+`
+	pingBusybox = `PING 10.0.0.3 (10.0.0.3): 56 data bytes
+
+--- 10.0.0.3 ping statistics ---
+3 packets transmitted, 3 packets received, 0% packet loss
+round-trip min/avg/max = 0.081/0.104/0.142 ms
+`
+)
+
+func TestPing(t *testing.T) {
+	metrics := &mockMetrics{}
+	tests := []struct {
+		name   string
+		exec   func(name string, args ...string) ([]byte, error)
+		netns  string
+		dest   string
+		expRes PingStats
+		pass   bool
+	}{
+		{
+			name: "success",
+			exec: func(name string, args ...string) ([]byte, error) {
+				assert.Equal(t, "ip", name)
+				assert.Equal(t, []string{"netns", "exec", "vm1", "ping", "-q", "-c", "3", "-W", "1", "10.0.0.3"}, args)
+				return []byte(pingSuccess), nil
+			},
+			expRes: PingStats{Dest: "10.0.0.3", Transmitted: 3, Received: 3, RttMin: 0.045, RttAvg: 0.060, RttMax: 0.071},
+			pass:   true,
+		},
+		{
+			name: "partial loss",
+			exec: func(name string, args ...string) ([]byte, error) {
+				return []byte(pingPartial), nil
+			},
+			expRes: PingStats{Dest: "10.0.0.3", Transmitted: 4, Received: 1, PacketLoss: 75, RttMin: 1.5, RttAvg: 1.5, RttMax: 1.5},
+			pass:   true,
+		},
+		{
+			name: "unreachable",
+			exec: func(name string, args ...string) ([]byte, error) {
+				return []byte(pingUnreachable), errors.New("exit status 1")
+			},
+			expRes: PingStats{Dest: "10.0.0.3", Transmitted: 3, Received: 0, PacketLoss: 100},
+			pass:   true,
+		},
+		{
+			name: "busybox",
+			exec: func(name string, args ...string) ([]byte, error) {
+				return []byte(pingBusybox), nil
+			},
+			expRes: PingStats{Dest: "10.0.0.3", Transmitted: 3, Received: 3, RttMin: 0.081, RttAvg: 0.104, RttMax: 0.142},
+			pass:   true,
+		},
+		{
+			name: "no namespace",
+			exec: func(name string, args ...string) ([]byte, error) {
+				return []byte(""), errors.New("exit status 1")
+			},
+			expRes: PingStats{Dest: "10.0.0.3"},
+			pass:   false,
+		},
+		{
+			name:   "shell in namespace",
+			netns:  "vm1; reboot",
+			expRes: PingStats{Dest: "10.0.0.3"},
+			pass:   false,
+		},
+		{
+			name:   "shell in destination",
+			dest:   "10.0.0.3 && reboot",
+			expRes: PingStats{Dest: "10.0.0.3 && reboot"},
+			pass:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			CommandExec = tt.exec
+			if tt.exec == nil {
+				CommandExec = func(name string, args ...string) ([]byte, error) {
+					t.Error("unexpected command ", name, args)
+					return nil, nil
+				}
+			}
+			netns, dest := "vm1", "10.0.0.3"
+			if tt.netns != "" {
+				netns = tt.netns
+			}
+			if tt.dest != "" {
+				dest = tt.dest
+			}
+			res, err := Ping(netns, dest, 3, 1, metrics)
+			if tt.pass {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+			assert.Equal(t, tt.expRes, res)
+		})
+	}
+}
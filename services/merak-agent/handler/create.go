@@ -15,6 +15,7 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"os"
 	"runtime"
 
@@ -34,16 +35,37 @@ func caseCreate(ctx context.Context, in *pb.InternalPortConfig, updatePortUrl st
 	}
 	MerakLogger.Info("Executing in mode " + val)
 	if val == constants.MODE_STANDALONE {
+		// Every VM needs the address merak-network allocated for its port,
+		// a shared one would collide with the other VMs
+		if in.Ip == "" || in.Mac == "" || in.Cidr == "" || in.Gw == "" {
+			return &pb.AgentReturnInfo{
+				ReturnMessage: "No port address given for " + in.Name,
+				ReturnCode:    common_pb.ReturnCode_FAILED,
+				Port: &pb.ReturnPortInfo{
+					Status: common_pb.Status_ERROR,
+				},
+			}, errors.New("no port address given")
+		}
+		if len("tap"+in.Name) > constants.AGENT_MAX_DEVICE_NAME {
+			return &pb.AgentReturnInfo{
+				ReturnMessage: "VM name " + in.Name + " is too long for its tap",
+				ReturnCode:    common_pb.ReturnCode_FAILED,
+				Port: &pb.ReturnPortInfo{
+					Status: common_pb.Status_ERROR,
+				},
+			}, errors.New("device name too long")
+		}
 		evm, _ = merakEvm.NewEvm(
 			in.Name,
-			constants.AGENT_STANDALONE_IP,
-			constants.AGENT_STANDALONE_MAC,
+			in.Ip,
+			in.Mac,
 			constants.AGENT_STANDALONE_REMOTE_ID,
 			"tap"+in.Name,
-			constants.AGENT_STANDALONE_CIDR,
-			constants.AGENT_STANDALONE_GW,
+			in.Cidr,
+			in.Gw,
 			common_pb.Status_DEPLOYING,
 		)
+		saveEvm(evm, common_pb.Status_DEPLOYING)
 
 		err := evm.CreateStandaloneDevice(MerakMetrics)
 		if err != nil {
@@ -67,6 +89,7 @@ func caseCreate(ctx context.Context, in *pb.InternalPortConfig, updatePortUrl st
 			in.Gw,
 			common_pb.Status_DEPLOYING,
 		)
+		saveEvm(evm, common_pb.Status_DEPLOYING)
 	}
 	err = evm.CreateNamespace(MerakMetrics)
 	if err != nil {
@@ -175,6 +198,7 @@ func caseCreate(ctx context.Context, in *pb.InternalPortConfig, updatePortUrl st
 		Remoteid: evm.GetRemoteId(),
 		Status:   common_pb.Status_DONE,
 	}
+	saveEvm(evm, common_pb.Status_DONE)
 	MerakLogger.Info("Successfully created devices for evm ", "name", evm.GetName())
 	runtime.SetFinalizer(evm, func(evm merakEvm.Evm) {
 		MerakLogger.Info("Finalize EVM Create ", "name", evm.GetName())
@@ -4,9 +4,12 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	constants "github.com/futurewei-cloud/merak/services/common"
 	"github.com/futurewei-cloud/merak/services/merak-agent/evm"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
@@ -78,6 +81,30 @@ func TestCaseCreate(t *testing.T) {
 	}
 }
 
+func TestCaseCreateStandaloneInvalid(t *testing.T) {
+	MerakMetrics = &mockMetrics{ServiceName: "fake"}
+	var cmds []string
+	evm.BashExec = func(cmd string) ([]byte, error) {
+		cmds = append(cmds, cmd)
+		return nil, nil
+	}
+	os.Setenv(constants.MODE_ENV, constants.MODE_STANDALONE)
+	defer os.Unsetenv(constants.MODE_ENV)
+
+	res, err := caseCreate(context.Background(), &pb.InternalPortConfig{Name: "vm1", Cidr: "10.0.0.0/16", Gw: "10.0.0.1"}, "")
+	assert.NotNil(t, err)
+	assert.Equal(t, common_pb.ReturnCode_FAILED, res.ReturnCode)
+	assert.Empty(t, cmds)
+
+	// The tap of the VM would be cut short by the kernel
+	res, err = caseCreate(context.Background(), &pb.InternalPortConfig{
+		Name: "v1542000123456", Ip: "10.0.0.2", Mac: "aa:bb:cc:dd:ee:02", Cidr: "10.0.0.0/16", Gw: "10.0.0.1",
+	}, "")
+	assert.NotNil(t, err)
+	assert.Equal(t, common_pb.ReturnCode_FAILED, res.ReturnCode)
+	assert.Empty(t, cmds)
+}
+
 func TestCaseCreateMinimalPort(t *testing.T) {
 	metrics := &mockMetrics{
 		ServiceName:     "fake",
@@ -41,6 +41,7 @@ func caseDelete(ctx context.Context, in *pb.InternalPortConfig, deletePortUrl st
 			ReturnCode:    common_pb.ReturnCode_FAILED,
 		}, err
 	}
+	setEvmStatus(evm, common_pb.Status_DELETING)
 	err = evm.MoveDeviceToRootNetns(MerakMetrics)
 	if err != nil {
 		return &pb.AgentReturnInfo{
@@ -93,6 +94,7 @@ func caseDelete(ctx context.Context, in *pb.InternalPortConfig, deletePortUrl st
 		}
 	}
 
+	forgetEvm(evm.GetName())
 	log.Println("Successfully deleted devices for evm ", evm.GetName())
 	runtime.SetFinalizer(evm, func(evm merakEvm.Evm) {
 		MerakLogger.Info("Finalize EVM Delete ", "name", evm.GetName())
@@ -55,12 +55,9 @@ func (s *Server) PortHandler(ctx context.Context, in *pb.InternalPortConfig) (*p
 		return caseCreate(ctx, in, updatePortUrl)
 
 	case common_pb.OperationType_UPDATE:
-		MerakLogger.Info("Update Unimplemented")
-		return &pb.AgentReturnInfo{
-			ReturnMessage: "Update Unimplemented",
-			ReturnCode:    common_pb.ReturnCode_FAILED,
-			Port:          nil,
-		}, errors.New("update unimplemented")
+		MerakLogger.Info("Operation Update")
+		updatePortUrl := "http://" + RemoteServer + ":" + strconv.Itoa(constants.ALCOR_PORT_MANAGER_PORT) + "/project/" + in.Projectid + "/ports/"
+		return caseUpdate(ctx, in, updatePortUrl)
 
 	case common_pb.OperationType_DELETE:
 		MerakLogger.Info("Operation Delete")
@@ -0,0 +1,96 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package handler
+
+import (
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	merakEvm "github.com/futurewei-cloud/merak/services/merak-agent/evm"
+	"github.com/futurewei-cloud/merak/services/merak-agent/inventory"
+)
+
+// The EVMs on this host. Nothing is recorded when it is nil.
+var Inventory *inventory.Store
+
+func recordOf(evm merakEvm.Evm, status common_pb.Status) inventory.Record {
+	return inventory.Record{
+		Name:     evm.GetName(),
+		DeviceID: evm.GetDeviceId(),
+		RemoteID: evm.GetRemoteId(),
+		IP:       evm.GetIP(),
+		MAC:      evm.GetMac(),
+		Cidr:     evm.GetCidr(),
+		Gw:       evm.GetGw(),
+		Status:   status.String(),
+	}
+}
+
+func putRecord(record inventory.Record) {
+	if err := Inventory.Put(record); err != nil {
+		MerakLogger.Error("Failed to save evm to inventory", "name", record.Name, "err", err)
+	}
+}
+
+// Records the EVM and its status
+func saveEvm(evm merakEvm.Evm, status common_pb.Status) {
+	if Inventory == nil {
+		return
+	}
+	putRecord(recordOf(evm, status))
+}
+
+// Changes the status of a recorded EVM, keeping its addresses. An EVM
+// that isn't recorded yet is recorded as it is.
+func setEvmStatus(evm merakEvm.Evm, status common_pb.Status) {
+	if Inventory == nil {
+		return
+	}
+	record, ok := Inventory.Get(evm.GetName())
+	if !ok {
+		record = recordOf(evm, status)
+	}
+	record.Status = status.String()
+	putRecord(record)
+}
+
+// Applies the changes of a port update to the EVM's record
+func updateEvmRecord(in *pb.InternalPortConfig) {
+	if Inventory == nil {
+		return
+	}
+	record, ok := Inventory.Get(in.Name)
+	if !ok {
+		return
+	}
+	if in.Ip != "" {
+		record.IP, record.Cidr = in.Ip, in.Cidr
+	}
+	if in.Gw != "" {
+		record.Gw = in.Gw
+	}
+	if in.Mac != "" {
+		record.MAC = in.Mac
+	}
+	putRecord(record)
+}
+
+// Drops the EVM's record once it is deleted
+func forgetEvm(name string) {
+	if Inventory == nil {
+		return
+	}
+	if err := Inventory.Delete(name); err != nil {
+		MerakLogger.Error("Failed to remove evm from inventory", "name", name, "err", err)
+	}
+}
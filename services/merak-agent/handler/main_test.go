@@ -0,0 +1,13 @@
+package handler
+
+import (
+	"os"
+	"testing"
+
+	"github.com/futurewei-cloud/merak/services/common/logger"
+)
+
+func TestMain(m *testing.M) {
+	MerakLogger, _ = logger.NewConsoleLogger(logger.DEBUG)
+	os.Exit(m.Run())
+}
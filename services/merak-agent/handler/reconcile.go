@@ -0,0 +1,237 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package handler
+
+import (
+	"regexp"
+	"strings"
+
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/common/metrics"
+	merakEvm "github.com/futurewei-cloud/merak/services/merak-agent/evm"
+	"github.com/futurewei-cloud/merak/services/merak-agent/inventory"
+)
+
+var vmNameRegex = regexp.MustCompile(constants.COMPUTE_VM_NAME_PATTERN)
+
+// What Reconcile found and did, by VM, namespace or device name
+type ReconcileReport struct {
+	// Recorded VMs that were intact
+	Kept []string
+	// Recorded VMs whose namespace or tap was gone and was set up again
+	Recreated []string
+	// VMs whose create or delete never finished, cleaned up
+	Removed []string
+	// Namespaces that no VM was recorded for, deleted
+	OrphanNamespaces []string
+	// Taps, or in Alcor mode OVS ports, that no VM was recorded for, deleted
+	OrphanDevices []string
+	// Why a VM, namespace or device couldn't be fixed
+	Failed map[string]string
+}
+
+func (r *ReconcileReport) fail(name string, err error) {
+	MerakLogger.Error("Reconcile failed", "name", name, "err", err)
+	r.Failed[name] = err.Error()
+}
+
+// Brings the host in line with the inventory after an agent restart.
+// VMs recorded as created get back any namespace or tap they lost, VMs
+// caught halfway through a create or delete are removed, and VM namespaces
+// and taps that aren't in the inventory are deleted. Only namespaces named
+// the way merak-compute names VMs count as VM namespaces, and only devices
+// whose name starts with tap as taps; in standalone mode the tap has to be
+// named after such a VM as well. A new inventory can't tell orphans from
+// VMs set up before it, so nothing is deleted as an orphan then.
+// Returns an error only if the host's namespaces or devices can't be
+// listed.
+func Reconcile(mode string) (*ReconcileReport, error) {
+	report := &ReconcileReport{Failed: make(map[string]string)}
+	if Inventory == nil {
+		return report, nil
+	}
+	listed, err := merakEvm.ListNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	var listedDevices []string
+	if mode == constants.MODE_ALCOR {
+		listedDevices, err = merakEvm.ListOvsPorts()
+	} else {
+		listedDevices, err = merakEvm.ListDevices()
+	}
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make(map[string]bool, len(listed))
+	for _, name := range listed {
+		namespaces[name] = true
+	}
+	devices := make(map[string]bool, len(listedDevices))
+	for _, name := range listedDevices {
+		devices[name] = true
+	}
+
+	// Namespaces and devices accounted for by a record
+	known := make(map[string]bool)
+	for _, record := range Inventory.List() {
+		known[record.Name] = true
+		known[record.DeviceID] = true
+		evm, err := evmOf(record)
+		if err != nil {
+			report.fail(record.Name, err)
+			continue
+		}
+		switch record.GetStatus() {
+		case common_pb.Status_DONE, common_pb.Status_ERROR:
+			if namespaces[record.Name] && merakEvm.DeviceInNetns(record.Name, record.DeviceID) {
+				report.Kept = append(report.Kept, record.Name)
+				continue
+			}
+			if err := recreateEvm(evm, mode, namespaces[record.Name], devices[record.DeviceID]); err != nil {
+				report.fail(record.Name, err)
+				setEvmStatus(evm, common_pb.Status_ERROR)
+				continue
+			}
+			setEvmStatus(evm, common_pb.Status_DONE)
+			report.Recreated = append(report.Recreated, record.Name)
+		default:
+			if err := removeEvm(evm, mode, namespaces[record.Name], devices[record.DeviceID]); err != nil {
+				// Kept, to try again on the next start
+				report.fail(record.Name, err)
+				continue
+			}
+			forgetEvm(record.Name)
+			report.Removed = append(report.Removed, record.Name)
+		}
+	}
+
+	if !Inventory.Existed() {
+		MerakLogger.Info("New inventory, leaving unrecorded namespaces and taps alone")
+		return report, nil
+	}
+	for _, name := range listed {
+		if known[name] || !vmNameRegex.MatchString(name) {
+			continue
+		}
+		evm := bareEvm(name, "")
+		if err := evm.DeleteNamespace(MerakMetrics); err != nil {
+			report.fail(name, err)
+			continue
+		}
+		report.OrphanNamespaces = append(report.OrphanNamespaces, name)
+	}
+	for _, name := range listedDevices {
+		if known[name] || !isVMTap(name, mode) {
+			continue
+		}
+		evm := bareEvm("", name)
+		if mode == constants.MODE_ALCOR {
+			err = evm.DeleteDevice(MerakMetrics)
+		} else {
+			err = evm.DeleteStandaloneDevice(MerakMetrics)
+		}
+		if err != nil {
+			report.fail(name, err)
+			continue
+		}
+		report.OrphanDevices = append(report.OrphanDevices, name)
+	}
+	return report, nil
+}
+
+// Alcor names taps after their port, standalone mode after their VM
+func isVMTap(name, mode string) bool {
+	if !strings.HasPrefix(name, "tap") {
+		return false
+	}
+	return mode == constants.MODE_ALCOR || vmNameRegex.MatchString(strings.TrimPrefix(name, "tap"))
+}
+
+func evmOf(record inventory.Record) (merakEvm.Evm, error) {
+	return merakEvm.NewEvm(record.Name, record.IP, record.MAC, record.RemoteID, record.DeviceID, record.Cidr, record.Gw, record.GetStatus())
+}
+
+// An EVM with only a name and a tap, enough to delete either
+func bareEvm(name, deviceID string) merakEvm.Evm {
+	evm, _ := merakEvm.NewEvm(
+		name,
+		constants.AGENT_STANDALONE_IP,
+		constants.AGENT_STANDALONE_MAC,
+		constants.AGENT_STANDALONE_REMOTE_ID,
+		deviceID,
+		constants.AGENT_STANDALONE_CIDR,
+		constants.AGENT_STANDALONE_GW,
+		common_pb.Status_DELETING)
+	return evm
+}
+
+// Sets a VM up again from its record, the way caseCreate does, reusing its
+// tap or OVS port if that is still there. Alcor already has the port, so
+// it isn't told.
+func recreateEvm(evm merakEvm.Evm, mode string, namespace, device bool) error {
+	if namespace {
+		// Start over rather than patch a namespace that lost its tap
+		if err := evm.DeleteNamespace(MerakMetrics); err != nil {
+			return err
+		}
+	}
+	var steps []func(metrics.Metrics) error
+	if !device {
+		if mode == constants.MODE_ALCOR {
+			steps = append(steps, evm.CreateDevice)
+		} else {
+			steps = append(steps, evm.CreateStandaloneDevice)
+		}
+	}
+	steps = append(steps,
+		evm.CreateNamespace,
+		evm.MoveDeviceToNetns,
+		evm.AssignIP,
+		evm.BringLoUp,
+		evm.AssignMac,
+		evm.BringDeviceUp,
+		evm.AddGateway,
+		evm.SetMTUProbing,
+	)
+	for _, step := range steps {
+		if err := step(MerakMetrics); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes whatever a VM left behind, the way caseDelete does
+func removeEvm(evm merakEvm.Evm, mode string, namespace, device bool) error {
+	if namespace {
+		if merakEvm.DeviceInNetns(evm.GetName(), evm.GetDeviceId()) {
+			if err := evm.MoveDeviceToRootNetns(MerakMetrics); err != nil {
+				return err
+			}
+			device = true
+		}
+		if err := evm.DeleteNamespace(MerakMetrics); err != nil {
+			return err
+		}
+	}
+	if !device {
+		return nil
+	}
+	if mode == constants.MODE_ALCOR {
+		return evm.DeleteDevice(MerakMetrics)
+	}
+	return evm.DeleteStandaloneDevice(MerakMetrics)
+}
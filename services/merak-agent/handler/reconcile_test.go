@@ -0,0 +1,321 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-agent/evm"
+	"github.com/futurewei-cloud/merak/services/merak-agent/inventory"
+	"github.com/stretchr/testify/assert"
+)
+
+// The namespaces, devices and OVS ports of a host, changed by the ip and
+// ovs-vsctl commands the EVMs run
+type fakeHost struct {
+	namespaces map[string]map[string]bool
+	root       map[string]bool
+	ports      map[string]bool
+	cmds       []string
+}
+
+func newFakeHost() *fakeHost {
+	return &fakeHost{
+		namespaces: make(map[string]map[string]bool),
+		root:       map[string]bool{"lo": true, "eth0": true},
+		ports:      make(map[string]bool),
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *fakeHost) exec(cmd string) ([]byte, error) {
+	h.cmds = append(h.cmds, cmd)
+	f := strings.Fields(cmd)
+	fail := errors.New("exit status 1")
+	switch {
+	case cmd == "ip netns list":
+		names := []string{}
+		for name := range h.namespaces {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return []byte(strings.Join(names, "\n")), nil
+	case cmd == "ip -o link show":
+		lines := []string{}
+		for i, name := range sortedKeys(h.root) {
+			lines = append(lines, string(rune('1'+i))+": "+name+": <BROADCAST,MULTICAST> mtu 1500")
+		}
+		return []byte(strings.Join(lines, "\n")), nil
+	case cmd == "ovs-vsctl list-ports br-int":
+		return []byte(strings.Join(sortedKeys(h.ports), "\n")), nil
+	case strings.HasPrefix(cmd, "ovs-vsctl add-port br-int"):
+		h.ports[f[3]], h.root[f[3]] = true, true
+	case strings.HasPrefix(cmd, "ovs-vsctl del-port br-int"):
+		if !h.ports[f[3]] {
+			return nil, fail
+		}
+		delete(h.ports, f[3])
+		delete(h.root, f[3])
+	case strings.HasPrefix(cmd, "ip netns add"):
+		if h.namespaces[f[3]] != nil {
+			return nil, fail
+		}
+		h.namespaces[f[3]] = make(map[string]bool)
+	case strings.HasPrefix(cmd, "ip netns delete"):
+		if h.namespaces[f[3]] == nil {
+			return nil, fail
+		}
+		delete(h.namespaces, f[3])
+	case strings.HasPrefix(cmd, "ip tuntap add"):
+		h.root[f[5]] = true
+	case strings.HasPrefix(cmd, "ip tuntap del"):
+		if !h.root[f[5]] {
+			return nil, fail
+		}
+		delete(h.root, f[5])
+	case strings.HasPrefix(cmd, "ip link set") && f[4] == "netns":
+		if !h.root[f[3]] || h.namespaces[f[5]] == nil {
+			return nil, fail
+		}
+		delete(h.root, f[3])
+		h.namespaces[f[5]][f[3]] = true
+	case strings.HasPrefix(cmd, "ip netns exec"):
+		ns := h.namespaces[f[3]]
+		if ns == nil {
+			return nil, fail
+		}
+		inner := strings.Join(f[4:], " ")
+		if strings.HasPrefix(inner, "ip link show dev") && !ns[f[8]] {
+			return nil, fail
+		}
+		if strings.HasSuffix(inner, "netns 1") {
+			delete(ns, f[7])
+			h.root[f[7]] = true
+		}
+	}
+	return nil, nil
+}
+
+func (h *fakeHost) addVM(name, tap string) {
+	h.namespaces[name] = map[string]bool{tap: true}
+}
+
+// Opens an inventory with the records, as left by an earlier run of the
+// agent
+func openInventory(t *testing.T, records ...inventory.Record) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	store, err := inventory.Open(path)
+	assert.Nil(t, err)
+	for _, record := range records {
+		assert.Nil(t, store.Put(record))
+	}
+	assert.Nil(t, store.Close())
+	Inventory, err = inventory.Open(path)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		Inventory.Close()
+		Inventory = nil
+	})
+}
+
+func vmRecord(name, tap string, status common_pb.Status) inventory.Record {
+	return inventory.Record{
+		Name:     name,
+		DeviceID: tap,
+		IP:       "10.0.0.2",
+		MAC:      "aa:bb:cc:dd:ee:ff",
+		Cidr:     "10.0.0.0/8",
+		Gw:       "10.0.0.1",
+		Status:   status.String(),
+	}
+}
+
+func inventoryNames() []string {
+	names := []string{}
+	for _, record := range Inventory.List() {
+		names = append(names, record.Name+":"+record.Status)
+	}
+	return names
+}
+
+func TestReconcileStandalone(t *testing.T) {
+	MerakMetrics = &mockMetrics{ServiceName: "fake"}
+	host := newFakeHost()
+	evm.BashExec = host.exec
+	openInventory(t,
+		vmRecord("vm1", "tapvm1", common_pb.Status_DONE),
+		vmRecord("vm2", "tapvm2", common_pb.Status_DONE),
+		vmRecord("vm3", "tapvm3", common_pb.Status_DEPLOYING),
+		vmRecord("vm4", "tapvm4", common_pb.Status_DELETING),
+		vmRecord("vm5", "tapvm5", common_pb.Status_DONE),
+	)
+	host.addVM("vm1", "tapvm1")
+	// vm2 lost its namespace and tap, vm3's create never finished
+	host.addVM("vm3", "tapvm3")
+	// vm5 lost its tap but kept its namespace
+	host.namespaces["vm5"] = map[string]bool{}
+	host.addVM("v15420007", "tapv15420007")
+	host.root["tapv15420009"] = true
+	// Not the agent's
+	host.namespaces["cni-0a1b"] = map[string]bool{}
+	host.root["tapother"] = true
+
+	report, err := Reconcile(constants.MODE_STANDALONE)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm1"}, report.Kept)
+	assert.Equal(t, []string{"vm2", "vm5"}, report.Recreated)
+	assert.Equal(t, []string{"vm3", "vm4"}, report.Removed)
+	assert.Equal(t, []string{"v15420007"}, report.OrphanNamespaces)
+	assert.Equal(t, []string{"tapv15420009"}, report.OrphanDevices)
+	assert.Empty(t, report.Failed)
+
+	assert.Len(t, host.namespaces, 4)
+	assert.True(t, host.namespaces["vm1"]["tapvm1"])
+	assert.True(t, host.namespaces["vm2"]["tapvm2"])
+	assert.True(t, host.namespaces["vm5"]["tapvm5"])
+	assert.Contains(t, host.namespaces, "cni-0a1b")
+	assert.Equal(t, []string{"eth0", "lo", "tapother"}, sortedKeys(host.root))
+	assert.Contains(t, host.cmds, "ip netns exec vm2 ip addr add 10.0.0.2/8 dev tapvm2")
+	assert.Equal(t, []string{"vm1:DONE", "vm2:DONE", "vm5:DONE"}, inventoryNames())
+
+	// A second pass finds nothing to do
+	report, err = Reconcile(constants.MODE_STANDALONE)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm1", "vm2", "vm5"}, report.Kept)
+	assert.Empty(t, report.Recreated)
+	assert.Empty(t, report.Removed)
+	assert.Empty(t, report.OrphanNamespaces)
+	assert.Empty(t, report.OrphanDevices)
+}
+
+func TestReconcileNewInventory(t *testing.T) {
+	MerakMetrics = &mockMetrics{ServiceName: "fake"}
+	host := newFakeHost()
+	evm.BashExec = host.exec
+	var err error
+	Inventory, err = inventory.Open(filepath.Join(t.TempDir(), "inventory.json"))
+	assert.Nil(t, err)
+	defer func() {
+		Inventory.Close()
+		Inventory = nil
+	}()
+	// VMs the agent set up before it had an inventory
+	host.addVM("v15420000", "tapv15420000")
+	host.root["tapv15420001"] = true
+
+	report, err := Reconcile(constants.MODE_STANDALONE)
+	assert.Nil(t, err)
+	assert.Empty(t, report.OrphanNamespaces)
+	assert.Empty(t, report.OrphanDevices)
+	assert.True(t, host.namespaces["v15420000"]["tapv15420000"])
+	assert.True(t, host.root["tapv15420001"])
+}
+
+func TestReconcileAlcor(t *testing.T) {
+	MerakMetrics = &mockMetrics{ServiceName: "fake"}
+	host := newFakeHost()
+	evm.BashExec = host.exec
+	openInventory(t,
+		vmRecord("vm1", "tap1", common_pb.Status_DONE),
+		vmRecord("vm2", "tap2", common_pb.Status_DONE),
+		vmRecord("vm3", "tap3", common_pb.Status_ERROR),
+	)
+	// vswitchd brought vm1's port back in the root namespace, vm2's is gone
+	// and vm3 can't be set up again
+	host.ports["tap1"], host.root["tap1"] = true, true
+	host.ports["tap9"], host.ports["vxlan0"] = true, true
+	exec := host.exec
+	evm.BashExec = func(cmd string) ([]byte, error) {
+		if cmd == "ip link set tap3 netns vm3" {
+			return nil, errors.New("exit status 1")
+		}
+		return exec(cmd)
+	}
+
+	report, err := Reconcile(constants.MODE_ALCOR)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"vm1", "vm2"}, report.Recreated)
+	assert.Equal(t, []string{"tap9"}, report.OrphanDevices)
+	assert.Equal(t, map[string]string{"vm3": "exit status 1"}, report.Failed)
+	assert.Equal(t, []string{"tap1", "tap2", "tap3", "vxlan0"}, sortedKeys(host.ports))
+	assert.True(t, host.namespaces["vm1"]["tap1"])
+	assert.True(t, host.namespaces["vm2"]["tap2"])
+	assert.NotContains(t, host.cmds, "ovs-vsctl add-port br-int tap1 -- set Interface tap1 type=internal")
+	assert.Contains(t, host.cmds, "ovs-vsctl add-port br-int tap2 -- set Interface tap2 type=internal")
+	assert.Equal(t, []string{"vm1:DONE", "vm2:DONE", "vm3:ERROR"}, inventoryNames())
+}
+
+func TestReconcileListFailure(t *testing.T) {
+	openInventory(t)
+	evm.BashExec = func(cmd string) ([]byte, error) {
+		if strings.HasPrefix(cmd, "ovs-vsctl") {
+			return nil, errors.New("database connection failed")
+		}
+		return nil, nil
+	}
+	_, err := Reconcile(constants.MODE_ALCOR)
+	assert.NotNil(t, err)
+}
+
+func TestInventoryRecords(t *testing.T) {
+	MerakMetrics = &mockMetrics{ServiceName: "fake"}
+	host := newFakeHost()
+	evm.BashExec = host.exec
+	openInventory(t)
+	os.Setenv(constants.MODE_ENV, constants.MODE_STANDALONE)
+	defer os.Unsetenv(constants.MODE_ENV)
+
+	in := &pb.InternalPortConfig{
+		Name:     "vm1",
+		Deviceid: "tapvm1",
+		Ip:       "10.0.0.5",
+		Mac:      "aa:bb:cc:dd:ee:05",
+		Cidr:     "10.0.0.0/16",
+		Gw:       "10.0.0.1",
+	}
+	res, err := caseCreate(context.Background(), in, "")
+	assert.Nil(t, err)
+	assert.Equal(t, common_pb.ReturnCode_OK, res.ReturnCode)
+	record, ok := Inventory.Get("vm1")
+	assert.True(t, ok)
+	assert.Equal(t, inventory.Record{
+		Name:     "vm1",
+		DeviceID: "tapvm1",
+		RemoteID: constants.AGENT_STANDALONE_REMOTE_ID,
+		IP:       "10.0.0.5",
+		MAC:      "aa:bb:cc:dd:ee:05",
+		Cidr:     "10.0.0.0/16",
+		Gw:       "10.0.0.1",
+		Status:   common_pb.Status_DONE.String(),
+	}, record)
+
+	_, err = caseUpdate(context.Background(), &pb.InternalPortConfig{
+		Name:     "vm1",
+		Deviceid: "tapvm1",
+		Gw:       "10.0.0.254",
+	}, "")
+	assert.Nil(t, err)
+	record, _ = Inventory.Get("vm1")
+	assert.Equal(t, "10.0.0.254", record.Gw)
+	assert.Equal(t, "10.0.0.5", record.IP)
+
+	_, err = caseDelete(context.Background(), &pb.InternalPortConfig{Name: "vm1", Deviceid: "tapvm1"}, "")
+	assert.Nil(t, err)
+	assert.Empty(t, Inventory.List())
+	assert.Empty(t, host.namespaces)
+}
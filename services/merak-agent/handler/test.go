@@ -0,0 +1,111 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	ntest_pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	merakEvm "github.com/futurewei-cloud/merak/services/merak-agent/evm"
+)
+
+func (s *Server) TestHandler(ctx context.Context, in *pb.InternalTestTargetConfig) (*pb.AgentReturnTestInfo, error) {
+	MerakLogger.Info("Received on TestHandler", "src", in.Src, "dests", len(in.Dest), "type", in.TestType.String())
+	if in.Src == "" {
+		return &pb.AgentReturnTestInfo{
+			ReturnMessage: "No source namespace given",
+			ReturnCode:    common_pb.ReturnCode_FAILED,
+			Results:       ntest_pb.TestStatus_FAILED,
+		}, errors.New("no source namespace given")
+	}
+	switch testType := in.TestType; testType {
+	case ntest_pb.TestType_PINGALL:
+		return casePingAll(ctx, in)
+
+	default:
+		MerakLogger.Info("Unknown Test Type")
+		return &pb.AgentReturnTestInfo{
+			ReturnMessage: "Unknown Test Type",
+			ReturnCode:    common_pb.ReturnCode_FAILED,
+			Results:       ntest_pb.TestStatus_FAILED,
+		}, errors.New("unknown test type")
+	}
+}
+
+// Pings every destination from the source namespace. The test only passes
+// if every destination answers.
+func casePingAll(ctx context.Context, in *pb.InternalTestTargetConfig) (*pb.AgentReturnTestInfo, error) {
+	targets := make([]*pb.ReturnTestTargetInfo, len(in.Dest))
+	sem := make(chan struct{}, constants.AGENT_TEST_CONCURRENCY)
+	var wg sync.WaitGroup
+	for i, dest := range in.Dest {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, dest string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			targets[i] = pingTarget(in.Src, dest)
+		}(i, dest)
+	}
+	wg.Wait()
+
+	results := ntest_pb.TestStatus_PASSED
+	failed := 0
+	for _, target := range targets {
+		if target.Results != ntest_pb.TestStatus_PASSED {
+			results = ntest_pb.TestStatus_FAILED
+			failed += 1
+		}
+	}
+	MerakLogger.Info("Pingall finished", "src", in.Src, "failed", failed, "total", len(targets))
+	return &pb.AgentReturnTestInfo{
+		ReturnMessage: "Pingall Success",
+		ReturnCode:    common_pb.ReturnCode_OK,
+		Results:       results,
+		Targets:       targets,
+	}, nil
+}
+
+func pingTarget(src, dest string) *pb.ReturnTestTargetInfo {
+	stats, err := merakEvm.Ping(src, dest, constants.AGENT_PING_COUNT, constants.AGENT_PING_TIMEOUT, MerakMetrics)
+	if err != nil {
+		MerakLogger.Error("Ping failed", "src", src, "dest", dest, "err", err)
+		return &pb.ReturnTestTargetInfo{
+			Dest:       dest,
+			Results:    ntest_pb.TestStatus_FAILED,
+			PacketLoss: 100,
+		}
+	}
+	results := ntest_pb.TestStatus_PASSED
+	if stats.Received == 0 {
+		results = ntest_pb.TestStatus_FAILED
+	}
+	return &pb.ReturnTestTargetInfo{
+		Dest:        dest,
+		Results:     results,
+		Transmitted: uint32(stats.Transmitted),
+		Received:    uint32(stats.Received),
+		PacketLoss:  stats.PacketLoss,
+		RttMin:      stats.RttMin,
+		RttAvg:      stats.RttAvg,
+		RttMax:      stats.RttMax,
+	}
+}
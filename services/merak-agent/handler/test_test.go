@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	ntest_pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
+	"github.com/futurewei-cloud/merak/services/merak-agent/evm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTestHandler(t *testing.T) {
+	MerakMetrics = &mockMetrics{}
+	reply := func(dest string, received int) string {
+		out := "--- " + dest + " ping statistics ---\n3 packets transmitted, " + string(rune('0'+received)) + " received\n"
+		if received > 0 {
+			out += "rtt min/avg/max/mdev = 0.1/0.2/0.3/0.0 ms\n"
+		}
+		return out
+	}
+	tests := []struct {
+		name    string
+		exec    func(name string, args ...string) ([]byte, error)
+		in      *pb.InternalTestTargetConfig
+		expRes  ntest_pb.TestStatus
+		expFail []string
+		pass    bool
+	}{
+		{
+			name: "all reachable",
+			exec: func(name string, args ...string) ([]byte, error) {
+				return []byte(reply(args[len(args)-1], 3)), nil
+			},
+			in: &pb.InternalTestTargetConfig{
+				Src:  "vm1",
+				Dest: []string{"10.0.0.3", "10.0.0.4"},
+			},
+			expRes: ntest_pb.TestStatus_PASSED,
+			pass:   true,
+		},
+		{
+			name: "one unreachable",
+			exec: func(name string, args ...string) ([]byte, error) {
+				dest := args[len(args)-1]
+				if dest == "10.0.0.4" {
+					return []byte(reply(dest, 0)), errors.New("exit status 1")
+				}
+				return []byte(reply(dest, 3)), nil
+			},
+			in: &pb.InternalTestTargetConfig{
+				Src:  "vm1",
+				Dest: []string{"10.0.0.3", "10.0.0.4"},
+			},
+			expRes:  ntest_pb.TestStatus_FAILED,
+			expFail: []string{"10.0.0.4"},
+			pass:    true,
+		},
+		{
+			name: "missing namespace",
+			exec: func(name string, args ...string) ([]byte, error) {
+				return nil, errors.New("exit status 1")
+			},
+			in: &pb.InternalTestTargetConfig{
+				Src:  "vm1",
+				Dest: []string{"10.0.0.3"},
+			},
+			expRes:  ntest_pb.TestStatus_FAILED,
+			expFail: []string{"10.0.0.3"},
+			pass:    true,
+		},
+		{
+			name: "no source",
+			in: &pb.InternalTestTargetConfig{
+				Dest: []string{"10.0.0.3"},
+			},
+			expRes: ntest_pb.TestStatus_FAILED,
+			pass:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evm.CommandExec = tt.exec
+			s := &Server{}
+			res, err := s.TestHandler(context.Background(), tt.in)
+			assert.Equal(t, tt.expRes, res.Results)
+			if !tt.pass {
+				assert.NotNil(t, err)
+				assert.Equal(t, common_pb.ReturnCode_FAILED, res.ReturnCode)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, common_pb.ReturnCode_OK, res.ReturnCode)
+			assert.Len(t, res.Targets, len(tt.in.Dest))
+			failed := []string{}
+			for i, target := range res.Targets {
+				assert.Equal(t, tt.in.Dest[i], target.Dest)
+				if target.Results != ntest_pb.TestStatus_PASSED {
+					failed = append(failed, target.Dest)
+				}
+			}
+			assert.ElementsMatch(t, tt.expFail, failed)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package handler
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	merakEvm "github.com/futurewei-cloud/merak/services/merak-agent/evm"
+)
+
+// Changes an existing EVM in place. Only the fields that are set in the
+// request are changed: a new MAC, a new IP with its CIDR and gateway, a
+// new gateway alone, or a new security group. In Alcor mode the port is
+// updated in Alcor first.
+func caseUpdate(ctx context.Context, in *pb.InternalPortConfig, updatePortUrl string) (*pb.AgentReturnInfo, error) {
+	changeIP := in.Ip != "" || in.Cidr != ""
+	changeGw := in.Gw != ""
+	changeMac := in.Mac != ""
+	changeSg := in.Sg != ""
+	if changeIP && (in.Ip == "" || in.Cidr == "" || in.Gw == "") {
+		return updateFailed("A new IP needs its CIDR and gateway", errors.New("incomplete address update"))
+	}
+	if !changeIP && !changeGw && !changeMac && !changeSg {
+		return updateFailed("Nothing to update", errors.New("nothing to update"))
+	}
+
+	val, ok := os.LookupEnv(constants.MODE_ENV)
+	if !ok {
+		val = constants.MODE_ALCOR
+	}
+	MerakLogger.Info("Executing in mode " + val)
+	deviceID := in.Deviceid
+	if val == constants.MODE_STANDALONE && deviceID == "" {
+		deviceID = "tap" + in.Name
+	}
+
+	evm, err := merakEvm.NewEvm(
+		in.Name,
+		constants.AGENT_STANDALONE_IP,
+		constants.AGENT_STANDALONE_MAC,
+		in.Remoteid,
+		deviceID,
+		constants.AGENT_STANDALONE_CIDR,
+		constants.AGENT_STANDALONE_GW,
+		common_pb.Status_DEPLOYING)
+	if err == nil && changeIP {
+		err = evm.SetIP(in.Ip)
+		if err == nil {
+			err = evm.SetCidr(in.Cidr)
+		}
+	}
+	if err == nil && changeGw {
+		err = evm.SetGw(in.Gw)
+	}
+	if err == nil && changeMac {
+		err = evm.SetMac(in.Mac)
+	}
+	if err != nil {
+		return updateFailed("Invalid info for Update EVM", err)
+	}
+	// Alcor names the port to update and the tap it is plugged into
+	if val == constants.MODE_ALCOR && (deviceID == "" || (in.Remoteid == "" && (changeIP || changeMac || changeSg))) {
+		return updateFailed("Missing port or device ID", errors.New("missing port or device id"))
+	}
+
+	if val == constants.MODE_ALCOR && (changeIP || changeMac || changeSg) {
+		MerakLogger.Info(updatePortUrl + evm.GetRemoteId())
+		err = merakEvm.ChangePort(updatePortUrl+evm.GetRemoteId(), in, MerakMetrics, evm)
+		if err != nil {
+			return updateFailed("Failed to update port", err)
+		}
+	}
+
+	if changeMac {
+		err = evm.AssignMac(MerakMetrics)
+		if err != nil {
+			return updateFailed("Assign mac!", err)
+		}
+	}
+	if changeIP {
+		// Dropping the old address also drops the default route through it
+		err = evm.FlushIP(MerakMetrics)
+		if err != nil {
+			return updateFailed("Failed to remove old IP!", err)
+		}
+		err = evm.AssignIP(MerakMetrics)
+		if err != nil {
+			return updateFailed("Failed to give tap IP!", err)
+		}
+	}
+	if changeIP || changeGw {
+		err = evm.ReplaceGateway(MerakMetrics)
+		if err != nil {
+			return updateFailed("Failed to replace default gw!", err)
+		}
+	}
+
+	updateEvmRecord(in)
+	MerakLogger.Info("Successfully updated evm ", "name", evm.GetName())
+	return &pb.AgentReturnInfo{
+		ReturnMessage: "Update Success",
+		ReturnCode:    common_pb.ReturnCode_OK,
+		Port: &pb.ReturnPortInfo{
+			Ip:       in.Ip,
+			Mac:      in.Mac,
+			Deviceid: evm.GetDeviceId(),
+			Remoteid: evm.GetRemoteId(),
+			Status:   common_pb.Status_DONE,
+		},
+	}, nil
+}
+
+func updateFailed(message string, err error) (*pb.AgentReturnInfo, error) {
+	MerakLogger.Error(message, "err", err)
+	return &pb.AgentReturnInfo{
+		ReturnMessage: message,
+		ReturnCode:    common_pb.ReturnCode_FAILED,
+		Port: &pb.ReturnPortInfo{
+			Status: common_pb.Status_ERROR,
+		},
+	}, err
+}
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-agent/evm"
+	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+)
+
+func TestCaseUpdate(t *testing.T) {
+	MerakMetrics = &mockMetrics{ServiceName: "fake"}
+	tests := []struct {
+		name       string
+		mode       string
+		in         *pb.InternalPortConfig
+		expCmds    []string
+		expBody    map[string]string
+		expMessage string
+	}{
+		{
+			name: "new address",
+			in: &pb.InternalPortConfig{
+				Name:     "vm1",
+				Remoteid: "port1",
+				Deviceid: "tap1",
+				Subnetid: "subnet1",
+				Ip:       "10.0.1.5",
+				Cidr:     "10.0.1.0/24",
+				Gw:       "10.0.1.1",
+			},
+			expCmds: []string{
+				"ip netns exec vm1 ip addr flush dev tap1",
+				"ip netns exec vm1 ip addr add 10.0.1.5/24 dev tap1",
+				"ip netns exec vm1 ip r replace default via 10.0.1.1",
+			},
+			expBody: map[string]string{
+				"port.id":                     "port1",
+				"port.fixed_ips.0.ip_address": "10.0.1.5",
+				"port.fixed_ips.0.subnet_id":  "subnet1",
+				"port.security_groups":        "",
+				"port.mac_address":            "",
+			},
+		},
+		{
+			name: "new address in the same subnet",
+			in: &pb.InternalPortConfig{
+				Name:     "vm1",
+				Remoteid: "port1",
+				Deviceid: "tap1",
+				Ip:       "10.0.0.9",
+				Cidr:     "10.0.0.0/24",
+				Gw:       "10.0.0.1",
+			},
+			expCmds: []string{
+				"ip netns exec vm1 ip addr flush dev tap1",
+				"ip netns exec vm1 ip addr add 10.0.0.9/24 dev tap1",
+				"ip netns exec vm1 ip r replace default via 10.0.0.1",
+			},
+			expBody: map[string]string{
+				"port.fixed_ips.0.ip_address": "10.0.0.9",
+				"port.fixed_ips.0.subnet_id":  "subnet0",
+			},
+		},
+		{
+			name: "security group and mac",
+			in: &pb.InternalPortConfig{
+				Name:     "vm1",
+				Remoteid: "port1",
+				Deviceid: "tap1",
+				Sg:       "sg2",
+				Mac:      "aa:bb:cc:dd:ee:01",
+			},
+			expCmds: []string{
+				"ip netns exec vm1 ip link set dev tap1 address aa:bb:cc:dd:ee:01",
+			},
+			expBody: map[string]string{
+				"port.security_groups.0": "sg2",
+				"port.mac_address":       "aa:bb:cc:dd:ee:01",
+				"port.fixed_ips":         "",
+			},
+		},
+		{
+			name: "gateway only",
+			in: &pb.InternalPortConfig{
+				Name:     "vm1",
+				Remoteid: "port1",
+				Deviceid: "tap1",
+				Gw:       "10.0.0.254",
+			},
+			expCmds: []string{
+				"ip netns exec vm1 ip r replace default via 10.0.0.254",
+			},
+		},
+		{
+			name: "standalone",
+			mode: constants.MODE_STANDALONE,
+			in: &pb.InternalPortConfig{
+				Name: "vm1",
+				Sg:   "sg2",
+				Ip:   "10.0.0.9",
+				Cidr: "10.0.0.0/8",
+				Gw:   "10.0.0.1",
+			},
+			expCmds: []string{
+				"ip netns exec vm1 ip addr flush dev tapvm1",
+				"ip netns exec vm1 ip addr add 10.0.0.9/8 dev tapvm1",
+				"ip netns exec vm1 ip r replace default via 10.0.0.1",
+			},
+		},
+		{
+			name:       "ip without cidr",
+			in:         &pb.InternalPortConfig{Name: "vm1", Deviceid: "tap1", Ip: "10.0.1.5"},
+			expMessage: "A new IP needs its CIDR and gateway",
+		},
+		{
+			name:       "invalid mac",
+			in:         &pb.InternalPortConfig{Name: "vm1", Deviceid: "tap1", Mac: "zz"},
+			expMessage: "Invalid info for Update EVM",
+		},
+		{
+			name:       "no port id",
+			in:         &pb.InternalPortConfig{Name: "vm1", Deviceid: "tap1", Sg: "sg2"},
+			expMessage: "Missing port or device ID",
+		},
+		{
+			name:       "no device id",
+			in:         &pb.InternalPortConfig{Name: "vm1", Remoteid: "port1", Gw: "10.0.0.254"},
+			expMessage: "Missing port or device ID",
+		},
+		{
+			name:       "nothing",
+			in:         &pb.InternalPortConfig{Name: "vm1", Deviceid: "tap1"},
+			expMessage: "Nothing to update",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mode != "" {
+				os.Setenv(constants.MODE_ENV, tt.mode)
+				defer os.Unsetenv(constants.MODE_ENV)
+			}
+			var cmds []string
+			evm.BashExec = func(cmd string) ([]byte, error) {
+				cmds = append(cmds, cmd)
+				return nil, nil
+			}
+			var body []byte
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				assert.Equal(t, "/port1", r.URL.Path)
+				if r.Method == http.MethodGet {
+					w.Write([]byte(`{"port":{"id":"port1","fixed_ips":[{"subnet_id":"subnet0","ip_address":"10.0.0.5"}]}}`))
+					return
+				}
+				assert.Equal(t, http.MethodPut, r.Method)
+				body, _ = io.ReadAll(r.Body)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer server.Close()
+
+			res, err := caseUpdate(context.Background(), tt.in, server.URL+"/")
+			if tt.expMessage != "" {
+				assert.NotNil(t, err)
+				assert.Equal(t, tt.expMessage, res.ReturnMessage)
+				assert.Equal(t, common_pb.ReturnCode_FAILED, res.ReturnCode)
+				assert.Empty(t, cmds)
+				assert.Equal(t, 0, requests)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, common_pb.ReturnCode_OK, res.ReturnCode)
+			assert.Equal(t, common_pb.Status_DONE, res.Port.Status)
+			assert.Equal(t, tt.in.Ip, res.Port.Ip)
+			assert.Equal(t, tt.expCmds, cmds)
+			if tt.expBody == nil {
+				assert.Nil(t, body)
+			}
+			for path, value := range tt.expBody {
+				assert.Equal(t, value, gjson.GetBytes(body, path).String(), path)
+			}
+		})
+	}
+}
+
+func TestCaseUpdateAlcorFailure(t *testing.T) {
+	MerakMetrics = &mockMetrics{ServiceName: "fake"}
+	var cmds []string
+	evm.BashExec = func(cmd string) ([]byte, error) {
+		cmds = append(cmds, cmd)
+		return nil, nil
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	res, err := caseUpdate(context.Background(), &pb.InternalPortConfig{
+		Name:     "vm1",
+		Remoteid: "port1",
+		Deviceid: "tap1",
+		Sg:       "sg2",
+	}, server.URL+"/")
+	assert.NotNil(t, err)
+	assert.Equal(t, "Failed to update port", res.ReturnMessage)
+	assert.Equal(t, common_pb.Status_ERROR, res.Port.Status)
+	// Nothing changes locally if Alcor rejects the update
+	assert.Empty(t, cmds)
+}
@@ -0,0 +1,214 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+// Package inventory keeps a record of the EVMs the agent has set up on this
+// host in a local file, so that a restarted agent knows which namespaces
+// and taps are its own.
+package inventory
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+)
+
+type Record struct {
+	Name     string `json:"name"`
+	DeviceID string `json:"device_id"`
+	RemoteID string `json:"remote_id"`
+	IP       string `json:"ip"`
+	MAC      string `json:"mac"`
+	Cidr     string `json:"cidr"`
+	Gw       string `json:"gw"`
+	// The name of a common_pb.Status
+	Status string `json:"status"`
+}
+
+func (r Record) GetStatus() common_pb.Status {
+	return common_pb.Status(common_pb.Status_value[r.Status])
+}
+
+// A journal entry. A put without a record is a delete.
+type entry struct {
+	Name   string  `json:"name"`
+	Record *Record `json:"record,omitempty"`
+}
+
+// The inventory, kept in memory and backed by an append-only journal so
+// that each change costs one small write however many EVMs there are.
+// The journal is compacted every time it is opened.
+type Store struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	records map[string]Record
+	// Whether there was an inventory to load
+	existed bool
+}
+
+// Loads the inventory at path, creating an empty one if there is none
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{path: path, records: make(map[string]Record)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	s.existed = true
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// The last line is cut short if the agent died while writing it
+			if !scanner.Scan() {
+				break
+			}
+			return fmt.Errorf("corrupt inventory %s line %d: %v", s.path, line, err)
+		}
+		if e.Record == nil {
+			delete(s.records, e.Name)
+		} else {
+			s.records[e.Name] = *e.Record
+		}
+	}
+	return scanner.Err()
+}
+
+// Whether the inventory was already there when it was opened. A new one
+// knows nothing about the EVMs that may be on the host.
+func (s *Store) Existed() bool {
+	return s.existed
+}
+
+// Rewrites the journal with one entry per record and reopens it for
+// appending
+func (s *Store) compact() error {
+	tmp := s.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	enc := json.NewEncoder(writer)
+	for _, record := range s.list() {
+		record := record
+		if err := enc.Encode(entry{Name: record.Name, Record: &record}); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	return err
+}
+
+func (s *Store) append(e entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// No fsync: the page cache outlives a crashed agent, and the inventory
+	// isn't worth a disk flush per VM
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Adds or replaces the record of an EVM
+func (s *Store) Put(record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.append(entry{Name: record.Name, Record: &record}); err != nil {
+		return err
+	}
+	s.records[record.Name] = record
+	return nil
+}
+
+// Drops the record of an EVM, if any
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[name]; !ok {
+		return nil
+	}
+	if err := s.append(entry{Name: name}); err != nil {
+		return err
+	}
+	delete(s.records, name)
+	return nil
+}
+
+func (s *Store) Get(name string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[name]
+	return record, ok
+}
+
+// Returns every record, sorted by name
+func (s *Store) List() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+func (s *Store) list() []Record {
+	records := make([]Record, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Name < records[j].Name })
+	return records
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,65 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent", "inventory.json")
+	store, err := Open(path)
+	assert.Nil(t, err)
+	assert.Empty(t, store.List())
+	assert.False(t, store.Existed())
+
+	vm1 := Record{Name: "vm1", DeviceID: "tap1", IP: "10.0.0.2", Status: common_pb.Status_DEPLOYING.String()}
+	vm2 := Record{Name: "vm2", DeviceID: "tap2", IP: "10.0.0.3", Status: common_pb.Status_DONE.String()}
+	assert.Nil(t, store.Put(vm2))
+	assert.Nil(t, store.Put(vm1))
+	vm1.Status = common_pb.Status_DONE.String()
+	assert.Nil(t, store.Put(vm1))
+	assert.Nil(t, store.Put(Record{Name: "vm3"}))
+	assert.Nil(t, store.Delete("vm3"))
+	assert.Nil(t, store.Delete("vm4"))
+	assert.Equal(t, []Record{vm1, vm2}, store.List())
+	record, ok := store.Get("vm1")
+	assert.True(t, ok)
+	assert.Equal(t, common_pb.Status_DONE, record.GetStatus())
+	_, ok = store.Get("vm3")
+	assert.False(t, ok)
+	assert.Nil(t, store.Close())
+
+	// Reopening replays the journal and compacts it
+	store, err = Open(path)
+	assert.Nil(t, err)
+	assert.True(t, store.Existed())
+	assert.Equal(t, []Record{vm1, vm2}, store.List())
+	journal, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(string(journal), "\n"))
+	assert.Nil(t, store.Close())
+}
+
+func TestStoreTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	journal := `{"name":"vm1","record":{"name":"vm1","status":"DONE"}}
+{"name":"vm1"}
+{"name":"vm2","record":{"name":"vm2","status":"DONE"}}
+{"name":"vm3","rec`
+	assert.Nil(t, os.WriteFile(path, []byte(journal), 0644))
+	store, err := Open(path)
+	assert.Nil(t, err)
+	assert.Equal(t, []Record{{Name: "vm2", Status: "DONE"}}, store.List())
+	store.Close()
+
+	// Only a cut short last line is forgiven
+	journal = "{\"name\":\nnot json\n"
+	assert.Nil(t, os.WriteFile(path, []byte(journal), 0644))
+	_, err = Open(path)
+	assert.NotNil(t, err)
+}
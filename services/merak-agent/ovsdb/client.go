@@ -0,0 +1,412 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package ovsdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A connection to an ovsdb-server. Requests can be sent concurrently; the
+// responses are matched to them by id.
+type Client struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan message
+	err     error
+	done    chan struct{}
+}
+
+// Connects to an OVSDB endpoint given the way ovs-vsctl takes it, e.g.
+// unix:/var/run/openvswitch/db.sock or tcp:127.0.0.1:6640
+func Dial(endpoint string) (*Client, error) {
+	network, address, ok := strings.Cut(endpoint, ":")
+	if !ok || (network != "unix" && network != "tcp") {
+		return nil, fmt.Errorf("invalid ovsdb endpoint %q", endpoint)
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// Wraps an established connection
+func NewClient(conn net.Conn) *Client {
+	c := &Client{
+		conn:    conn,
+		enc:     json.NewEncoder(conn),
+		pending: make(map[uint64]chan message),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Closed once the connection is gone; Err then returns why
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) send(v interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.enc.Encode(v)
+}
+
+// Dispatches responses to their callers and answers the server's echo
+// keepalives until the connection closes
+func (c *Client) read() {
+	dec := json.NewDecoder(c.conn)
+	var err error
+	for {
+		var msg message
+		if err = dec.Decode(&msg); err != nil {
+			break
+		}
+		if msg.Method == "echo" {
+			var params []interface{}
+			json.Unmarshal(msg.Params, &params)
+			if err = c.send(response{Result: params, ID: msg.ID}); err != nil {
+				break
+			}
+			continue
+		}
+		if msg.Method != "" {
+			// Monitor updates and other notifications aren't used
+			continue
+		}
+		id, ok := msg.ID.(float64)
+		if !ok {
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[uint64(id)]
+		delete(c.pending, uint64(id))
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+	c.conn.Close()
+	c.mu.Lock()
+	c.err = fmt.Errorf("%w: %v", ErrClosed, err)
+	c.pending = nil
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// Sends a request and waits for its response
+func (c *Client) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	ch := make(chan message, 1)
+	c.mu.Lock()
+	if c.pending == nil {
+		err := c.err
+		c.mu.Unlock()
+		return err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.send(request{Method: method, Params: params, ID: id}); err != nil {
+		c.forget(id)
+		return err
+	}
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return fmt.Errorf("ovsdb %s failed: %v", method, msg.Error)
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		c.forget(id)
+		return ctx.Err()
+	}
+}
+
+func (c *Client) forget(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending != nil {
+		delete(c.pending, id)
+	}
+}
+
+// Lists the databases served
+func (c *Client) ListDbs(ctx context.Context) ([]string, error) {
+	var dbs []string
+	err := c.call(ctx, "list_dbs", []interface{}{}, &dbs)
+	return dbs, err
+}
+
+// Runs the operations as a single transaction on the Open_vSwitch
+// database. Either all of them are committed or none; in the latter case
+// a *TransactionError names the operation that failed.
+func (c *Client) Transact(ctx context.Context, ops ...Operation) ([]OperationResult, error) {
+	params := make([]interface{}, 0, len(ops)+1)
+	params = append(params, DATABASE)
+	for _, op := range ops {
+		params = append(params, op)
+	}
+	var results []OperationResult
+	if err := c.call(ctx, "transact", params, &results); err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		if result.Error != "" {
+			return results, &TransactionError{Op: i, Reason: result.Error, Details: result.Details}
+		}
+	}
+	if len(results) < len(ops) {
+		return results, fmt.Errorf("ovsdb returned %d results for %d operations", len(results), len(ops))
+	}
+	return results, nil
+}
+
+// A wait operation that fails the transaction at once unless the rows
+// matching where have the given columns
+func expect(table string, where []Condition, until string, rows ...Row) Operation {
+	columns := []string{}
+	for column := range rowsColumns(rows) {
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		columns = []string{"_uuid"}
+	}
+	timeout := 0
+	return Operation{
+		Op:      "wait",
+		Table:   table,
+		Where:   where,
+		Columns: columns,
+		Until:   until,
+		Rows:    append([]Row{}, rows...),
+		Timeout: &timeout,
+	}
+}
+
+func rowsColumns(rows []Row) map[string]bool {
+	columns := make(map[string]bool)
+	for _, row := range rows {
+		for column := range row {
+			columns[column] = true
+		}
+	}
+	return columns
+}
+
+// Adds an internal port and interface named after each device to the
+// bridge, like ovs-vsctl add-port <bridge> <name> -- set Interface <name>
+// type=internal, all in one transaction. Nothing is added if the bridge
+// is missing or any of the ports already exists.
+func (c *Client) AddPorts(ctx context.Context, bridge string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	ops := []Operation{expect(TABLE_BRIDGE, []Condition{Equal("name", bridge)}, "==", Row{"name": bridge})}
+	ports := make(Set, 0, len(names))
+	for i, name := range names {
+		iface := NamedUUID(fmt.Sprintf("iface%d", i))
+		port := NamedUUID(fmt.Sprintf("port%d", i))
+		ops = append(ops,
+			expect(TABLE_PORT, []Condition{Equal("name", name)}, "=="),
+			Operation{
+				Op:       "insert",
+				Table:    TABLE_INTERFACE,
+				Row:      Row{"name": name, "type": "internal"},
+				UUIDName: string(iface),
+			},
+			Operation{
+				Op:       "insert",
+				Table:    TABLE_PORT,
+				Row:      Row{"name": name, "interfaces": iface},
+				UUIDName: string(port),
+			})
+		ports = append(ports, port)
+	}
+	ops = append(ops, Operation{
+		Op:        "mutate",
+		Table:     TABLE_BRIDGE,
+		Where:     []Condition{Equal("name", bridge)},
+		Mutations: []Mutation{{"ports", "insert", ports}},
+	})
+	_, err := c.Transact(ctx, ops...)
+	return describe(err, ops, names)
+}
+
+// Removes the named ports from the bridge in one transaction, like
+// ovs-vsctl del-port. Their Port and Interface rows are garbage collected
+// by the server once no bridge refers to them.
+func (c *Client) DeletePorts(ctx context.Context, bridge string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	selects := make([]Operation, len(names))
+	for i, name := range names {
+		selects[i] = Operation{
+			Op:      "select",
+			Table:   TABLE_PORT,
+			Where:   []Condition{Equal("name", name)},
+			Columns: []string{"_uuid"},
+		}
+	}
+	results, err := c.Transact(ctx, selects...)
+	if err != nil {
+		return err
+	}
+	ports := make(Set, 0, len(names))
+	for i, result := range results {
+		if len(result.Rows) == 0 {
+			return fmt.Errorf("no port named %s", names[i])
+		}
+		id, _ := RowUUID(result.Rows[0]["_uuid"])
+		ports = append(ports, id)
+	}
+
+	ops := []Operation{expect(TABLE_BRIDGE, []Condition{Equal("name", bridge)}, "==", Row{"name": bridge})}
+	for _, port := range ports {
+		// Fails the delete if a port was removed since the select
+		ops = append(ops, expect(TABLE_PORT, []Condition{Equal("_uuid", port)}, "!="))
+	}
+	ops = append(ops, Operation{
+		Op:        "mutate",
+		Table:     TABLE_BRIDGE,
+		Where:     []Condition{Equal("name", bridge)},
+		Mutations: []Mutation{{"ports", "delete", ports}},
+	})
+	_, err = c.Transact(ctx, ops...)
+	return err
+}
+
+// Returns the names of the ports on the bridge
+func (c *Client) ListPorts(ctx context.Context, bridge string) ([]string, error) {
+	results, err := c.Transact(ctx,
+		Operation{
+			Op:      "select",
+			Table:   TABLE_BRIDGE,
+			Where:   []Condition{Equal("name", bridge)},
+			Columns: []string{"ports"},
+		},
+		Operation{
+			Op:      "select",
+			Table:   TABLE_PORT,
+			Columns: []string{"_uuid", "name"},
+		})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[0].Rows) == 0 {
+		return nil, fmt.Errorf("no bridge named %s", bridge)
+	}
+	onBridge := make(map[UUID]bool)
+	for _, port := range setAtoms(results[0].Rows[0]["ports"]) {
+		if id, ok := RowUUID(port); ok {
+			onBridge[id] = true
+		}
+	}
+	names := []string{}
+	for _, row := range results[1].Rows {
+		id, _ := RowUUID(row["_uuid"])
+		if name, ok := String(row["name"]); ok && onBridge[id] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Waits up to timeout for vswitchd to give each interface an OpenFlow
+// port number and returns them by name. An interface that vswitchd failed
+// to create gets ofport -1 and makes this return its error.
+func (c *Client) WaitOfports(ctx context.Context, names []string, timeout time.Duration) (map[string]int, error) {
+	ms := int(timeout.Milliseconds())
+	ops := make([]Operation, 0, 2*len(names))
+	for _, name := range names {
+		ops = append(ops, Operation{
+			Op:      "wait",
+			Table:   TABLE_INTERFACE,
+			Where:   []Condition{Equal("name", name)},
+			Columns: []string{"ofport"},
+			Until:   "!=",
+			Rows:    []Row{{"ofport": Set{}}},
+			Timeout: &ms,
+		})
+	}
+	for _, name := range names {
+		ops = append(ops, Operation{
+			Op:      "select",
+			Table:   TABLE_INTERFACE,
+			Where:   []Condition{Equal("name", name)},
+			Columns: []string{"ofport", "error"},
+		})
+	}
+	results, err := c.Transact(ctx, ops...)
+	if err != nil {
+		if txErr, ok := err.(*TransactionError); ok && txErr.Reason == "timed out" && txErr.Op < len(names) {
+			return nil, fmt.Errorf("timed out waiting for ofport of %s", names[txErr.Op])
+		}
+		return nil, err
+	}
+	ofports := make(map[string]int, len(names))
+	for i, name := range names {
+		rows := results[len(names)+i].Rows
+		if len(rows) == 0 {
+			return nil, fmt.Errorf("no interface named %s", name)
+		}
+		ofport, _ := Integer(rows[0]["ofport"])
+		if ofport < 0 {
+			reason, _ := String(rows[0]["error"])
+			return nil, fmt.Errorf("interface %s has no ofport: %s", name, reason)
+		}
+		ofports[name] = ofport
+	}
+	return ofports, nil
+}
+
+// Names the bridge or port behind a failed precondition in AddPorts
+func describe(err error, ops []Operation, names []string) error {
+	txErr, ok := err.(*TransactionError)
+	if !ok || txErr.Op >= len(ops) || ops[txErr.Op].Op != "wait" {
+		return err
+	}
+	if txErr.Op == 0 {
+		return fmt.Errorf("no bridge named %v: %w", ops[0].Rows[0]["name"], err)
+	}
+	// Each port adds a wait and two inserts after the bridge's wait
+	return fmt.Errorf("port %s already exists: %w", names[(txErr.Op-1)/3], err)
+}
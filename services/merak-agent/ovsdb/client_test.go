@@ -0,0 +1,170 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package ovsdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/futurewei-cloud/merak/services/merak-agent/ovsdb/ovsdbmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func startMock(t testing.TB, config ovsdbmock.Config) (*ovsdbmock.Server, *Client) {
+	mock := ovsdbmock.New(config, "br-int")
+	endpoint, stop, err := mock.Start()
+	assert.Nil(t, err)
+	t.Cleanup(stop)
+	client, err := Dial(endpoint)
+	assert.Nil(t, err)
+	t.Cleanup(func() { client.Close() })
+	return mock, client
+}
+
+func TestDial(t *testing.T) {
+	_, err := Dial("/var/run/openvswitch/db.sock")
+	assert.NotNil(t, err)
+	_, err = Dial("ssl:127.0.0.1:6640")
+	assert.NotNil(t, err)
+
+	mock, client := startMock(t, ovsdbmock.Config{})
+	dbs, err := client.ListDbs(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{DATABASE}, dbs)
+	// The mock's echo is answered
+	assert.Eventually(t, func() bool { return mock.Echoes() == 1 }, time.Second, time.Millisecond)
+
+	client.Close()
+	<-client.Done()
+	_, err = client.ListDbs(context.Background())
+	assert.True(t, errors.Is(err, ErrClosed))
+}
+
+func TestAddDeletePorts(t *testing.T) {
+	mock, client := startMock(t, ovsdbmock.Config{OfportDelay: 10 * time.Millisecond})
+	ctx := context.Background()
+	names := []string{"tap1", "tap2", "tap3"}
+
+	assert.Nil(t, client.AddPorts(ctx, "br-int", names))
+	assert.Equal(t, 1, mock.Transactions())
+	assert.Equal(t, names, mock.Ports("br-int"))
+
+	ofports, err := client.WaitOfports(ctx, names, time.Second)
+	assert.Nil(t, err)
+	assert.Len(t, ofports, 3)
+	for _, name := range names {
+		ofport, ok := mock.Ofport(name)
+		assert.True(t, ok)
+		assert.Equal(t, ofport, ofports[name])
+	}
+
+	// Nothing is added if one port exists
+	err = client.AddPorts(ctx, "br-int", []string{"tap4", "tap2"})
+	assert.EqualError(t, err, "port tap2 already exists: ovsdb operation 4 failed: timed out")
+	assert.Equal(t, names, mock.Ports("br-int"))
+	err = client.AddPorts(ctx, "br-ex", []string{"tap4"})
+	assert.ErrorContains(t, err, "no bridge named br-ex")
+	assert.Equal(t, 3, mock.Count(TABLE_PORT))
+
+	ports, err := client.ListPorts(ctx, "br-int")
+	assert.Nil(t, err)
+	assert.Equal(t, names, ports)
+	_, err = client.ListPorts(ctx, "br-ex")
+	assert.EqualError(t, err, "no bridge named br-ex")
+
+	assert.Nil(t, client.DeletePorts(ctx, "br-int", []string{"tap1", "tap3"}))
+	assert.Equal(t, []string{"tap2"}, mock.Ports("br-int"))
+	assert.Equal(t, 1, mock.Count(TABLE_PORT))
+	assert.Equal(t, 1, mock.Count(TABLE_INTERFACE))
+	assert.EqualError(t, client.DeletePorts(ctx, "br-int", []string{"tap2", "tap1"}), "no port named tap1")
+	assert.Equal(t, []string{"tap2"}, mock.Ports("br-int"))
+	ports, err = client.ListPorts(ctx, "br-int")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tap2"}, ports)
+
+	assert.Nil(t, client.AddPorts(ctx, "br-int", nil))
+	assert.Nil(t, client.DeletePorts(ctx, "br-int", nil))
+}
+
+func TestWaitOfports(t *testing.T) {
+	mock, client := startMock(t, ovsdbmock.Config{OfportDelay: 200 * time.Millisecond})
+	ctx := context.Background()
+
+	assert.Nil(t, client.AddPorts(ctx, "br-int", []string{"tap1"}))
+	_, err := client.WaitOfports(ctx, []string{"tap1"}, 20*time.Millisecond)
+	assert.EqualError(t, err, "timed out waiting for ofport of tap1")
+
+	mock.FailInterface("tap2", "could not open network device tap2 (No such device)")
+	assert.Nil(t, client.AddPorts(ctx, "br-int", []string{"tap2"}))
+	_, err = client.WaitOfports(ctx, []string{"tap1", "tap2"}, time.Second)
+	assert.EqualError(t, err, "interface tap2 has no ofport: could not open network device tap2 (No such device)")
+
+	_, err = client.WaitOfports(ctx, []string{"tap3"}, time.Second)
+	assert.EqualError(t, err, "no interface named tap3")
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.Nil(t, client.AddPorts(ctx, "br-int", []string{"tap4"}))
+	_, err = client.WaitOfports(timeout, []string{"tap4"}, time.Second)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestConcurrentTransactions(t *testing.T) {
+	mock, client := startMock(t, ovsdbmock.Config{})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("tap%02d", i)
+			assert.Nil(t, client.AddPorts(context.Background(), "br-int", []string{name}))
+			_, err := client.WaitOfports(context.Background(), []string{name}, time.Second)
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, mock.Ports("br-int"), 20)
+}
+
+// Adding ports one transaction each, as separate ovs-vsctl calls do,
+// against a single transaction for all of them
+func BenchmarkAddPorts(b *testing.B) {
+	for _, batch := range []int{1, 100} {
+		b.Run(fmt.Sprintf("batch%d", batch), func(b *testing.B) {
+			_, client := startMock(b, ovsdbmock.Config{})
+			ctx := context.Background()
+			names := make([]string, 100)
+			for j := range names {
+				names[j] = fmt.Sprintf("tap%d", j)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < len(names); j += batch {
+					if err := client.AddPorts(ctx, "br-int", names[j:j+batch]); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.StopTimer()
+				if err := client.DeletePorts(ctx, "br-int", names); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+			}
+		})
+	}
+}
@@ -0,0 +1,594 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+// Package ovsdbmock is an in-process stand-in for ovsdb-server and
+// ovs-vswitchd, holding the Bridge, Port and Interface tables of the
+// Open_vSwitch database. It answers transact requests the way the real
+// server does, including blocking waits and garbage collection of
+// unreferenced ports, and hands out ofports to new interfaces so that the
+// agent's OVSDB client can be tested without Open vSwitch installed.
+package ovsdbmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DATABASE = "Open_vSwitch"
+
+// Columns each supported table starts with
+var defaults = map[string]map[string]interface{}{
+	"Bridge":    {"name": "", "ports": emptySet()},
+	"Port":      {"name": "", "interfaces": emptySet()},
+	"Interface": {"name": "", "type": "", "ofport": emptySet(), "error": emptySet()},
+}
+
+type Config struct {
+	// Delay before a new interface gets its ofport, as vswitchd would take
+	OfportDelay time.Duration
+}
+
+type row map[string]interface{}
+
+type Server struct {
+	mu           sync.Mutex
+	ofportDelay  time.Duration
+	tables       map[string]map[string]row
+	failures     map[string]string
+	lastOfport   int
+	transactions int
+	echoes       int
+	// Closed and replaced whenever the database changes, to wake waits
+	changed chan struct{}
+}
+
+// Creates a fake with the given bridges and no ports
+func New(config Config, bridges ...string) *Server {
+	s := &Server{
+		ofportDelay: config.OfportDelay,
+		tables:      make(map[string]map[string]row),
+		failures:    make(map[string]string),
+		changed:     make(chan struct{}),
+	}
+	for table := range defaults {
+		s.tables[table] = make(map[string]row)
+	}
+	for _, bridge := range bridges {
+		s.AddBridge(bridge)
+	}
+	return s
+}
+
+func (s *Server) AddBridge(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := uuid.New().String()
+	s.tables["Bridge"][id] = newRow("Bridge", id, row{"name": name})
+	s.notify()
+}
+
+// Makes vswitchd fail to create interfaces with this name, leaving them
+// with ofport -1 and the given error
+func (s *Server) FailInterface(name, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[name] = reason
+}
+
+// Returns the names of the ports on the bridge, sorted
+func (s *Server) Ports(bridge string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := []string{}
+	for _, b := range s.tables["Bridge"] {
+		if b["name"] != bridge {
+			continue
+		}
+		for _, id := range setElems(b["ports"]) {
+			if port, ok := s.tables["Port"][uuidOf(id)]; ok {
+				names = append(names, port["name"].(string))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Number of rows left in a table, to check garbage collection
+func (s *Server) Count(table string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tables[table])
+}
+
+// Returns the ofport of the named interface, false if it has none yet
+func (s *Server) Ofport(name string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, iface := range s.tables["Interface"] {
+		if iface["name"] == name {
+			ofport, ok := iface["ofport"].(float64)
+			return int(ofport), ok
+		}
+	}
+	return 0, false
+}
+
+// Number of transact requests received, including aborted ones
+func (s *Server) Transactions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transactions
+}
+
+// Number of echo requests the clients answered
+func (s *Server) Echoes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.echoes
+}
+
+// Listens on a free local TCP port. Returns the endpoint to dial, as
+// ovs-vsctl takes it, and a function that stops the server.
+func (s *Server) Start() (string, func(), error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	go s.Serve(listener)
+	return "tcp:" + listener.Addr().String(), func() { listener.Close() }, nil
+}
+
+// Serves connections on the listener until it is closed
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+type message struct {
+	Method string            `json:"method,omitempty"`
+	Params []json.RawMessage `json:"params,omitempty"`
+	Result interface{}       `json:"result,omitempty"`
+	Error  interface{}       `json:"error"`
+	ID     interface{}       `json:"id"`
+}
+
+type response struct {
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+	ID     interface{} `json:"id"`
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	var writeMu sync.Mutex
+	enc := json.NewEncoder(conn)
+	send := func(v interface{}) {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		enc.Encode(v)
+	}
+	// ovsdb-server checks idle clients with echo requests
+	send(map[string]interface{}{"method": "echo", "params": []interface{}{}, "id": "echo"})
+
+	dec := json.NewDecoder(conn)
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+		switch msg.Method {
+		case "":
+			if msg.ID == "echo" {
+				s.mu.Lock()
+				s.echoes++
+				s.mu.Unlock()
+			}
+		case "echo":
+			send(response{Result: msg.Params, ID: msg.ID})
+		case "list_dbs":
+			send(response{Result: []string{DATABASE}, ID: msg.ID})
+		case "transact":
+			// Transactions may block in a wait, so don't hold up the connection
+			go func(msg message) {
+				result, err := s.transact(msg.Params)
+				send(response{Result: result, Error: err, ID: msg.ID})
+			}(msg)
+		default:
+			send(response{Error: "unknown method", ID: msg.ID})
+		}
+	}
+}
+
+type opError struct {
+	Error   string `json:"error"`
+	Details string `json:"details,omitempty"`
+}
+
+type operation struct {
+	Op        string          `json:"op"`
+	Table     string          `json:"table"`
+	Row       row             `json:"row"`
+	Rows      []row           `json:"rows"`
+	Where     [][]interface{} `json:"where"`
+	Columns   []string        `json:"columns"`
+	Mutations [][]interface{} `json:"mutations"`
+	UUIDName  string          `json:"uuid-name"`
+	Timeout   *int            `json:"timeout"`
+	Until     string          `json:"until"`
+}
+
+// Runs a transaction, retrying it whenever the database changes while one
+// of its waits is unmet, until the wait's timeout
+func (s *Server) transact(params []json.RawMessage) (interface{}, interface{}) {
+	var db string
+	if len(params) == 0 || json.Unmarshal(params[0], &db) != nil || db != DATABASE {
+		return nil, "unknown database"
+	}
+	ops := make([]operation, len(params)-1)
+	for i, param := range params[1:] {
+		if err := json.Unmarshal(param, &ops[i]); err != nil {
+			return nil, err.Error()
+		}
+	}
+
+	s.mu.Lock()
+	s.transactions++
+	s.mu.Unlock()
+	start := time.Now()
+	for {
+		s.mu.Lock()
+		results, blocked, deadline := s.try(ops, start)
+		changed := s.changed
+		s.mu.Unlock()
+		if blocked < 0 {
+			return results, nil
+		}
+		select {
+		case <-changed:
+		case <-time.After(time.Until(deadline)):
+		}
+	}
+}
+
+// Runs the operations against a copy of the database and commits the copy
+// if all succeed. Returns the index of an unmet wait that hasn't timed out
+// yet, or -1.
+func (s *Server) try(ops []operation, start time.Time) ([]interface{}, int, time.Time) {
+	tables := make(map[string]map[string]row, len(s.tables))
+	for name, rows := range s.tables {
+		tables[name] = make(map[string]row, len(rows))
+		for id, r := range rows {
+			tables[name][id] = r.copy()
+		}
+	}
+	named := make(map[string]string)
+	results := make([]interface{}, 0, len(ops))
+	for i, op := range ops {
+		rows, ok := tables[op.Table]
+		if !ok {
+			return append(results, opError{Error: "unknown table", Details: op.Table}), -1, time.Time{}
+		}
+		where := resolve(op.Where, named)
+		switch op.Op {
+		case "insert":
+			id := uuid.New().String()
+			rows[id] = newRow(op.Table, id, resolve(op.Row, named).(row))
+			if op.UUIDName != "" {
+				named[op.UUIDName] = id
+			}
+			results = append(results, map[string]interface{}{"uuid": []interface{}{"uuid", id}})
+		case "select":
+			selected := []row{}
+			for _, r := range match(rows, where) {
+				selected = append(selected, r.project(op.Columns))
+			}
+			results = append(results, map[string]interface{}{"rows": selected})
+		case "delete":
+			matched := match(rows, where)
+			for _, r := range matched {
+				delete(rows, uuidOf(r["_uuid"]))
+			}
+			results = append(results, map[string]interface{}{"count": len(matched)})
+		case "mutate":
+			matched := match(rows, where)
+			for _, r := range matched {
+				for _, m := range op.Mutations {
+					if err := r.mutate(resolve(m, named).([]interface{})); err != nil {
+						return append(results, *err), -1, time.Time{}
+					}
+				}
+			}
+			results = append(results, map[string]interface{}{"count": len(matched)})
+		case "wait":
+			if waitMet(rows, where, op) {
+				results = append(results, map[string]interface{}{})
+				continue
+			}
+			// A wait without a timeout blocks indefinitely
+			timeout := time.Hour
+			if op.Timeout != nil {
+				timeout = time.Duration(*op.Timeout) * time.Millisecond
+			}
+			if deadline := start.Add(timeout); time.Now().Before(deadline) {
+				return nil, i, deadline
+			}
+			return append(results, opError{Error: "timed out"}), -1, time.Time{}
+		default:
+			return append(results, opError{Error: "not supported", Details: op.Op}), -1, time.Time{}
+		}
+	}
+	collect(tables)
+	for id := range tables["Interface"] {
+		if _, ok := s.tables["Interface"][id]; !ok {
+			s.plug(id)
+		}
+	}
+	s.tables = tables
+	s.notify()
+	return results, -1, time.Time{}
+}
+
+// Gives a newly committed interface its ofport once the delay is up, as
+// vswitchd would
+func (s *Server) plug(id string) {
+	time.AfterFunc(s.ofportDelay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		iface, ok := s.tables["Interface"][id]
+		if !ok {
+			return
+		}
+		if reason, failed := s.failures[iface["name"].(string)]; failed {
+			iface["ofport"] = float64(-1)
+			iface["error"] = reason
+		} else {
+			s.lastOfport++
+			iface["ofport"] = float64(s.lastOfport)
+		}
+		s.notify()
+	})
+}
+
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Drops ports no bridge refers to, then interfaces no port refers to
+func collect(tables map[string]map[string]row) {
+	for _, link := range []struct{ parent, column, child string }{
+		{"Bridge", "ports", "Port"},
+		{"Port", "interfaces", "Interface"},
+	} {
+		referenced := make(map[string]bool)
+		for _, r := range tables[link.parent] {
+			for _, id := range setElems(r[link.column]) {
+				referenced[uuidOf(id)] = true
+			}
+		}
+		for id := range tables[link.child] {
+			if !referenced[id] {
+				delete(tables[link.child], id)
+			}
+		}
+	}
+}
+
+func newRow(table, id string, values row) row {
+	r := row{"_uuid": []interface{}{"uuid", id}}
+	for column, value := range defaults[table] {
+		r[column] = value
+	}
+	for column, value := range values {
+		r[column] = value
+	}
+	return r
+}
+
+func (r row) copy() row {
+	c := make(row, len(r))
+	for column, value := range r {
+		c[column] = value
+	}
+	return c
+}
+
+func (r row) project(columns []string) row {
+	if len(columns) == 0 {
+		return r.copy()
+	}
+	p := make(row, len(columns))
+	for _, column := range columns {
+		p[column] = r[column]
+	}
+	return p
+}
+
+// Applies an insert or delete mutator to a set column
+func (r row) mutate(m []interface{}) *opError {
+	column, _ := m[0].(string)
+	mutator, _ := m[1].(string)
+	elems := setElems(r[column])
+	switch mutator {
+	case "insert":
+		for _, elem := range setElems(m[2]) {
+			if !contains(elems, elem) {
+				elems = append(elems, elem)
+			}
+		}
+	case "delete":
+		kept := []interface{}{}
+		remove := setElems(m[2])
+		for _, elem := range elems {
+			if !contains(remove, elem) {
+				kept = append(kept, elem)
+			}
+		}
+		elems = kept
+	default:
+		return &opError{Error: "not supported", Details: mutator}
+	}
+	r[column] = []interface{}{"set", elems}
+	return nil
+}
+
+func match(rows map[string]row, where interface{}) []row {
+	conditions, _ := where.([]interface{})
+	matched := []row{}
+	for _, r := range rows {
+		ok := true
+		for _, c := range conditions {
+			cond := c.([]interface{})
+			equal := equalValues(r[cond[0].(string)], cond[2])
+			if (cond[1] == "==") != equal {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+// Compares the selected columns of the matching rows with the expected
+// rows, in any order
+func waitMet(rows map[string]row, where interface{}, op operation) bool {
+	var got, want []string
+	for _, r := range match(rows, where) {
+		got = append(got, canonical(r.project(op.Columns)))
+	}
+	for _, r := range op.Rows {
+		want = append(want, canonical(r))
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	equal := fmt.Sprint(got) == fmt.Sprint(want)
+	if op.Until == "!=" {
+		return !equal
+	}
+	return equal
+}
+
+// Replaces named-uuids with the uuids inserted earlier in the transaction
+func resolve(value interface{}, named map[string]string) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) == 2 && v[0] == "named-uuid" {
+			return []interface{}{"uuid", named[v[1].(string)]}
+		}
+		resolved := make([]interface{}, len(v))
+		for i, elem := range v {
+			resolved[i] = resolve(elem, named)
+		}
+		return resolved
+	case [][]interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, elem := range v {
+			resolved[i] = resolve(elem, named)
+		}
+		return resolved
+	case row:
+		resolved := make(row, len(v))
+		for column, elem := range v {
+			resolved[column] = resolve(elem, named)
+		}
+		return resolved
+	}
+	return value
+}
+
+func emptySet() []interface{} {
+	return []interface{}{"set", []interface{}{}}
+}
+
+// Returns the atoms of a set, where a single atom is a set of one
+func setElems(value interface{}) []interface{} {
+	if v, ok := value.([]interface{}); ok && len(v) == 2 && v[0] == "set" {
+		elems, _ := v[1].([]interface{})
+		return elems
+	}
+	if value == nil {
+		return nil
+	}
+	return []interface{}{value}
+}
+
+func uuidOf(value interface{}) string {
+	if v, ok := value.([]interface{}); ok && len(v) == 2 && v[0] == "uuid" {
+		id, _ := v[1].(string)
+		return id
+	}
+	return ""
+}
+
+func contains(elems []interface{}, elem interface{}) bool {
+	for _, e := range elems {
+		if equalValues(e, elem) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalValues(a, b interface{}) bool {
+	return canonical(a) == canonical(b)
+}
+
+// Encodes a value so that equal OVSDB values encode the same, treating
+// an atom and a set of one as equal and ignoring set order
+func canonical(value interface{}) string {
+	switch v := value.(type) {
+	case row:
+		columns := make([]string, 0, len(v))
+		for column := range v {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		out := ""
+		for _, column := range columns {
+			out += column + "=" + canonical(v[column]) + ";"
+		}
+		return out
+	case map[string]interface{}:
+		return canonical(row(v))
+	case []interface{}:
+		if len(v) == 2 && v[0] == "set" {
+			elems := setElems(v)
+			if len(elems) == 1 {
+				return canonical(elems[0])
+			}
+			encoded := make([]string, len(elems))
+			for i, elem := range elems {
+				encoded[i] = canonical(elem)
+			}
+			sort.Strings(encoded)
+			return fmt.Sprint(encoded)
+		}
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
@@ -0,0 +1,223 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+// Package ovsdb is a small OVSDB (RFC 7047) client for adding and removing
+// the agent's ports on the local Open vSwitch, without forking ovs-vsctl.
+package ovsdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	DATABASE = "Open_vSwitch"
+
+	TABLE_BRIDGE    = "Bridge"
+	TABLE_PORT      = "Port"
+	TABLE_INTERFACE = "Interface"
+)
+
+// An operation inside a transact request. Only the fields used by the
+// given op are sent.
+type Operation struct {
+	Op        string      `json:"op"`
+	Table     string      `json:"table,omitempty"`
+	Row       Row         `json:"row,omitempty"`
+	Rows      []Row       `json:"rows,omitempty"`
+	Where     []Condition `json:"where,omitempty"`
+	Columns   []string    `json:"columns,omitempty"`
+	Mutations []Mutation  `json:"mutations,omitempty"`
+	UUIDName  string      `json:"uuid-name,omitempty"`
+	Timeout   *int        `json:"timeout,omitempty"`
+	Until     string      `json:"until,omitempty"`
+}
+
+func (o Operation) MarshalJSON() ([]byte, error) {
+	// Without the method set, so that the conversion doesn't recurse
+	type operation Operation
+	op := struct {
+		operation
+		// Required by these ops even when empty, where an empty where
+		// matches every row
+		Where *[]Condition `json:"where,omitempty"`
+		Rows  *[]Row       `json:"rows,omitempty"`
+	}{operation: operation(o)}
+	switch o.Op {
+	case "select", "update", "mutate", "delete", "wait":
+		op.Where = &o.Where
+		if o.Where == nil {
+			op.Where = &[]Condition{}
+		}
+	}
+	if o.Op == "wait" {
+		op.Rows = &o.Rows
+		if o.Rows == nil {
+			op.Rows = &[]Row{}
+		}
+	}
+	return json.Marshal(op)
+}
+
+// A row of column values in OVSDB JSON notation
+type Row map[string]interface{}
+
+// A [column, function, value] triple, e.g. ["name", "==", "br-int"]
+type Condition [3]interface{}
+
+func Equal(column string, value interface{}) Condition {
+	return Condition{column, "==", value}
+}
+
+// A [column, mutator, value] triple, e.g. ["ports", "insert", set]
+type Mutation [3]interface{}
+
+// The result of a single operation. Error is set if the operation failed,
+// in which case the transaction was aborted.
+type OperationResult struct {
+	Count   int    `json:"count,omitempty"`
+	UUID    UUID   `json:"uuid,omitempty"`
+	Rows    []Row  `json:"rows,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Details string `json:"details,omitempty"`
+}
+
+// A row UUID, ["uuid", "<id>"] on the wire
+type UUID string
+
+func (u UUID) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string{"uuid", string(u)})
+}
+
+func (u *UUID) UnmarshalJSON(data []byte) error {
+	var pair []string
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 || pair[0] != "uuid" {
+		return fmt.Errorf("invalid uuid %s", string(data))
+	}
+	*u = UUID(pair[1])
+	return nil
+}
+
+// A reference to a row inserted earlier in the same transaction
+type NamedUUID string
+
+func (n NamedUUID) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string{"named-uuid", string(n)})
+}
+
+// A set of atoms, ["set", [...]] on the wire
+type Set []interface{}
+
+func (s Set) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		s = Set{}
+	}
+	return json.Marshal([]interface{}{"set", []interface{}(s)})
+}
+
+// Returns the integer in a column that holds at most one integer, such as
+// ofport. ok is false if the column is empty.
+func Integer(value interface{}) (n int, ok bool) {
+	switch v := value.(type) {
+	case float64:
+		return int(v), true
+	case []interface{}:
+		if len(v) == 2 && v[0] == "set" {
+			if atoms, _ := v[1].([]interface{}); len(atoms) == 1 {
+				return Integer(atoms[0])
+			}
+		}
+	}
+	return 0, false
+}
+
+// Returns the string in a column that holds at most one string, such as
+// an Interface's error.
+func String(value interface{}) (s string, ok bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []interface{}:
+		if len(v) == 2 && v[0] == "set" {
+			if atoms, _ := v[1].([]interface{}); len(atoms) == 1 {
+				return String(atoms[0])
+			}
+		}
+	}
+	return "", false
+}
+
+// Returns the atoms of a set column, where a single atom is a set of one
+func setAtoms(value interface{}) []interface{} {
+	if v, ok := value.([]interface{}); ok && len(v) == 2 && v[0] == "set" {
+		atoms, _ := v[1].([]interface{})
+		return atoms
+	}
+	if value == nil {
+		return nil
+	}
+	return []interface{}{value}
+}
+
+// Returns the id of a ["uuid", "<id>"] value
+func RowUUID(value interface{}) (UUID, bool) {
+	pair, ok := value.([]interface{})
+	if !ok || len(pair) != 2 || pair[0] != "uuid" {
+		return "", false
+	}
+	id, ok := pair[1].(string)
+	return UUID(id), ok
+}
+
+// Returned when one of the operations in a transaction failed
+type TransactionError struct {
+	// Index of the failed operation, or len(ops) if the commit failed
+	Op      int
+	Reason  string
+	Details string
+}
+
+func (e *TransactionError) Error() string {
+	if e.Details == "" {
+		return fmt.Sprintf("ovsdb operation %d failed: %s", e.Op, e.Reason)
+	}
+	return fmt.Sprintf("ovsdb operation %d failed: %s: %s", e.Op, e.Reason, e.Details)
+}
+
+var ErrClosed = errors.New("ovsdb connection closed")
+
+type request struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+	ID     interface{}   `json:"id"`
+}
+
+type response struct {
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+	ID     interface{} `json:"id"`
+}
+
+// Any message on the wire. Requests and notifications have a method,
+// responses don't.
+type message struct {
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  interface{}     `json:"error,omitempty"`
+	ID     interface{}     `json:"id"`
+}
@@ -15,23 +15,36 @@ package activities
 
 import (
 	"context"
+	"time"
 
 	agent_pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
 	"github.com/futurewei-cloud/merak/services/merak-compute/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
+	"github.com/go-redis/redis/v9"
 	"go.temporal.io/sdk/activity"
 )
 
 // Calls ovsdb bulk port add
 func PortBulkCreate(ctx context.Context, vms []string, podIP string) error {
 	logger := activity.GetLogger(ctx)
+	defer recordStage(ctx, logger, entities.VM_STAGE_BULK_PORT, podIP, time.Now(), vms...)
 
 	client := common.ClientMapGRPC[podIP]
 	ports := agent_pb.BulkPorts{}
 	logger.Info("PortBulkCreate: Sending to agent at " + podIP)
+	// Tap names of all VMs in one round trip
+	pipe := common.RedisClient.Pipeline()
+	cmds := make([]*redis.StringCmd, len(vms))
+	for i, vmID := range vms {
+		cmds[i] = pipe.HGet(ctx, vmID, "deviceID")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		logger.Info("PortBulkCreate: Failed to get tap names from DB", err)
+		return err
+	}
 	tapNames := []string{}
-	for _, vmID := range vms {
-		tapName := common.RedisClient.HGet(ctx, vmID, "deviceID").Val()
-		tapNames = append(tapNames, tapName)
+	for _, cmd := range cmds {
+		tapNames = append(tapNames, cmd.Val())
 	}
 	ports.Tapnames = tapNames
 
@@ -0,0 +1,39 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package activities
+
+import (
+	"context"
+	"time"
+
+	"github.com/futurewei-cloud/merak/services/merak-compute/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
+	merakwf "github.com/futurewei-cloud/merak/services/merak-compute/workflows"
+	"go.temporal.io/sdk/log"
+)
+
+// Records that the VMs went through a stage from start until now, in their
+// hashes for compute INFO and in the stage latency histogram of the pod.
+// Failed stages are recorded as well, INFO tells them apart by status.
+func recordStage(ctx context.Context, logger log.Logger, stage string, podIP string, start time.Time, vmIDs ...string) {
+	end := time.Now()
+	merakwf.StageMetrics.Observe(stage, podIP, end.Sub(start))
+	pipe := common.RedisClient.Pipeline()
+	for _, vmID := range vmIDs {
+		entities.HSetStage(ctx, pipe, vmID, stage, start, end)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Info("Failed to record stage "+stage+" of VMs in DB", err)
+	}
+}
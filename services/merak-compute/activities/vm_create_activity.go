@@ -16,36 +16,45 @@ package activities
 import (
 	"context"
 	"strconv"
+	"time"
 
 	agent_pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
 	commonPB "github.com/futurewei-cloud/merak/api/proto/v1/common"
 	"github.com/futurewei-cloud/merak/services/merak-compute/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
+	merakwf "github.com/futurewei-cloud/merak/services/merak-compute/workflows"
 	"go.temporal.io/sdk/activity"
 )
 
 // Creates a VM given by the vmID
 func VmCreate(ctx context.Context, vmID string, podIP string) error {
 	logger := activity.GetLogger(ctx)
+	defer recordStage(ctx, logger, entities.VM_STAGE_CREATE, podIP, time.Now(), vmID)
 	logger.Info("Final VMCreate: Starting create activity for VM " + vmID)
 
+	vm, err := entities.GetVM(ctx, &common.RedisClient, vmID)
+	if err != nil {
+		logger.Error("Final VMCreate: Failed to get VM " + vmID + " from DB")
+		return err
+	}
 	client := common.ClientMapGRPC[podIP]
 	logger.Info("Final VMCreate: Sending to agent at " + podIP)
 	port := agent_pb.InternalPortConfig{
 		OperationType: commonPB.OperationType_CREATE,
 		Id:            vmID,
-		Name:          common.RedisClient.HGet(ctx, vmID, "name").Val(),
-		Vpcid:         common.RedisClient.HGet(ctx, vmID, "vpc").Val(),
-		Tenantid:      common.RedisClient.HGet(ctx, vmID, "tenantID").Val(),
-		Projectid:     common.RedisClient.HGet(ctx, vmID, "projectID").Val(),
-		Subnetid:      common.RedisClient.HGet(ctx, vmID, "subnetID").Val(),
-		Gw:            common.RedisClient.HGet(ctx, vmID, "gw").Val(),
-		Sg:            common.RedisClient.HGet(ctx, vmID, "sg").Val(),
-		Cidr:          common.RedisClient.HGet(ctx, vmID, "cidr").Val(),
-		Hostname:      common.RedisClient.HGet(ctx, vmID, "hostname").Val(),
-		Deviceid:      common.RedisClient.HGet(ctx, vmID, "deviceID").Val(),
-		Ip:            common.RedisClient.HGet(ctx, vmID, "ip").Val(),
-		Mac:           common.RedisClient.HGet(ctx, vmID, "mac").Val(),
-		Remoteid:      common.RedisClient.HGet(ctx, vmID, "remoteID").Val(),
+		Name:          vm.Name,
+		Vpcid:         vm.VPC,
+		Tenantid:      vm.TenantID,
+		Projectid:     vm.ProjectID,
+		Subnetid:      vm.SubnetID,
+		Gw:            vm.Gateway,
+		Sg:            vm.SecurityGroup,
+		Cidr:          vm.CIDR,
+		Hostname:      vm.HostName,
+		Deviceid:      vm.DeviceID,
+		Ip:            vm.IP,
+		Mac:           vm.MAC,
+		Remoteid:      vm.RemoteID,
 	}
 	resp, err := client.PortHandler(ctx, &port)
 	if err != nil {
@@ -55,6 +64,8 @@ func VmCreate(ctx context.Context, vmID string, podIP string) error {
 			vmID,
 			"status",
 			"5",
+			"reason",
+			err.Error(),
 		).Err(); err != nil {
 			logger.Info("Final VMCreate: Failed to add vm response to DB!")
 			return err
@@ -78,6 +89,22 @@ func VmCreate(ctx context.Context, vmID string, podIP string) error {
 			logger.Info("Final VMCreate: Failed to add vm response to DB!")
 			return err
 		}
+		if vm.GeneratedAt != 0 {
+			merakwf.StageMetrics.Observe(entities.VM_READY, podIP, time.Since(time.UnixMilli(vm.GeneratedAt)))
+		}
+	} else {
+		// Keep the agent's answer so that INFO can tell why the VM failed
+		if err := common.RedisClient.HSet(
+			ctx,
+			vmID,
+			"status",
+			"5",
+			"reason",
+			resp.GetReturnMessage(),
+		).Err(); err != nil {
+			logger.Info("Final VMCreate: Failed to add vm response to DB!")
+			return err
+		}
 	}
 	logger.Info("Final VMCreate: Response from agent at address " + podIP + ": " + resp.GetReturnMessage())
 	return nil
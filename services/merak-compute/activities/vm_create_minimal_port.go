@@ -15,32 +15,40 @@ package activities
 
 import (
 	"context"
+	"time"
 
 	agent_pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
 	commonPB "github.com/futurewei-cloud/merak/api/proto/v1/common"
 	"github.com/futurewei-cloud/merak/services/merak-compute/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
 	"go.temporal.io/sdk/activity"
 )
 
 // Creates a VM given by the vmID
 func VmCreateMinimalPort(ctx context.Context, vmID string, podIP string) error {
 	logger := activity.GetLogger(ctx)
+	defer recordStage(ctx, logger, entities.VM_STAGE_MINIMAL_PORT, podIP, time.Now(), vmID)
 	logger.Info("VmCreateMinimalPort: Starting create activity for VM " + vmID)
 
+	vm, err := entities.GetVM(ctx, &common.RedisClient, vmID)
+	if err != nil {
+		logger.Error("VmCreateMinimalPort: Failed to get VM " + vmID + " from DB")
+		return err
+	}
 	client := common.ClientMapGRPC[podIP]
 	logger.Info("VmCreateMinimalPort: Sending to agent at " + podIP)
 	port := agent_pb.InternalPortConfig{
 		OperationType: commonPB.OperationType_PRECREATE,
 		Id:            vmID,
-		Name:          common.RedisClient.HGet(ctx, vmID, "name").Val(),
-		Vpcid:         common.RedisClient.HGet(ctx, vmID, "vpc").Val(),
-		Tenantid:      common.RedisClient.HGet(ctx, vmID, "tenantID").Val(),
-		Projectid:     common.RedisClient.HGet(ctx, vmID, "projectID").Val(),
-		Subnetid:      common.RedisClient.HGet(ctx, vmID, "subnetID").Val(),
-		Gw:            common.RedisClient.HGet(ctx, vmID, "gw").Val(),
-		Sg:            common.RedisClient.HGet(ctx, vmID, "sg").Val(),
-		Cidr:          common.RedisClient.HGet(ctx, vmID, "cidr").Val(),
-		Hostname:      common.RedisClient.HGet(ctx, vmID, "hostname").Val(),
+		Name:          vm.Name,
+		Vpcid:         vm.VPC,
+		Tenantid:      vm.TenantID,
+		Projectid:     vm.ProjectID,
+		Subnetid:      vm.SubnetID,
+		Gw:            vm.Gateway,
+		Sg:            vm.SecurityGroup,
+		Cidr:          vm.CIDR,
+		Hostname:      vm.HostName,
 	}
 	resp, err := client.PortHandler(ctx, &port)
 	if err != nil {
@@ -50,6 +58,8 @@ func VmCreateMinimalPort(ctx context.Context, vmID string, podIP string) error {
 			vmID,
 			"status",
 			"5",
+			"reason",
+			err.Error(),
 		).Err(); err != nil {
 			logger.Info("VmCreateMinimalPort: Failed to add vm response to DB!")
 			return err
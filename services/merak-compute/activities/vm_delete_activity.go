@@ -23,16 +23,22 @@ import (
 	constants "github.com/futurewei-cloud/merak/services/common"
 
 	"github.com/futurewei-cloud/merak/services/merak-compute/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
 	"go.temporal.io/sdk/activity"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-// Deletes a VM given by the vmID
-func VmDelete(ctx context.Context, vmID string) (string, error) {
+// Deletes a VM given by the vmID from the compute config given by configID
+func VmDelete(ctx context.Context, vmID string, configID string) (string, error) {
 	logger := activity.GetLogger(ctx)
 
-	podIP := common.RedisClient.HGet(ctx, vmID, "hostIP").Val()
+	vm, err := entities.GetVM(ctx, &common.RedisClient, vmID)
+	if err != nil {
+		logger.Error("VMDelete: Failed to get VM " + vmID + " from DB")
+		return vmID, err
+	}
+	podIP := vm.HostIP
 	var agent_address strings.Builder
 	agent_address.Reset()
 	agent_address.WriteString(podIP)
@@ -46,10 +52,10 @@ func VmDelete(ctx context.Context, vmID string) (string, error) {
 	client := agentPB.NewMerakAgentServiceClient(conn)
 	port := agentPB.InternalPortConfig{
 		OperationType: commonPB.OperationType_DELETE,
-		Name:          common.RedisClient.HGet(ctx, vmID, "name").Val(),
-		Projectid:     common.RedisClient.HGet(ctx, vmID, "projectID").Val(),
-		Deviceid:      common.RedisClient.HGet(ctx, vmID, "deviceID").Val(),
-		Remoteid:      common.RedisClient.HGet(ctx, vmID, "remoteID").Val(),
+		Name:          vm.Name,
+		Projectid:     vm.ProjectID,
+		Deviceid:      vm.DeviceID,
+		Remoteid:      vm.RemoteID,
 	}
 	logger.Info("VMDelete: Sending to agent: ", podIP)
 	resp, err := client.PortHandler(ctx, &port)
@@ -57,8 +63,8 @@ func VmDelete(ctx context.Context, vmID string) (string, error) {
 		logger.Error("VMDelete: Unable delete vm ID " + podIP + "Reason: " + resp.GetReturnMessage() + "\n")
 		return vmID, err
 	}
-	common.RedisClient.HDel(ctx, vmID)                                 // VM Detail hashmap
-	common.RedisClient.SRem(ctx, constants.COMPUTE_REDIS_VM_SET, vmID) // Set of all VM IDs
+	common.RedisClient.Del(ctx, vmID)                                       // VM Detail hashmap
+	common.RedisClient.SRem(ctx, constants.ComputeVMSetKey(configID), vmID) // Set of the config's VM IDs
 
 	return vmID, nil
 }
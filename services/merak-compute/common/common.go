@@ -14,6 +14,7 @@ Copyright(c) 2022 Futurewei Cloud
 package common
 
 import (
+	"strconv"
 	"time"
 
 	agent_pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
@@ -52,4 +53,21 @@ const (
 
 	COMPUTE_REDIS_POOL_SIZE    = 10000
 	COMPUTE_REDIS_POOL_TIMEOUT = time.Second * 60
+
+	// VMs returned by an INFO request without a limit, and VM hashes read
+	// from Redis per pipeline while answering it
+	VM_INFO_DEFAULT_LIMIT = 1000
+	VM_INFO_BATCH_SIZE    = 1000
+
+	// VMs written to Redis per pipeline when they are generated
+	VM_STORE_BATCH_SIZE = 1000
 )
+
+// Workflow ID of the nth pod of a compute config, so that the workflows of
+// concurrent deployments don't collide in Temporal
+func WorkflowID(prefix, configID string, n int) string {
+	if configID == "" {
+		return prefix + strconv.Itoa(n)
+	}
+	return prefix + "-" + configID + "-" + strconv.Itoa(n)
+}
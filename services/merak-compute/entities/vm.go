@@ -22,26 +22,54 @@ import (
 	"time"
 
 	"github.com/futurewei-cloud/merak/services/common/datastore"
+	"github.com/go-redis/redis/v9"
 )
 
+// The redis tags are the fields of the VM hash merak-compute keeps in Redis
 type VM struct {
-	ID            string
-	Name          string
-	VPC           string
-	SubnetID      string
-	TenantID      string
-	ProjectID     string
-	CIDR          string
-	Gateway       string
-	SecurityGroup string
-	HostIP        string
-	HostMAC       string
-	HostName      string
-	Status        string
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	ID            string    `redis:"id"`
+	Name          string    `redis:"name"`
+	VPC           string    `redis:"vpc"`
+	SubnetID      string    `redis:"subnetID"`
+	TenantID      string    `redis:"tenantID"`
+	ProjectID     string    `redis:"projectID"`
+	CIDR          string    `redis:"cidr"`
+	Gateway       string    `redis:"gw"`
+	SecurityGroup string    `redis:"sg"`
+	HostIP        string    `redis:"hostIP"`
+	HostMAC       string    `redis:"hostmac"`
+	HostName      string    `redis:"hostname"`
+	Status        string    `redis:"status"`
+	IP            string    `redis:"ip"`
+	MAC           string    `redis:"mac"`
+	DeviceID      string    `redis:"deviceID"`
+	RemoteID      string    `redis:"remoteID"`
+	Reason        string    `redis:"reason"`
+	CreatedAt     time.Time `redis:"-"`
+	UpdatedAt     time.Time `redis:"-"`
+
+	// Timeline of the VM in Unix milliseconds, see HSetStage
+	GeneratedAt      int64 `redis:"generatedAt"`
+	MinimalPortStart int64 `redis:"minimalPortStart"`
+	MinimalPortEnd   int64 `redis:"minimalPortEnd"`
+	BulkPortStart    int64 `redis:"bulkPortStart"`
+	BulkPortEnd      int64 `redis:"bulkPortEnd"`
+	CreateStart      int64 `redis:"createStart"`
+	CreateEnd        int64 `redis:"createEnd"`
 }
 
+// Stages of creating a VM: the Alcor port create, the bulk OVSDB port add
+// and the final create of the netns and port update on the agent
+const (
+	VM_STAGE_MINIMAL_PORT = "minimalPort"
+	VM_STAGE_BULK_PORT    = "bulkPort"
+	VM_STAGE_CREATE       = "create"
+
+	// Not a stage of its own, but the time from generating a VM until its
+	// final create is done
+	VM_READY = "ready"
+)
+
 // Create a new VM with timestamps
 func NewVM(
 	ID,
@@ -74,6 +102,7 @@ func NewVM(
 		CreatedAt:     time.Now().Round(0), // Strip monotonic clock reading
 		UpdatedAt:     time.Now().Round(0), // Strip monotonic clock reading
 	}
+	v.GeneratedAt = v.CreatedAt.UnixMilli()
 	return v
 }
 
@@ -99,3 +128,55 @@ func GetVMStore(ctx context.Context, id string, field string, datastore *datasto
 	_ = json.Unmarshal(vString, &vm) // Should never fail
 	return &vm, nil
 }
+
+// Writes the VM to its hash, keyed by the VM ID. cmd may be a pipeline, so
+// that many VMs go out in one round trip. The port and agent fields are
+// only written when set, as they are filled in by the activities.
+func (v *VM) HSet(ctx context.Context, cmd redis.Cmdable) *redis.IntCmd {
+	fields := []interface{}{
+		"id", v.ID,
+		"name", v.Name,
+		"vpc", v.VPC,
+		"tenantID", v.TenantID,
+		"projectID", v.ProjectID,
+		"subnetID", v.SubnetID,
+		"cidr", v.CIDR,
+		"gw", v.Gateway,
+		"sg", v.SecurityGroup,
+		"hostIP", v.HostIP,
+		"hostmac", v.HostMAC,
+		"hostname", v.HostName,
+		"status", v.Status,
+	}
+	if v.GeneratedAt != 0 {
+		fields = append(fields, "generatedAt", v.GeneratedAt)
+	}
+	for _, field := range []struct{ name, value string }{
+		{"ip", v.IP},
+		{"mac", v.MAC},
+		{"deviceID", v.DeviceID},
+		{"remoteID", v.RemoteID},
+		{"reason", v.Reason},
+	} {
+		if field.value != "" {
+			fields = append(fields, field.name, field.value)
+		}
+	}
+	return cmd.HSet(ctx, v.ID, fields...)
+}
+
+// Records when a VM entered and left a stage, as the <stage>Start and
+// <stage>End fields of its hash
+func HSetStage(ctx context.Context, cmd redis.Cmdable, id string, stage string, start time.Time, end time.Time) *redis.IntCmd {
+	return cmd.HSet(ctx, id, stage+"Start", start.UnixMilli(), stage+"End", end.UnixMilli())
+}
+
+// Reads a VM from its hash with a single HGETALL. A VM that doesn't exist
+// comes back with every field empty.
+func GetVM(ctx context.Context, cmd redis.Cmdable, id string) (*VM, error) {
+	var vm VM
+	if err := cmd.HGetAll(ctx, id).Scan(&vm); err != nil {
+		return nil, err
+	}
+	return &vm, nil
+}
@@ -129,3 +129,60 @@ func TestVMDBFail(t *testing.T) {
 	_, err := GetVMStore(ctx, v0.ID, "1", &datastore)
 	assert.Error(t, err)
 }
+
+func TestVMHash(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	v0 := NewVM("vm0", "v000", "vpc0", "subnet0", "tenant", "project", "10.0.0.0/16",
+		"10.0.0.1", "sg", "10.200.0.1", "aa:bb:cc:dd:ee:ff", "vhost-0", "1")
+	v0.IP = "10.0.0.2"
+
+	assert.Nil(t, v0.HSet(ctx, client).Err())
+	fields := client.HGetAll(ctx, "vm0").Val()
+	assert.Equal(t, "10.0.0.1", fields["gw"])
+	assert.Equal(t, "10.0.0.2", fields["ip"])
+	// Unset agent fields are left to the activities
+	assert.NotContains(t, fields, "remoteID")
+
+	client.HSet(ctx, "vm0", "status", "6", "remoteID", "remote")
+	v1, err := GetVM(ctx, client, "vm0")
+	assert.Nil(t, err)
+	assert.Equal(t, "v000", v1.Name)
+	assert.Equal(t, "sg", v1.SecurityGroup)
+	assert.Equal(t, "6", v1.Status)
+	assert.Equal(t, "remote", v1.RemoteID)
+
+	v2, err := GetVM(ctx, client, "vm9")
+	assert.Nil(t, err)
+	assert.Equal(t, "", v2.ID)
+}
+
+// Reading a VM with one HGETALL against one HGET per field, as the
+// activities used to
+func BenchmarkGetVM(b *testing.B) {
+	ctx := context.Background()
+	server, _ := miniredis.Run()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	v0 := NewVM("vm0", "v000", "vpc0", "subnet0", "tenant", "project", "10.0.0.0/16",
+		"10.0.0.1", "sg", "10.200.0.1", "aa:bb:cc:dd:ee:ff", "vhost-0", "1")
+	v0.HSet(ctx, client)
+	fields := []string{"name", "vpc", "tenantID", "projectID", "subnetID", "gw", "sg", "cidr",
+		"hostname", "deviceID", "ip", "mac", "remoteID"}
+
+	b.Run("hgetall", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := GetVM(ctx, client, "vm0"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("hget", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, field := range fields {
+				client.HGet(ctx, "vm0", field)
+			}
+		}
+	})
+}
@@ -16,6 +16,7 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"strconv"
 	"time"
@@ -26,7 +27,9 @@ import (
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
 	constants "github.com/futurewei-cloud/merak/services/common"
 	"github.com/futurewei-cloud/merak/services/merak-compute/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
 	"github.com/futurewei-cloud/merak/services/merak-compute/workflows/create"
+	"github.com/go-redis/redis/v9"
 	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/temporal"
 )
@@ -40,12 +43,58 @@ func caseCreate(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.Retu
 	}
 	log.Println("Operation Create")
 	returnVMs := []*pb.InternalVMInfo{}
+	// The seed is picked here so that placement and pacing can be repeated
+	// from the log
+	seed := in.Config.VmDeploy.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("Deploying VMs with seed %d", seed)
+	placement, err := placeVMs(in.Config, seed)
+	if err != nil {
+		return &pb.ReturnComputeMessage{
+			ReturnMessage: "Unable to place VMs: " + err.Error(),
+			ReturnCode:    commonPB.ReturnCode_FAILED,
+		}, err
+	}
+	if err := placement.checkPorts(in.Config.VmDeploy.Vpcs); err != nil {
+		return &pb.ReturnComputeMessage{
+			ReturnMessage: "Not enough ports: " + err.Error(),
+			ReturnCode:    commonPB.ReturnCode_FAILED,
+		}, err
+	}
+	configID := in.Config.ComputeConfigId
+	for n, pod := range in.Config.Pods {
+		// The last VM of every subnet has the longest name
+		var names []string
+		for i := range placement[n] {
+			for j, count := range placement[n][i] {
+				if count > 0 {
+					names = append(names, constants.ComputeVMName(configID, vmSuffix(i, j, count-1)))
+				}
+			}
+		}
+		if err := checkVMNames(ctx, configID, pod.Id, names); err != nil {
+			return &pb.ReturnComputeMessage{
+				ReturnMessage: "Unable to name VMs: " + err.Error(),
+				ReturnCode:    commonPB.ReturnCode_FAILED,
+			}, err
+		}
+	}
+	// Ports of every subnet already handed out to earlier pods
+	portOffsets := make([][]int, len(in.Config.VmDeploy.Vpcs))
+	for i, vpc := range in.Config.VmDeploy.Vpcs {
+		portOffsets[i] = make([]int, len(vpc.Subnets))
+	}
+	total := placement.total()
+	// Arrival order of the VMs on every pod, drawn from the same seed
+	rng := rand.New(rand.NewSource(seed))
 	// Add pods to DB
 	count := 0
 	for n, pod := range in.Config.Pods {
 		if err := RedisClient.HSet(
 			ctx,
-			pod.Id,
+			constants.ComputePodKey(configID, pod.Id),
 			"name", pod.Name,
 			"ip", pod.ContainerIp,
 			"mac", pod.Mac,
@@ -60,7 +109,7 @@ func caseCreate(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.Retu
 		log.Println("Added pod " + pod.Name + " at address " + pod.ContainerIp)
 		if err := RedisClient.SAdd(
 			ctx,
-			constants.COMPUTE_REDIS_NODE_IP_SET,
+			constants.ComputeNodeIPSetKey(configID),
 			pod.Id,
 		).Err(); err != nil {
 			return &pb.ReturnComputeMessage{
@@ -68,47 +117,69 @@ func caseCreate(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.Retu
 				ReturnCode:    commonPB.ReturnCode_FAILED,
 			}, err
 		}
-		vms := []string{}
+		newVMs := []*entities.VM{}
 		for i, vpc := range in.Config.VmDeploy.Vpcs {
 			for j, subnet := range vpc.Subnets {
-				for k := 0; k < int(subnet.NumberVms); k++ {
-					generateVMs(i, j, k,
-						vpc.VpcId, vpc.ProjectId, vpc.TenantId, subnet.SubnetId,
-						subnet.SubnetCidr, subnet.SubnetGw, in.Config.VmDeploy.Secgroups[0],
-						pod.Id, pod.Name, pod.ContainerIp, pod.Mac, ctx, &vms)
+				for k := 0; k < placement[n][i][j]; k++ {
+					// Ports handed out by merak-network in standalone mode, shared
+					// out across pods in order
+					var port *commonPB.InternalPortInfo
+					if len(subnet.Ports) > 0 {
+						port = subnet.Ports[portOffsets[i][j]+k]
+					}
+					newVMs = append(newVMs, newVM(i, j, k, vpc, subnet, in.Config.VmDeploy.Secgroups[0], configID, pod, port))
 				}
+				portOffsets[i][j] += placement[n][i][j]
 			}
 		}
-		// Shuffle the VMs
-		rand.Seed(time.Now().UnixNano())
-		rand.Shuffle(len(vms), func(i, j int) {
-			vms[i], vms[j] = vms[j], vms[i]
-		})
-		if err := RedisClient.SAdd(
-			ctx,
-			constants.COMPUTE_REDIS_VM_SET,
-			vms,
-		).Err(); err != nil {
+		// Cold pods of a SKEW or ASSIGN placement may get no VMs at all
+		if len(newVMs) == 0 {
+			log.Println("No VMs placed on pod at " + pod.ContainerIp)
+			continue
+		}
+		if err := claimVMNames(ctx, configID, pod.Id); err != nil {
+			return &pb.ReturnComputeMessage{
+				ReturnMessage: "Unable to claim VM names of pod in DB",
+				ReturnCode:    commonPB.ReturnCode_FAILED,
+				Vms:           returnVMs,
+			}, err
+		}
+		if err := storeVMs(ctx, configID, pod.Id, newVMs); err != nil {
 			return &pb.ReturnComputeMessage{
 				ReturnMessage: "Failed to add vm list to redis!",
 				ReturnCode:    commonPB.ReturnCode_FAILED,
 				Vms:           returnVMs,
 			}, err
 		}
+		vms := make([]string, len(newVMs))
+		for index, vm := range newVMs {
+			vms[index] = vm.ID
+		}
+		// Shuffle the VMs
+		rng.Shuffle(len(vms), func(i, j int) {
+			vms[i], vms[j] = vms[j], vms[i]
+		})
 		// Execute VM creation on a per pod basis
 		// Send a list of VMs to the Workflow
 		workflowOptions = client.StartWorkflowOptions{
-			ID:                       common.VM_CREATE_WORKFLOW_ID + strconv.Itoa(n),
+			ID:                       common.WorkflowID(common.VM_CREATE_WORKFLOW_ID, configID, n),
 			TaskQueue:                pod.Hostname,
 			RetryPolicy:              retrypolicy,
 			WorkflowExecutionTimeout: common.TEMPORAL_WF_EXEC_TIMEOUT,
 			WorkflowRunTimeout:       common.TEMPORAL_WF_RUN_TIMEOUT,
 			WorkflowTaskTimeout:      common.TEMPORAL_WF_TASK_TIMEOUT,
 		}
+		// Every pod gets its share of the requested rate, and its own
+		// sequence of random arrivals
+		schedule := create.Schedule{
+			Type: in.Config.VmDeploy.Scheduler,
+			Rps:  in.Config.VmDeploy.Rps * float64(len(vms)) / float64(total),
+			Seed: seed + int64(n),
+		}
 		num_vms := strconv.Itoa(len(vms))
 		count += len(vms)
 		log.Println("Executing VM Create Workflow with VMs " + num_vms + " on pod at " + pod.ContainerIp)
-		_, err := TemporalClient.ExecuteWorkflow(context.Background(), workflowOptions, create.Create, vms, pod.ContainerIp)
+		_, err := TemporalClient.ExecuteWorkflow(context.Background(), workflowOptions, create.Create, vms, pod.ContainerIp, schedule)
 		if err != nil {
 			return &pb.ReturnComputeMessage{
 				ReturnMessage: "Unable to execute create workflow",
@@ -129,37 +200,95 @@ func caseCreate(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.Retu
 	}, nil
 }
 
-func generateVMs(i, j, k int,
-	vpcID, vpcProjectID, vpcTenantID, subnetID, subnetCidr, subnetGw, secgroup,
-	podID, podName, podContainerIP, podMAC string,
-	ctx context.Context,
-	vms *[]string) error {
-	vmID := podID + strconv.Itoa(i) + strconv.Itoa(j) + strconv.Itoa(k)
-	suffix := strconv.Itoa(i) + strconv.Itoa(j) + strconv.Itoa(k)
-	if err := RedisClient.HSet(
-		ctx,
-		vmID,
-		"id", vmID,
-		"name", "v"+suffix,
-		"vpc", vpcID,
-		"tenantID", vpcTenantID,
-		"projectID", vpcProjectID,
-		"subnetID", subnetID,
-		"cidr", subnetCidr,
-		"gw", subnetGw,
-		"sg", secgroup,
-		"hostIP", podContainerIP,
-		"hostmac", podMAC,
-		"hostname", podName,
-		"status", "1",
-	).Err(); err != nil {
-		log.Println("Failed to hset vm ", vmID)
+// newVM describes the kth VM of subnet j of VPC i on a pod. Its ID and name
+// are made from the config and the indexes, and it takes the port handed out
+// by merak-network, if any.
+func newVM(i, j, k int,
+	vpc *commonPB.InternalVpcInfo, subnet *commonPB.InternalSubnetInfo, secgroup string,
+	configID string, pod *commonPB.InternalComputeInfo,
+	port *commonPB.InternalPortInfo) *entities.VM {
+	suffix := vmSuffix(i, j, k)
+	vm := entities.NewVM(
+		constants.ComputeVMID(configID, pod.Id, suffix),
+		constants.ComputeVMName(configID, suffix),
+		vpc.VpcId,
+		subnet.SubnetId,
+		vpc.TenantId,
+		vpc.ProjectId,
+		subnet.SubnetCidr,
+		subnet.SubnetGw,
+		secgroup,
+		pod.ContainerIp,
+		pod.Mac,
+		pod.Name,
+		strconv.Itoa(int(commonPB.Status_DEPLOYING)),
+	)
+	if port != nil {
+		vm.IP = port.Ip
+		vm.MAC = port.Mac
+	}
+	return vm
+}
+
+func vmSuffix(i, j, k int) string {
+	return strconv.Itoa(i) + strconv.Itoa(j) + strconv.Itoa(k)
+}
+
+// checkVMNames makes sure a config can name its VMs on a pod as given: the
+// tap device of every VM has to fit its name, and no other config may use
+// the same name prefix on the pod.
+func checkVMNames(ctx context.Context, configID string, podID string, names []string) error {
+	for _, name := range names {
+		if len("tap"+name) > constants.AGENT_MAX_DEVICE_NAME {
+			return fmt.Errorf("VM name %s is too long for its tap device, which can have at most %d characters", name, constants.AGENT_MAX_DEVICE_NAME)
+		}
+	}
+	prefix := constants.ComputeVMName(configID, "")
+	owner, err := RedisClient.HGet(ctx, constants.ComputePodVMNamesKey(podID), prefix).Result()
+	if err == redis.Nil || owner == configID {
+		return nil
+	}
+	if err != nil {
 		return err
 	}
-	*vms = append(*vms, vmID)
-	if err := RedisClient.LPush(ctx, "l"+podID, vmID).Err(); err != nil {
-		log.Println("Failed to add pod -> vm mapping " + vmID)
+	// The claim is left over once the other config has no VMs on the pod
+	used, err := RedisClient.Exists(ctx, constants.ComputePodVMListKey(owner, podID)).Result()
+	if err != nil {
 		return err
 	}
+	if used > 0 {
+		return fmt.Errorf("VM names %s... of compute config %s are already used by compute config %s on pod %s", prefix, configID, owner, podID)
+	}
+	return nil
+}
+
+// claimVMNames records the config as the one naming its VMs with its prefix
+// on the pod
+func claimVMNames(ctx context.Context, configID string, podID string) error {
+	return RedisClient.HSet(ctx, constants.ComputePodVMNamesKey(podID), constants.ComputeVMName(configID, ""), configID).Err()
+}
+
+// storeVMs records the VMs of a pod in Redis, their hashes, the pod's VM
+// list and the VM set of the config. The writes are pipelined in batches
+// of VM_STORE_BATCH_SIZE VMs rather than sent one round trip at a time.
+func storeVMs(ctx context.Context, configID string, podID string, vms []*entities.VM) error {
+	for start := 0; start < len(vms); start += common.VM_STORE_BATCH_SIZE {
+		end := start + common.VM_STORE_BATCH_SIZE
+		if end > len(vms) {
+			end = len(vms)
+		}
+		ids := make([]interface{}, 0, end-start)
+		pipe := RedisClient.Pipeline()
+		for _, vm := range vms[start:end] {
+			vm.HSet(ctx, pipe)
+			ids = append(ids, vm.ID)
+		}
+		pipe.LPush(ctx, constants.ComputePodVMListKey(configID, podID), ids...)
+		pipe.SAdd(ctx, constants.ComputeVMSetKey(configID), ids...)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Println("Failed to store VMs of pod " + podID)
+			return err
+		}
+	}
 	return nil
 }
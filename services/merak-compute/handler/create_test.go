@@ -0,0 +1,120 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreVMs(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	config := placementConfig(1, 1, pb.VMDeployType_UNIFORM)
+	vpc, subnet, pod := config.VmDeploy.Vpcs[0], config.VmDeploy.Vpcs[0].Subnets[0], config.Pods[0]
+	vms := []*entities.VM{}
+	for k := 0; k < 2500; k++ {
+		vms = append(vms, newVM(0, 0, k, vpc, subnet, "sg", "config1", pod, nil))
+	}
+	assert.Nil(t, storeVMs(ctx, "config1", pod.Id, vms))
+
+	assert.Equal(t, int64(2500), RedisClient.SCard(ctx, constants.ComputeVMSetKey("config1")).Val())
+	// Newest first, as before
+	list := RedisClient.LRange(ctx, constants.ComputePodVMListKey("config1", pod.Id), 0, 1).Val()
+	assert.Equal(t, []string{"config1:pod0002499", "config1:pod0002498"}, list)
+	vm, err := entities.GetVM(ctx, &RedisClient, "config1:pod00012")
+	assert.Nil(t, err)
+	assert.Equal(t, "v15420012", vm.Name)
+	assert.Equal(t, "10.0.0.0/24", vm.CIDR)
+	assert.Equal(t, "10.200.0.1", vm.HostIP)
+	assert.Equal(t, "1", vm.Status)
+}
+
+func TestCheckVMNames(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	// tapv15420012345 is as long as a device name gets
+	assert.Nil(t, checkVMNames(ctx, "config1", "pod0", []string{constants.ComputeVMName("config1", "0012345")}))
+	assert.NotNil(t, checkVMNames(ctx, "config1", "pod0", []string{constants.ComputeVMName("config1", "00123456")}))
+
+	// config5439 hashes to the same names as config1
+	assert.Equal(t, constants.ComputeVMName("config1", ""), constants.ComputeVMName("config5439", ""))
+	assert.Nil(t, claimVMNames(ctx, "config1", "pod0"))
+	RedisClient.LPush(ctx, constants.ComputePodVMListKey("config1", "pod0"), "config1:pod0000")
+	assert.Nil(t, checkVMNames(ctx, "config1", "pod0", nil))
+	assert.NotNil(t, checkVMNames(ctx, "config5439", "pod0", nil))
+	assert.Nil(t, checkVMNames(ctx, "config5439", "pod1", nil))
+	// Once config1 has no VMs on the pod its claim is left over
+	RedisClient.Del(ctx, constants.ComputePodVMListKey("config1", "pod0"))
+	assert.Nil(t, checkVMNames(ctx, "config5439", "pod0", nil))
+}
+
+// Recording the VMs of a pod with pipelines against the HSET and LPUSH
+// round trips per VM done before
+func BenchmarkStoreVMs(b *testing.B) {
+	ctx := context.Background()
+	server, _ := miniredis.Run()
+	defer server.Close()
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	config := placementConfig(1, 1, pb.VMDeployType_UNIFORM)
+	vpc, subnet, pod := config.VmDeploy.Vpcs[0], config.VmDeploy.Vpcs[0].Subnets[0], config.Pods[0]
+	vms := []*entities.VM{}
+	ids := []string{}
+	for k := 0; k < 1000; k++ {
+		vms = append(vms, newVM(0, 0, k, vpc, subnet, "sg", "config1", pod, nil))
+		ids = append(ids, vms[k].ID)
+	}
+
+	b.Run("pipelined", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			server.FlushAll()
+			b.StartTimer()
+			if err := storeVMs(ctx, "config1", pod.Id, vms); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("per-vm", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			server.FlushAll()
+			b.StartTimer()
+			for _, vm := range vms {
+				if err := vm.HSet(ctx, &RedisClient).Err(); err != nil {
+					b.Fatal(err)
+				}
+				if err := RedisClient.LPush(ctx, constants.ComputePodVMListKey("config1", pod.Id), vm.ID).Err(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := RedisClient.SAdd(ctx, constants.ComputeVMSetKey("config1"), ids).Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -17,7 +17,6 @@ package handler
 import (
 	"context"
 	"log"
-	"strconv"
 
 	commonPB "github.com/futurewei-cloud/merak/api/proto/v1/common"
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
@@ -38,9 +37,11 @@ func caseDelete(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.Retu
 	}
 
 	log.Println("Operation Delete")
+	// Only the pods and VMs of this compute config are deleted
+	configID := in.GetConfig().GetComputeConfigId()
 	podList := RedisClient.SMembers(
 		ctx,
-		constants.COMPUTE_REDIS_NODE_IP_SET,
+		constants.ComputeNodeIPSetKey(configID),
 	)
 	if podList.Err() != nil {
 		log.Println("Unable get VM IDs from redis", podList.Err())
@@ -52,7 +53,7 @@ func caseDelete(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.Retu
 	}
 	// Get list of all vms in pod
 	for n, podID := range podList.Val() {
-		vms := RedisClient.LRange(ctx, "l"+podID, 0, -1)
+		vms := RedisClient.LRange(ctx, constants.ComputePodVMListKey(configID, podID), 0, -1)
 		if vms.Err() != nil {
 			log.Println("Unable get node vmIDsList from redis", vms.Err())
 			return &pb.ReturnComputeMessage{
@@ -72,14 +73,14 @@ func caseDelete(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.Retu
 				}, err
 			}
 		}
-		tq := RedisClient.HGet(ctx, podID, "host").Val()
+		tq := RedisClient.HGet(ctx, constants.ComputePodKey(configID, podID), "host").Val()
 		workflowOptions = client.StartWorkflowOptions{
-			ID:          common.VM_DELETE_WORKFLOW_ID + strconv.Itoa(n),
+			ID:          common.WorkflowID(common.VM_DELETE_WORKFLOW_ID, configID, n),
 			TaskQueue:   tq,
 			RetryPolicy: retrypolicy,
 		}
 		log.Println("Executing VM Delete Workflow!")
-		we, err := TemporalClient.ExecuteWorkflow(context.Background(), workflowOptions, delete.Delete, vms.Val(), podID)
+		we, err := TemporalClient.ExecuteWorkflow(context.Background(), workflowOptions, delete.Delete, vms.Val(), configID, podID)
 		if err != nil {
 			return &pb.ReturnComputeMessage{
 				ReturnMessage: "Unable to execute delete workflow",
@@ -45,6 +45,10 @@ func (s *Server) ComputeHandler(ctx context.Context, in *pb.InternalComputeConfi
 
 		return caseCreate(ctx, in)
 
+	case common_pb.OperationType_UPDATE:
+
+		return caseUpdate(ctx, in)
+
 	case common_pb.OperationType_DELETE:
 
 		return caseDelete(ctx, in)
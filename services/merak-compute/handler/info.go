@@ -16,18 +16,29 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math"
+	"sort"
 	"strconv"
 
 	commonPB "github.com/futurewei-cloud/merak/api/proto/v1/common"
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
 	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
+	"github.com/go-redis/redis/v9"
 )
 
+// Returns the VMs matching the vm_query of the request, ordered by VM ID so
+// that offset and limit page through them consistently. Total is the number
+// of matching VMs, and the return message still counts the finished VMs of
+// the whole deployment. Latencies has the percentiles of every creation
+// stage over all matching VMs, not just the returned page.
 func caseInfo(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.ReturnComputeMessage, error) {
 	log.Println("Operation Info")
 
-	ids := RedisClient.SMembers(ctx, constants.COMPUTE_REDIS_VM_SET)
+	ids := RedisClient.SMembers(ctx, constants.ComputeVMSetKey(in.GetConfig().GetComputeConfigId()))
 	if ids.Err() != nil {
 		log.Println("Unable to get VM IDs from redis", ids.Err())
 
@@ -36,25 +47,193 @@ func caseInfo(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.Return
 			ReturnMessage: "Unable to get node IDs from redis",
 		}, ids.Err()
 	}
-	vms := []*pb.InternalVMInfo{}
 	log.Println("Success in getting VM IDs!")
+	vmIDs := ids.Val()
+	sort.Strings(vmIDs)
+
+	query := in.GetConfig().GetVmQuery()
+	offset := int(query.GetOffset())
+	limit := int(query.GetLimit())
+	if limit == 0 {
+		limit = common.VM_INFO_DEFAULT_LIMIT
+	}
+	vms := []*pb.InternalVMInfo{}
+	latencies := stageLatencies{}
 	count := 0
 	total := 0
-	for _, vmID := range ids.Val() {
-		status, _ := strconv.Atoi(RedisClient.HGet(ctx, vmID, "status").Val())
-		if commonPB.Status(status) == commonPB.Status_DONE {
-			count += 1
+	matched := 0
+	for start := 0; start < len(vmIDs); start += common.VM_INFO_BATCH_SIZE {
+		end := start + common.VM_INFO_BATCH_SIZE
+		if end > len(vmIDs) {
+			end = len(vmIDs)
+		}
+		records, err := getVMRecords(ctx, vmIDs[start:end])
+		if err != nil {
+			log.Println("Unable to get VMs from redis", err)
+			return &pb.ReturnComputeMessage{
+				ReturnCode:    commonPB.ReturnCode_FAILED,
+				ReturnMessage: "Unable to get VMs from redis",
+			}, err
+		}
+		for _, record := range records {
+			// The VM was deleted since the set was read
+			if len(record) == 0 {
+				continue
+			}
+			vm := vmInfo(record)
+			if vm.Status == commonPB.Status_DONE {
+				count += 1
+			}
+			total += 1
+			if !matchVMQuery(record, vm, query) {
+				continue
+			}
+			if matched >= offset && len(vms) < limit {
+				vms = append(vms, vm)
+			}
+			latencies.add(vm)
+			matched += 1
 		}
-		total += 1
-	}
-	returnVM := pb.InternalVMInfo{
-		Id: strconv.Itoa(count) + " out of " + strconv.Itoa(total) + " done!",
 	}
 	log.Println(strconv.Itoa(count) + " out of " + strconv.Itoa(total) + " done!")
-	vms = append(vms, &returnVM)
 	return &pb.ReturnComputeMessage{
 		ReturnCode:    commonPB.ReturnCode_OK,
-		ReturnMessage: "Success!",
+		ReturnMessage: fmt.Sprintf("%d out of %d done!", count, total),
 		Vms:           vms,
+		Total:         uint32(matched),
+		Latencies:     latencies.percentiles(),
 	}, nil
 }
+
+// Reads the hashes of the given VMs in one round trip
+func getVMRecords(ctx context.Context, vmIDs []string) ([]map[string]string, error) {
+	pipe := RedisClient.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(vmIDs))
+	for i, vmID := range vmIDs {
+		cmds[i] = pipe.HGetAll(ctx, vmID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	records := make([]map[string]string, len(vmIDs))
+	for i, cmd := range cmds {
+		records[i] = cmd.Val()
+	}
+	return records, nil
+}
+
+func vmInfo(record map[string]string) *pb.InternalVMInfo {
+	status, _ := strconv.Atoi(record["status"])
+	return &pb.InternalVMInfo{
+		Id:              record["id"],
+		Name:            record["name"],
+		Ip:              record["ip"],
+		VpcId:           record["vpc"],
+		SubnetId:        record["subnetID"],
+		SecurityGroupId: record["sg"],
+		DefaultGateway:  record["gw"],
+		Host:            record["hostname"],
+		RemoteId:        record["remoteID"],
+		Status:          commonPB.Status(status),
+		Mac:             record["mac"],
+		Reason:          record["reason"],
+		Timeline: &pb.InternalVMTimeline{
+			GeneratedAt:      timestamp(record["generatedAt"]),
+			MinimalPortStart: timestamp(record[entities.VM_STAGE_MINIMAL_PORT+"Start"]),
+			MinimalPortEnd:   timestamp(record[entities.VM_STAGE_MINIMAL_PORT+"End"]),
+			BulkPortStart:    timestamp(record[entities.VM_STAGE_BULK_PORT+"Start"]),
+			BulkPortEnd:      timestamp(record[entities.VM_STAGE_BULK_PORT+"End"]),
+			CreateStart:      timestamp(record[entities.VM_STAGE_CREATE+"Start"]),
+			CreateEnd:        timestamp(record[entities.VM_STAGE_CREATE+"End"]),
+		},
+	}
+}
+
+func timestamp(field string) int64 {
+	value, _ := strconv.ParseInt(field, 10, 64)
+	return value
+}
+
+// Latencies of the creation stages of VMs, in milliseconds
+type stageLatencies map[string][]float64
+
+var latencyStages = []string{
+	entities.VM_STAGE_MINIMAL_PORT,
+	entities.VM_STAGE_BULK_PORT,
+	entities.VM_STAGE_CREATE,
+	entities.VM_READY,
+}
+
+// Adds the stages the VM went through. Ready only counts VMs that are done.
+func (latencies stageLatencies) add(vm *pb.InternalVMInfo) {
+	timeline := vm.Timeline
+	for stage, span := range map[string][2]int64{
+		entities.VM_STAGE_MINIMAL_PORT: {timeline.MinimalPortStart, timeline.MinimalPortEnd},
+		entities.VM_STAGE_BULK_PORT:    {timeline.BulkPortStart, timeline.BulkPortEnd},
+		entities.VM_STAGE_CREATE:       {timeline.CreateStart, timeline.CreateEnd},
+	} {
+		if span[0] != 0 && span[1] != 0 {
+			latencies[stage] = append(latencies[stage], float64(span[1]-span[0]))
+		}
+	}
+	if vm.Status == commonPB.Status_DONE && timeline.GeneratedAt != 0 && timeline.CreateEnd != 0 {
+		latencies[entities.VM_READY] = append(latencies[entities.VM_READY], float64(timeline.CreateEnd-timeline.GeneratedAt))
+	}
+}
+
+// p50, p95 and p99 of every stage that any VM went through, by the nearest
+// rank method
+func (latencies stageLatencies) percentiles() []*pb.InternalStageLatency {
+	result := []*pb.InternalStageLatency{}
+	for _, stage := range latencyStages {
+		values := latencies[stage]
+		if len(values) == 0 {
+			continue
+		}
+		sort.Float64s(values)
+		rank := func(p float64) float64 {
+			index := int(math.Ceil(p*float64(len(values)))) - 1
+			if index < 0 {
+				index = 0
+			}
+			return values[index]
+		}
+		result = append(result, &pb.InternalStageLatency{
+			Stage: stage,
+			Count: uint32(len(values)),
+			P50:   rank(0.50),
+			P95:   rank(0.95),
+			P99:   rank(0.99),
+		})
+	}
+	return result
+}
+
+// A host matches either the pod name or the pod IP of the VM
+func matchVMQuery(record map[string]string, vm *pb.InternalVMInfo, query *pb.InternalVMQuery) bool {
+	if query == nil {
+		return true
+	}
+	if len(query.Status) > 0 {
+		found := false
+		for _, status := range query.Status {
+			if vm.Status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if query.Host != "" && query.Host != vm.Host && query.Host != record["hostIP"] {
+		return false
+	}
+	if query.VpcId != "" && query.VpcId != vm.VpcId {
+		return false
+	}
+	if query.SubnetId != "" && query.SubnetId != vm.SubnetId {
+		return false
+	}
+	return true
+}
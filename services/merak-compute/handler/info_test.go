@@ -0,0 +1,183 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	commonPB "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaseInfo(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	// 10 VMs on two hosts, every third one failed
+	for i := 0; i < 10; i++ {
+		vmID := fmt.Sprintf("vm%02d", i)
+		status, reason := commonPB.Status_DONE, ""
+		if i%3 == 0 {
+			status, reason = commonPB.Status_ERROR, "port create timed out"
+		}
+		assert.Nil(t, RedisClient.HSet(ctx, vmID,
+			"id", vmID,
+			"name", "v"+strconv.Itoa(i),
+			"vpc", "vpc"+strconv.Itoa(i%2),
+			"subnetID", "subnet"+strconv.Itoa(i%2),
+			"hostname", "vhost-"+strconv.Itoa(i%2),
+			"hostIP", "10.200.0."+strconv.Itoa(i%2+1),
+			"ip", "10.0.0."+strconv.Itoa(i+2),
+			"status", strconv.Itoa(int(status)),
+			"reason", reason,
+		).Err())
+		assert.Nil(t, RedisClient.SAdd(ctx, constants.COMPUTE_REDIS_VM_SET, vmID).Err())
+	}
+	info := func(query *pb.InternalVMQuery) *pb.ReturnComputeMessage {
+		ret, err := caseInfo(ctx, &pb.InternalComputeConfigInfo{
+			OperationType: commonPB.OperationType_INFO,
+			Config:        &pb.InternalComputeConfiguration{VmQuery: query},
+		})
+		assert.Nil(t, err)
+		return ret
+	}
+	ids := func(ret *pb.ReturnComputeMessage) []string {
+		var ids []string
+		for _, vm := range ret.Vms {
+			ids = append(ids, vm.Id)
+		}
+		return ids
+	}
+
+	ret := info(nil)
+	assert.Equal(t, "6 out of 10 done!", ret.ReturnMessage)
+	assert.Equal(t, uint32(10), ret.Total)
+	assert.Len(t, ret.Vms, 10)
+	assert.Equal(t, "vhost-1", ret.Vms[1].Host)
+	assert.Equal(t, "10.0.0.3", ret.Vms[1].Ip)
+
+	ret = info(&pb.InternalVMQuery{Status: []commonPB.Status{commonPB.Status_ERROR}})
+	assert.Equal(t, []string{"vm00", "vm03", "vm06", "vm09"}, ids(ret))
+	assert.Equal(t, "port create timed out", ret.Vms[0].Reason)
+
+	// A host is matched by name or IP
+	ret = info(&pb.InternalVMQuery{Host: "10.200.0.2", Status: []commonPB.Status{commonPB.Status_ERROR}})
+	assert.Equal(t, []string{"vm03", "vm09"}, ids(ret))
+	ret = info(&pb.InternalVMQuery{Host: "vhost-0", VpcId: "vpc0", SubnetId: "subnet0"})
+	assert.Equal(t, uint32(5), ret.Total)
+	ret = info(&pb.InternalVMQuery{VpcId: "vpc9"})
+	assert.Equal(t, uint32(0), ret.Total)
+	assert.Empty(t, ret.Vms)
+
+	// Pages follow the VM IDs
+	ret = info(&pb.InternalVMQuery{Offset: 4, Limit: 3})
+	assert.Equal(t, []string{"vm04", "vm05", "vm06"}, ids(ret))
+	assert.Equal(t, uint32(10), ret.Total)
+	ret = info(&pb.InternalVMQuery{Offset: 9, Limit: 3})
+	assert.Equal(t, []string{"vm09"}, ids(ret))
+}
+
+func TestCaseInfoScopedByConfig(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	// Two deployments sharing a pod
+	config := placementConfig(1, 1, pb.VMDeployType_UNIFORM)
+	vpc, subnet, pod := config.VmDeploy.Vpcs[0], config.VmDeploy.Vpcs[0].Subnets[0], config.Pods[0]
+	names := map[string]bool{}
+	for configID, count := range map[string]int{"config1": 2, "config2": 3} {
+		vms := []*entities.VM{}
+		for k := 0; k < count; k++ {
+			vm := newVM(0, 0, k, vpc, subnet, "sg", configID, pod, nil)
+			// The agent makes a namespace and a tap of the name on the pod
+			assert.False(t, names[vm.Name], vm.Name)
+			assert.LessOrEqual(t, len("tap"+vm.Name), 15, vm.Name)
+			names[vm.Name] = true
+			vms = append(vms, vm)
+		}
+		assert.Nil(t, storeVMs(ctx, configID, pod.Id, vms))
+	}
+	assert.ElementsMatch(t, []string{"config1:pod0000", "config1:pod0001"},
+		RedisClient.SMembers(ctx, constants.ComputeVMSetKey("config1")).Val())
+	podVMs, err := RedisClient.LRange(ctx, constants.ComputePodVMListKey("config2", "pod0"), 0, -1).Result()
+	assert.Nil(t, err)
+	assert.Len(t, podVMs, 3)
+
+	for configID, expected := range map[string]int{"config1": 2, "config2": 3, "": 0} {
+		ret, err := caseInfo(ctx, &pb.InternalComputeConfigInfo{
+			OperationType: commonPB.OperationType_INFO,
+			Config:        &pb.InternalComputeConfiguration{ComputeConfigId: configID},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, uint32(expected), ret.Total, configID)
+		for _, vm := range ret.Vms {
+			assert.Contains(t, vm.Id, configID+":")
+		}
+	}
+}
+
+func TestCaseInfoLatencies(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	// VM i is generated at base and takes i ms in its final create, the
+	// first 10 VMs also went through the minimal port stage
+	base := time.UnixMilli(1700000000000)
+	for i := 1; i <= 100; i++ {
+		vmID := fmt.Sprintf("vm%03d", i)
+		assert.Nil(t, RedisClient.HSet(ctx, vmID,
+			"id", vmID,
+			"status", strconv.Itoa(int(commonPB.Status_DONE)),
+			"generatedAt", base.UnixMilli(),
+		).Err())
+		start := base.Add(10 * time.Millisecond)
+		assert.Nil(t, entities.HSetStage(ctx, &RedisClient, vmID, entities.VM_STAGE_CREATE,
+			start, start.Add(time.Duration(i)*time.Millisecond)).Err())
+		if i <= 10 {
+			assert.Nil(t, entities.HSetStage(ctx, &RedisClient, vmID, entities.VM_STAGE_MINIMAL_PORT,
+				base, base.Add(5*time.Millisecond)).Err())
+		}
+		assert.Nil(t, RedisClient.SAdd(ctx, constants.COMPUTE_REDIS_VM_SET, vmID).Err())
+	}
+
+	ret, err := caseInfo(ctx, &pb.InternalComputeConfigInfo{
+		OperationType: commonPB.OperationType_INFO,
+		Config:        &pb.InternalComputeConfiguration{VmQuery: &pb.InternalVMQuery{Limit: 1}},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, ret.Vms, 1)
+	assert.Equal(t, base.UnixMilli()+10, ret.Vms[0].Timeline.CreateStart)
+	assert.Equal(t, base.UnixMilli()+11, ret.Vms[0].Timeline.CreateEnd)
+	assert.Equal(t, int64(0), ret.Vms[0].Timeline.BulkPortStart)
+
+	// The percentiles cover every matching VM, not only the page
+	assert.Equal(t, []*pb.InternalStageLatency{
+		{Stage: entities.VM_STAGE_MINIMAL_PORT, Count: 10, P50: 5, P95: 5, P99: 5},
+		{Stage: entities.VM_STAGE_CREATE, Count: 100, P50: 50, P95: 95, P99: 99},
+		{Stage: entities.VM_READY, Count: 100, P50: 60, P95: 105, P99: 109},
+	}, ret.Latencies)
+}
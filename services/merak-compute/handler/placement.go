@@ -0,0 +1,233 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	commonPB "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+)
+
+// Defaults for SKEW when hot_node_ratio or skew are left at 0
+const (
+	DEFAULT_HOT_NODE_RATIO = 1.0
+	DEFAULT_SKEW           = 1.0
+)
+
+// vmPlacement holds how many VMs each pod gets in each subnet, indexed by pod,
+// VPC and subnet in the order of the compute config.
+type vmPlacement [][][]int
+
+func newVMPlacement(pods []*commonPB.InternalComputeInfo, vpcs []*commonPB.InternalVpcInfo) vmPlacement {
+	placement := make(vmPlacement, len(pods))
+	for n := range pods {
+		placement[n] = make([][]int, len(vpcs))
+		for i, vpc := range vpcs {
+			placement[n][i] = make([]int, len(vpc.Subnets))
+		}
+	}
+	return placement
+}
+
+// placeVMs decides how the VMs of the compute config are spread over its pods.
+// UNIFORM puts number_vms of every subnet on every pod. SKEW and RANDOM spread
+// the same total, number_vms times the number of pods, unevenly, RANDOM drawing
+// from seed. ASSIGN takes the number of VMs of each pod from deploy_method,
+// and falls back to UNIFORM when that is empty.
+func placeVMs(config *pb.InternalComputeConfiguration, seed int64) (vmPlacement, error) {
+	pods := config.Pods
+	deploy := config.VmDeploy
+	placement := newVMPlacement(pods, deploy.Vpcs)
+	if len(pods) == 0 {
+		return placement, nil
+	}
+
+	switch deploy.DeployType {
+	case pb.VMDeployType_SKEW:
+		weights := skewWeights(len(pods), deploy.HotNodeRatio, deploy.Skew)
+		for i, vpc := range deploy.Vpcs {
+			for j, subnet := range vpc.Subnets {
+				counts := apportion(int(subnet.NumberVms)*len(pods), weights)
+				for n := range pods {
+					placement[n][i][j] = counts[n]
+				}
+			}
+		}
+	case pb.VMDeployType_RANDOM:
+		rng := rand.New(rand.NewSource(seed))
+		for i, vpc := range deploy.Vpcs {
+			for j, subnet := range vpc.Subnets {
+				for k := 0; k < int(subnet.NumberVms)*len(pods); k++ {
+					placement[rng.Intn(len(pods))][i][j]++
+				}
+			}
+		}
+	case pb.VMDeployType_ASSIGN:
+		if len(deploy.DeployMethod) > 0 {
+			return assignVMs(placement, pods, deploy)
+		}
+		fallthrough
+	default:
+		for n := range pods {
+			for i, vpc := range deploy.Vpcs {
+				for j, subnet := range vpc.Subnets {
+					placement[n][i][j] = int(subnet.NumberVms)
+				}
+			}
+		}
+	}
+	return placement, nil
+}
+
+func (placement vmPlacement) total() int {
+	total := 0
+	for n := range placement {
+		for i := range placement[n] {
+			for _, count := range placement[n][i] {
+				total += count
+			}
+		}
+	}
+	return total
+}
+
+// checkPorts makes sure every subnet with ports handed out by merak-network,
+// as in standalone mode, has a port for each of the VMs placed in it.
+func (placement vmPlacement) checkPorts(vpcs []*commonPB.InternalVpcInfo) error {
+	for i, vpc := range vpcs {
+		for j, subnet := range vpc.Subnets {
+			if len(subnet.Ports) == 0 {
+				continue
+			}
+			placed := 0
+			for n := range placement {
+				placed += placement[n][i][j]
+			}
+			if placed > len(subnet.Ports) {
+				return fmt.Errorf("subnet %s has %d ports for %d VMs", subnet.SubnetId, len(subnet.Ports), placed)
+			}
+		}
+	}
+	return nil
+}
+
+// skewWeights gives the first hotNodeRatio of the pods Zipf weights 1/rank^skew,
+// the remaining cold pods get no VMs at all.
+func skewWeights(numPods int, hotNodeRatio float64, skew float64) []float64 {
+	if hotNodeRatio <= 0 || hotNodeRatio > 1 {
+		hotNodeRatio = DEFAULT_HOT_NODE_RATIO
+	}
+	if skew <= 0 {
+		skew = DEFAULT_SKEW
+	}
+	hot := int(math.Ceil(hotNodeRatio * float64(numPods)))
+	weights := make([]float64, numPods)
+	for n := 0; n < hot; n++ {
+		weights[n] = 1 / math.Pow(float64(n+1), skew)
+	}
+	return weights
+}
+
+// apportion splits total by the weights with the largest remainder method, so
+// the counts always add up to total.
+func apportion(total int, weights []float64) []int {
+	var sum float64
+	for _, weight := range weights {
+		sum += weight
+	}
+	counts := make([]int, len(weights))
+	if sum == 0 || total == 0 {
+		return counts
+	}
+	remainders := make([]float64, len(weights))
+	left := total
+	for n, weight := range weights {
+		share := float64(total) * weight / sum
+		counts[n] = int(share)
+		remainders[n] = share - float64(counts[n])
+		left -= counts[n]
+	}
+	order := make([]int, len(weights))
+	for n := range order {
+		order[n] = n
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for _, n := range order[:left] {
+		counts[n]++
+	}
+	return counts
+}
+
+// assignVMs places num_of_vm VMs on each pod of deploy_method, round robin
+// over its subnets or over every subnet when it lists none. Pods are matched
+// by pod_ip or else pod_name, subnets by CIDR or ID.
+func assignVMs(placement vmPlacement, pods []*commonPB.InternalComputeInfo, deploy *pb.InternalVMDeployInfo) (vmPlacement, error) {
+	type subnetIndex struct{ vpc, subnet int }
+	var allSubnets []subnetIndex
+	subnetsByKey := make(map[string]subnetIndex)
+	for i, vpc := range deploy.Vpcs {
+		for j, subnet := range vpc.Subnets {
+			allSubnets = append(allSubnets, subnetIndex{i, j})
+			subnetsByKey[subnet.SubnetCidr] = subnetIndex{i, j}
+			if subnet.SubnetId != "" {
+				subnetsByKey[subnet.SubnetId] = subnetIndex{i, j}
+			}
+		}
+	}
+	if len(allSubnets) == 0 {
+		return nil, errors.New("no subnet to assign VMs to")
+	}
+
+	for _, method := range deploy.DeployMethod {
+		n := -1
+		for index, pod := range pods {
+			if (method.PodIp != "" && pod.ContainerIp == method.PodIp) ||
+				(method.PodIp == "" && method.PodName != "" && pod.Name == method.PodName) {
+				n = index
+				break
+			}
+		}
+		if n < 0 {
+			pod := method.PodIp
+			if pod == "" {
+				pod = method.PodName
+			}
+			return nil, fmt.Errorf("pod %q of deploy_method not found", pod)
+		}
+		subnets := allSubnets
+		if len(method.Subnets) > 0 {
+			subnets = nil
+			for _, key := range method.Subnets {
+				index, ok := subnetsByKey[key]
+				if !ok {
+					return nil, fmt.Errorf("subnet %q of deploy_method not found", key)
+				}
+				subnets = append(subnets, index)
+			}
+		}
+		for k := 0; k < int(method.NumOfVm); k++ {
+			index := subnets[k%len(subnets)]
+			placement[n][index.vpc][index.subnet]++
+		}
+	}
+	return placement, nil
+}
@@ -0,0 +1,145 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"testing"
+
+	commonPB "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+	"github.com/stretchr/testify/assert"
+)
+
+// A compute config with numPods pods and one VPC of two subnets
+func placementConfig(numPods int, numberVms uint32, deployType pb.VMDeployType) *pb.InternalComputeConfiguration {
+	config := &pb.InternalComputeConfiguration{
+		VmDeploy: &pb.InternalVMDeployInfo{
+			DeployType: deployType,
+			Vpcs: []*commonPB.InternalVpcInfo{{
+				VpcId: "vpc0",
+				Subnets: []*commonPB.InternalSubnetInfo{
+					{SubnetId: "subnet0", SubnetCidr: "10.0.0.0/24", NumberVms: numberVms},
+					{SubnetId: "subnet1", SubnetCidr: "10.0.1.0/24", NumberVms: numberVms},
+				},
+			}},
+		},
+	}
+	for n := 0; n < numPods; n++ {
+		config.Pods = append(config.Pods, &commonPB.InternalComputeInfo{
+			Id:          fmt.Sprintf("pod%d", n),
+			Name:        fmt.Sprintf("vhost-%d", n),
+			ContainerIp: fmt.Sprintf("10.200.0.%d", n+1),
+		})
+	}
+	return config
+}
+
+// VMs per pod over all subnets
+func podTotals(placement vmPlacement) []int {
+	totals := make([]int, len(placement))
+	for n := range placement {
+		for i := range placement[n] {
+			for _, count := range placement[n][i] {
+				totals[n] += count
+			}
+		}
+	}
+	return totals
+}
+
+func sum(counts []int) int {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total
+}
+
+func TestPlaceVMsUniform(t *testing.T) {
+	placement, err := placeVMs(placementConfig(3, 4, pb.VMDeployType_UNIFORM), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{8, 8, 8}, podTotals(placement))
+
+	// ASSIGN without deploy_method keeps the old behaviour
+	placement, err = placeVMs(placementConfig(3, 4, pb.VMDeployType_ASSIGN), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{8, 8, 8}, podTotals(placement))
+}
+
+func TestPlaceVMsSkew(t *testing.T) {
+	config := placementConfig(4, 25, pb.VMDeployType_SKEW)
+	placement, err := placeVMs(config, 1)
+	assert.Nil(t, err)
+	totals := podTotals(placement)
+	assert.Equal(t, 200, sum(totals))
+	// Zipf with exponent 1 over 4 pods: 48%, 24%, 16% and 12%
+	assert.Equal(t, []int{96, 48, 32, 24}, totals)
+
+	config.VmDeploy.HotNodeRatio = 0.5
+	config.VmDeploy.Skew = 2
+	placement, err = placeVMs(config, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{160, 40, 0, 0}, podTotals(placement))
+
+	assert.Equal(t, []int{4, 3, 3}, apportion(10, []float64{1, 1, 1}))
+}
+
+func TestPlaceVMsRandom(t *testing.T) {
+	config := placementConfig(5, 20, pb.VMDeployType_RANDOM)
+	placement, err := placeVMs(config, 42)
+	assert.Nil(t, err)
+	totals := podTotals(placement)
+	assert.Equal(t, 200, sum(totals))
+
+	// The same seed gives the same placement
+	again, err := placeVMs(config, 42)
+	assert.Nil(t, err)
+	assert.Equal(t, placement, again)
+}
+
+func TestPlaceVMsAssign(t *testing.T) {
+	config := placementConfig(3, 4, pb.VMDeployType_ASSIGN)
+	config.VmDeploy.DeployMethod = []*pb.InternalVMPod{
+		{PodIp: "10.200.0.1", NumOfVm: 5},
+		{PodName: "vhost-2", NumOfVm: 3, Subnets: []string{"10.0.1.0/24"}},
+	}
+	placement, err := placeVMs(config, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{3, 2}, placement[0][0])
+	assert.Equal(t, []int{0, 0}, placement[1][0])
+	assert.Equal(t, []int{0, 3}, placement[2][0])
+
+	config.VmDeploy.DeployMethod = []*pb.InternalVMPod{{PodIp: "10.200.0.9", NumOfVm: 1}}
+	_, err = placeVMs(config, 1)
+	assert.NotNil(t, err)
+
+	config.VmDeploy.DeployMethod = []*pb.InternalVMPod{{PodName: "vhost-0", NumOfVm: 1, Subnets: []string{"subnet9"}}}
+	_, err = placeVMs(config, 1)
+	assert.NotNil(t, err)
+}
+
+func TestCheckPorts(t *testing.T) {
+	config := placementConfig(2, 2, pb.VMDeployType_UNIFORM)
+	placement, err := placeVMs(config, 1)
+	assert.Nil(t, err)
+	// Subnets without ports aren't standalone, their VMs get ports from Alcor
+	assert.Nil(t, placement.checkPorts(config.VmDeploy.Vpcs))
+
+	config.VmDeploy.Vpcs[0].Subnets[0].Ports = []*commonPB.InternalPortInfo{{Ip: "10.0.0.2"}, {Ip: "10.0.0.3"}, {Ip: "10.0.0.4"}, {Ip: "10.0.0.5"}}
+	assert.Nil(t, placement.checkPorts(config.VmDeploy.Vpcs))
+	config.VmDeploy.Vpcs[0].Subnets[0].Ports = config.VmDeploy.Vpcs[0].Subnets[0].Ports[:3]
+	assert.NotNil(t, placement.checkPorts(config.VmDeploy.Vpcs))
+}
@@ -0,0 +1,402 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	commonPB "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/common"
+	"github.com/futurewei-cloud/merak/services/merak-compute/entities"
+	"github.com/futurewei-cloud/merak/services/merak-compute/workflows/create"
+	"github.com/futurewei-cloud/merak/services/merak-compute/workflows/delete"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
+)
+
+// vmState is what Redis records about the VMs of a compute config
+type vmState struct {
+	// VM IDs by pod, VPC and subnet of the config, failed VMs first and then
+	// the newest, which is the order they are removed in
+	placed [][][][]string
+	// VMs on pods or in subnets that are no longer in the config, by pod ID
+	stale map[string][]string
+	// Every VM ID of the config
+	ids map[string]bool
+	// IPs held by the VMs
+	ips map[string]bool
+}
+
+func (state *vmState) placement() vmPlacement {
+	placement := make(vmPlacement, len(state.placed))
+	for n := range state.placed {
+		placement[n] = make([][]int, len(state.placed[n]))
+		for i := range state.placed[n] {
+			placement[n][i] = make([]int, len(state.placed[n][i]))
+			for j, vms := range state.placed[n][i] {
+				placement[n][i][j] = len(vms)
+			}
+		}
+	}
+	return placement
+}
+
+// Scales the VMs of a compute config to the counts it asks for now. Pods
+// that need more VMs get a create workflow for the new ones only, pods with
+// a surplus get a delete workflow for it, and VMs of pods or subnets dropped
+// from the config are deleted.
+func caseUpdate(ctx context.Context, in *pb.InternalComputeConfigInfo) (*pb.ReturnComputeMessage, error) {
+	retrypolicy := &temporal.RetryPolicy{
+		InitialInterval:    common.TEMPORAL_WF_RETRY_INTERVAL,
+		BackoffCoefficient: common.TEMPORAL_WF_BACKOFF,
+		MaximumInterval:    common.TEMPORAL_WF_MAX_INTERVAL,
+		MaximumAttempts:    common.TEMPORAL_WF_MAX_ATTEMPT,
+	}
+	log.Println("Operation Update")
+	configID := in.Config.ComputeConfigId
+	seed := in.Config.VmDeploy.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Printf("Scaling VMs with seed %d", seed)
+
+	state, err := currentVMs(ctx, configID, in.Config)
+	if err != nil {
+		return &pb.ReturnComputeMessage{
+			ReturnMessage: "Unable to get VMs from redis",
+			ReturnCode:    commonPB.ReturnCode_FAILED,
+		}, err
+	}
+	target, err := scalePlacement(in.Config, state.placement(), seed)
+	if err != nil {
+		return &pb.ReturnComputeMessage{
+			ReturnMessage: "Unable to place VMs: " + err.Error(),
+			ReturnCode:    commonPB.ReturnCode_FAILED,
+		}, err
+	}
+	if err := target.checkPorts(in.Config.VmDeploy.Vpcs); err != nil {
+		return &pb.ReturnComputeMessage{
+			ReturnMessage: "Not enough ports: " + err.Error(),
+			ReturnCode:    commonPB.ReturnCode_FAILED,
+		}, err
+	}
+	creates, deletes, err := scaleVMs(ctx, configID, in.Config, state, target)
+	if err != nil {
+		return &pb.ReturnComputeMessage{
+			ReturnMessage: "Unable to update VMs in DB",
+			ReturnCode:    commonPB.ReturnCode_FAILED,
+		}, err
+	}
+
+	// Workflows of earlier steps may still be running, so the workflow IDs
+	// of an update are scoped by its request as well
+	scope := configID
+	if in.Config.RequestId != "" {
+		scope += "-" + in.Config.RequestId
+	}
+	created := 0
+	for _, vms := range creates {
+		created += len(vms)
+	}
+	for n, vms := range creates {
+		if len(vms) == 0 {
+			continue
+		}
+		pod := in.Config.Pods[n]
+		workflowOptions = client.StartWorkflowOptions{
+			ID:                       common.WorkflowID(common.VM_CREATE_WORKFLOW_ID, scope, n),
+			TaskQueue:                pod.Hostname,
+			RetryPolicy:              retrypolicy,
+			WorkflowExecutionTimeout: common.TEMPORAL_WF_EXEC_TIMEOUT,
+			WorkflowRunTimeout:       common.TEMPORAL_WF_RUN_TIMEOUT,
+			WorkflowTaskTimeout:      common.TEMPORAL_WF_TASK_TIMEOUT,
+		}
+		schedule := create.Schedule{
+			Type: in.Config.VmDeploy.Scheduler,
+			Rps:  in.Config.VmDeploy.Rps * float64(len(vms)) / float64(created),
+			Seed: seed + int64(n),
+		}
+		log.Println("Executing VM Create Workflow with VMs " + strconv.Itoa(len(vms)) + " on pod at " + pod.ContainerIp)
+		if _, err := TemporalClient.ExecuteWorkflow(context.Background(), workflowOptions, create.Create, vms, pod.ContainerIp, schedule); err != nil {
+			return &pb.ReturnComputeMessage{
+				ReturnMessage: "Unable to execute create workflow",
+				ReturnCode:    commonPB.ReturnCode_FAILED,
+			}, err
+		}
+	}
+
+	podIDs := make([]string, 0, len(deletes))
+	deleted := 0
+	for podID, vms := range deletes {
+		podIDs = append(podIDs, podID)
+		deleted += len(vms)
+	}
+	sort.Strings(podIDs)
+	for n, podID := range podIDs {
+		tq := RedisClient.HGet(ctx, constants.ComputePodKey(configID, podID), "host").Val()
+		workflowOptions = client.StartWorkflowOptions{
+			ID:          common.WorkflowID(common.VM_DELETE_WORKFLOW_ID, scope, n),
+			TaskQueue:   tq,
+			RetryPolicy: retrypolicy,
+		}
+		log.Println("Executing VM Delete Workflow with VMs " + strconv.Itoa(len(deletes[podID])) + " on pod " + podID)
+		if _, err := TemporalClient.ExecuteWorkflow(context.Background(), workflowOptions, delete.Delete, deletes[podID], configID, podID); err != nil {
+			return &pb.ReturnComputeMessage{
+				ReturnMessage: "Unable to execute delete workflow",
+				ReturnCode:    commonPB.ReturnCode_FAILED,
+			}, err
+		}
+	}
+
+	message := fmt.Sprintf("Scaling to %d VMs, creating %d and deleting %d", target.total(), created, deleted)
+	log.Println(message)
+	return &pb.ReturnComputeMessage{
+		ReturnMessage: message,
+		ReturnCode:    commonPB.ReturnCode_OK,
+	}, nil
+}
+
+// Reads the VMs of a compute config and sorts them into the pods, VPCs and
+// subnets of the config, by pod ID, VPC ID and subnet ID
+func currentVMs(ctx context.Context, configID string, config *pb.InternalComputeConfiguration) (*vmState, error) {
+	state := &vmState{
+		placed: make([][][][]string, len(config.Pods)),
+		stale:  make(map[string][]string),
+		ids:    make(map[string]bool),
+		ips:    make(map[string]bool),
+	}
+	type cell struct{ vpc, subnet int }
+	cells := make(map[string]cell)
+	for i, vpc := range config.VmDeploy.Vpcs {
+		for j, subnet := range vpc.Subnets {
+			cells[vpc.VpcId+"/"+subnet.SubnetId] = cell{i, j}
+		}
+	}
+	pods := make(map[string]int)
+	for n, pod := range config.Pods {
+		pods[pod.Id] = n
+		state.placed[n] = make([][][]string, len(config.VmDeploy.Vpcs))
+		for i, vpc := range config.VmDeploy.Vpcs {
+			state.placed[n][i] = make([][]string, len(vpc.Subnets))
+		}
+	}
+
+	podIDs, err := RedisClient.SMembers(ctx, constants.ComputeNodeIPSetKey(configID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, podID := range podIDs {
+		// Newest first, as the VMs are pushed to the head of the list
+		vmIDs, err := RedisClient.LRange(ctx, constants.ComputePodVMListKey(configID, podID), 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		records, err := getVMRecords(ctx, vmIDs)
+		if err != nil {
+			return nil, err
+		}
+		n, found := pods[podID]
+		for index, record := range records {
+			vmID := vmIDs[index]
+			state.ids[vmID] = true
+			if record["ip"] != "" {
+				state.ips[record["ip"]] = true
+			}
+			// Already on its way out with an earlier delete or update
+			if record["status"] == strconv.Itoa(int(commonPB.Status_DELETING)) {
+				continue
+			}
+			c, ok := cells[record["vpc"]+"/"+record["subnetID"]]
+			if !found || !ok {
+				state.stale[podID] = append(state.stale[podID], vmID)
+				continue
+			}
+			state.placed[n][c.vpc][c.subnet] = append(state.placed[n][c.vpc][c.subnet], vmID)
+		}
+		if found {
+			failed := make(map[string]bool)
+			for index, record := range records {
+				if record["status"] == strconv.Itoa(int(commonPB.Status_ERROR)) {
+					failed[vmIDs[index]] = true
+				}
+			}
+			for i := range state.placed[n] {
+				for _, vms := range state.placed[n][i] {
+					sort.SliceStable(vms, func(a, b int) bool {
+						return failed[vms[a]] && !failed[vms[b]]
+					})
+				}
+			}
+		}
+	}
+	return state, nil
+}
+
+// scalePlacement gives the VM counts the config asks for. RANDOM only moves
+// the difference to the current counts, adding VMs to random pods and
+// removing random VMs, so that scaling doesn't shuffle the VMs already
+// running. The other deploy types are placed as on create.
+func scalePlacement(config *pb.InternalComputeConfiguration, current vmPlacement, seed int64) (vmPlacement, error) {
+	pods := config.Pods
+	deploy := config.VmDeploy
+	if deploy.DeployType != pb.VMDeployType_RANDOM || len(pods) == 0 {
+		return placeVMs(config, seed)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	target := newVMPlacement(pods, deploy.Vpcs)
+	for i, vpc := range deploy.Vpcs {
+		for j, subnet := range vpc.Subnets {
+			// The pod of every VM of the subnet
+			var slots []int
+			for n := range pods {
+				target[n][i][j] = current[n][i][j]
+				for k := 0; k < current[n][i][j]; k++ {
+					slots = append(slots, n)
+				}
+			}
+			diff := int(subnet.NumberVms)*len(pods) - len(slots)
+			for ; diff > 0; diff-- {
+				target[rng.Intn(len(pods))][i][j]++
+			}
+			if diff < 0 {
+				rng.Shuffle(len(slots), func(a, b int) {
+					slots[a], slots[b] = slots[b], slots[a]
+				})
+				for _, n := range slots[:-diff] {
+					target[n][i][j]--
+				}
+			}
+		}
+	}
+	return target, nil
+}
+
+// scaleVMs records the VMs to add in Redis and marks the surplus as
+// deleting. It returns the new VMs by pod index, and the VMs to delete by
+// pod ID. New VMs take the lowest free VM IDs of their subnet, and the
+// ports handed out by merak-network that no VM holds yet.
+func scaleVMs(ctx context.Context, configID string, config *pb.InternalComputeConfiguration, state *vmState, target vmPlacement) ([][]string, map[string][]string, error) {
+	creates := make([][]string, len(config.Pods))
+	deletes := make(map[string][]string)
+	for podID, vms := range state.stale {
+		deletes[podID] = append(deletes[podID], vms...)
+	}
+	secgroup := ""
+	if len(config.VmDeploy.Secgroups) > 0 {
+		secgroup = config.VmDeploy.Secgroups[0]
+	}
+
+	// Every new VM is named before any is stored, so that a bad name fails
+	// the update up front
+	podVMs := make([][]*entities.VM, len(config.Pods))
+	for n, pod := range config.Pods {
+		newVMs := []*entities.VM{}
+		for i, vpc := range config.VmDeploy.Vpcs {
+			for j, subnet := range vpc.Subnets {
+				current := state.placed[n][i][j]
+				diff := target[n][i][j] - len(current)
+				if diff < 0 {
+					deletes[pod.Id] = append(deletes[pod.Id], current[:-diff]...)
+				}
+				k := 0
+				for ; diff > 0; diff-- {
+					for state.ids[constants.ComputeVMID(configID, pod.Id, vmSuffix(i, j, k))] {
+						k++
+					}
+					port, err := freePort(subnet, state.ips)
+					if err != nil {
+						return nil, nil, err
+					}
+					vm := newVM(i, j, k, vpc, subnet, secgroup, configID, pod, port)
+					state.ids[vm.ID] = true
+					newVMs = append(newVMs, vm)
+					creates[n] = append(creates[n], vm.ID)
+				}
+			}
+		}
+		if len(newVMs) == 0 {
+			continue
+		}
+		names := make([]string, len(newVMs))
+		for index, vm := range newVMs {
+			names[index] = vm.Name
+		}
+		if err := checkVMNames(ctx, configID, pod.Id, names); err != nil {
+			return nil, nil, err
+		}
+		podVMs[n] = newVMs
+	}
+	for n, pod := range config.Pods {
+		newVMs := podVMs[n]
+		if len(newVMs) == 0 {
+			continue
+		}
+		if err := RedisClient.HSet(
+			ctx,
+			constants.ComputePodKey(configID, pod.Id),
+			"name", pod.Name,
+			"ip", pod.ContainerIp,
+			"mac", pod.Mac,
+			"veth", pod.Veth,
+			"host", pod.Hostname,
+		).Err(); err != nil {
+			return nil, nil, err
+		}
+		if err := RedisClient.SAdd(ctx, constants.ComputeNodeIPSetKey(configID), pod.Id).Err(); err != nil {
+			return nil, nil, err
+		}
+		if err := claimVMNames(ctx, configID, pod.Id); err != nil {
+			return nil, nil, err
+		}
+		if err := storeVMs(ctx, configID, pod.Id, newVMs); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	pipe := RedisClient.Pipeline()
+	for _, vms := range deletes {
+		for _, vmID := range vms {
+			pipe.HSet(ctx, vmID, "status", strconv.Itoa(int(commonPB.Status_DELETING)))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, nil, err
+	}
+	return creates, deletes, nil
+}
+
+// First port of the subnet whose IP is not held by a VM yet, which is then
+// marked as held. A subnet without ports gets none, but one whose ports are
+// all held is out of ports.
+func freePort(subnet *commonPB.InternalSubnetInfo, ips map[string]bool) (*commonPB.InternalPortInfo, error) {
+	if len(subnet.Ports) == 0 {
+		return nil, nil
+	}
+	for _, port := range subnet.Ports {
+		if !ips[port.Ip] {
+			ips[port.Ip] = true
+			return port, nil
+		}
+	}
+	return nil, fmt.Errorf("subnet %s has no free port left", subnet.SubnetId)
+}
@@ -0,0 +1,208 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	commonPB "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// Brings the VMs recorded for the config to what it asks for, as an update
+// does before starting its workflows
+func scale(t *testing.T, config *pb.InternalComputeConfiguration, seed int64) ([][]string, map[string][]string) {
+	ctx := context.Background()
+	state, err := currentVMs(ctx, config.ComputeConfigId, config)
+	assert.Nil(t, err)
+	target, err := scalePlacement(config, state.placement(), seed)
+	assert.Nil(t, err)
+	creates, deletes, err := scaleVMs(ctx, config.ComputeConfigId, config, state, target)
+	assert.Nil(t, err)
+	return creates, deletes
+}
+
+// Finishes the workflows of a scale step: new VMs are done and deleted VMs
+// are gone
+func finish(t *testing.T, config *pb.InternalComputeConfiguration, creates [][]string, deletes map[string][]string) {
+	ctx := context.Background()
+	for _, vms := range creates {
+		for _, vmID := range vms {
+			assert.Nil(t, RedisClient.HSet(ctx, vmID, "status", int(commonPB.Status_DONE)).Err())
+		}
+	}
+	for podID, vms := range deletes {
+		for _, vmID := range vms {
+			assert.Nil(t, RedisClient.Del(ctx, vmID).Err())
+			assert.Nil(t, RedisClient.SRem(ctx, constants.ComputeVMSetKey(config.ComputeConfigId), vmID).Err())
+			assert.Nil(t, RedisClient.LRem(ctx, constants.ComputePodVMListKey(config.ComputeConfigId, podID), 1, vmID).Err())
+		}
+	}
+}
+
+func placementOf(t *testing.T, config *pb.InternalComputeConfiguration) vmPlacement {
+	state, err := currentVMs(context.Background(), config.ComputeConfigId, config)
+	assert.Nil(t, err)
+	return state.placement()
+}
+
+func count(vms [][]string) int {
+	total := 0
+	for _, v := range vms {
+		total += len(v)
+	}
+	return total
+}
+
+func TestScaleUniform(t *testing.T) {
+	server := miniredis.RunT(t)
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+	ctx := context.Background()
+
+	config := placementConfig(2, 2, pb.VMDeployType_UNIFORM)
+	config.ComputeConfigId = "config1"
+	config.VmDeploy.Vpcs[0].Subnets[0].Ports = []*commonPB.InternalPortInfo{
+		{Ip: "10.0.0.2"}, {Ip: "10.0.0.3"}, {Ip: "10.0.0.4"}, {Ip: "10.0.0.5"}, {Ip: "10.0.0.6"}, {Ip: "10.0.0.7"},
+	}
+	creates, deletes := scale(t, config, 1)
+	assert.Equal(t, 8, count(creates))
+	assert.Empty(t, deletes)
+	finish(t, config, creates, deletes)
+
+	// Scaling out only adds the new VMs, with the next free IDs and ports
+	config.VmDeploy.Vpcs[0].Subnets[0].NumberVms = 3
+	creates, deletes = scale(t, config, 1)
+	assert.Equal(t, [][]string{{"config1:pod0002"}, {"config1:pod1002"}}, creates)
+	assert.Empty(t, deletes)
+	ip, err := RedisClient.HGet(ctx, "config1:pod1002", "ip").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.7", ip)
+	finish(t, config, creates, deletes)
+
+	// Scaling in removes failed VMs first, and then the newest ones
+	assert.Nil(t, RedisClient.HSet(ctx, "config1:pod0000", "status", int(commonPB.Status_ERROR)).Err())
+	config.VmDeploy.Vpcs[0].Subnets[0].NumberVms = 1
+	creates, deletes = scale(t, config, 1)
+	assert.Equal(t, 0, count(creates))
+	assert.Equal(t, map[string][]string{
+		"pod0": {"config1:pod0000", "config1:pod0002"},
+		"pod1": {"config1:pod1002", "config1:pod1001"},
+	}, deletes)
+	status, err := RedisClient.HGet(ctx, "config1:pod1001", "status").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "3", status)
+
+	// An update started before those deletes finish leaves them alone
+	creates, deletes = scale(t, config, 1)
+	assert.Equal(t, 0, count(creates))
+	assert.Empty(t, deletes)
+	finish(t, config, nil, map[string][]string{
+		"pod0": {"config1:pod0000", "config1:pod0002"},
+		"pod1": {"config1:pod1002", "config1:pod1001"},
+	})
+
+	// VMs of a pod dropped from the config are all deleted
+	config.Pods = config.Pods[:1]
+	creates, deletes = scale(t, config, 1)
+	assert.Equal(t, 0, count(creates))
+	assert.ElementsMatch(t, []string{"config1:pod1000", "config1:pod1010", "config1:pod1011"}, deletes["pod1"])
+	assert.Len(t, deletes, 1)
+}
+
+func TestScaleOutOfPorts(t *testing.T) {
+	server := miniredis.RunT(t)
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+	ctx := context.Background()
+
+	config := placementConfig(2, 1, pb.VMDeployType_UNIFORM)
+	config.ComputeConfigId = "config1"
+	config.VmDeploy.Vpcs[0].Subnets[0].Ports = []*commonPB.InternalPortInfo{{Ip: "10.0.0.2"}, {Ip: "10.0.0.3"}}
+	creates, deletes := scale(t, config, 1)
+	finish(t, config, creates, deletes)
+
+	// Every port is held, so a new VM has none to take
+	config.VmDeploy.Vpcs[0].Subnets[0].NumberVms = 2
+	state, err := currentVMs(ctx, config.ComputeConfigId, config)
+	assert.Nil(t, err)
+	target, err := scalePlacement(config, state.placement(), 1)
+	assert.Nil(t, err)
+	assert.NotNil(t, target.checkPorts(config.VmDeploy.Vpcs))
+	_, _, err = scaleVMs(ctx, config.ComputeConfigId, config, state, target)
+	assert.NotNil(t, err)
+}
+
+func TestScaleNameClash(t *testing.T) {
+	server := miniredis.RunT(t)
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+	ctx := context.Background()
+
+	config := placementConfig(2, 1, pb.VMDeployType_UNIFORM)
+	config.ComputeConfigId = "config1"
+	creates, deletes := scale(t, config, 1)
+	finish(t, config, creates, deletes)
+
+	// config5439 would give its VMs the names of those of config1 on the
+	// same pods, nothing of it is stored
+	other := placementConfig(2, 1, pb.VMDeployType_UNIFORM)
+	other.ComputeConfigId = "config5439"
+	state, err := currentVMs(ctx, other.ComputeConfigId, other)
+	assert.Nil(t, err)
+	target, err := scalePlacement(other, state.placement(), 1)
+	assert.Nil(t, err)
+	_, _, err = scaleVMs(ctx, other.ComputeConfigId, other, state, target)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(0), RedisClient.SCard(ctx, constants.ComputeVMSetKey("config5439")).Val())
+}
+
+func TestScaleRandom(t *testing.T) {
+	server := miniredis.RunT(t)
+	RedisClient = *redis.NewClient(&redis.Options{Addr: server.Addr()})
+
+	config := placementConfig(4, 5, pb.VMDeployType_RANDOM)
+	config.ComputeConfigId = "config1"
+	creates, deletes := scale(t, config, 1)
+	assert.Equal(t, 40, count(creates))
+	finish(t, config, creates, deletes)
+	before := podTotals(placementOf(t, config))
+
+	// Scaling out keeps every VM where it is
+	config.VmDeploy.Vpcs[0].Subnets[0].NumberVms = 10
+	config.VmDeploy.Vpcs[0].Subnets[1].NumberVms = 10
+	creates, deletes = scale(t, config, 2)
+	assert.Equal(t, 40, count(creates))
+	assert.Empty(t, deletes)
+	for n, vms := range creates {
+		assert.Equal(t, before[n]+len(vms), podTotals(placementOf(t, config))[n])
+	}
+	finish(t, config, creates, deletes)
+
+	// Scaling back in only removes VMs
+	config.VmDeploy.Vpcs[0].Subnets[0].NumberVms = 5
+	config.VmDeploy.Vpcs[0].Subnets[1].NumberVms = 5
+	creates, deletes = scale(t, config, 3)
+	assert.Equal(t, 0, count(creates))
+	removed := 0
+	for _, vms := range deletes {
+		removed += len(vms)
+	}
+	assert.Equal(t, 40, removed)
+	finish(t, config, creates, deletes)
+	assert.Equal(t, 40, placementOf(t, config).total())
+}
@@ -139,6 +139,7 @@ func main() {
 	go func() {
 		workflow.PrometheusRegistry = prometheus.NewRegistry()
 		workflow.MerakMetrics = metrics.NewMetrics(workflow.PrometheusRegistry, "ComputeWorker")
+		workflow.StageMetrics = metrics.NewStageMetrics(workflow.PrometheusRegistry, "ComputeWorker")
 		http.Handle("/metrics", promhttp.HandlerFor(
 			workflow.PrometheusRegistry,
 			promhttp.HandlerOpts{Registry: workflow.PrometheusRegistry}))
@@ -30,7 +30,7 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-func Create(ctx workflow.Context, vms []string, podIP string) (err error) {
+func Create(ctx workflow.Context, vms []string, podIP string, schedule Schedule) (err error) {
 	defer merakwf.MerakMetrics.GetMetrics(&err)()
 	retrypolicy := &temporal.RetryPolicy{
 		InitialInterval:    common.TEMPORAL_ACTIVITY_RETRY_INTERVAL,
@@ -93,12 +93,7 @@ func Create(ctx workflow.Context, vms []string, podIP string) (err error) {
 	}
 	logger.Info("Workflow: Final VMCreate activities starting for all " + strconv.Itoa(len(vms)) + " vms at pod IP " + podIP)
 	//Create VMCreate and Port Update
-	var futuresCreate []workflow.Future
-	for _, vm := range vms {
-		future := workflow.ExecuteLocalActivity(ctx, activities.VmCreate, vm, podIP)
-		logger.Info("Workflow: VmCreate activity started for vm_id " + vm)
-		futuresCreate = append(futuresCreate, future)
-	}
+	futuresCreate := startVmCreates(ctx, vms, podIP, schedule)
 	logger.Info("Workflow: Final VMCreate activities started for all " + strconv.Itoa(len(vms)) + " vms at pod IP " + podIP)
 
 	for _, future := range futuresCreate {
@@ -0,0 +1,88 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package create
+
+import (
+	"math/rand"
+	"time"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+	"github.com/futurewei-cloud/merak/services/merak-compute/activities"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Schedule is how the VmCreate activities of one Create workflow are paced.
+// Rps is the rate of this workflow alone, the handler splits the rate of the
+// compute config over its pods.
+type Schedule struct {
+	Type pb.VMScheduleType
+	Rps  float64
+	Seed int64
+}
+
+// startOffsets returns when each of n VMs is started, relative to the first.
+// RPS starts them at a fixed interval, RANDOM_SCHEDULE as a Poisson process
+// with exponentially distributed gaps. CONCURRENT, or either of them without a
+// rate, starts them all at once.
+func startOffsets(schedule Schedule, n int) []time.Duration {
+	offsets := make([]time.Duration, n)
+	if schedule.Type == pb.VMScheduleType_CONCURRENT || schedule.Rps <= 0 {
+		return offsets
+	}
+	mean := float64(time.Second) / schedule.Rps
+	rng := rand.New(rand.NewSource(schedule.Seed))
+	var next float64
+	for i := range offsets {
+		offsets[i] = time.Duration(next)
+		if schedule.Type == pb.VMScheduleType_RANDOM_SCHEDULE {
+			next += rng.ExpFloat64() * mean
+		} else {
+			next += mean
+		}
+	}
+	return offsets
+}
+
+// startVmCreates runs VmCreate for every VM following the schedule. In
+// SEQUENTIAL mode each VM is only started once the one before is done.
+// Waiting is done with workflow timers so that replays stay deterministic.
+func startVmCreates(ctx workflow.Context, vms []string, podIP string, schedule Schedule) []workflow.Future {
+	logger := workflow.GetLogger(ctx)
+	var futures []workflow.Future
+	if schedule.Type == pb.VMScheduleType_SEQUENTIAL {
+		for _, vm := range vms {
+			future := workflow.ExecuteLocalActivity(ctx, activities.VmCreate, vm, podIP)
+			logger.Info("Workflow: VmCreate activity started for vm_id " + vm)
+			if err := future.Get(ctx, nil); err != nil {
+				logger.Info("Workflow: VmCreate activity failed for vm_id "+vm, err)
+			}
+			futures = append(futures, future)
+		}
+		return futures
+	}
+
+	start := workflow.Now(ctx)
+	for i, offset := range startOffsets(schedule, len(vms)) {
+		if wait := start.Add(offset).Sub(workflow.Now(ctx)); wait > 0 {
+			if err := workflow.Sleep(ctx, wait); err != nil {
+				logger.Info("Workflow: VmCreate pacing interrupted", err)
+				break
+			}
+		}
+		future := workflow.ExecuteLocalActivity(ctx, activities.VmCreate, vms[i], podIP)
+		logger.Info("Workflow: VmCreate activity started for vm_id " + vms[i])
+		futures = append(futures, future)
+	}
+	return futures
+}
@@ -0,0 +1,46 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package create
+
+import (
+	"testing"
+	"time"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartOffsetsRps(t *testing.T) {
+	offsets := startOffsets(Schedule{Type: pb.VMScheduleType_RPS, Rps: 4}, 5)
+	assert.Equal(t, []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond, time.Second}, offsets)
+
+	// Without a rate everything starts at once
+	assert.Equal(t, make([]time.Duration, 3), startOffsets(Schedule{Type: pb.VMScheduleType_RPS}, 3))
+	// and so does the default, whatever the rate
+	assert.Equal(t, make([]time.Duration, 3), startOffsets(Schedule{Rps: 4}, 3))
+}
+
+func TestStartOffsetsRandom(t *testing.T) {
+	schedule := Schedule{Type: pb.VMScheduleType_RANDOM_SCHEDULE, Rps: 100, Seed: 7}
+	offsets := startOffsets(schedule, 10000)
+	assert.Equal(t, offsets, startOffsets(schedule, 10000))
+	for i := 1; i < len(offsets); i++ {
+		assert.GreaterOrEqual(t, offsets[i], offsets[i-1])
+	}
+	// 10000 arrivals at 100 per second take about 100 seconds
+	assert.InDelta(t, 100, offsets[len(offsets)-1].Seconds(), 5)
+
+	schedule.Seed = 8
+	assert.NotEqual(t, offsets, startOffsets(schedule, 10000))
+}
@@ -15,6 +15,7 @@ package delete
 
 import (
 	"context"
+	"strconv"
 	"strings"
 
 	constants "github.com/futurewei-cloud/merak/services/common"
@@ -25,7 +26,7 @@ import (
 	"go.temporal.io/sdk/workflow"
 )
 
-func Delete(ctx workflow.Context, vms []string, podID string) (err error) {
+func Delete(ctx workflow.Context, vms []string, configID string, podID string) (err error) {
 	defer merakwf.MerakMetrics.GetMetrics(&err)()
 	retrypolicy := &temporal.RetryPolicy{
 		InitialInterval:    common.TEMPORAL_ACTIVITY_RETRY_INTERVAL,
@@ -43,7 +44,7 @@ func Delete(ctx workflow.Context, vms []string, podID string) (err error) {
 
 	var futures []workflow.Future
 	for _, vm := range vms {
-		future := workflow.ExecuteLocalActivity(ctx, activities.VmDelete, vm)
+		future := workflow.ExecuteLocalActivity(ctx, activities.VmDelete, vm, configID)
 		futures = append(futures, future)
 	}
 	logger.Info("Started VmDelete workflows for vms" + strings.Join(vms, " "))
@@ -59,13 +60,22 @@ func Delete(ctx workflow.Context, vms []string, podID string) (err error) {
 		logger.Info("Deleted VM ID " + vmID)
 
 		// Delete Single VM from DB
-		common.RedisClient.LRem(wfContext, "l"+podID, 1, vmID)
+		common.RedisClient.LRem(wfContext, constants.ComputePodVMListKey(configID, podID), 1, vmID)
+	}
+	// A scale-in may leave VMs on the pod
+	if common.RedisClient.LLen(wfContext, constants.ComputePodVMListKey(configID, podID)).Val() > 0 {
+		logger.Info("Deleted " + strconv.Itoa(len(vms)) + " VMs of pod " + podID)
+		return nil
 	}
 	// All VMs on pod have been deleted.
 	// Delete all Pod/VM associations from DB
-	common.RedisClient.HDel(wfContext, podID)
-	common.RedisClient.SRem(wfContext, constants.COMPUTE_REDIS_NODE_IP_SET, podID)
-	common.RedisClient.Del(wfContext, "l"+podID)
+	common.RedisClient.Del(wfContext, constants.ComputePodKey(configID, podID))
+	common.RedisClient.SRem(wfContext, constants.ComputeNodeIPSetKey(configID), podID)
+	common.RedisClient.Del(wfContext, constants.ComputePodVMListKey(configID, podID))
+	prefix := constants.ComputeVMName(configID, "")
+	if common.RedisClient.HGet(wfContext, constants.ComputePodVMNamesKey(podID), prefix).Val() == configID {
+		common.RedisClient.HDel(wfContext, constants.ComputePodVMNamesKey(podID), prefix)
+	}
 	logger.Info("All VMs for pod " + podID + " deleted!")
 	return nil
 
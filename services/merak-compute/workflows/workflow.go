@@ -7,5 +7,6 @@ import (
 
 var (
 	MerakMetrics       metrics.Metrics
+	StageMetrics       *metrics.StageMetrics
 	PrometheusRegistry *prometheus.Registry
 )
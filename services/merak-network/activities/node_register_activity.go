@@ -16,6 +16,7 @@ package activities
 import (
 	"encoding/json"
 	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	constants "github.com/futurewei-cloud/merak/services/common"
 	"github.com/futurewei-cloud/merak/services/merak-network/database"
 	"github.com/futurewei-cloud/merak/services/merak-network/entities"
 	"github.com/futurewei-cloud/merak/services/merak-network/http"
@@ -25,6 +26,11 @@ import (
 
 func RegisterNode(compute []*common_pb.InternalComputeInfo, netConfigId string) (string, error) {
 	log.Println("RegisterNode")
+	if utils.MODE == constants.MODE_STANDALONE {
+		// Nodes only need to be known by Alcor
+		log.Println("RegisterNode skipped in standalone mode")
+		return "", nil
+	}
 	//defer wg.Done()
 	log.Printf("compute %s", compute)
 	nodeInfo := entities.NodeStruct{}
@@ -42,7 +48,7 @@ func RegisterNode(compute []*common_pb.InternalComputeInfo, netConfigId string)
 		}
 		nodeInfo.Hosts = append(nodeInfo.Hosts, nodeBody)
 	}
-	log.Printf("nodeInfo: %s", nodeInfo)
+	log.Printf("nodeInfo: %+v", nodeInfo)
 	returnMessage, returnErr := http.RequestCall("http://"+utils.ALCORURL+":30007/nodes/bulk", "POST", nodeInfo, nil)
 	if returnErr != nil {
 		log.Printf("returnErr %s", returnErr)
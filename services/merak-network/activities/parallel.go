@@ -0,0 +1,254 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package activities
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/futurewei-cloud/merak/services/merak-network/http"
+	"github.com/futurewei-cloud/merak/services/merak-network/utils"
+)
+
+// runBounded runs the tasks with at most limit of them at a time. Once a task
+// fails no new ones are started, and the first error is returned after the
+// running ones are done.
+func runBounded(limit int, tasks []func() error) error {
+	if limit < 1 {
+		limit = 1
+	}
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	failed := make(chan struct{})
+	sem := make(chan struct{}, limit)
+
+launch:
+	for _, task := range tasks {
+		select {
+		case <-failed:
+			break launch
+		case sem <- struct{}{}:
+		}
+		select {
+		case <-failed:
+			<-sem
+			break launch
+		default:
+		}
+		wg.Add(1)
+		go func(task func() error) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := task(); err != nil {
+				once.Do(func() {
+					firstErr = err
+					close(failed)
+				})
+			}
+		}(task)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// withRetry calls the Alcor request up to utils.RETRY_ATTEMPTS times, backing
+// off exponentially between attempts.
+func withRetry(name string, call func() error) error {
+	backoff := utils.RETRY_BACKOFF
+	var err error
+	for attempt := 1; attempt <= utils.RETRY_ATTEMPTS; attempt++ {
+		if err = call(); err == nil {
+			return nil
+		}
+		log.Printf("%s attempt %d/%d failed: %s", name, attempt, utils.RETRY_ATTEMPTS, err)
+		if attempt < utils.RETRY_ATTEMPTS {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return fmt.Errorf("%s failed after %d attempts: %w", name, utils.RETRY_ATTEMPTS, err)
+}
+
+// notCreated tells whether a failed create certainly left nothing behind in
+// Alcor, because the request never got through or Alcor answered it with a
+// server error.
+func notCreated(err error) bool {
+	var statusErr *http.StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// createWithRetry is withRetry for Alcor creates, which aren't idempotent. A
+// failed attempt is only repeated as is when nothing was created. After any
+// other failure, e.g. a timeout once Alcor already stored the resource, find
+// looks for it first and its id is taken if it is there. Every id handed out
+// is claimed in known.
+func createWithRetry(name string, known *knownIds, create func() (string, error), find func() (string, error)) (string, error) {
+	backoff := utils.RETRY_BACKOFF
+	var err error
+	for attempt := 1; attempt <= utils.RETRY_ATTEMPTS; attempt++ {
+		var id string
+		if id, err = create(); err == nil {
+			known.claim(id)
+			return id, nil
+		}
+		log.Printf("%s attempt %d/%d failed: %s", name, attempt, utils.RETRY_ATTEMPTS, err)
+		if !notCreated(err) {
+			found, findErr := find()
+			if findErr != nil {
+				return "", fmt.Errorf("%s failed and it is unknown whether it was created: %w (lookup: %s)", name, err, findErr)
+			}
+			if found != "" {
+				log.Printf("%s was created after all as %s", name, found)
+				return found, nil
+			}
+		}
+		if attempt < utils.RETRY_ATTEMPTS {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return "", fmt.Errorf("%s failed after %d attempts: %w", name, utils.RETRY_ATTEMPTS, err)
+}
+
+// knownIds are the Alcor ids a lookup after a failed create must not take:
+// those that existed before and those already handed out.
+type knownIds struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func (k *knownIds) claim(id string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.ids[id] {
+		return false
+	}
+	k.ids[id] = true
+	return true
+}
+
+// vnetResources keeps track of what VnetCreate created in Alcor so a failed
+// run can be undone.
+type vnetResources struct {
+	mu        sync.Mutex
+	projectId string
+	vpcIds    []string
+	subnetIds []string
+	sgIds     []string
+	routerIds []string
+	// router id and subnet id of every attached interface
+	interfaces [][2]string
+}
+
+func (r *vnetResources) add(list *[]string, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*list = append(*list, id)
+}
+
+func (r *vnetResources) addInterface(routerId string, subnetId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interfaces = append(r.interfaces, [2]string{routerId, subnetId})
+}
+
+// rollback deletes everything created so far, in reverse dependency order,
+// and returns the error that caused it. Failures are logged and skipped so
+// as much as possible gets cleaned up.
+func (r *vnetResources) rollback(cause error) error {
+	log.Printf("VnetCreate failed, rolling back: %s", cause)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tasks []func() error
+	for _, iface := range r.interfaces {
+		routerId, subnetId := iface[0], iface[1]
+		tasks = append(tasks, func() error {
+			return withRetry("detach subnet "+subnetId, func() error {
+				_, err := removeInterfaceToNeutronRouter(subnetId, routerId, r.projectId)
+				return err
+			})
+		})
+	}
+	r.cleanup(tasks)
+
+	tasks = nil
+	for _, routerId := range r.routerIds {
+		routerId := routerId
+		tasks = append(tasks, func() error {
+			return withRetry("delete router "+routerId, func() error {
+				_, err := deleteNeutronRouterByRouterId(routerId, r.projectId)
+				return err
+			})
+		})
+	}
+	r.cleanup(tasks)
+
+	tasks = nil
+	for _, subnetId := range r.subnetIds {
+		subnetId := subnetId
+		tasks = append(tasks, func() error {
+			return withRetry("delete subnet "+subnetId, func() error {
+				_, err := deleteSubnet(subnetId, r.projectId)
+				return err
+			})
+		})
+	}
+	r.cleanup(tasks)
+
+	tasks = nil
+	for _, vpcId := range r.vpcIds {
+		vpcId := vpcId
+		tasks = append(tasks, func() error {
+			return withRetry("delete vpc "+vpcId, func() error {
+				_, err := deleteVpc(vpcId, r.projectId)
+				return err
+			})
+		})
+	}
+	for _, sgId := range r.sgIds {
+		sgId := sgId
+		tasks = append(tasks, func() error {
+			return withRetry("delete security group "+sgId, func() error {
+				_, err := deleteSg(sgId, r.projectId)
+				return err
+			})
+		})
+	}
+	r.cleanup(tasks)
+	return cause
+}
+
+// cleanup runs every task, unlike runBounded it doesn't stop at a failure
+func (r *vnetResources) cleanup(tasks []func() error) {
+	var wrapped []func() error
+	for _, task := range tasks {
+		task := task
+		wrapped = append(wrapped, func() error {
+			if err := task(); err != nil {
+				log.Printf("rollback: %s", err)
+			}
+			return nil
+		})
+	}
+	runBounded(utils.CONCURRENCY, wrapped)
+}
@@ -35,11 +35,11 @@ func DoServices(services []*pb.InternalServiceInfo) (string, error) {
 				log.Printf("WhenToRun %s", service.WhenToRun)
 				if strings.ReplaceAll(strings.Split(service.WhenToRun, ":")[0], " ", "") == "AFTER" {
 					runSequenceMap[strings.Split(service.WhenToRun, ":")[1]] = service.Name
-					log.Printf("numberOfService %s", numberOfService)
+					log.Printf("numberOfService %d", numberOfService)
 				}
 				if strings.ReplaceAll(strings.Split(service.WhenToRun, ":")[0], " ", "") == "BEFORE" {
 					runSequenceMap[service.Name] = strings.Split(service.WhenToRun, ":")[1]
-					log.Printf("numberOfService %s", numberOfService)
+					log.Printf("numberOfService %d", numberOfService)
 				}
 			}
 			if service.Cmd == "alcorIp" {
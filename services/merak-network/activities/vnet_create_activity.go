@@ -15,13 +15,17 @@ package activities
 
 import (
 	"encoding/json"
+	"fmt"
 	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	constants "github.com/futurewei-cloud/merak/services/common"
 	"github.com/futurewei-cloud/merak/services/merak-network/database"
 	"github.com/futurewei-cloud/merak/services/merak-network/entities"
 	"github.com/futurewei-cloud/merak/services/merak-network/http"
 	"github.com/futurewei-cloud/merak/services/merak-network/utils"
 	"log"
+	"strconv"
+	"strings"
 )
 
 func doVPC(vpc *common_pb.InternalVpcInfo, projectId string) (vpcId string, err error) {
@@ -46,7 +50,12 @@ func doVPC(vpc *common_pb.InternalVpcInfo, projectId string) (vpcId string, err
 	}
 	log.Printf("returnMessage %s", returnMessage)
 	var returnJson entities.VpcReturn
-	json.Unmarshal([]byte(returnMessage), &returnJson)
+	if err := json.Unmarshal([]byte(returnMessage), &returnJson); err != nil {
+		return "", fmt.Errorf("unexpected reply creating vpc %s: %s", vpc.VpcCidr, err)
+	}
+	if returnJson.Network.ID == "" {
+		return "", fmt.Errorf("vpc %s was not created: %s", vpc.VpcCidr, returnMessage)
+	}
 	database.Set(utils.VPC+returnJson.Network.ID, returnJson.Network)
 	log.Printf("returnJson : %+v", returnJson)
 	log.Println("doVPC done")
@@ -67,7 +76,12 @@ func doSubnet(subnet *common_pb.InternalSubnetInfo, vpcId string, projectId stri
 	}
 	log.Printf("returnMessage %s", returnMessage)
 	var returnJson entities.SubnetReturn
-	json.Unmarshal([]byte(returnMessage), &returnJson)
+	if err := json.Unmarshal([]byte(returnMessage), &returnJson); err != nil {
+		return "", fmt.Errorf("unexpected reply creating subnet %s: %s", subnet.SubnetCidr, err)
+	}
+	if returnJson.Subnet.ID == "" {
+		return "", fmt.Errorf("subnet %s was not created: %s", subnet.SubnetCidr, returnMessage)
+	}
 	database.Set(utils.SUBNET+returnJson.Subnet.ID, returnJson.Subnet)
 	log.Printf("doSubnet returnJson : %+v", returnJson)
 	log.Println("doSubnet done")
@@ -100,7 +114,12 @@ func doRouter(vpcId string, projectId string) (routerId string, err error) {
 	}
 	log.Printf("returnMessage %s", returnMessage)
 	var returnJson entities.RouterReturn
-	json.Unmarshal([]byte(returnMessage), &returnJson)
+	if err := json.Unmarshal([]byte(returnMessage), &returnJson); err != nil {
+		return "", fmt.Errorf("unexpected reply creating router: %s", err)
+	}
+	if returnJson.Router.ID == "" {
+		return "", fmt.Errorf("router was not created: %s", returnMessage)
+	}
 	database.Set(utils.Router+returnJson.Router.ID, returnJson.Router)
 	log.Printf("returnJson : %+v", returnJson)
 	log.Println("doRouter done")
@@ -122,11 +141,89 @@ func doAttachRouter(routerId string, subnetId string, projectId string) error {
 	log.Println("doAttachRouter done")
 	return nil
 }
+
+// parsePortRange turns the rule's port range ("80", "80-90" or "80:90") into
+// the min/max pair expected by Alcor. An empty range leaves both ends unset,
+// which Alcor treats as every port.
+func parsePortRange(portRange string) (*int, *int, error) {
+	portRange = strings.TrimSpace(portRange)
+	if portRange == "" {
+		return nil, nil, nil
+	}
+	bounds := strings.FieldsFunc(portRange, func(r rune) bool { return r == '-' || r == ':' })
+	if len(bounds) < 1 || len(bounds) > 2 {
+		return nil, nil, fmt.Errorf("invalid port range %q", portRange)
+	}
+	var ports []int
+	for _, bound := range bounds {
+		port, err := strconv.Atoi(strings.TrimSpace(bound))
+		if err != nil || port < 0 || port > 65535 {
+			return nil, nil, fmt.Errorf("invalid port range %q", portRange)
+		}
+		ports = append(ports, port)
+	}
+	min, max := ports[0], ports[len(ports)-1]
+	if min > max {
+		return nil, nil, fmt.Errorf("invalid port range %q", portRange)
+	}
+	return &min, &max, nil
+}
+
+func optionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func doSgRule(rule *pb.InternalSecurityGroupRulelnfo, sgId string, sg *pb.InternalSecurityGroupInfo, projectId string) (string, error) {
+	log.Println("doSgRule")
+	portMin, portMax, err := parsePortRange(rule.PortRange)
+	if err != nil {
+		return "", err
+	}
+	protocol := rule.Protocol
+	if strings.EqualFold(protocol, "any") {
+		protocol = ""
+	}
+	sgRuleBody := entities.SgRuleStruct{SgRule: entities.SgRuleBody{
+		Description:     rule.Description,
+		Direction:       rule.Direction,
+		Ethertype:       rule.Ethertype,
+		Name:            rule.Name,
+		PortRangeMax:    portMax,
+		PortRangeMin:    portMin,
+		Protocol:        optionalString(protocol),
+		ProjectId:       sg.ProjectId,
+		RemoteGroupId:   optionalString(rule.RemoteGroupId),
+		RemoteIpPrefix:  optionalString(rule.RemoteIpPrefix),
+		SecurityGroupId: sgId,
+		TenantId:        sg.TenantId,
+	}}
+	returnMessage, returnErr := http.RequestCall("http://"+utils.ALCORURL+":30008/project/"+projectId+"/security-group-rules", "POST", sgRuleBody, nil)
+	if returnErr != nil {
+		log.Printf("returnErr %s", returnErr)
+		return "", returnErr
+	}
+	log.Printf("returnMessage %s", returnMessage)
+	var returnJson entities.SgRuleReturn
+	if err := json.Unmarshal([]byte(returnMessage), &returnJson); err != nil {
+		return "", fmt.Errorf("unexpected reply creating security group rule %s: %s", rule.Name, err)
+	}
+	if returnJson.SecurityGroupRule.ID == "" {
+		return "", fmt.Errorf("security group rule %s was not created: %s", rule.Name, returnMessage)
+	}
+	database.Set(utils.SECURITYGROUPRULE+returnJson.SecurityGroupRule.ID, returnJson.SecurityGroupRule)
+	log.Printf("returnJson : %+v", returnJson)
+	log.Println("doSgRule done")
+	return returnJson.SecurityGroupRule.ID, nil
+}
+
 func doSg(sg *pb.InternalSecurityGroupInfo, projectId string) (string, error) {
 	log.Println("doSg")
 	sgBody := entities.SgStruct{Sg: entities.SgBody{
-		Description:        "sg Description",
-		Name:               "YM_sample_sg",
+		Description:        "security group " + sg.Name,
+		Name:               sg.Name,
 		ProjectId:          sg.ProjectId,
 		SecurityGroupRules: nil,
 		TenantId:           sg.TenantId,
@@ -138,17 +235,175 @@ func doSg(sg *pb.InternalSecurityGroupInfo, projectId string) (string, error) {
 	}
 	log.Printf("returnMessage %s", returnMessage)
 	var returnJson entities.SgReturn
-	json.Unmarshal([]byte(returnMessage), &returnJson)
+	if err := json.Unmarshal([]byte(returnMessage), &returnJson); err != nil {
+		return "", fmt.Errorf("unexpected reply creating security group %s: %s", sg.Name, err)
+	}
+	if returnJson.SecurityGroup.ID == "" {
+		return "", fmt.Errorf("security group %s was not created: %s", sg.Name, returnMessage)
+	}
 	database.Set(utils.SECURITYGROUP+returnJson.SecurityGroup.ID, returnJson.SecurityGroup)
 	log.Printf("returnJson : %+v", returnJson)
 	log.Println("doSg done")
 	return returnJson.SecurityGroup.ID, nil
 }
 
+// Alcor collections whose existing ids are collected by newKnownIds. New
+// subnets always land in a VPC of the netconfig next to subnets with other
+// CIDRs, so they can be told apart without.
+var knownCollections = []struct{ port, resource, key string }{
+	{"30001", "vpcs", "networks"},
+	{"30003", "routers", "routers"},
+	{"30008", "security-groups", "security_groups"},
+	{"30008", "security-group-rules", "security_group_rules"},
+}
+
+func alcorCollectionUrl(port string, projectId string, resource string) string {
+	return "http://" + utils.ALCORURL + ":" + port + "/project/" + projectId + "/" + resource
+}
+
+func listAlcor(url string, key string) ([]map[string]interface{}, error) {
+	returnMessage, returnErr := http.RequestCall(url, "GET", nil, nil)
+	if returnErr != nil {
+		return nil, returnErr
+	}
+	var returnJson map[string][]map[string]interface{}
+	if err := json.Unmarshal([]byte(returnMessage), &returnJson); err != nil {
+		return nil, fmt.Errorf("unexpected list of %s: %s", key, err)
+	}
+	return returnJson[key], nil
+}
+
+// newKnownIds collects the ids that exist in the project before anything is
+// created, so that finding a resource after a failed create can't mistake
+// one of them for the new one.
+func newKnownIds(projectId string) (*knownIds, error) {
+	known := &knownIds{ids: make(map[string]bool)}
+	for _, collection := range knownCollections {
+		url := alcorCollectionUrl(collection.port, projectId, collection.resource)
+		var objs []map[string]interface{}
+		err := withRetry("list "+collection.resource, func() (err error) {
+			objs, err = listAlcor(url, collection.key)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			known.claim(stringField(obj, "id"))
+		}
+	}
+	return known, nil
+}
+
+func stringField(obj map[string]interface{}, key string) string {
+	value, _ := obj[key].(string)
+	return value
+}
+
+// findCreated looks for a resource whose create failed but may have gone
+// through anyway. Only objects that match and aren't known yet are
+// considered. It returns an empty id if there is none and fails if there is
+// more than one, since then it isn't clear which is the new one. A found
+// object is stored under dbKey like a created one.
+func findCreated(url string, key string, dbKey string, known *knownIds, match func(map[string]interface{}) bool) (string, error) {
+	objs, err := listAlcor(url, key)
+	if err != nil {
+		return "", err
+	}
+	known.mu.Lock()
+	defer known.mu.Unlock()
+	var found []map[string]interface{}
+	for _, obj := range objs {
+		if id := stringField(obj, "id"); id != "" && !known.ids[id] && match(obj) {
+			found = append(found, obj)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", nil
+	case 1:
+		id := stringField(found[0], "id")
+		known.ids[id] = true
+		database.Set(dbKey+id, found[0])
+		return id, nil
+	}
+	return "", fmt.Errorf("%d %s match, can't tell which one is new", len(found), key)
+}
+
+func createAlcorVpc(vpc *common_pb.InternalVpcInfo, projectId string, known *knownIds) (string, error) {
+	return createWithRetry("create vpc "+vpc.VpcCidr, known, func() (string, error) {
+		return doVPC(vpc, projectId)
+	}, func() (string, error) {
+		return findCreated(alcorCollectionUrl("30001", projectId, "vpcs"), "networks", utils.VPC, known, func(obj map[string]interface{}) bool {
+			return stringField(obj, "cidr") == vpc.VpcCidr && stringField(obj, "name") == "YM_sample_vpc"
+		})
+	})
+}
+
+func createAlcorSubnet(subnet *common_pb.InternalSubnetInfo, vpcId string, projectId string, known *knownIds) (string, error) {
+	return createWithRetry("create subnet "+subnet.SubnetCidr, known, func() (string, error) {
+		return doSubnet(subnet, vpcId, projectId)
+	}, func() (string, error) {
+		return findCreated(alcorCollectionUrl("30002", projectId, "subnets"), "subnets", utils.SUBNET, known, func(obj map[string]interface{}) bool {
+			return stringField(obj, "cidr") == subnet.SubnetCidr && stringField(obj, "network_id") == vpcId
+		})
+	})
+}
+
+func createAlcorRouter(vpcId string, projectId string, known *knownIds) (string, error) {
+	return createWithRetry("create router in vpc "+vpcId, known, func() (string, error) {
+		return doRouter(vpcId, projectId)
+	}, func() (string, error) {
+		return findCreated(alcorCollectionUrl("30003", projectId, "routers"), "routers", utils.Router, known, func(obj map[string]interface{}) bool {
+			gateway, _ := obj["external_gateway_info"].(map[string]interface{})
+			return stringField(obj, "name") == "YM_simple_router" && stringField(gateway, "network_id") == vpcId
+		})
+	})
+}
+
+// createAlcorSg creates the security group and then its rules one by one,
+// so that every ID can be tracked and removed again by VnetDelete.
+func createAlcorSg(sg *pb.InternalSecurityGroupInfo, projectId string, known *knownIds) (string, error) {
+	sgId, err := createWithRetry("create security group "+sg.Name, known, func() (string, error) {
+		return doSg(sg, projectId)
+	}, func() (string, error) {
+		return findCreated(alcorCollectionUrl("30008", projectId, "security-groups"), "security_groups", utils.SECURITYGROUP, known, func(obj map[string]interface{}) bool {
+			return stringField(obj, "name") == sg.Name
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	var ruleIds []string
+	for _, rule := range sg.Rules {
+		ruleId, err := createAlcorSgRule(rule, sgId, sg, projectId, known)
+		if err != nil {
+			// Don't leave a half provisioned group behind in Alcor
+			database.Set(utils.SECURITYGROUPRULES+sgId, ruleIds)
+			deleteSg(sgId, projectId)
+			return "", err
+		}
+		ruleIds = append(ruleIds, ruleId)
+	}
+	database.Set(utils.SECURITYGROUPRULES+sgId, ruleIds)
+	return sgId, nil
+}
+
+func createAlcorSgRule(rule *pb.InternalSecurityGroupRulelnfo, sgId string, sg *pb.InternalSecurityGroupInfo, projectId string, known *knownIds) (string, error) {
+	return createWithRetry("create security group rule "+rule.Name, known, func() (string, error) {
+		return doSgRule(rule, sgId, sg, projectId)
+	}, func() (string, error) {
+		return findCreated(alcorCollectionUrl("30008", projectId, "security-group-rules"), "security_group_rules", utils.SECURITYGROUPRULE, known, func(obj map[string]interface{}) bool {
+			return stringField(obj, "security_group_id") == sgId && stringField(obj, "name") == rule.Name && stringField(obj, "direction") == rule.Direction
+		})
+	})
+}
+
 func VnetCreate(netConfigId string, network *pb.InternalNetworkInfo, projectId string) (*pb.ReturnNetworkMessage, error) {
 	log.Println("VnetCreate")
-	// TODO may want to separate bellow sections to different function, and use `go` and `wg` to improve overall speed
-	// TODO when do concurrent, need to keep in mind on how to control the number of concurrency
+	if utils.MODE == constants.MODE_STANDALONE {
+		return vnetCreateStandalone(netConfigId, network)
+	}
 
 	var returnNetworkMessage = pb.ReturnNetworkMessage{
 		ReturnCode:       common_pb.ReturnCode_OK,
@@ -156,67 +411,141 @@ func VnetCreate(netConfigId string, network *pb.InternalNetworkInfo, projectId s
 		Vpcs:             nil,
 		SecurityGroupIds: nil,
 	}
+	// Results are written by index so the reply keeps the order of the request
+	vpcs := make([]*common_pb.InternalVpcInfo, len(network.Vpcs))
+	sgIds := make([]string, len(network.SecurityGroups))
+	routers := make([]*pb.InternalRouterInfo, len(network.Routers))
+	resources := &vnetResources{projectId: projectId}
+	known, err := newKnownIds(projectId)
+	if err != nil {
+		return nil, err
+	}
 
-	var vpcId string
-	var vpcIds []string
-	subnetCiderIdMap := make(map[string]string)
-	for _, vpc := range network.Vpcs {
-		vpcId, err := doVPC(vpc, projectId)
-		if err != nil {
-			return nil, err
-		}
-		vpcIds = append(vpcIds, vpcId)
-		var returnInfo []*common_pb.InternalVpcInfo
-
-		var subnetInfo []*common_pb.InternalSubnetInfo
-		for _, subnet := range vpc.Subnets {
-			subnetId, err := doSubnet(subnet, vpcId, projectId)
+	// VPCs and security groups don't depend on anything
+	var tasks []func() error
+	for i, vpc := range network.Vpcs {
+		i, vpc := i, vpc
+		tasks = append(tasks, func() error {
+			vpcId, err := createAlcorVpc(vpc, projectId, known)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			subnetCiderIdMap[subnet.SubnetCidr] = subnetId
-			log.Printf("subnetCiderIdMap %s", subnetCiderIdMap)
-			currentSubnet := common_pb.InternalSubnetInfo{
-				SubnetId:   subnetId,
-				SubnetCidr: subnet.SubnetCidr,
-				SubnetGw:   subnet.SubnetGw,
-				NumberVms:  subnet.NumberVms,
+			resources.add(&resources.vpcIds, vpcId)
+			vpcs[i] = &common_pb.InternalVpcInfo{
+				VpcId:     vpcId,
+				TenantId:  vpc.TenantId,
+				ProjectId: vpc.ProjectId,
+				VpcCidr:   vpc.VpcCidr,
+				Subnets:   make([]*common_pb.InternalSubnetInfo, len(vpc.Subnets)),
 			}
-			subnetInfo = append(subnetInfo, &currentSubnet)
-		}
-		currentVPC := common_pb.InternalVpcInfo{
-			VpcId:     vpcId,
-			TenantId:  vpc.TenantId,
-			ProjectId: vpc.ProjectId,
-			Subnets:   subnetInfo,
-		}
-		returnNetworkMessage.Vpcs = append(returnNetworkMessage.Vpcs, &currentVPC)
-		log.Printf("VnetCreate End %s", returnInfo)
+			return nil
+		})
+	}
+	for i, sg := range network.SecurityGroups {
+		i, sg := i, sg
+		tasks = append(tasks, func() error {
+			sgId, err := createAlcorSg(sg, projectId, known)
+			if err != nil {
+				return err
+			}
+			resources.add(&resources.sgIds, sgId)
+			sgIds[i] = sgId
+			return nil
+		})
+	}
+	if err := runBounded(utils.CONCURRENCY, tasks); err != nil {
+		return nil, resources.rollback(err)
 	}
 
-	//doing security group
-	for _, sg := range network.SecurityGroups {
-		sgID, err := doSg(sg, projectId)
-		if err != nil {
-			return nil, err
+	// Subnets, once their VPC exists
+	tasks = nil
+	for i, vpc := range network.Vpcs {
+		for j, subnet := range vpc.Subnets {
+			i, j, subnet := i, j, subnet
+			tasks = append(tasks, func() error {
+				subnetId, err := createAlcorSubnet(subnet, vpcs[i].VpcId, projectId, known)
+				if err != nil {
+					return err
+				}
+				resources.add(&resources.subnetIds, subnetId)
+				vpcs[i].Subnets[j] = &common_pb.InternalSubnetInfo{
+					SubnetId:   subnetId,
+					SubnetCidr: subnet.SubnetCidr,
+					SubnetGw:   subnet.SubnetGw,
+					NumberVms:  subnet.NumberVms,
+				}
+				return nil
+			})
 		}
-		returnNetworkMessage.SecurityGroupIds = append(returnNetworkMessage.SecurityGroupIds, sgID)
+	}
+	if err := runBounded(utils.CONCURRENCY, tasks); err != nil {
+		return nil, resources.rollback(err)
 	}
 
-	//doing router: create and attach subnet
-	for _, router := range network.Routers {
-		routerId, err := doRouter(vpcId, projectId)
-		if err != nil {
-			return nil, err
+	subnetCiderIdMap := make(map[string]string)
+	subnetCiderVpcMap := make(map[string]string)
+	for _, vpc := range vpcs {
+		for _, subnet := range vpc.Subnets {
+			subnetCiderIdMap[subnet.SubnetCidr] = subnet.SubnetId
+			subnetCiderVpcMap[subnet.SubnetCidr] = vpc.VpcId
 		}
-		for _, subnet := range router.Subnets {
-			err := doAttachRouter(routerId, subnetCiderIdMap[subnet], projectId)
+	}
+	log.Printf("subnetCiderIdMap %s", subnetCiderIdMap)
+
+	// Routers, each created and then attached to its subnets in turn
+	tasks = nil
+	for i, router := range network.Routers {
+		i, router := i, router
+		tasks = append(tasks, func() error {
+			// The router's gateway sits in the VPC of its first subnet
+			var vpcId string
+			if len(router.Subnets) > 0 {
+				vpcId = subnetCiderVpcMap[router.Subnets[0]]
+			}
+			routerId, err := createAlcorRouter(vpcId, projectId, known)
 			if err != nil {
-				return nil, err
+				return err
 			}
-		}
+			resources.add(&resources.routerIds, routerId)
+			routers[i] = &pb.InternalRouterInfo{Id: routerId, Name: router.Name}
+			for _, subnet := range router.Subnets {
+				subnetId := subnetCiderIdMap[subnet]
+				err := withRetry("attach subnet "+subnet, func() error {
+					return doAttachRouter(routerId, subnetId, projectId)
+				})
+				if err != nil {
+					return err
+				}
+				resources.addInterface(routerId, subnetId)
+				routers[i].Subnets = append(routers[i].Subnets, subnet)
+			}
+			return nil
+		})
+	}
+	if err := runBounded(utils.CONCURRENCY, tasks); err != nil {
+		return nil, resources.rollback(err)
+	}
+
+	returnNetworkMessage.Vpcs = vpcs
+	returnNetworkMessage.SecurityGroupIds = sgIds
+	returnNetworkMessage.Routers = routers
+	for i, sg := range network.SecurityGroups {
+		returnNetworkMessage.SecurityGroups = append(returnNetworkMessage.SecurityGroups, securityGroupInfo(sg, sgIds[i]))
 	}
 	database.Set(utils.NETCONFIG+netConfigId, &returnNetworkMessage)
 	log.Printf("&returnNetworkMessage %s", &returnNetworkMessage)
 	return &returnNetworkMessage, nil
 }
+
+// Copy of the requested security group carrying the id it was created with
+func securityGroupInfo(sg *pb.InternalSecurityGroupInfo, sgId string) *pb.InternalSecurityGroupInfo {
+	return &pb.InternalSecurityGroupInfo{
+		OperationType: sg.OperationType,
+		Id:            sgId,
+		Name:          sg.Name,
+		TenantId:      sg.TenantId,
+		ProjectId:     sg.ProjectId,
+		Rules:         sg.Rules,
+		ApplyTo:       sg.ApplyTo,
+	}
+}
@@ -0,0 +1,210 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package activities
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/common/alcormock"
+	"github.com/futurewei-cloud/merak/services/merak-network/database"
+	"github.com/futurewei-cloud/merak/services/merak-network/utils"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePortRange(t *testing.T) {
+	cases := []struct {
+		in       string
+		min, max int
+		unset    bool
+		fail     bool
+	}{
+		{in: "", unset: true},
+		{in: "22", min: 22, max: 22},
+		{in: "80-90", min: 80, max: 90},
+		{in: "1000:2000", min: 1000, max: 2000},
+		{in: "90-80", fail: true},
+		{in: "http", fail: true},
+		{in: "1-2-3", fail: true},
+		{in: "70000", fail: true},
+	}
+	for _, c := range cases {
+		min, max, err := parsePortRange(c.in)
+		if c.fail {
+			if err == nil {
+				t.Errorf("parsePortRange(%q) expected an error", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePortRange(%q) unexpected error %s", c.in, err)
+			continue
+		}
+		if c.unset {
+			if min != nil || max != nil {
+				t.Errorf("parsePortRange(%q) expected an unset range", c.in)
+			}
+			continue
+		}
+		if min == nil || max == nil || *min != c.min || *max != c.max {
+			t.Errorf("parsePortRange(%q) = %v, %v, want %d-%d", c.in, min, max, c.min, c.max)
+		}
+	}
+}
+
+// Serves an Alcor mock on the Alcor ports of localhost for the test
+func useAlcorMock(t *testing.T) *alcormock.Server {
+	mr := miniredis.RunT(t)
+	database.Rdb = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mock := alcormock.New(alcormock.Config{Seed: 1})
+	stop, err := mock.Start(constants.LOCALHOST, alcormock.DefaultPorts)
+	if err != nil {
+		t.Skipf("Alcor ports are not available: %s", err)
+	}
+	alcorUrl, backoff := utils.ALCORURL, utils.RETRY_BACKOFF
+	utils.ALCORURL, utils.RETRY_BACKOFF = constants.LOCALHOST, time.Millisecond
+	t.Cleanup(func() {
+		stop()
+		utils.ALCORURL, utils.RETRY_BACKOFF = alcorUrl, backoff
+	})
+	return mock
+}
+
+// A network with one router per VPC and two security groups
+func testNetwork(numVpcs int, numSubnets int) *pb.InternalNetworkInfo {
+	network := &pb.InternalNetworkInfo{}
+	for i := 0; i < numVpcs; i++ {
+		vpc := &common_pb.InternalVpcInfo{
+			ProjectId: "123456789",
+			TenantId:  "123456789",
+			VpcCidr:   fmt.Sprintf("10.%d.0.0/16", i),
+		}
+		router := &pb.InternalRouterInfo{Name: fmt.Sprintf("router-%d", i)}
+		for j := 0; j < numSubnets; j++ {
+			cidr := fmt.Sprintf("10.%d.%d.0/24", i, j)
+			vpc.Subnets = append(vpc.Subnets, &common_pb.InternalSubnetInfo{SubnetCidr: cidr, NumberVms: 1})
+			router.Subnets = append(router.Subnets, cidr)
+		}
+		network.Vpcs = append(network.Vpcs, vpc)
+		network.Routers = append(network.Routers, router)
+	}
+	for i := 0; i < 2; i++ {
+		network.SecurityGroups = append(network.SecurityGroups, &pb.InternalSecurityGroupInfo{
+			Name:      fmt.Sprintf("sg-%d", i),
+			ProjectId: "123456789",
+			TenantId:  "123456789",
+			Rules: []*pb.InternalSecurityGroupRulelnfo{{
+				Name:      "ssh",
+				Direction: "ingress",
+				Ethertype: "IPv4",
+				Protocol:  "tcp",
+				PortRange: "22",
+			}},
+		})
+	}
+	return network
+}
+
+func assertNoAlcorResources(t *testing.T, mock *alcormock.Server) {
+	for _, resource := range []string{alcormock.VPCS, alcormock.SUBNETS, alcormock.ROUTERS, alcormock.SECURITY_GROUPS, alcormock.SECURITY_GROUP_RULES} {
+		assert.Equal(t, 0, mock.Count(resource), resource)
+	}
+}
+
+func TestVnetCreateAlcor(t *testing.T) {
+	mock := useAlcorMock(t)
+	concurrency := utils.CONCURRENCY
+	utils.CONCURRENCY = 8
+	defer func() { utils.CONCURRENCY = concurrency }()
+
+	ret, err := VnetCreate("net1", testNetwork(30, 2), "123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, 30, mock.Count(alcormock.VPCS))
+	assert.Equal(t, 60, mock.Count(alcormock.SUBNETS))
+	assert.Equal(t, 30, mock.Count(alcormock.ROUTERS))
+	assert.Equal(t, 2, mock.Count(alcormock.SECURITY_GROUPS))
+	assert.Equal(t, 2, mock.Count(alcormock.SECURITY_GROUP_RULES))
+
+	// The reply keeps the order of the request
+	assert.Len(t, ret.Vpcs, 30)
+	for i, vpc := range ret.Vpcs {
+		for j, subnet := range vpc.Subnets {
+			assert.Equal(t, fmt.Sprintf("10.%d.%d.0/24", i, j), subnet.SubnetCidr)
+			assert.Equal(t, vpc.VpcId, mock.Get(alcormock.SUBNETS, subnet.SubnetId)["network_id"])
+			assert.NotEmpty(t, mock.Get(alcormock.SUBNETS, subnet.SubnetId)["attached_router_id"])
+		}
+	}
+	assert.Len(t, ret.SecurityGroupIds, 2)
+
+	_, err = VnetDelete("net1", nil)
+	assert.Nil(t, err)
+	assertNoAlcorResources(t, mock)
+}
+
+func TestVnetCreateRetry(t *testing.T) {
+	mock := useAlcorMock(t)
+
+	mock.InjectError(http.MethodPost, alcormock.SUBNETS, http.StatusServiceUnavailable, 2)
+	_, err := VnetCreate("net1", testNetwork(2, 2), "123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, mock.Count(alcormock.SUBNETS))
+	assert.Equal(t, 6, mock.Requests(http.MethodPost, alcormock.SUBNETS))
+}
+
+func TestVnetCreateLostReply(t *testing.T) {
+	mock := useAlcorMock(t)
+
+	// Alcor creates one of each but the replies get lost, the retries have
+	// to find them instead of creating them a second time
+	for _, resource := range []string{alcormock.VPCS, alcormock.SUBNETS, alcormock.ROUTERS, alcormock.SECURITY_GROUPS, alcormock.SECURITY_GROUP_RULES} {
+		mock.DropReply(http.MethodPost, resource, 1)
+	}
+	ret, err := VnetCreate("net1", testNetwork(2, 2), "123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, mock.Count(alcormock.VPCS))
+	assert.Equal(t, 4, mock.Count(alcormock.SUBNETS))
+	assert.Equal(t, 2, mock.Count(alcormock.ROUTERS))
+	assert.Equal(t, 2, mock.Count(alcormock.SECURITY_GROUPS))
+	assert.Equal(t, 2, mock.Count(alcormock.SECURITY_GROUP_RULES))
+	assert.Equal(t, 2, mock.Requests(http.MethodPost, alcormock.VPCS))
+	for _, vpc := range ret.Vpcs {
+		assert.NotNil(t, mock.Get(alcormock.VPCS, vpc.VpcId))
+		for _, subnet := range vpc.Subnets {
+			assert.Equal(t, vpc.VpcId, mock.Get(alcormock.SUBNETS, subnet.SubnetId)["network_id"])
+		}
+	}
+
+	_, err = VnetDelete("net1", nil)
+	assert.Nil(t, err)
+	assertNoAlcorResources(t, mock)
+}
+
+func TestVnetCreateRollback(t *testing.T) {
+	mock := useAlcorMock(t)
+
+	// Attaching the routers never succeeds, everything created before has
+	// to be removed again
+	mock.InjectError(http.MethodPut, alcormock.ROUTERS, http.StatusInternalServerError, 1000)
+	_, err := VnetCreate("net1", testNetwork(5, 2), "123456789")
+	assert.NotNil(t, err)
+	assert.Greater(t, mock.Requests(http.MethodDelete, alcormock.VPCS), 0)
+	assertNoAlcorResources(t, mock)
+}
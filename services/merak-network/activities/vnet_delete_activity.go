@@ -16,6 +16,7 @@ package activities
 import (
 	"encoding/json"
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	constants "github.com/futurewei-cloud/merak/services/common"
 	"github.com/futurewei-cloud/merak/services/merak-network/database"
 	"github.com/futurewei-cloud/merak/services/merak-network/entities"
 	"github.com/futurewei-cloud/merak/services/merak-network/http"
@@ -33,7 +34,7 @@ func getSubnetRouter(subnetId string, projectId string) (returnRouterId string,
 	log.Printf("returnMessage %s", returnMessage)
 	var returnJson entities.SubnetReturn
 	json.Unmarshal([]byte(returnMessage), &returnJson)
-	log.Printf("returnJson : %s", returnJson)
+	log.Printf("returnJson : %+v", returnJson)
 	log.Println("getSubnetRouter done")
 	return returnJson.Subnet.AttachedRouterID, nil
 }
@@ -98,8 +99,31 @@ func deleteVpc(vpcId string, projectId string) (returnVpcId string, err error) {
 	return vpcId, nil
 }
 
+func deleteSgRule(sgRuleId string, projectId string) error {
+	log.Println("deleteSgRule")
+	returnMessage, returnErr := http.RequestCall("http://"+utils.ALCORURL+":30008/project/"+projectId+"/security-group-rules/"+sgRuleId, "DELETE", "", nil)
+	if returnErr != nil {
+		log.Printf("returnErr %s", returnErr)
+		return returnErr
+	}
+	log.Printf("returnMessage %s", returnMessage)
+	database.Del(utils.SECURITYGROUPRULE + sgRuleId)
+	log.Println("deleteSgRule done")
+	return nil
+}
+
 func deleteSg(sgId string, projectId string) (returnSgId string, err error) {
 	log.Println("deleteSg")
+	var ruleIds []string
+	if values, err := database.Get(utils.SECURITYGROUPRULES + sgId); err == nil {
+		json.Unmarshal([]byte(values), &ruleIds)
+	}
+	for _, ruleId := range ruleIds {
+		if err := deleteSgRule(ruleId, projectId); err != nil {
+			return "", err
+		}
+	}
+	database.Del(utils.SECURITYGROUPRULES + sgId)
 	returnMessage, returnErr := http.RequestCall("http://"+utils.ALCORURL+":30008/project/"+projectId+"/security-groups/"+sgId, "DELETE", "", nil)
 	if returnErr != nil {
 		log.Printf("returnErr %s", returnErr)
@@ -107,7 +131,7 @@ func deleteSg(sgId string, projectId string) (returnSgId string, err error) {
 	}
 	log.Printf("returnMessage %s", returnMessage)
 	database.Del(utils.SECURITYGROUP + sgId)
-	log.Println("deleteVpc done")
+	log.Println("deleteSg done")
 	return sgId, nil
 }
 
@@ -120,7 +144,7 @@ func deleteNode(netConfigId string) (err error) {
 	log.Printf("NodeGroup %s", values)
 	var returnJson entities.NodeReturn
 	json.Unmarshal([]byte(values), &returnJson)
-	log.Printf("returnMessage %s", returnJson)
+	log.Printf("returnMessage %+v", returnJson)
 
 	for _, node := range returnJson {
 		_, returnErr := http.RequestCall("http://"+utils.ALCORURL+":30007/nodes/"+node.NodeID, "DELETE", nil, nil)
@@ -137,6 +161,9 @@ func deleteNode(netConfigId string) (err error) {
 func VnetDelete(netConfigId string, returnMessage chan *pb.ReturnNetworkMessage) (*pb.ReturnNetworkMessage, error) {
 	// TODO: when query db, make sure to check if key exist first, other wise could timeout
 	log.Println("VnetDelete")
+	if utils.MODE == constants.MODE_STANDALONE {
+		return vnetDeleteStandalone(netConfigId)
+	}
 
 	deleteNode(netConfigId)
 
@@ -145,7 +172,7 @@ func VnetDelete(netConfigId string, returnMessage chan *pb.ReturnNetworkMessage)
 		return nil, err
 	}
 	log.Printf("VnetInfo %s", values)
-	log.Printf("returnMessage %s", returnMessage)
+	log.Printf("returnMessage %v", returnMessage)
 	var returnJson *pb.ReturnNetworkMessage
 	json.Unmarshal([]byte(values), &returnJson)
 	log.Printf("returnMessage %s", returnJson)
@@ -0,0 +1,207 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package activities
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	"github.com/futurewei-cloud/merak/services/merak-network/database"
+	"github.com/futurewei-cloud/merak/services/merak-network/utils"
+)
+
+// subnetPool hands out the host addresses of a subnet in order, skipping the
+// network, broadcast and gateway addresses.
+type subnetPool struct {
+	cidr    string
+	base    uint32
+	size    uint32
+	next    uint32
+	gateway uint32
+}
+
+func newSubnetPool(cidr string, gateway string) (*subnetPool, string, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil || ip.To4() == nil {
+		return nil, "", fmt.Errorf("invalid IPv4 subnet cidr %q", cidr)
+	}
+	ones, bits := network.Mask.Size()
+	if bits-ones < 2 {
+		return nil, "", fmt.Errorf("subnet %q has no room for hosts", cidr)
+	}
+	pool := &subnetPool{
+		cidr: cidr,
+		base: binary.BigEndian.Uint32(network.IP.To4()),
+		size: 1 << uint(bits-ones),
+		next: 1,
+	}
+	pool.gateway = 1
+	if gateway != "" {
+		gw := net.ParseIP(gateway).To4()
+		if gw == nil || !network.Contains(gw) {
+			return nil, "", fmt.Errorf("gateway %q is not in subnet %q", gateway, cidr)
+		}
+		pool.gateway = binary.BigEndian.Uint32(gw) - pool.base
+		if pool.gateway == 0 || pool.gateway == pool.size-1 {
+			return nil, "", fmt.Errorf("gateway %q is not a host address of subnet %q", gateway, cidr)
+		}
+	}
+	return pool, pool.ip(pool.gateway), nil
+}
+
+func (p *subnetPool) ip(offset uint32) string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, p.base+offset)
+	return ip.String()
+}
+
+func (p *subnetPool) allocate() (string, error) {
+	if p.next == p.gateway {
+		p.next++
+	}
+	if p.next >= p.size-1 {
+		return "", fmt.Errorf("no free address left in subnet %s", p.cidr)
+	}
+	ip := p.ip(p.next)
+	p.next++
+	return ip, nil
+}
+
+// MACs come from a counter in Redis so they stay unique across netconfigs
+func newStandaloneMac() (string, error) {
+	n, err := database.Rdb.Incr(database.Ctx, utils.MACCOUNTER).Result()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%02x:%02x:%02x:%02x", utils.STANDALONE_MAC_PREFIX, n>>24&0xff, n>>16&0xff, n>>8&0xff, n&0xff), nil
+}
+
+// Creates a subnet without Alcor, with number_vms ports that each get an IP
+// from its CIDR and a MAC.
+func standaloneSubnet(subnet *common_pb.InternalSubnetInfo) (*common_pb.InternalSubnetInfo, error) {
+	pool, gateway, err := newSubnetPool(subnet.SubnetCidr, subnet.SubnetGw)
+	if err != nil {
+		return nil, err
+	}
+	currentSubnet := common_pb.InternalSubnetInfo{
+		SubnetId:   utils.GenUUID(),
+		SubnetCidr: subnet.SubnetCidr,
+		SubnetGw:   gateway,
+		NumberVms:  subnet.NumberVms,
+	}
+	for i := 0; i < int(subnet.NumberVms); i++ {
+		ip, err := pool.allocate()
+		if err != nil {
+			return nil, err
+		}
+		mac, err := newStandaloneMac()
+		if err != nil {
+			return nil, err
+		}
+		port := common_pb.InternalPortInfo{
+			PortId: utils.GenUUID(),
+			Ip:     ip,
+			Mac:    mac,
+		}
+		database.Set(utils.PORT+port.PortId, &port)
+		currentSubnet.Ports = append(currentSubnet.Ports, &port)
+	}
+	database.Set(utils.SUBNET+currentSubnet.SubnetId, &currentSubnet)
+	return &currentSubnet, nil
+}
+
+func deleteStandaloneSubnet(subnet *common_pb.InternalSubnetInfo) {
+	for _, port := range subnet.Ports {
+		database.Del(utils.PORT + port.PortId)
+	}
+	database.Del(utils.SUBNET + subnet.SubnetId)
+}
+
+// Creates the virtual network without Alcor. IDs are generated locally and
+// every subnet gets number_vms ports with an IP from its CIDR and a MAC.
+func vnetCreateStandalone(netConfigId string, network *pb.InternalNetworkInfo) (*pb.ReturnNetworkMessage, error) {
+	log.Println("vnetCreateStandalone")
+	var returnNetworkMessage = pb.ReturnNetworkMessage{
+		ReturnCode:       common_pb.ReturnCode_OK,
+		ReturnMessage:    "returnNetworkMessage Finished",
+		Vpcs:             nil,
+		SecurityGroupIds: nil,
+	}
+
+	for _, vpc := range network.Vpcs {
+		currentVPC := common_pb.InternalVpcInfo{
+			VpcId:     utils.GenUUID(),
+			TenantId:  vpc.TenantId,
+			ProjectId: vpc.ProjectId,
+			VpcCidr:   vpc.VpcCidr,
+		}
+		for _, subnet := range vpc.Subnets {
+			currentSubnet, err := standaloneSubnet(subnet)
+			if err != nil {
+				return nil, err
+			}
+			currentVPC.Subnets = append(currentVPC.Subnets, currentSubnet)
+		}
+		database.Set(utils.VPC+currentVPC.VpcId, &currentVPC)
+		returnNetworkMessage.Vpcs = append(returnNetworkMessage.Vpcs, &currentVPC)
+	}
+
+	// Routers only exist on paper here, there is nothing to route through
+	for _, router := range network.Routers {
+		returnNetworkMessage.Routers = append(returnNetworkMessage.Routers, &pb.InternalRouterInfo{
+			Id:      utils.GenUUID(),
+			Name:    router.Name,
+			Subnets: router.Subnets,
+		})
+	}
+
+	for _, sg := range network.SecurityGroups {
+		sgId := utils.GenUUID()
+		database.Set(utils.SECURITYGROUP+sgId, sg)
+		returnNetworkMessage.SecurityGroupIds = append(returnNetworkMessage.SecurityGroupIds, sgId)
+		returnNetworkMessage.SecurityGroups = append(returnNetworkMessage.SecurityGroups, securityGroupInfo(sg, sgId))
+	}
+
+	database.Set(utils.NETCONFIG+netConfigId, &returnNetworkMessage)
+	log.Printf("vnetCreateStandalone done %s", &returnNetworkMessage)
+	return &returnNetworkMessage, nil
+}
+
+func vnetDeleteStandalone(netConfigId string) (*pb.ReturnNetworkMessage, error) {
+	log.Println("vnetDeleteStandalone")
+	values, err := database.Get(utils.NETCONFIG + netConfigId)
+	if err != nil {
+		return nil, err
+	}
+	var returnJson *pb.ReturnNetworkMessage
+	json.Unmarshal([]byte(values), &returnJson)
+
+	for _, vpc := range returnJson.Vpcs {
+		for _, subnet := range vpc.Subnets {
+			deleteStandaloneSubnet(subnet)
+		}
+		database.Del(utils.VPC + vpc.VpcId)
+	}
+	for _, sgId := range returnJson.SecurityGroupIds {
+		database.Del(utils.SECURITYGROUP + sgId)
+	}
+	database.Del(utils.NETCONFIG + netConfigId)
+	log.Println("vnetDeleteStandalone done")
+	return returnJson, nil
+}
@@ -0,0 +1,107 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package activities
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-network/database"
+	"github.com/futurewei-cloud/merak/services/merak-network/utils"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func useStandalone(t *testing.T) *miniredis.Miniredis {
+	mr := miniredis.RunT(t)
+	database.Rdb = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mode := utils.MODE
+	utils.MODE = constants.MODE_STANDALONE
+	t.Cleanup(func() { utils.MODE = mode })
+	return mr
+}
+
+func TestVnetStandalone(t *testing.T) {
+	mr := useStandalone(t)
+
+	network := &pb.InternalNetworkInfo{
+		Vpcs: []*common_pb.InternalVpcInfo{{
+			ProjectId: "123456789",
+			TenantId:  "123456789",
+			VpcCidr:   "10.8.0.0/16",
+			Subnets: []*common_pb.InternalSubnetInfo{
+				{SubnetCidr: "10.8.1.0/24", SubnetGw: "10.8.1.3", NumberVms: 3},
+				{SubnetCidr: "10.8.2.0/24", NumberVms: 2},
+			},
+		}},
+		SecurityGroups: []*pb.InternalSecurityGroupInfo{{Name: "sg"}},
+	}
+	ret, err := VnetCreate("net1", network, "123456789")
+	assert.Nil(t, err)
+	assert.Len(t, ret.Vpcs, 1)
+	assert.Len(t, ret.SecurityGroupIds, 1)
+	assert.NotEmpty(t, ret.Vpcs[0].VpcId)
+
+	subnets := ret.Vpcs[0].Subnets
+	assert.Equal(t, "10.8.1.3", subnets[0].SubnetGw)
+	assert.Equal(t, "10.8.2.1", subnets[1].SubnetGw)
+	var ips []string
+	macs := map[string]bool{}
+	for _, subnet := range subnets {
+		assert.NotEmpty(t, subnet.SubnetId)
+		for _, port := range subnet.Ports {
+			ips = append(ips, port.Ip)
+			macs[port.Mac] = true
+			assert.True(t, mr.Exists(utils.PORT+port.PortId))
+		}
+	}
+	// The gateway is skipped and every port gets its own MAC
+	assert.Equal(t, []string{"10.8.1.1", "10.8.1.2", "10.8.1.4", "10.8.2.2", "10.8.2.3"}, ips)
+	assert.Len(t, macs, 5)
+	assert.True(t, macs["02:00:00:00:00:01"])
+
+	info, err := VnetInfo("net1")
+	assert.Nil(t, err)
+	assert.Equal(t, ret.Vpcs[0].Subnets[1].Ports[1].Ip, info.Vpcs[0].Subnets[1].Ports[1].Ip)
+
+	// MACs stay unique across netconfigs
+	ret2, err := VnetCreate("net2", network, "123456789")
+	assert.Nil(t, err)
+	assert.False(t, macs[ret2.Vpcs[0].Subnets[0].Ports[0].Mac])
+
+	_, err = VnetDelete("net1", nil)
+	assert.Nil(t, err)
+	_, err = VnetDelete("net2", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{utils.MACCOUNTER}, mr.Keys())
+}
+
+func TestVnetStandaloneExhausted(t *testing.T) {
+	useStandalone(t)
+
+	network := &pb.InternalNetworkInfo{
+		Vpcs: []*common_pb.InternalVpcInfo{{
+			Subnets: []*common_pb.InternalSubnetInfo{{SubnetCidr: "10.8.1.0/30", NumberVms: 2}},
+		}},
+	}
+	_, err := VnetCreate("net1", network, "123456789")
+	assert.NotNil(t, err)
+
+	network.Vpcs[0].Subnets[0] = &common_pb.InternalSubnetInfo{SubnetCidr: "10.8.1.0/24", SubnetGw: "10.9.0.1"}
+	_, err = VnetCreate("net1", network, "123456789")
+	assert.NotNil(t, err)
+}
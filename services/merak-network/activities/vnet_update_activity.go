@@ -0,0 +1,738 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package activities
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-network/database"
+	"github.com/futurewei-cloud/merak/services/merak-network/utils"
+)
+
+// vnetOps creates and deletes single network resources, in Alcor or, in
+// standalone mode, only in Redis.
+type vnetOps interface {
+	createVpc(vpc *common_pb.InternalVpcInfo) (string, error)
+	createSubnet(subnet *common_pb.InternalSubnetInfo, vpcId string) (*common_pb.InternalSubnetInfo, error)
+	createRouter(vpcId string) (string, error)
+	createSg(sg *pb.InternalSecurityGroupInfo) (string, error)
+	// updateSgRules turns the rules of an existing group into the wanted
+	// ones and returns the rules it has afterwards, also when it fails
+	updateSgRules(sg *pb.InternalSecurityGroupInfo, wanted []*pb.InternalSecurityGroupRulelnfo) ([]*pb.InternalSecurityGroupRulelnfo, error)
+	attach(routerId string, subnetId string) error
+	detach(routerId string, subnetId string) error
+	deleteRouter(routerId string) error
+	deleteSubnet(subnet *common_pb.InternalSubnetInfo) error
+	deleteVpc(vpcId string) error
+	deleteSg(sgId string) error
+}
+
+type alcorOps struct {
+	projectId string
+	known     *knownIds
+}
+
+func (o alcorOps) createVpc(vpc *common_pb.InternalVpcInfo) (string, error) {
+	return createAlcorVpc(vpc, o.projectId, o.known)
+}
+
+func (o alcorOps) createSubnet(subnet *common_pb.InternalSubnetInfo, vpcId string) (*common_pb.InternalSubnetInfo, error) {
+	subnetId, err := createAlcorSubnet(subnet, vpcId, o.projectId, o.known)
+	if err != nil {
+		return nil, err
+	}
+	return &common_pb.InternalSubnetInfo{
+		SubnetId:   subnetId,
+		SubnetCidr: subnet.SubnetCidr,
+		SubnetGw:   subnet.SubnetGw,
+		NumberVms:  subnet.NumberVms,
+	}, nil
+}
+
+func (o alcorOps) createRouter(vpcId string) (string, error) {
+	return createAlcorRouter(vpcId, o.projectId, o.known)
+}
+
+func (o alcorOps) createSg(sg *pb.InternalSecurityGroupInfo) (string, error) {
+	return createAlcorSg(sg, o.projectId, o.known)
+}
+
+// The rule ids of a group are kept in the order of its rules
+func (o alcorOps) updateSgRules(sg *pb.InternalSecurityGroupInfo, wanted []*pb.InternalSecurityGroupRulelnfo) ([]*pb.InternalSecurityGroupRulelnfo, error) {
+	var ruleIds []string
+	if values, err := database.Get(utils.SECURITYGROUPRULES + sg.Id); err == nil {
+		json.Unmarshal([]byte(values), &ruleIds)
+	}
+	if len(ruleIds) != len(sg.Rules) {
+		return sg.Rules, fmt.Errorf("rules of security group %s are not tracked", sg.Name)
+	}
+	var rules []*pb.InternalSecurityGroupRulelnfo
+	var ids []string
+	for i, rule := range sg.Rules {
+		if containsRule(wanted, rule) {
+			rules = append(rules, rule)
+			ids = append(ids, ruleIds[i])
+			continue
+		}
+		ruleId := ruleIds[i]
+		err := withRetry("delete security group rule "+rule.Name, func() error {
+			return deleteSgRule(ruleId, o.projectId)
+		})
+		if err != nil {
+			// What wasn't looked at yet is still there as well
+			rules = append(rules, sg.Rules[i:]...)
+			ids = append(ids, ruleIds[i:]...)
+			database.Set(utils.SECURITYGROUPRULES+sg.Id, ids)
+			return rules, err
+		}
+	}
+	for _, rule := range wanted {
+		if containsRule(rules, rule) {
+			continue
+		}
+		ruleId, err := createAlcorSgRule(rule, sg.Id, sg, o.projectId, o.known)
+		if err != nil {
+			database.Set(utils.SECURITYGROUPRULES+sg.Id, ids)
+			return rules, err
+		}
+		rules = append(rules, rule)
+		ids = append(ids, ruleId)
+	}
+	database.Set(utils.SECURITYGROUPRULES+sg.Id, ids)
+	return rules, nil
+}
+
+func (o alcorOps) attach(routerId string, subnetId string) error {
+	return withRetry("attach subnet "+subnetId, func() error {
+		return doAttachRouter(routerId, subnetId, o.projectId)
+	})
+}
+
+func (o alcorOps) detach(routerId string, subnetId string) error {
+	return withRetry("detach subnet "+subnetId, func() error {
+		_, err := removeInterfaceToNeutronRouter(subnetId, routerId, o.projectId)
+		return err
+	})
+}
+
+func (o alcorOps) deleteRouter(routerId string) error {
+	return withRetry("delete router "+routerId, func() error {
+		_, err := deleteNeutronRouterByRouterId(routerId, o.projectId)
+		return err
+	})
+}
+
+func (o alcorOps) deleteSubnet(subnet *common_pb.InternalSubnetInfo) error {
+	return withRetry("delete subnet "+subnet.SubnetId, func() error {
+		_, err := deleteSubnet(subnet.SubnetId, o.projectId)
+		return err
+	})
+}
+
+func (o alcorOps) deleteVpc(vpcId string) error {
+	return withRetry("delete vpc "+vpcId, func() error {
+		_, err := deleteVpc(vpcId, o.projectId)
+		return err
+	})
+}
+
+func (o alcorOps) deleteSg(sgId string) error {
+	return withRetry("delete security group "+sgId, func() error {
+		_, err := deleteSg(sgId, o.projectId)
+		return err
+	})
+}
+
+// standaloneOps mirrors what vnetCreateStandalone and vnetDeleteStandalone do
+type standaloneOps struct{}
+
+func (standaloneOps) createVpc(vpc *common_pb.InternalVpcInfo) (string, error) {
+	vpcId := utils.GenUUID()
+	database.Set(utils.VPC+vpcId, &common_pb.InternalVpcInfo{
+		VpcId:     vpcId,
+		TenantId:  vpc.TenantId,
+		ProjectId: vpc.ProjectId,
+		VpcCidr:   vpc.VpcCidr,
+	})
+	return vpcId, nil
+}
+
+func (standaloneOps) createSubnet(subnet *common_pb.InternalSubnetInfo, vpcId string) (*common_pb.InternalSubnetInfo, error) {
+	return standaloneSubnet(subnet)
+}
+
+func (standaloneOps) createRouter(vpcId string) (string, error) {
+	return utils.GenUUID(), nil
+}
+
+func (standaloneOps) createSg(sg *pb.InternalSecurityGroupInfo) (string, error) {
+	sgId := utils.GenUUID()
+	database.Set(utils.SECURITYGROUP+sgId, sg)
+	return sgId, nil
+}
+
+func (standaloneOps) attach(routerId string, subnetId string) error {
+	return nil
+}
+
+func (standaloneOps) detach(routerId string, subnetId string) error {
+	return nil
+}
+
+func (standaloneOps) updateSgRules(sg *pb.InternalSecurityGroupInfo, wanted []*pb.InternalSecurityGroupRulelnfo) ([]*pb.InternalSecurityGroupRulelnfo, error) {
+	return wanted, nil
+}
+
+func (standaloneOps) deleteRouter(routerId string) error {
+	return nil
+}
+
+func (standaloneOps) deleteSubnet(subnet *common_pb.InternalSubnetInfo) error {
+	deleteStandaloneSubnet(subnet)
+	return nil
+}
+
+func (standaloneOps) deleteVpc(vpcId string) error {
+	database.Del(utils.VPC + vpcId)
+	return nil
+}
+
+func (standaloneOps) deleteSg(sgId string) error {
+	database.Del(utils.SECURITYGROUP + sgId)
+	return nil
+}
+
+// vnetUpdate holds what currently exists for a netconfig while an update is
+// applied to it. VPCs are matched by CIDR, subnets by CIDR within their VPC,
+// and routers and security groups by name.
+type vnetUpdate struct {
+	mu      sync.Mutex
+	request *pb.InternalNetworkInfo
+	stored  *pb.ReturnNetworkMessage
+	vpcs    map[string]*common_pb.InternalVpcInfo
+	subnets map[string]*common_pb.InternalSubnetInfo
+	// VPC CIDR of every subnet, by subnet CIDR
+	subnetVpc map[string]string
+	routers   map[string]*pb.InternalRouterInfo
+	sgs       map[string]*pb.InternalSecurityGroupInfo
+	// VPC CIDR of every requested subnet
+	wantedSubnetVpc map[string]string
+}
+
+func newVnetUpdate(stored *pb.ReturnNetworkMessage, request *pb.InternalNetworkInfo) (*vnetUpdate, error) {
+	u := &vnetUpdate{
+		request:         request,
+		stored:          stored,
+		vpcs:            make(map[string]*common_pb.InternalVpcInfo),
+		subnets:         make(map[string]*common_pb.InternalSubnetInfo),
+		subnetVpc:       make(map[string]string),
+		routers:         make(map[string]*pb.InternalRouterInfo),
+		sgs:             make(map[string]*pb.InternalSecurityGroupInfo),
+		wantedSubnetVpc: make(map[string]string),
+	}
+
+	wantedVpcs := make(map[string]bool)
+	for _, vpc := range request.Vpcs {
+		if wantedVpcs[vpc.VpcCidr] {
+			return nil, fmt.Errorf("duplicate vpc cidr %q", vpc.VpcCidr)
+		}
+		wantedVpcs[vpc.VpcCidr] = true
+		for _, subnet := range vpc.Subnets {
+			if _, ok := u.wantedSubnetVpc[subnet.SubnetCidr]; ok {
+				return nil, fmt.Errorf("duplicate subnet cidr %q", subnet.SubnetCidr)
+			}
+			u.wantedSubnetVpc[subnet.SubnetCidr] = vpc.VpcCidr
+		}
+	}
+	wantedRouters := make(map[string]bool)
+	for _, router := range request.Routers {
+		if wantedRouters[router.Name] {
+			return nil, fmt.Errorf("duplicate router name %q", router.Name)
+		}
+		wantedRouters[router.Name] = true
+		for _, subnet := range router.Subnets {
+			if _, ok := u.wantedSubnetVpc[subnet]; !ok {
+				return nil, fmt.Errorf("router %q uses unknown subnet %q", router.Name, subnet)
+			}
+		}
+	}
+	wantedSgs := make(map[string]bool)
+	for _, sg := range request.SecurityGroups {
+		if wantedSgs[sg.Name] {
+			return nil, fmt.Errorf("duplicate security group name %q", sg.Name)
+		}
+		wantedSgs[sg.Name] = true
+	}
+
+	for _, vpc := range stored.Vpcs {
+		u.vpcs[vpc.VpcCidr] = &common_pb.InternalVpcInfo{
+			VpcId:     vpc.VpcId,
+			TenantId:  vpc.TenantId,
+			ProjectId: vpc.ProjectId,
+			VpcCidr:   vpc.VpcCidr,
+		}
+		for _, subnet := range vpc.Subnets {
+			u.subnets[subnet.SubnetCidr] = subnet
+			u.subnetVpc[subnet.SubnetCidr] = vpc.VpcCidr
+		}
+	}
+	for _, router := range stored.Routers {
+		u.routers[router.Name] = &pb.InternalRouterInfo{
+			Id:      router.Id,
+			Name:    router.Name,
+			Subnets: append([]string(nil), router.Subnets...),
+		}
+	}
+	for _, sg := range stored.SecurityGroups {
+		u.sgs[sg.Name] = sg
+	}
+	return u, nil
+}
+
+// A subnet is kept when the request still has it under the same VPC, a
+// subnet that moved to another VPC is deleted and created again.
+func (u *vnetUpdate) keepsSubnet(cidr string) bool {
+	vpcCidr, ok := u.wantedSubnetVpc[cidr]
+	return ok && vpcCidr == u.subnetVpc[cidr]
+}
+
+func (u *vnetUpdate) locked(f func()) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	f()
+}
+
+// apply deletes what is no longer wanted, then creates what is new, stage by
+// stage so that nothing is touched before what it depends on. The first
+// failing stage stops the update, what was done until then stays recorded.
+func (u *vnetUpdate) apply(ops vnetOps) error {
+	wantedRouters := make(map[string]*pb.InternalRouterInfo)
+	for _, router := range u.request.Routers {
+		wantedRouters[router.Name] = router
+	}
+
+	// Routers: detach the subnets they lose, and delete the removed ones
+	var tasks []func() error
+	for _, router := range u.stored.Routers {
+		current := u.routers[router.Name]
+		wanted := wantedRouters[router.Name]
+		var detach []string
+		for _, subnet := range current.Subnets {
+			if wanted == nil || !containsString(wanted.Subnets, subnet) || !u.keepsSubnet(subnet) {
+				detach = append(detach, subnet)
+			}
+		}
+		if wanted != nil && len(detach) == 0 {
+			continue
+		}
+		subnetIds := make(map[string]string)
+		for _, subnet := range detach {
+			if info, ok := u.subnets[subnet]; ok {
+				subnetIds[subnet] = info.SubnetId
+			}
+		}
+		tasks = append(tasks, func() error {
+			for _, subnet := range detach {
+				if subnetId, ok := subnetIds[subnet]; ok {
+					if err := ops.detach(current.Id, subnetId); err != nil {
+						return err
+					}
+				}
+				u.locked(func() { current.Subnets = removeString(current.Subnets, subnet) })
+			}
+			if wanted != nil {
+				return nil
+			}
+			if err := ops.deleteRouter(current.Id); err != nil {
+				return err
+			}
+			u.locked(func() { delete(u.routers, current.Name) })
+			return nil
+		})
+	}
+	if err := runBounded(utils.CONCURRENCY, tasks); err != nil {
+		return err
+	}
+
+	// Subnets that are gone or moved to another VPC
+	tasks = nil
+	for cidr, subnet := range u.subnets {
+		if u.keepsSubnet(cidr) {
+			continue
+		}
+		cidr, subnet := cidr, subnet
+		tasks = append(tasks, func() error {
+			if err := ops.deleteSubnet(subnet); err != nil {
+				return err
+			}
+			u.locked(func() {
+				delete(u.subnets, cidr)
+				delete(u.subnetVpc, cidr)
+			})
+			return nil
+		})
+	}
+	if err := runBounded(utils.CONCURRENCY, tasks); err != nil {
+		return err
+	}
+
+	// VPCs and security groups that are gone
+	wantedVpcs := make(map[string]bool)
+	for _, vpc := range u.request.Vpcs {
+		wantedVpcs[vpc.VpcCidr] = true
+	}
+	wantedSgs := make(map[string]bool)
+	for _, sg := range u.request.SecurityGroups {
+		wantedSgs[sg.Name] = true
+	}
+	tasks = nil
+	for cidr, vpc := range u.vpcs {
+		if wantedVpcs[cidr] {
+			continue
+		}
+		cidr, vpc := cidr, vpc
+		tasks = append(tasks, func() error {
+			if err := ops.deleteVpc(vpc.VpcId); err != nil {
+				return err
+			}
+			u.locked(func() { delete(u.vpcs, cidr) })
+			return nil
+		})
+	}
+	for name, sg := range u.sgs {
+		if wantedSgs[name] {
+			continue
+		}
+		name, sg := name, sg
+		tasks = append(tasks, func() error {
+			if err := ops.deleteSg(sg.Id); err != nil {
+				return err
+			}
+			u.locked(func() { delete(u.sgs, name) })
+			return nil
+		})
+	}
+	if err := runBounded(utils.CONCURRENCY, tasks); err != nil {
+		return err
+	}
+
+	// New VPCs and security groups, and the rules of kept groups
+	tasks = nil
+	for _, vpc := range u.request.Vpcs {
+		if _, ok := u.vpcs[vpc.VpcCidr]; ok {
+			continue
+		}
+		vpc := vpc
+		tasks = append(tasks, func() error {
+			vpcId, err := ops.createVpc(vpc)
+			if err != nil {
+				return err
+			}
+			u.locked(func() {
+				u.vpcs[vpc.VpcCidr] = &common_pb.InternalVpcInfo{
+					VpcId:     vpcId,
+					TenantId:  vpc.TenantId,
+					ProjectId: vpc.ProjectId,
+					VpcCidr:   vpc.VpcCidr,
+				}
+			})
+			return nil
+		})
+	}
+	for _, sg := range u.request.SecurityGroups {
+		sg := sg
+		if current, ok := u.sgs[sg.Name]; ok {
+			if sameRules(current.Rules, sg.Rules) {
+				continue
+			}
+			tasks = append(tasks, func() error {
+				rules, err := ops.updateSgRules(current, sg.Rules)
+				u.locked(func() {
+					updated := securityGroupInfo(current, current.Id)
+					updated.Rules = rules
+					u.sgs[sg.Name] = updated
+				})
+				return err
+			})
+			continue
+		}
+		tasks = append(tasks, func() error {
+			sgId, err := ops.createSg(sg)
+			if err != nil {
+				return err
+			}
+			u.locked(func() { u.sgs[sg.Name] = securityGroupInfo(sg, sgId) })
+			return nil
+		})
+	}
+	if err := runBounded(utils.CONCURRENCY, tasks); err != nil {
+		return err
+	}
+
+	// New subnets, in new and kept VPCs alike
+	tasks = nil
+	for _, vpc := range u.request.Vpcs {
+		vpcId := u.vpcs[vpc.VpcCidr].VpcId
+		for _, subnet := range vpc.Subnets {
+			if _, ok := u.subnets[subnet.SubnetCidr]; ok {
+				continue
+			}
+			vpcCidr, subnet := vpc.VpcCidr, subnet
+			tasks = append(tasks, func() error {
+				created, err := ops.createSubnet(subnet, vpcId)
+				if err != nil {
+					return err
+				}
+				u.locked(func() {
+					u.subnets[subnet.SubnetCidr] = created
+					u.subnetVpc[subnet.SubnetCidr] = vpcCidr
+				})
+				return nil
+			})
+		}
+	}
+	if err := runBounded(utils.CONCURRENCY, tasks); err != nil {
+		return err
+	}
+
+	// New routers, and the subnets routers gain
+	tasks = nil
+	for _, router := range u.request.Routers {
+		current := u.routers[router.Name]
+		var attach []string
+		for _, subnet := range router.Subnets {
+			if current == nil || !containsString(current.Subnets, subnet) {
+				attach = append(attach, subnet)
+			}
+		}
+		if current != nil && len(attach) == 0 {
+			continue
+		}
+		subnetIds := make(map[string]string)
+		for _, subnet := range attach {
+			subnetIds[subnet] = u.subnets[subnet].SubnetId
+		}
+		// As in VnetCreate the gateway sits in the VPC of the first subnet
+		var vpcId string
+		if len(router.Subnets) > 0 {
+			vpcId = u.vpcs[u.subnetVpc[router.Subnets[0]]].VpcId
+		}
+		router := router
+		tasks = append(tasks, func() error {
+			if current == nil {
+				routerId, err := ops.createRouter(vpcId)
+				if err != nil {
+					return err
+				}
+				current = &pb.InternalRouterInfo{Id: routerId, Name: router.Name}
+				u.locked(func() { u.routers[router.Name] = current })
+			}
+			for _, subnet := range attach {
+				if err := ops.attach(current.Id, subnetIds[subnet]); err != nil {
+					return err
+				}
+				u.locked(func() { current.Subnets = append(current.Subnets, subnet) })
+			}
+			return nil
+		})
+	}
+	return runBounded(utils.CONCURRENCY, tasks)
+}
+
+// result lists what exists now in the order of the request, followed by
+// anything left over from the stored record that couldn't be deleted.
+func (u *vnetUpdate) result() *pb.ReturnNetworkMessage {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var returnNetworkMessage = pb.ReturnNetworkMessage{
+		ReturnCode:    common_pb.ReturnCode_OK,
+		ReturnMessage: "returnNetworkMessage Finished",
+	}
+
+	var vpcCidrs []string
+	subnetCidrs := make(map[string][]string)
+	for _, vpc := range u.request.Vpcs {
+		vpcCidrs = append(vpcCidrs, vpc.VpcCidr)
+		for _, subnet := range vpc.Subnets {
+			subnetCidrs[vpc.VpcCidr] = append(subnetCidrs[vpc.VpcCidr], subnet.SubnetCidr)
+		}
+	}
+	for _, vpc := range u.stored.Vpcs {
+		vpcCidrs = append(vpcCidrs, vpc.VpcCidr)
+		for _, subnet := range vpc.Subnets {
+			subnetCidrs[vpc.VpcCidr] = append(subnetCidrs[vpc.VpcCidr], subnet.SubnetCidr)
+		}
+	}
+	for _, cidr := range uniqueStrings(vpcCidrs) {
+		vpc, ok := u.vpcs[cidr]
+		if !ok {
+			continue
+		}
+		for _, subnetCidr := range uniqueStrings(subnetCidrs[cidr]) {
+			if subnet, ok := u.subnets[subnetCidr]; ok && u.subnetVpc[subnetCidr] == cidr {
+				vpc.Subnets = append(vpc.Subnets, subnet)
+			}
+		}
+		returnNetworkMessage.Vpcs = append(returnNetworkMessage.Vpcs, vpc)
+	}
+
+	var routerNames []string
+	routerSubnets := make(map[string][]string)
+	for _, router := range u.request.Routers {
+		routerNames = append(routerNames, router.Name)
+		routerSubnets[router.Name] = router.Subnets
+	}
+	for _, router := range u.stored.Routers {
+		routerNames = append(routerNames, router.Name)
+	}
+	for _, name := range uniqueStrings(routerNames) {
+		router, ok := u.routers[name]
+		if !ok {
+			continue
+		}
+		var subnets []string
+		for _, subnet := range uniqueStrings(append(append([]string(nil), routerSubnets[name]...), router.Subnets...)) {
+			if containsString(router.Subnets, subnet) {
+				subnets = append(subnets, subnet)
+			}
+		}
+		router.Subnets = subnets
+		returnNetworkMessage.Routers = append(returnNetworkMessage.Routers, router)
+	}
+
+	var sgNames []string
+	for _, sg := range u.request.SecurityGroups {
+		sgNames = append(sgNames, sg.Name)
+	}
+	for _, sg := range u.stored.SecurityGroups {
+		sgNames = append(sgNames, sg.Name)
+	}
+	for _, name := range uniqueStrings(sgNames) {
+		if sg, ok := u.sgs[name]; ok {
+			returnNetworkMessage.SecurityGroups = append(returnNetworkMessage.SecurityGroups, sg)
+			returnNetworkMessage.SecurityGroupIds = append(returnNetworkMessage.SecurityGroupIds, sg.Id)
+		}
+	}
+	return &returnNetworkMessage
+}
+
+// Rules are the same when everything but their id matches
+func equalRules(a *pb.InternalSecurityGroupRulelnfo, b *pb.InternalSecurityGroupRulelnfo) bool {
+	return a.Name == b.Name &&
+		a.Description == b.Description &&
+		a.Ethertype == b.Ethertype &&
+		a.Direction == b.Direction &&
+		a.Protocol == b.Protocol &&
+		a.PortRange == b.PortRange &&
+		a.RemoteGroupId == b.RemoteGroupId &&
+		a.RemoteIpPrefix == b.RemoteIpPrefix
+}
+
+func containsRule(list []*pb.InternalSecurityGroupRulelnfo, rule *pb.InternalSecurityGroupRulelnfo) bool {
+	for _, item := range list {
+		if equalRules(item, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameRules(a []*pb.InternalSecurityGroupRulelnfo, b []*pb.InternalSecurityGroupRulelnfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, rule := range a {
+		if !containsRule(b, rule) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(list []string, value string) []string {
+	var kept []string
+	for _, item := range list {
+		if item != value {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+func uniqueStrings(list []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, item := range list {
+		if !seen[item] {
+			seen[item] = true
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
+
+// Brings the network of a netconfig in line with the given one, creating
+// and deleting only what differs from the stored record. The number_vms of a
+// subnet that already exists is not changed. Security groups that are kept
+// gain the rules that were added or changed and lose the others. The stored
+// record is rewritten even when the update fails part way, so that a later
+// update or delete picks up from what really exists.
+func VnetUpdate(netConfigId string, network *pb.InternalNetworkInfo, projectId string) (*pb.ReturnNetworkMessage, error) {
+	log.Println("VnetUpdate")
+	values, err := database.Get(utils.NETCONFIG + netConfigId)
+	if err != nil {
+		return nil, err
+	}
+	var stored pb.ReturnNetworkMessage
+	if err := json.Unmarshal([]byte(values), &stored); err != nil {
+		return nil, err
+	}
+	u, err := newVnetUpdate(&stored, network)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops vnetOps = standaloneOps{}
+	if utils.MODE != constants.MODE_STANDALONE {
+		known, err := newKnownIds(projectId)
+		if err != nil {
+			return nil, err
+		}
+		ops = alcorOps{projectId: projectId, known: known}
+	}
+	updateErr := u.apply(ops)
+	returnNetworkMessage := u.result()
+	database.Set(utils.NETCONFIG+netConfigId, returnNetworkMessage)
+	if updateErr != nil {
+		log.Printf("VnetUpdate failed: %s", updateErr)
+		return nil, updateErr
+	}
+	log.Printf("VnetUpdate done %s", returnNetworkMessage)
+	return returnNetworkMessage, nil
+}
@@ -0,0 +1,206 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package activities
+
+import (
+	"net/http"
+	"testing"
+
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	"github.com/futurewei-cloud/merak/services/common/alcormock"
+	"github.com/futurewei-cloud/merak/services/merak-network/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// testNetwork(2, 2) with a third VPC, without the second subnet of the first
+// VPC and with sg-1 replaced by sg-web
+func updatedTestNetwork() *pb.InternalNetworkInfo {
+	network := testNetwork(3, 2)
+	network.Vpcs[0].Subnets = network.Vpcs[0].Subnets[:1]
+	network.Routers[0].Subnets = network.Routers[0].Subnets[:1]
+	network.SecurityGroups[1] = &pb.InternalSecurityGroupInfo{Name: "sg-web", ProjectId: "123456789", TenantId: "123456789"}
+	return network
+}
+
+func TestVnetUpdateAlcor(t *testing.T) {
+	mock := useAlcorMock(t)
+
+	created, err := VnetCreate("net1", testNetwork(2, 2), "123456789")
+	assert.Nil(t, err)
+
+	ret, err := VnetUpdate("net1", updatedTestNetwork(), "123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, mock.Count(alcormock.VPCS))
+	assert.Equal(t, 5, mock.Count(alcormock.SUBNETS))
+	assert.Equal(t, 3, mock.Count(alcormock.ROUTERS))
+	assert.Equal(t, 2, mock.Count(alcormock.SECURITY_GROUPS))
+	assert.Equal(t, 1, mock.Count(alcormock.SECURITY_GROUP_RULES))
+	// Only the difference went to Alcor
+	assert.Equal(t, 3, mock.Requests(http.MethodPost, alcormock.VPCS))
+	assert.Equal(t, 6, mock.Requests(http.MethodPost, alcormock.SUBNETS))
+	assert.Equal(t, 1, mock.Requests(http.MethodDelete, alcormock.SUBNETS))
+
+	// What was kept keeps its id, and the reply follows the request
+	assert.Len(t, ret.Vpcs, 3)
+	assert.Equal(t, created.Vpcs[0].VpcId, ret.Vpcs[0].VpcId)
+	assert.Equal(t, created.Vpcs[0].Subnets[0].SubnetId, ret.Vpcs[0].Subnets[0].SubnetId)
+	assert.Len(t, ret.Vpcs[0].Subnets, 1)
+	assert.Equal(t, "10.2.0.0/16", ret.Vpcs[2].VpcCidr)
+	assert.Len(t, ret.Vpcs[2].Subnets, 2)
+	assert.Equal(t, created.Routers[0].Id, ret.Routers[0].Id)
+	assert.Equal(t, []string{"10.0.0.0/24"}, ret.Routers[0].Subnets)
+	assert.Equal(t, []string{"10.2.0.0/24", "10.2.1.0/24"}, ret.Routers[2].Subnets)
+	assert.Equal(t, created.SecurityGroupIds[0], ret.SecurityGroupIds[0])
+	assert.Equal(t, "sg-web", ret.SecurityGroups[1].Name)
+	for _, subnet := range ret.Vpcs[2].Subnets {
+		assert.Equal(t, ret.Routers[2].Id, mock.Get(alcormock.SUBNETS, subnet.SubnetId)["attached_router_id"])
+	}
+
+	info, err := VnetInfo("net1")
+	assert.Nil(t, err)
+	assert.Equal(t, ret.SecurityGroupIds, info.SecurityGroupIds)
+
+	// Going back removes what the update added
+	_, err = VnetUpdate("net1", testNetwork(2, 2), "123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, mock.Count(alcormock.VPCS))
+	assert.Equal(t, 4, mock.Count(alcormock.SUBNETS))
+	assert.Equal(t, 2, mock.Count(alcormock.ROUTERS))
+
+	_, err = VnetDelete("net1", nil)
+	assert.Nil(t, err)
+	assertNoAlcorResources(t, mock)
+}
+
+func TestVnetUpdateSgRules(t *testing.T) {
+	mock := useAlcorMock(t)
+
+	created, err := VnetCreate("net1", testNetwork(1, 1), "123456789")
+	assert.Nil(t, err)
+
+	// sg-0 opens another port for ssh and gains a rule for http
+	network := testNetwork(1, 1)
+	network.SecurityGroups[0].Rules[0].PortRange = "2222"
+	network.SecurityGroups[0].Rules = append(network.SecurityGroups[0].Rules, &pb.InternalSecurityGroupRulelnfo{
+		Name:      "http",
+		Direction: "ingress",
+		Ethertype: "IPv4",
+		Protocol:  "tcp",
+		PortRange: "80",
+	})
+	ret, err := VnetUpdate("net1", network, "123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, created.SecurityGroupIds, ret.SecurityGroupIds)
+	assert.Equal(t, 2, mock.Count(alcormock.SECURITY_GROUPS))
+	assert.Equal(t, 3, mock.Count(alcormock.SECURITY_GROUP_RULES))
+	assert.Equal(t, 1, mock.Requests(http.MethodDelete, alcormock.SECURITY_GROUP_RULES))
+	assert.Len(t, ret.SecurityGroups[0].Rules, 2)
+	rules, _ := mock.Get(alcormock.SECURITY_GROUPS, ret.SecurityGroupIds[0])["security_group_rules"].([]interface{})
+	var ports []interface{}
+	for _, rule := range rules {
+		ports = append(ports, rule.(map[string]interface{})["port_range_min"])
+	}
+	assert.ElementsMatch(t, []interface{}{2222.0, 80.0}, ports)
+
+	// Unchanged rules are left alone
+	posts := mock.Requests(http.MethodPost, alcormock.SECURITY_GROUP_RULES)
+	_, err = VnetUpdate("net1", network, "123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, posts, mock.Requests(http.MethodPost, alcormock.SECURITY_GROUP_RULES))
+	assert.Equal(t, 1, mock.Requests(http.MethodDelete, alcormock.SECURITY_GROUP_RULES))
+
+	_, err = VnetDelete("net1", nil)
+	assert.Nil(t, err)
+	assertNoAlcorResources(t, mock)
+}
+
+func TestVnetUpdateFailure(t *testing.T) {
+	mock := useAlcorMock(t)
+
+	_, err := VnetCreate("net1", testNetwork(2, 2), "123456789")
+	assert.Nil(t, err)
+
+	// The new VPC is created but none of its subnets, one at a time so the
+	// injected errors are used up by the first subnet
+	concurrency := utils.CONCURRENCY
+	utils.CONCURRENCY = 1
+	defer func() { utils.CONCURRENCY = concurrency }()
+	mock.InjectError(http.MethodPost, alcormock.SUBNETS, http.StatusInternalServerError, utils.RETRY_ATTEMPTS)
+	_, err = VnetUpdate("net1", updatedTestNetwork(), "123456789")
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, mock.Count(alcormock.VPCS))
+
+	// The stored record still knows about it so nothing is leaked
+	info, err := VnetInfo("net1")
+	assert.Nil(t, err)
+	assert.Len(t, info.Vpcs, 3)
+	assert.Empty(t, info.Vpcs[2].Subnets)
+
+	_, err = VnetDelete("net1", nil)
+	assert.Nil(t, err)
+	assertNoAlcorResources(t, mock)
+}
+
+func TestVnetUpdateInvalid(t *testing.T) {
+	useAlcorMock(t)
+
+	_, err := VnetUpdate("net1", testNetwork(1, 1), "123456789")
+	assert.NotNil(t, err)
+
+	_, err = VnetCreate("net1", testNetwork(1, 1), "123456789")
+	assert.Nil(t, err)
+	network := testNetwork(2, 1)
+	network.Vpcs[1].VpcCidr = network.Vpcs[0].VpcCidr
+	_, err = VnetUpdate("net1", network, "123456789")
+	assert.NotNil(t, err)
+	network = testNetwork(1, 1)
+	network.Routers[0].Subnets = append(network.Routers[0].Subnets, "10.9.0.0/24")
+	_, err = VnetUpdate("net1", network, "123456789")
+	assert.NotNil(t, err)
+}
+
+func TestVnetUpdateStandalone(t *testing.T) {
+	mr := useStandalone(t)
+
+	network := &pb.InternalNetworkInfo{
+		Vpcs: []*common_pb.InternalVpcInfo{{
+			VpcCidr: "10.8.0.0/16",
+			Subnets: []*common_pb.InternalSubnetInfo{
+				{SubnetCidr: "10.8.1.0/24", NumberVms: 2},
+				{SubnetCidr: "10.8.2.0/24", NumberVms: 2},
+			},
+		}},
+	}
+	created, err := VnetCreate("net1", network, "123456789")
+	assert.Nil(t, err)
+
+	network.Vpcs[0].Subnets = []*common_pb.InternalSubnetInfo{
+		{SubnetCidr: "10.8.2.0/24", NumberVms: 2},
+		{SubnetCidr: "10.8.3.0/24", NumberVms: 1},
+	}
+	ret, err := VnetUpdate("net1", network, "123456789")
+	assert.Nil(t, err)
+	assert.Equal(t, created.Vpcs[0].VpcId, ret.Vpcs[0].VpcId)
+	assert.Len(t, ret.Vpcs[0].Subnets, 2)
+	assert.Equal(t, created.Vpcs[0].Subnets[1].Ports, ret.Vpcs[0].Subnets[0].Ports)
+	assert.Equal(t, "10.8.3.2", ret.Vpcs[0].Subnets[1].Ports[0].Ip)
+	for _, port := range created.Vpcs[0].Subnets[0].Ports {
+		assert.False(t, mr.Exists(utils.PORT+port.PortId))
+	}
+
+	_, err = VnetDelete("net1", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{utils.MACCOUNTER}, mr.Keys())
+}
@@ -192,6 +192,41 @@ type SgReturnDB struct {
 	UpdateAt string `json:"update_at"`
 }
 
+type SgRuleBody struct {
+	Description     string  `json:"description"`
+	Direction       string  `json:"direction"`
+	Ethertype       string  `json:"ethertype"`
+	Name            string  `json:"name"`
+	PortRangeMax    *int    `json:"port_range_max"`
+	PortRangeMin    *int    `json:"port_range_min"`
+	Protocol        *string `json:"protocol"`
+	ProjectId       string  `json:"project_id"`
+	RemoteGroupId   *string `json:"remote_group_id"`
+	RemoteIpPrefix  *string `json:"remote_ip_prefix"`
+	SecurityGroupId string  `json:"security_group_id"`
+	TenantId        string  `json:"tenant_id"`
+}
+type SgRuleStruct struct {
+	SgRule SgRuleBody `json:"security_group_rule"`
+}
+type SgRuleReturn struct {
+	SecurityGroupRule struct {
+		ID              string      `json:"id"`
+		ProjectID       string      `json:"project_id"`
+		TenantID        string      `json:"tenant_id"`
+		Name            string      `json:"name"`
+		Description     string      `json:"description"`
+		SecurityGroupID string      `json:"security_group_id"`
+		RemoteGroupID   interface{} `json:"remote_group_id"`
+		Direction       string      `json:"direction"`
+		RemoteIPPrefix  interface{} `json:"remote_ip_prefix"`
+		Protocol        interface{} `json:"protocol"`
+		PortRangeMax    interface{} `json:"port_range_max"`
+		PortRangeMin    interface{} `json:"port_range_min"`
+		Ethertype       string      `json:"ethertype"`
+	} `json:"security_group_rule"`
+}
+
 type SubnetBody struct {
 	Cider     string `json:"cidr"`
 	Id        string `json:"id"`
@@ -332,7 +367,7 @@ type RouterBody struct {
 	ServiceTypeId         string                    `json:"service_type_id"`
 	Status                string                    `json:"status"`
 	Tags                  []string                  `json:"tags"`
-	TenantId              string                    `json:"tenant_id":`
+	TenantId              string                    `json:"tenant_id"`
 }
 type RouterStruct struct {
 	Router RouterBody `json:"router"`
@@ -70,7 +70,7 @@ func (s *Server) NetConfigHandler(ctx context.Context, in *pb.InternalNetConfigI
 				currentError = err
 			}
 			networkInfoReturn <- vnetInfoReturn
-			log.Printf("networkInfoReturn: %s", networkInfoReturn)
+			log.Printf("networkInfoReturn: %v", networkInfoReturn)
 		}()
 
 		returnNetworkMessage := <-networkInfoReturn
@@ -155,6 +155,31 @@ func (s *Server) NetConfigHandler(ctx context.Context, in *pb.InternalNetConfigI
 		return returnNetworkMessage, nil
 	case common_pb.OperationType_UPDATE:
 		log.Println("Update")
+		var projectId string
+		if len(in.Config.GetNetwork().GetVpcs()) > 0 {
+			projectId = in.Config.Network.Vpcs[0].ProjectId
+		}
+		networkUpdateReturn := make(chan *pb.ReturnNetworkMessage)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var vnetUpdateReturn, err = activities.VnetUpdate(netConfigId, in.Config.GetNetwork(), projectId)
+			if err != nil {
+				returnNetworkMessage.ReturnCode = common_pb.ReturnCode_FAILED
+				returnNetworkMessage.ReturnMessage = err.Error()
+				ifAnyFailure = true
+				currentError = err
+			}
+			networkUpdateReturn <- vnetUpdateReturn
+			log.Printf("networkUpdateReturn: %s", vnetUpdateReturn)
+		}()
+		returnNetworkMessage := <-networkUpdateReturn
+		wg.Wait()
+		if ifAnyFailure {
+			return nil, currentError
+		}
+		log.Printf("networkUpdateReturn returnNetworkMessage %s", returnNetworkMessage)
+		return returnNetworkMessage, nil
 	case common_pb.OperationType_DELETE:
 		log.Println("Delete")
 		networkDeleteReturn := make(chan *pb.ReturnNetworkMessage)
@@ -190,6 +215,4 @@ func (s *Server) NetConfigHandler(ctx context.Context, in *pb.InternalNetConfigI
 		returnNetworkMessage.ReturnMessage = "NetworkHandler: Unknown Operation"
 		return &returnNetworkMessage, nil
 	}
-
-	return &returnNetworkMessage, nil
 }
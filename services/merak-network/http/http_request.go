@@ -24,6 +24,17 @@ import (
 	"time"
 )
 
+// StatusError is returned by RequestCall when the server answers with a
+// status outside of 2xx. Its message is the body of the response.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return e.Body
+}
+
 func RequestCall(url, method string, bodyIn interface{}, headers []string) (string, error) {
 	client := &http.Client{
 		Timeout: time.Second * 20,
@@ -42,14 +53,14 @@ func RequestCall(url, method string, bodyIn interface{}, headers []string) (stri
 	}
 	response, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("Got error %s", err.Error())
+		return "", fmt.Errorf("Got error %w", err)
 	}
 	defer response.Body.Close()
 	bodyBytes, _ := ioutil.ReadAll(response.Body)
 	bodyString := string(bodyBytes)
 	if response.StatusCode < 200 || response.StatusCode > 299 {
 		log.Println("RequestCall Fail ", response.StatusCode, bodyString)
-		return "", fmt.Errorf(bodyString)
+		return "", &StatusError{StatusCode: response.StatusCode, Body: bodyString}
 	}
 	return bodyString, nil
 }
@@ -18,10 +18,14 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"strconv"
 
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	constants "github.com/futurewei-cloud/merak/services/common"
 	"github.com/futurewei-cloud/merak/services/merak-network/database"
 	"github.com/futurewei-cloud/merak/services/merak-network/grpc/service"
+	"github.com/futurewei-cloud/merak/services/merak-network/utils"
 	"google.golang.org/grpc"
 )
 
@@ -31,6 +35,21 @@ func main() {
 		fmt.Printf("Cannot connect to Redis db!, error: '%s'\n", err)
 	}
 	flag.Parse()
+	if val, ok := os.LookupEnv(constants.MODE_ENV); ok {
+		utils.MODE = val
+	}
+	log.Printf("Running in mode %s", utils.MODE)
+	if val, ok := os.LookupEnv(utils.CONCURRENCY_ENV); ok {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			utils.CONCURRENCY = n
+		}
+	}
+	if val, ok := os.LookupEnv(utils.RETRY_ATTEMPTS_ENV); ok {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			utils.RETRY_ATTEMPTS = n
+		}
+	}
+	log.Printf("Alcor concurrency %d, retry attempts %d", utils.CONCURRENCY, utils.RETRY_ATTEMPTS)
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *service.Port))
 	if err != nil {
 		log.Printf("failed to listen: %v", err)
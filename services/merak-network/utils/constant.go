@@ -13,6 +13,12 @@ Copyright(c) 2022 Futurewei Cloud
 
 package utils
 
+import (
+	"time"
+
+	constants "github.com/futurewei-cloud/merak/services/common"
+)
+
 const CODE_SUCCESS uint16 = 200
 const CODE_FAILED uint16 = 500
 const CODE_NOT_FOUND uint16 = 400
@@ -21,7 +27,31 @@ const VPC string = "vpc:"
 const SUBNET string = "subnet:"
 const Router string = "router:"
 const SECURITYGROUP string = "securityGroup:"
+const SECURITYGROUPRULE string = "securityGroupRule:"
+const SECURITYGROUPRULES string = "securityGroupRules:"
 const NETCONFIG string = "netconfig:"
 const NODEGROUP string = "nodeGroup:"
+const PORT string = "port:"
+
+// Counter behind the MACs handed out in standalone mode
+const MACCOUNTER string = "ipam:macCounter"
+
+// Locally administered prefix of the MACs handed out in standalone mode
+const STANDALONE_MAC_PREFIX string = "02:00"
 
 var ALCORURL = ""
+
+// Either constants.MODE_ALCOR or constants.MODE_STANDALONE, set from the MODE env at startup
+var MODE = constants.MODE_ALCOR
+
+// Upper bound of Alcor requests VnetCreate keeps in flight
+const CONCURRENCY_ENV string = "NETWORK_CONCURRENCY"
+
+var CONCURRENCY = 16
+
+// Attempts per Alcor resource, and the wait before the first retry which
+// doubles after every failed attempt
+const RETRY_ATTEMPTS_ENV string = "NETWORK_RETRY_ATTEMPTS"
+
+var RETRY_ATTEMPTS = 3
+var RETRY_BACKOFF = 200 * time.Millisecond
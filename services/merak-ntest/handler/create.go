@@ -0,0 +1,178 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package handler
+
+import (
+	"context"
+	"sync"
+
+	agent_pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/merak-ntest/common"
+	"github.com/google/uuid"
+)
+
+func caseCreate(ctx context.Context, in *pb.InternalTestConfiguration) (*pb.ReturnTestMessage, error) {
+	test, dests, err := getTestTargets(ctx, in)
+	if err != nil {
+		MerakLogger.Error("Unable to get test targets from redis", "err", err)
+		return &pb.ReturnTestMessage{
+			ReturnMessage: "Unable to get test targets from redis",
+			ReturnCode:    common_pb.ReturnCode_FAILED,
+		}, err
+	}
+	if _, ok := tests.get(test.Id); ok {
+		MerakLogger.Error("Test already exists", "id", test.Id)
+		return &pb.ReturnTestMessage{
+			ReturnMessage: "Test " + test.Id + " already exists",
+			ReturnCode:    common_pb.ReturnCode_FAILED,
+		}, errTestExists
+	}
+	tests.add(test)
+
+	go runTest(test, dests)
+
+	results, _ := tests.get(test.Id)
+	MerakLogger.Info("Started test", "id", test.Id, "type", test.TestType.String(), "targets", len(dests))
+	return &pb.ReturnTestMessage{
+		ReturnMessage: "Started test " + test.Id,
+		ReturnCode:    common_pb.ReturnCode_OK,
+		Results:       results,
+	}, nil
+}
+
+// getTestTargets builds the test from every VM merak-compute has recorded
+// for the compute config of the request, grouped by the vhost pod the VM
+// lives in. It also returns the IPs of all
+// VMs, which are the destinations for a PINGALL test.
+func getTestTargets(ctx context.Context, in *pb.InternalTestConfiguration) (*pb.InternalTestInfo, []string, error) {
+	id := in.Id
+	if id == "" {
+		id = uuid.NewString()
+	}
+	test := &pb.InternalTestInfo{
+		Id:       id,
+		TestType: in.TestType,
+		Hosts:    []*pb.InternalVMHost{},
+	}
+	dests := []string{}
+
+	configID := in.ComputeConfigId
+	pods, err := common.RedisClient.SMembers(ctx, constants.ComputeNodeIPSetKey(configID)).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, podID := range pods {
+		pod, err := common.RedisClient.HGetAll(ctx, constants.ComputePodKey(configID, podID)).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		host := &pb.InternalVMHost{
+			Name: pod["name"],
+			Ip:   pod["ip"],
+			Vms:  []*pb.InternalVMTestInfo{},
+		}
+		vmIDs, err := common.RedisClient.LRange(ctx, constants.ComputePodVMListKey(configID, podID), 0, -1).Result()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, vmID := range vmIDs {
+			vm, err := common.RedisClient.HGetAll(ctx, vmID).Result()
+			if err != nil {
+				return nil, nil, err
+			}
+			host.Vms = append(host.Vms, &pb.InternalVMTestInfo{
+				Name:    vm["name"],
+				Id:      vmID,
+				Ip:      vm["ip"],
+				Results: pb.TestStatus_RUNNING,
+			})
+			if vm["ip"] != "" {
+				dests = append(dests, vm["ip"])
+			}
+		}
+		test.Hosts = append(test.Hosts, host)
+	}
+	return test, dests, nil
+}
+
+// runTest fans the test out to the agent on every host and records each
+// VM's result as it comes back. Hosts are tested in parallel, with at most
+// NTEST_AGENT_CONCURRENCY outstanding requests per agent.
+func runTest(test *pb.InternalTestInfo, dests []string) {
+	var wg sync.WaitGroup
+	for _, host := range test.Hosts {
+		wg.Add(1)
+		go func(host *pb.InternalVMHost) {
+			defer wg.Done()
+			runHostTest(test.TestType, host, dests)
+		}(host)
+	}
+	wg.Wait()
+	MerakLogger.Info("Test finished", "id", test.Id)
+}
+
+func runHostTest(testType pb.TestType, host *pb.InternalVMHost, dests []string) {
+	client, conn, err := NewAgentClient(host.Ip)
+	if err != nil {
+		MerakLogger.Error("Failed to dial agent", "host", host.Name, "ip", host.Ip, "err", err)
+		for _, vm := range host.Vms {
+			tests.setResult(vm, pb.TestStatus_FAILED)
+		}
+		return
+	}
+	defer conn.Close()
+
+	sem := make(chan struct{}, common.NTEST_AGENT_CONCURRENCY)
+	var wg sync.WaitGroup
+	for _, vm := range host.Vms {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(vm *pb.InternalVMTestInfo) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			tests.setResult(vm, runVMTest(client, testType, vm, dests))
+		}(vm)
+	}
+	wg.Wait()
+}
+
+func runVMTest(client agent_pb.MerakAgentServiceClient, testType pb.TestType, vm *pb.InternalVMTestInfo, dests []string) pb.TestStatus {
+	targets := make([]string, 0, len(dests))
+	for _, dest := range dests {
+		if dest != vm.Ip {
+			targets = append(targets, dest)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), common.NTEST_AGENT_TIMEOUT)
+	defer cancel()
+	resp, err := client.TestHandler(ctx, &agent_pb.InternalTestTargetConfig{
+		Src:      vm.Name,
+		Dest:     targets,
+		TestType: testType,
+	})
+	if err != nil {
+		MerakLogger.Error("Test failed on agent", "vm", vm.Name, "err", err)
+		return pb.TestStatus_FAILED
+	}
+	if resp.ReturnCode != common_pb.ReturnCode_OK {
+		MerakLogger.Warn("Agent returned failure", "vm", vm.Name, "message", resp.ReturnMessage)
+		return pb.TestStatus_FAILED
+	}
+	return resp.Results
+}
@@ -0,0 +1,73 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+
+	agent_pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/common/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type Server struct {
+	pb.UnimplementedMeraknTestServiceServer
+}
+
+var MerakLogger *logger.MerakLog
+
+var (
+	errTestExists   = errors.New("test already exists")
+	errTestNotFound = errors.New("test not found")
+)
+
+// NewAgentClient returns a client for the merak-agent running at hostIP.
+// Overridden in tests.
+var NewAgentClient = dialAgent
+
+func (s *Server) TestHandler(ctx context.Context, in *pb.InternalTestConfiguration) (*pb.ReturnTestMessage, error) {
+	MerakLogger.Info("Received on TestHandler", "proto", in)
+	switch op := in.OperationType; op {
+	case common_pb.OperationType_INFO:
+		MerakLogger.Info("Operation Info")
+		return caseInfo(ctx, in)
+
+	case common_pb.OperationType_CREATE:
+		MerakLogger.Info("Operation Create")
+		return caseCreate(ctx, in)
+
+	default:
+		MerakLogger.Info("Unknown Operation")
+		return &pb.ReturnTestMessage{
+			ReturnMessage: "Unknown Operation",
+			ReturnCode:    common_pb.ReturnCode_FAILED,
+		}, errors.New("unknown operation")
+	}
+}
+
+func dialAgent(hostIP string) (agent_pb.MerakAgentServiceClient, io.Closer, error) {
+	address := hostIP + ":" + strconv.Itoa(constants.AGENT_GRPC_SERVER_PORT)
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return agent_pb.NewMerakAgentServiceClient(conn), conn, nil
+}
@@ -0,0 +1,186 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+
+	agent_pb "github.com/futurewei-cloud/merak/api/proto/v1/agent"
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/common/logger"
+	"github.com/futurewei-cloud/merak/services/merak-ntest/common"
+)
+
+type mockAgent struct {
+	agent_pb.MerakAgentServiceClient
+	unreachable string
+}
+
+func (a *mockAgent) TestHandler(ctx context.Context, in *agent_pb.InternalTestTargetConfig, opts ...grpc.CallOption) (*agent_pb.AgentReturnTestInfo, error) {
+	for _, dest := range in.Dest {
+		if dest == a.unreachable {
+			return &agent_pb.AgentReturnTestInfo{
+				ReturnCode: common_pb.ReturnCode_OK,
+				Results:    pb.TestStatus_FAILED,
+			}, nil
+		}
+	}
+	return &agent_pb.AgentReturnTestInfo{
+		ReturnCode: common_pb.ReturnCode_OK,
+		Results:    pb.TestStatus_PASSED,
+	}, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func setupRedis(t *testing.T) {
+	server, err := miniredis.Run()
+	assert.Nil(t, err)
+	t.Cleanup(server.Close)
+	common.RedisClient = *redis.NewClient(&redis.Options{
+		Addr: server.Addr(),
+	})
+	ctx := context.Background()
+	pods := map[string][]string{"pod0": {"vm0", "vm1"}, "pod1": {"vm2"}}
+	ips := map[string]string{"vm0": "10.0.1.2", "vm1": "10.0.1.3", "vm2": "10.0.1.4"}
+	for pod, vms := range pods {
+		common.RedisClient.HSet(ctx, pod, "name", "vhost-"+pod, "ip", pod)
+		common.RedisClient.SAdd(ctx, constants.COMPUTE_REDIS_NODE_IP_SET, pod)
+		for _, vm := range vms {
+			common.RedisClient.HSet(ctx, vm, "id", vm, "name", "v"+vm, "ip", ips[vm])
+			common.RedisClient.LPush(ctx, "l"+pod, vm)
+		}
+	}
+}
+
+func waitForTest(t *testing.T, id string) *pb.ReturnTestMessage {
+	var resp *pb.ReturnTestMessage
+	assert.Eventually(t, func() bool {
+		var err error
+		resp, err = caseInfo(context.Background(), &pb.InternalTestConfiguration{Id: id})
+		if err != nil {
+			return false
+		}
+		for _, host := range resp.Results.Hosts {
+			for _, vm := range host.Vms {
+				if vm.Results == pb.TestStatus_RUNNING {
+					return false
+				}
+			}
+		}
+		return true
+	}, time.Second*5, time.Millisecond*10)
+	return resp
+}
+
+func TestTestHandler(t *testing.T) {
+	MerakLogger, _ = logger.NewConsoleLogger(logger.DEBUG)
+	setupRedis(t)
+
+	tests := []struct {
+		name     string
+		dial     func(string) (agent_pb.MerakAgentServiceClient, io.Closer, error)
+		expected map[string]pb.TestStatus
+	}{
+		{
+			name: "all pass",
+			dial: func(ip string) (agent_pb.MerakAgentServiceClient, io.Closer, error) {
+				return &mockAgent{}, nopCloser{}, nil
+			},
+			expected: map[string]pb.TestStatus{"vm0": pb.TestStatus_PASSED, "vm1": pb.TestStatus_PASSED, "vm2": pb.TestStatus_PASSED},
+		},
+		{
+			// vm2 can't be reached, so only vm2 itself passes
+			name: "one unreachable",
+			dial: func(ip string) (agent_pb.MerakAgentServiceClient, io.Closer, error) {
+				return &mockAgent{unreachable: "10.0.1.4"}, nopCloser{}, nil
+			},
+			expected: map[string]pb.TestStatus{"vm0": pb.TestStatus_FAILED, "vm1": pb.TestStatus_FAILED, "vm2": pb.TestStatus_PASSED},
+		},
+		{
+			name: "agent down",
+			dial: func(ip string) (agent_pb.MerakAgentServiceClient, io.Closer, error) {
+				if ip == "pod1" {
+					return nil, nil, errors.New("connection refused")
+				}
+				return &mockAgent{}, nopCloser{}, nil
+			},
+			expected: map[string]pb.TestStatus{"vm0": pb.TestStatus_PASSED, "vm1": pb.TestStatus_PASSED, "vm2": pb.TestStatus_FAILED},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			NewAgentClient = tt.dial
+			s := &Server{}
+			resp, err := s.TestHandler(context.Background(), &pb.InternalTestConfiguration{
+				OperationType: common_pb.OperationType_CREATE,
+				TestType:      pb.TestType_PINGALL,
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, common_pb.ReturnCode_OK, resp.ReturnCode)
+			assert.Len(t, resp.Results.Hosts, 2)
+
+			info := waitForTest(t, resp.Results.Id)
+			results := map[string]pb.TestStatus{}
+			for _, host := range info.Results.Hosts {
+				for _, vm := range host.Vms {
+					results[vm.Id] = vm.Results
+				}
+			}
+			assert.Equal(t, tt.expected, results)
+		})
+	}
+}
+
+func TestTestHandlerErrors(t *testing.T) {
+	MerakLogger, _ = logger.NewConsoleLogger(logger.DEBUG)
+	setupRedis(t)
+	NewAgentClient = func(ip string) (agent_pb.MerakAgentServiceClient, io.Closer, error) {
+		return &mockAgent{}, nopCloser{}, nil
+	}
+	s := &Server{}
+
+	_, err := s.TestHandler(context.Background(), &pb.InternalTestConfiguration{
+		OperationType: common_pb.OperationType_INFO,
+		Id:            "missing",
+	})
+	assert.Equal(t, errTestNotFound, err)
+
+	in := &pb.InternalTestConfiguration{
+		OperationType: common_pb.OperationType_CREATE,
+		Id:            "dup",
+	}
+	_, err = s.TestHandler(context.Background(), in)
+	assert.Nil(t, err)
+	_, err = s.TestHandler(context.Background(), in)
+	assert.Equal(t, errTestExists, err)
+
+	_, err = s.TestHandler(context.Background(), &pb.InternalTestConfiguration{
+		OperationType: common_pb.OperationType_DELETE,
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,56 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package handler
+
+import (
+	"context"
+	"strconv"
+
+	common_pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
+)
+
+func caseInfo(ctx context.Context, in *pb.InternalTestConfiguration) (*pb.ReturnTestMessage, error) {
+	test, ok := tests.get(in.Id)
+	if !ok {
+		MerakLogger.Error("Test not found", "id", in.Id)
+		return &pb.ReturnTestMessage{
+			ReturnMessage: "Test " + in.Id + " not found",
+			ReturnCode:    common_pb.ReturnCode_FAILED,
+		}, errTestNotFound
+	}
+
+	passed, running, total := 0, 0, 0
+	for _, host := range test.Hosts {
+		for _, vm := range host.Vms {
+			switch vm.Results {
+			case pb.TestStatus_PASSED:
+				passed += 1
+			case pb.TestStatus_RUNNING:
+				running += 1
+			}
+			total += 1
+		}
+	}
+	message := strconv.Itoa(passed) + " out of " + strconv.Itoa(total) + " passed!"
+	if running > 0 {
+		message = strconv.Itoa(running) + " out of " + strconv.Itoa(total) + " still running"
+	}
+	MerakLogger.Info(message, "id", test.Id)
+	return &pb.ReturnTestMessage{
+		ReturnMessage: message,
+		ReturnCode:    common_pb.ReturnCode_OK,
+		Results:       test,
+	}, nil
+}
@@ -0,0 +1,60 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package handler
+
+import (
+	"sync"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
+	"google.golang.org/protobuf/proto"
+)
+
+// testStore keeps the results of every test started by this instance.
+// Agents report back concurrently, so all access goes through the mutex
+// and callers only ever see copies of the stored results.
+type testStore struct {
+	mu     sync.Mutex
+	tests  map[string]*pb.InternalTestInfo
+	latest string
+}
+
+var tests = testStore{tests: make(map[string]*pb.InternalTestInfo)}
+
+func (s *testStore) add(test *pb.InternalTestInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tests[test.Id] = test
+	s.latest = test.Id
+}
+
+// get returns a copy of the test with the given ID, or of the most recently
+// started test if id is empty.
+func (s *testStore) get(id string) (*pb.InternalTestInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id == "" {
+		id = s.latest
+	}
+	test, ok := s.tests[id]
+	if !ok {
+		return nil, false
+	}
+	return proto.Clone(test).(*pb.InternalTestInfo), true
+}
+
+func (s *testStore) setResult(vm *pb.InternalVMTestInfo, result pb.TestStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	vm.Results = result
+}
@@ -0,0 +1,85 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
+	constants "github.com/futurewei-cloud/merak/services/common"
+	"github.com/futurewei-cloud/merak/services/common/logger"
+	"github.com/futurewei-cloud/merak/services/merak-ntest/common"
+	"github.com/futurewei-cloud/merak/services/merak-ntest/handler"
+	"github.com/go-redis/redis/v9"
+	"google.golang.org/grpc"
+)
+
+var (
+	ctx  = context.Background()
+	Port = flag.Int("port", constants.NTEST_GRPC_SERVER_PORT, "The server port")
+)
+
+func main() {
+	var err error
+	val, ok := os.LookupEnv(constants.LOG_LEVEL_ENV)
+	if !ok {
+		log.Println("No log level specified. Defaulting to INFO")
+		val = constants.LOG_LEVEL_DEFAULT
+	}
+	handler.MerakLogger, err = logger.NewLogger(logger.LevelEnvParser(val), "merak-ntest")
+	if err != nil {
+		log.Fatalln("ERROR: Failed to create logger", err)
+	}
+
+	// Test targets are read from the VMs recorded by merak-compute
+	var redisAddress strings.Builder
+	redisAddress.WriteString(constants.COMPUTE_REDIS_ADDRESS)
+	redisAddress.WriteString(":")
+	redisAddress.WriteString(strconv.Itoa(constants.COMPUTE_REDIS_PORT))
+
+	common.RedisClient = *redis.NewClient(&redis.Options{
+		Addr:        redisAddress.String(),
+		Password:    "", // no password set
+		DB:          0,  // use default DB
+		PoolSize:    common.NTEST_REDIS_POOL_SIZE,
+		PoolTimeout: common.NTEST_REDIS_POOL_TIMEOUT,
+	})
+	if err := common.RedisClient.Ping(ctx).Err(); err != nil {
+		handler.MerakLogger.Fatal("Unable to connect to Redis", "err", err)
+	}
+	handler.MerakLogger.Info("Successfully connected to Redis!")
+	defer common.RedisClient.Close()
+
+	// Start gRPC Server
+	flag.Parse()
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *Port))
+	if err != nil {
+		handler.MerakLogger.Fatal("Failed to listen", "err", err)
+	}
+	gRPCServer := grpc.NewServer(
+		grpc.MaxSendMsgSize(constants.GRPC_MAX_SEND_MSG_SIZE),
+		grpc.MaxRecvMsgSize(constants.GRPC_MAX_RECV_MSG_SIZE))
+	pb.RegisterMeraknTestServiceServer(gRPCServer, &handler.Server{})
+	handler.MerakLogger.Info("Starting gRPC server. Listening at ", "addr", lis.Addr().String())
+	if err := gRPCServer.Serve(lis); err != nil {
+		handler.MerakLogger.Fatal("failed to serve", "err", err)
+	}
+}
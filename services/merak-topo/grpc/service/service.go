@@ -112,7 +112,26 @@ func (s *Server) TopologyHandler(ctx context.Context, in *pb.InternalTopologyInf
 			}
 		}
 
-		if data_plane_cidr == "" || aca_num == 0 || aca_per_rack == 0 || rack_num == 0 || ports_per_vswitch == 0 {
+		if in.Config.TopologyType == pb.TopologyType_CUSTOM {
+			if len(in.Config.GetVnodes()) == 0 {
+				utils.Logger.Error("request DEPLOY", "Invalid input info", "custom topology without vnodes")
+
+				returnMessage.ReturnCode = pb_common.ReturnCode_FAILED
+				returnMessage.ReturnMessage = "Must provide vnodes and vlinks for a custom topology"
+
+				return &returnMessage, errs
+			}
+		} else if in.Config.TopologyType == pb.TopologyType_FATTREE {
+			// the fat tree is sized by k and the oversubscription instead of racks and ports
+			if data_plane_cidr == "" || aca_num == 0 {
+				utils.Logger.Error("request DEPLOY", "Invalid input info", "check data plane cider and aca number")
+
+				returnMessage.ReturnCode = pb_common.ReturnCode_FAILED
+				returnMessage.ReturnMessage = "Must provide a valid data plane cider and aca number"
+
+				return &returnMessage, errs
+			}
+		} else if data_plane_cidr == "" || aca_num == 0 || aca_per_rack == 0 || rack_num == 0 || ports_per_vswitch == 0 {
 
 			utils.Logger.Error("request DEPLOY", "Invalid input info", "check data plane cider, aca number, aca per rack number, rack number, ports per vswitch, and control plane gateways")
 
@@ -126,17 +145,11 @@ func (s *Server) TopologyHandler(ctx context.Context, in *pb.InternalTopologyInf
 		switch s := in.Config.TopologyType; s {
 		case pb.TopologyType_SINGLE:
 		//
-		case pb.TopologyType_LINEAR:
-			//
-		case pb.TopologyType_MESH:
-			//
-		case pb.TopologyType_CUSTOM:
-			//
 		case pb.TopologyType_REVERSED:
 			//
 		default:
-			// pb.TopologyType_TREE
-			err_create := handler.Create(k8client, topo_id, uint32(aca_num), uint32(rack_num), uint32(aca_per_rack), uint32(cgw_num), data_plane_cidr, uint32(ports_per_vswitch), images, aca_parameters, &returnMessage, topoPrefix, namespace)
+			// pb.TopologyType_TREE, pb.TopologyType_LINEAR, pb.TopologyType_MESH, pb.TopologyType_CUSTOM, pb.TopologyType_FATTREE
+			err_create := handler.Create(k8client, topo_id, s, uint32(aca_num), uint32(rack_num), uint32(aca_per_rack), uint32(cgw_num), data_plane_cidr, uint32(ports_per_vswitch), in.Config.GetMeshDegree(), in.Config.GetFatTreeK(), in.Config.GetOversubscription(), in.Config.GetVnodes(), in.Config.GetVlinks(), images, aca_parameters, &returnMessage, topoPrefix, namespace)
 
 			if err_create != nil {
 				utils.Logger.Error("can't deploy topology", topo_id, err_create.Error())
@@ -30,30 +30,77 @@ import (
 
 //function CREATE
 /* save the part of gw creation and mac learning for future requirment, comment the related code now*/
-func Create(k8client *kubernetes.Clientset, topo_id string, aca_num uint32, rack_num uint32, aca_per_rack uint32, cgw_num uint32, data_plane_cidr string, ports_per_vswitch uint32, images []*pb.InternalTopologyImage, aca_parameters string, returnMessage *pb.ReturnTopologyMessage, topoPrefix string, namespace string) error {
+func Create(k8client *kubernetes.Clientset, topo_id string, topo_type pb.TopologyType, aca_num uint32, rack_num uint32, aca_per_rack uint32, cgw_num uint32, data_plane_cidr string, ports_per_vswitch uint32, mesh_degree uint32, fat_tree_k uint32, oversubscription uint32, vnodes []*pb.InternalVNodeInfo, vlinks []*pb.InternalVLinkInfo, images []*pb.InternalTopologyImage, aca_parameters string, returnMessage *pb.ReturnTopologyMessage, topoPrefix string, namespace string) error {
 
 	start_time := time.Now()
 
 	var aca_image string
 	var ovs_image string
+	var router_image string
 
 	for _, img := range images {
 		if strings.Contains(img.Name, "ACA") {
 			aca_image = img.Registry
 		} else if strings.Contains(img.Name, "OVS") {
 			ovs_image = img.Registry
+		} else if strings.Contains(img.Name, "ROUTER") {
+			router_image = img.Registry
 		}
 	}
 
-	utils.Logger.Debug("request DEPLOY details", "Vhost number", aca_num, "Rack number", rack_num, "Vhosts per rack", aca_per_rack, "Ports per vswitch", ports_per_vswitch)
+	// vrouters and vgateways only need ip forwarding, which the ovs image can do as well
+	if router_image == "" {
+		router_image = ovs_image
+	}
 
-	topo, err_create := Create_multiple_layers_vswitches(int(aca_num), int(rack_num), int(aca_per_rack), int(ports_per_vswitch), data_plane_cidr)
-	if err_create != nil {
-		utils.Logger.Error("request DEPLOY", "multiple layers vswitches", err_create.Error())
-		returnMessage.ReturnMessage = "Can not create multiple layers vswitches"
-		returnMessage.ReturnCode = pb_common.ReturnCode_FAILED
-		return err_create
+	utils.Logger.Debug("request DEPLOY details", "Topology type", topo_type, "Vhost number", aca_num, "Rack number", rack_num, "Vhosts per rack", aca_per_rack, "Ports per vswitch", ports_per_vswitch, "Mesh degree", mesh_degree, "Fat tree k", fat_tree_k, "Oversubscription", oversubscription)
+
+	var topo database.TopologyData
+	var err_create error
+
+	switch topo_type {
+	case pb.TopologyType_LINEAR:
+		// every rack becomes a vswitch in the line
+		topo, err_create = Create_linear_vswitches(int(aca_num), int(rack_num), int(aca_per_rack), data_plane_cidr)
+		if err_create != nil {
+			utils.Logger.Error("request DEPLOY", "linear vswitches", err_create.Error())
+			returnMessage.ReturnMessage = "Can not create linear vswitches"
+			returnMessage.ReturnCode = pb_common.ReturnCode_FAILED
+			return err_create
+		}
+	case pb.TopologyType_CUSTOM:
+		topo, err_create = Create_custom_topology(vnodes, vlinks)
+		if err_create != nil {
+			utils.Logger.Error("request DEPLOY", "custom topology", err_create.Error())
+			returnMessage.ReturnMessage = "Can not create custom topology: " + err_create.Error()
+			returnMessage.ReturnCode = pb_common.ReturnCode_FAILED
+			return err_create
+		}
+	case pb.TopologyType_FATTREE:
+		topo, err_create = Create_fat_tree(int(aca_num), int(fat_tree_k), int(oversubscription), data_plane_cidr)
+		if err_create != nil {
+			utils.Logger.Error("request DEPLOY", "fat tree", err_create.Error())
+			returnMessage.ReturnMessage = "Can not create fat tree"
+			returnMessage.ReturnCode = pb_common.ReturnCode_FAILED
+			return err_create
+		}
+	case pb.TopologyType_MESH:
+		topo, err_create = Create_mesh_vswitches(int(aca_num), int(rack_num), int(aca_per_rack), int(ports_per_vswitch), int(mesh_degree), data_plane_cidr)
+		if err_create != nil {
+			utils.Logger.Error("request DEPLOY", "mesh vswitches", err_create.Error())
+			returnMessage.ReturnMessage = "Can not create mesh vswitches"
+			returnMessage.ReturnCode = pb_common.ReturnCode_FAILED
+			return err_create
+		}
+	default:
+		topo, err_create = Create_multiple_layers_vswitches(int(aca_num), int(rack_num), int(aca_per_rack), int(ports_per_vswitch), data_plane_cidr)
+		if err_create != nil {
+			utils.Logger.Error("request DEPLOY", "multiple layers vswitches", err_create.Error())
+			returnMessage.ReturnMessage = "Can not create multiple layers vswitches"
+			returnMessage.ReturnCode = pb_common.ReturnCode_FAILED
+			return err_create
 
+		}
 	}
 
 	topo.Topology_id = topo_id
@@ -153,7 +200,7 @@ func Create(k8client *kubernetes.Clientset, topo_id string, aca_num uint32, rack
 		var cnode database.ComputeNode
 		var crm pb_common.InternalComputeInfo
 
-		if strings.Contains(node.Name, "vhost") {
+		if node.Type == "vhost" {
 			cnode.Name = node.Name
 			cnode.Id = node.Id
 			cnode.DatapathIp = strings.Split(node.Nics[len(node.Nics)-1].Ip, "/")[0]
@@ -201,7 +248,7 @@ func Create(k8client *kubernetes.Clientset, topo_id string, aca_num uint32, rack
 		utils.Logger.Info("request DEPLOY", "create k8s cluster namespace for new topology deployment", namespace)
 	}
 
-	go Topo_deploy(k8client, aca_image, ovs_image, topo, aca_parameters, topoPrefix, namespace)
+	go Topo_deploy(k8client, aca_image, ovs_image, router_image, topo, aca_parameters, topoPrefix, namespace)
 
 	elaps2 := time.Since(start1)
 
@@ -265,7 +312,7 @@ func UpdateComputenodeInfo(k8client *kubernetes.Clientset, topoPrefix string, na
 
 	for _, node := range topo.Vnodes {
 
-		if strings.Contains(node.Name, "vhost") {
+		if node.Type == "vhost" {
 
 			var cnode database.ComputeNode
 
@@ -361,7 +408,7 @@ func Info(k8client *kubernetes.Clientset, topo_id string, returnMessage *pb.Retu
 	}
 
 	for _, node := range topo.Vnodes {
-		if strings.Contains(node.Name, "vhost") {
+		if node.Type == "vhost" {
 			var cnode database.ComputeNode
 			var crm pb_common.InternalComputeInfo
 
@@ -450,7 +497,7 @@ func Delete(k8client *kubernetes.Clientset, topo_id string, returnMessage *pb.Re
 	}
 
 	for _, node := range topo.Vnodes {
-		if strings.Contains(node.Name, "vhost") {
+		if node.Type == "vhost" {
 			var cnode database.ComputeNode
 			var crm pb_common.InternalComputeInfo
 
@@ -15,8 +15,8 @@ package handler
 
 import (
 	"context"
+	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
 	constants "github.com/futurewei-cloud/merak/services/common"
@@ -98,7 +98,7 @@ func NewTopologyClass(name string, links []database.Vlink, namespace string) *un
 	return out
 }
 
-func Topo_deploy(k8client *kubernetes.Clientset, aca_image string, ovs_image string, topo database.TopologyData, aca_parameters string, topoPrefix string, namespace string) error {
+func Topo_deploy(k8client *kubernetes.Clientset, aca_image string, ovs_image string, router_image string, topo database.TopologyData, aca_parameters string, topoPrefix string, namespace string) error {
 	/*comment gw creation function*/
 	// var k8snodes []string
 
@@ -177,8 +177,11 @@ func Topo_deploy(k8client *kubernetes.Clientset, aca_image string, ovs_image str
 
 		var aff corev1.Affinity
 
-		if strings.Contains(node.Name, "vhost") {
+		if node.Type == "vhost" {
 			l["Type"] = "vhost"
+			// The agent's inventory outlives container restarts, but not the
+			// pod, so each pod keeps it under its own UID on the host
+			inventory_host_path := corev1.HostPathDirectoryOrCreate
 			newPod = &corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:   node.Name,
@@ -197,6 +200,32 @@ func Topo_deploy(k8client *kubernetes.Clientset, aca_image string, ovs_image str
 								{ContainerPort: constants.AGENT_GRPC_SERVER_PORT},
 								{ContainerPort: constants.PROMETHEUS_PORT},
 							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "POD_UID",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.uid"},
+									},
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:        "inventory",
+									MountPath:   filepath.Dir(constants.AGENT_INVENTORY_DEFAULT),
+									SubPathExpr: "$(POD_UID)",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "inventory",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{
+									Path: constants.AGENT_INVENTORY_HOST_PATH,
+									Type: &inventory_host_path,
+								},
+							},
 						},
 					},
 					TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
@@ -219,7 +248,7 @@ func Topo_deploy(k8client *kubernetes.Clientset, aca_image string, ovs_image str
 
 			vhost_pods_config = append(vhost_pods_config, newPod)
 
-		} else if strings.Contains(node.Name, "rack") {
+		} else if node.Type == "rack" {
 
 			ovs_set, err0 := ovs_config(topo, node.Name, SDN_IP, SDN_PORT)
 			if err0 != nil {
@@ -288,7 +317,7 @@ func Topo_deploy(k8client *kubernetes.Clientset, aca_image string, ovs_image str
 
 			// 	}
 
-		} else if strings.Contains(node.Name, "vs") || strings.Contains(node.Name, "core") {
+		} else if node.Type == "vswitch" || node.Type == "core" {
 
 			ovs_set, err0 := ovs_config(topo, node.Name, SDN_IP, SDN_PORT)
 			if err0 != nil {
@@ -322,6 +351,40 @@ func Topo_deploy(k8client *kubernetes.Clientset, aca_image string, ovs_image str
 			}
 			vs_pods_config = append(vs_pods_config, newPod)
 
+		} else if node.Type == "vrouter" || node.Type == "vgateway" {
+
+			script := "sysctl -w net.ipv4.ip_forward=1; "
+			if node.Type == "vgateway" {
+				// traffic leaving the data plane goes out through the pod network
+				script = script + "iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE; "
+			}
+
+			l["Type"] = node.Type
+
+			newPod = &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   node.Name,
+					Labels: l,
+				},
+				Spec: corev1.PodSpec{
+					InitContainers: init_containers,
+					Containers: []corev1.Container{
+						{
+							Name:            node.Type,
+							Image:           router_image,
+							ImagePullPolicy: "IfNotPresent",
+							Args:            []string{script + "sleep infinity"},
+							Command:         []string{"/bin/sh", "-c"},
+							SecurityContext: &sc,
+						},
+					},
+					RestartPolicy:                 "OnFailure",
+					TerminationGracePeriodSeconds: &grace_period,
+					Tolerations:                   tol,
+				},
+			}
+			vs_pods_config = append(vs_pods_config, newPod)
+
 		} else {
 			utils.Logger.Error("device type in topology has not been defined yet", "device type", "not defined")
 
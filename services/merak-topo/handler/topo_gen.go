@@ -14,12 +14,16 @@ Copyright(c) 2022 Futurewei Cloud
 package handler
 
 import (
+	"fmt"
 	"log"
+	"net"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
 
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/topology"
 	"github.com/futurewei-cloud/merak/services/merak-topo/database"
 )
 
@@ -255,7 +259,8 @@ func attach_vhosts_to_rack(rack database.Vnode, hosts []database.Vnode, uid_init
 
 	for i, nic := range rack.Nics {
 
-		if i < len(rack.Nics)-1 {
+		// the last rack may not be full
+		if i < len(rack.Nics)-1 && i < len(hosts) {
 			var link_r database.Vlink
 			var link_h database.Vlink
 
@@ -336,19 +341,13 @@ func attach_racks_to_vswitch(vswitch database.Vnode, racks []database.Vnode, uid
 	return vswitch, racks_attached
 }
 
-func Create_multiple_layers_vswitches(vhost_num int, rack_num int, vhosts_per_rack int, ports_per_vswitch int, data_plane_cidr string) (database.TopologyData, error) {
-	var topo database.TopologyData
-	upper := 250
-	nvhosts := vhost_num
-	idx := 1
-	var racks_full_attached []database.Vnode
+// fill up to rack_num racks with vhosts, vhosts_per_rack at most in each rack
+func create_racks(vhost_num int, rack_num int, vhosts_per_rack int, data_plane_cidr string, upper int, uid_initial int) ([]database.Vnode, []database.Vnode, int) {
 	var racks []database.Vnode
 	var vhosts []database.Vnode
-	var vswitches []database.Vnode
-
-	uid_initial := 1
+	nvhosts := vhost_num
+	idx := 1
 	init_idx_host := 0
-	init_idx_vs := 1
 
 	for nvhosts > 0 && idx < rack_num+1 {
 		var vhs []database.Vnode
@@ -376,6 +375,22 @@ func Create_multiple_layers_vswitches(vhost_num int, rack_num int, vhosts_per_ra
 		vhosts = append(vhosts, vhs_attached...)
 	}
 
+	return racks, vhosts, uid_initial
+}
+
+func Create_multiple_layers_vswitches(vhost_num int, rack_num int, vhosts_per_rack int, ports_per_vswitch int, data_plane_cidr string) (database.TopologyData, error) {
+	var topo database.TopologyData
+	upper := 250
+	var racks_full_attached []database.Vnode
+	var racks []database.Vnode
+	var vhosts []database.Vnode
+	var vswitches []database.Vnode
+
+	uid_initial := 1
+	init_idx_vs := 1
+
+	racks, vhosts, uid_initial = create_racks(vhost_num, rack_num, vhosts_per_rack, data_plane_cidr, upper, uid_initial)
+
 	vs_attached, racks_vs_attached := create_vswitches(racks, init_idx_vs, ports_per_vswitch, uid_initial)
 	uid_initial = uid_initial + len(racks)
 	init_idx_vs = init_idx_vs + len(vs_attached)
@@ -418,3 +433,382 @@ func Create_multiple_layers_vswitches(vhost_num int, rack_num int, vhosts_per_ra
 	return topo, nil
 
 }
+
+// connect two vnodes through the given nics, each side keeps its own link with the same uid
+func connect_vnodes(a *database.Vnode, a_nic database.Nic, b *database.Vnode, b_nic database.Nic, uid int) {
+	var link_a database.Vlink
+	var link_b database.Vlink
+
+	link_a.Id = GenUUID()
+	link_a.Uid = uid
+	link_a.Name = a.Name + "-l" + strconv.FormatInt(int64(uid), 10)
+	link_a.Local_pod = a.Name
+	link_a.Local_intf = a_nic.Intf
+	link_a.Local_ip = a_nic.Ip
+	link_a.Peer_pod = b.Name
+	link_a.Peer_intf = b_nic.Intf
+	link_a.Peer_ip = b_nic.Ip
+
+	link_b.Id = GenUUID()
+	link_b.Uid = uid
+	link_b.Name = b.Name + "-l" + strconv.FormatInt(int64(uid), 10)
+	link_b.Local_pod = b.Name
+	link_b.Local_intf = b_nic.Intf
+	link_b.Local_ip = b_nic.Ip
+	link_b.Peer_pod = a.Name
+	link_b.Peer_intf = a_nic.Intf
+	link_b.Peer_ip = a_nic.Ip
+
+	a.Flinks = append(a.Flinks, link_a)
+	b.Flinks = append(b.Flinks, link_b)
+}
+
+// chain vswitch_num vswitches in a line, vs-1 <-> vs-2 <-> ... <-> vs-n, and spread the vhosts evenly over them
+func Create_linear_vswitches(vhost_num int, vswitch_num int, vhosts_per_vswitch int, data_plane_cidr string) (database.TopologyData, error) {
+	var topo database.TopologyData
+	upper := 250
+
+	if vhost_num > vswitch_num*vhosts_per_vswitch {
+		return topo, fmt.Errorf("%v vhosts don't fit in %v vswitches with %v vhosts per vswitch", vhost_num, vswitch_num, vhosts_per_vswitch)
+	}
+
+	var vhosts []database.Vnode
+	var vswitches []database.Vnode
+
+	uid := 1
+	init_idx_host := 0
+
+	for i := 1; i <= vswitch_num; i++ {
+		nvhosts := vhost_num / vswitch_num
+		if i <= vhost_num%vswitch_num {
+			nvhosts = nvhosts + 1
+		}
+
+		// one port per vhost plus the ports to the previous and the next vswitch
+		nports := nvhosts
+		if i > 1 {
+			nports = nports + 1
+		}
+		if i < vswitch_num {
+			nports = nports + 1
+		}
+
+		var vswitch database.Vnode
+		vswitch.Id = GenUUID()
+		vswitch.Type = "vswitch"
+		vswitch.Name = "vs-" + strconv.FormatInt(int64(i), 10)
+		vswitch.Nics = vswitch_nics_gen(i, nports-1)
+
+		vhs := create_vhosts(init_idx_host, nvhosts, data_plane_cidr, upper)
+		init_idx_host = init_idx_host + nvhosts
+
+		for j := range vhs {
+			connect_vnodes(&vswitch, vswitch.Nics[j], &vhs[j], vhs[j].Nics[0], uid)
+			uid = uid + 1
+		}
+		vhosts = append(vhosts, vhs...)
+
+		if i > 1 {
+			prev := &vswitches[i-2]
+			connect_vnodes(prev, prev.Nics[len(prev.Nics)-1], &vswitch, vswitch.Nics[nvhosts], uid)
+			uid = uid + 1
+		}
+
+		vswitches = append(vswitches, vswitch)
+	}
+
+	topo.Vnodes = append(vhosts, vswitches...)
+
+	return topo, nil
+}
+
+// attach the racks to vswitches like the tree does, then connect the vswitches with each other instead of to a core.
+// mesh_degree is the number of vswitches each vswitch connects to, 0 or anything above the number of vswitches
+// gives a full mesh. An odd degree with an odd number of vswitches is rounded down.
+func Create_mesh_vswitches(vhost_num int, rack_num int, vhosts_per_rack int, ports_per_vswitch int, mesh_degree int, data_plane_cidr string) (database.TopologyData, error) {
+	var topo database.TopologyData
+	upper := 250
+	uid_initial := 1
+	init_idx_vs := 1
+
+	if vhost_num > rack_num*vhosts_per_rack {
+		return topo, fmt.Errorf("%v vhosts don't fit in %v racks with %v vhosts per rack", vhost_num, rack_num, vhosts_per_rack)
+	}
+
+	racks, vhosts, uid_initial := create_racks(vhost_num, rack_num, vhosts_per_rack, data_plane_cidr, upper, uid_initial)
+
+	vswitches, racks_attached := create_vswitches(racks, init_idx_vs, ports_per_vswitch, uid_initial)
+	uid_initial = uid_initial + len(racks)
+
+	n := len(vswitches)
+	if n < 2 {
+		return topo, fmt.Errorf("%v racks with %v ports per vswitch make %v vswitch, a mesh needs at least 2", len(racks), ports_per_vswitch, n)
+	}
+
+	// drop the uplink port which the tree uses for the core, mesh ports are added as the links are made
+	for i := range vswitches {
+		vswitches[i].Nics = vswitches[i].Nics[:len(vswitches[i].Nics)-1]
+	}
+
+	if mesh_degree <= 0 || mesh_degree >= n {
+		mesh_degree = n - 1
+	}
+
+	// circulant graph: vswitch i connects to i+k and i-k for k up to half the degree,
+	// plus the opposite vswitch if the degree is odd
+	for k := 1; k <= mesh_degree/2; k++ {
+		for i := 0; i < n; i++ {
+			j := (i + k) % n
+			if k*2 == n && i >= j {
+				continue
+			}
+			uid_initial = connect_vswitches(&vswitches[i], &vswitches[j], uid_initial)
+		}
+	}
+	if mesh_degree%2 == 1 && n%2 == 0 && mesh_degree/2 < n/2 {
+		for i := 0; i < n/2; i++ {
+			uid_initial = connect_vswitches(&vswitches[i], &vswitches[i+n/2], uid_initial)
+		}
+	}
+
+	vnodes := append(vhosts, racks_attached...)
+	vnodes = append(vnodes, vswitches...)
+
+	topo.Vnodes = vnodes
+
+	return topo, nil
+}
+
+// add a port to both vswitches and link them, returns the next free uid
+func connect_vswitches(a *database.Vnode, b *database.Vnode, uid int) int {
+	a_nic := add_vswitch_nic(a)
+	b_nic := add_vswitch_nic(b)
+	connect_vnodes(a, a_nic, b, b_nic, uid)
+	return uid + 1
+}
+
+func add_vswitch_nic(vswitch *database.Vnode) database.Nic {
+	var nic database.Nic
+	nic.Id = GenUUID()
+	nic.Intf = strings.Replace(vswitch.Name, "-", "", 1) + "-eth" + strconv.FormatInt(int64(len(vswitch.Nics)+1), 10)
+	vswitch.Nics = append(vswitch.Nics, nic)
+	return nic
+}
+
+// Names of custom vnics end up in the shell script of their pod, so they are limited to
+// interface names of at most 15 characters without anything the shell would interpret
+var vnic_name_regex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,14}$`)
+
+// build the topology from the vnodes and vlinks in the request, a vlink connects "node:nic" to "node:nic".
+// Every nic must be used by exactly one vlink, since the pod waits for all of its interfaces to come up.
+func Create_custom_topology(vnodes []*pb.InternalVNodeInfo, vlinks []*pb.InternalVLinkInfo) (database.TopologyData, error) {
+	var topo database.TopologyData
+	nodes := make([]database.Vnode, len(vnodes))
+	node_idx := make(map[string]int)
+	nic_used := make(map[string]bool)
+
+	for i, vnode := range vnodes {
+		if vnode.GetName() == "" {
+			return topo, fmt.Errorf("vnode %v has no name", i)
+		}
+		if _, ok := node_idx[vnode.GetName()]; ok {
+			return topo, fmt.Errorf("vnode %v is defined twice", vnode.GetName())
+		}
+		node_idx[vnode.GetName()] = i
+
+		nodes[i].Id = vnode.GetId()
+		if nodes[i].Id == "" {
+			nodes[i].Id = GenUUID()
+		}
+		nodes[i].Name = vnode.GetName()
+		nodes[i].Type = vnode_type(vnode.GetType())
+
+		// A vhost reaches the data plane through its last vnic
+		if nodes[i].Type == "vhost" {
+			vnics := vnode.GetVnics()
+			if len(vnics) == 0 {
+				return topo, fmt.Errorf("vhost %v has no vnic", vnode.GetName())
+			}
+			if vnics[len(vnics)-1].GetIp() == "" {
+				return topo, fmt.Errorf("last vnic %v of vhost %v has no ip", vnics[len(vnics)-1].GetName(), vnode.GetName())
+			}
+		}
+
+		for _, vnic := range vnode.GetVnics() {
+			if !vnic_name_regex.MatchString(vnic.GetName()) {
+				return topo, fmt.Errorf("nic %q of %v is not a valid interface name", vnic.GetName(), vnode.GetName())
+			}
+			if vnic.GetIp() != "" {
+				if _, _, err := net.ParseCIDR(vnic.GetIp()); err != nil {
+					return topo, fmt.Errorf("ip %v of %v:%v is not in CIDR notation", vnic.GetIp(), vnode.GetName(), vnic.GetName())
+				}
+			}
+			if _, ok := nic_used[vnode.GetName()+":"+vnic.GetName()]; ok {
+				return topo, fmt.Errorf("nic %v:%v is defined twice", vnode.GetName(), vnic.GetName())
+			}
+			nic_used[vnode.GetName()+":"+vnic.GetName()] = false
+
+			var nic database.Nic
+			nic.Id = vnic.GetId()
+			if nic.Id == "" {
+				nic.Id = GenUUID()
+			}
+			nic.Intf = vnic.GetName()
+			nic.Ip = vnic.GetIp()
+			nodes[i].Nics = append(nodes[i].Nics, nic)
+		}
+	}
+
+	find_nic := func(end string) (*database.Vnode, database.Nic, error) {
+		names := strings.SplitN(end, ":", 2)
+		if len(names) != 2 {
+			return nil, database.Nic{}, fmt.Errorf("vlink end %v is not in node:nic format", end)
+		}
+		idx, ok := node_idx[names[0]]
+		if !ok {
+			return nil, database.Nic{}, fmt.Errorf("vlink end %v refers to an unknown vnode", end)
+		}
+		for _, nic := range nodes[idx].Nics {
+			if nic.Intf == names[1] {
+				if nic_used[end] {
+					return nil, database.Nic{}, fmt.Errorf("nic %v is used by more than one vlink", end)
+				}
+				nic_used[end] = true
+				return &nodes[idx], nic, nil
+			}
+		}
+		return nil, database.Nic{}, fmt.Errorf("vlink end %v refers to an unknown nic", end)
+	}
+
+	for i, vlink := range vlinks {
+		src, src_nic, err := find_nic(vlink.GetSrc())
+		if err != nil {
+			return topo, err
+		}
+		dst, dst_nic, err := find_nic(vlink.GetDst())
+		if err != nil {
+			return topo, err
+		}
+		if src == dst {
+			return topo, fmt.Errorf("vlink %v connects %v to itself", vlink.GetName(), src.Name)
+		}
+		connect_vnodes(src, src_nic, dst, dst_nic, i+1)
+	}
+
+	for nic, used := range nic_used {
+		if !used {
+			return topo, fmt.Errorf("nic %v is not connected by any vlink", nic)
+		}
+	}
+
+	topo.Vnodes = nodes
+
+	return topo, nil
+}
+
+func vnode_type(t pb.VNodeType) string {
+	switch t {
+	case pb.VNodeType_VSWITCH:
+		return "vswitch"
+	case pb.VNodeType_VROUTER:
+		return "vrouter"
+	case pb.VNodeType_VGATEWAY:
+		return "vgateway"
+	default:
+		return "vhost"
+	}
+}
+
+// k-ary fat tree: k pods of k/2 edge and k/2 aggregation vswitches, and (k/2)^2 core vswitches.
+// Every edge links to every aggregation in its pod and aggregation j of every pod links to cores
+// j*k/2 to j*k/2+k/2-1, so there are k/2 uplinks per switch. Each edge has oversubscription*k/2 vhost
+// ports, and the vhosts are spread evenly over the edges. With k = 0 the smallest k that fits the vhosts is used.
+func Create_fat_tree(vhost_num int, k int, oversubscription int, data_plane_cidr string) (database.TopologyData, error) {
+	var topo database.TopologyData
+	upper := 250
+
+	if oversubscription <= 0 {
+		oversubscription = 1
+	}
+
+	if k <= 0 {
+		k = 2
+		for oversubscription*k*k*k/4 < vhost_num {
+			k = k + 2
+		}
+	}
+
+	if k%2 != 0 {
+		return topo, fmt.Errorf("fat tree k must be even, got %v", k)
+	}
+
+	half := k / 2
+	hosts_per_edge := half * oversubscription
+	nedges := k * half
+
+	if vhost_num > nedges*hosts_per_edge {
+		return topo, fmt.Errorf("%v vhosts don't fit in a %v-ary fat tree with %v vhosts per edge", vhost_num, k, hosts_per_edge)
+	}
+
+	new_switch := func(prefix string, idx int, node_type string) database.Vnode {
+		var vswitch database.Vnode
+		vswitch.Id = GenUUID()
+		vswitch.Type = node_type
+		vswitch.Name = prefix + "-" + strconv.FormatInt(int64(idx), 10)
+		return vswitch
+	}
+
+	uid := 1
+
+	cores := make([]database.Vnode, half*half)
+	for i := range cores {
+		cores[i] = new_switch("core", i+1, "core")
+	}
+
+	aggs := make([]database.Vnode, nedges)
+	edges := make([]database.Vnode, nedges)
+	for i := range edges {
+		aggs[i] = new_switch("agg", i+1, "vswitch")
+		// edges hold the vhosts like racks do in the tree
+		edges[i] = new_switch("edge", i+1, "rack")
+	}
+
+	for p := 0; p < k; p++ {
+		for j := 0; j < half; j++ {
+			agg := &aggs[p*half+j]
+			for c := 0; c < half; c++ {
+				uid = connect_vswitches(agg, &cores[j*half+c], uid)
+			}
+			for e := 0; e < half; e++ {
+				uid = connect_vswitches(&edges[p*half+e], agg, uid)
+			}
+		}
+	}
+
+	var vhosts []database.Vnode
+	init_idx_host := 0
+
+	for i := range edges {
+		nvhosts := vhost_num / nedges
+		if i < vhost_num%nedges {
+			nvhosts = nvhosts + 1
+		}
+
+		vhs := create_vhosts(init_idx_host, nvhosts, data_plane_cidr, upper)
+		init_idx_host = init_idx_host + nvhosts
+
+		for j := range vhs {
+			connect_vnodes(&edges[i], add_vswitch_nic(&edges[i]), &vhs[j], vhs[j].Nics[0], uid)
+			uid = uid + 1
+		}
+		vhosts = append(vhosts, vhs...)
+	}
+
+	vnodes := append(vhosts, edges...)
+	vnodes = append(vnodes, aggs...)
+	vnodes = append(vnodes, cores...)
+
+	topo.Vnodes = vnodes
+
+	return topo, nil
+}
@@ -0,0 +1,257 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package tests
+
+import (
+	"testing"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/topology"
+	"github.com/futurewei-cloud/merak/services/merak-topo/database"
+	"github.com/futurewei-cloud/merak/services/merak-topo/handler"
+	"github.com/stretchr/testify/assert"
+)
+
+// every link must have a peer link going back the other way with the same uid
+func checkLinks(t *testing.T, topo database.TopologyData) map[string]int {
+	links := make(map[int][]database.Vlink)
+	degree := make(map[string]int)
+	for _, node := range topo.Vnodes {
+		for _, link := range node.Flinks {
+			assert.Equal(t, node.Name, link.Local_pod)
+			links[link.Uid] = append(links[link.Uid], link)
+		}
+		degree[node.Name] = len(node.Flinks)
+	}
+
+	for uid, pair := range links {
+		if assert.Len(t, pair, 2, "uid %v", uid) {
+			assert.Equal(t, pair[0].Local_pod, pair[1].Peer_pod)
+			assert.Equal(t, pair[0].Local_intf, pair[1].Peer_intf)
+			assert.Equal(t, pair[1].Local_pod, pair[0].Peer_pod)
+			assert.Equal(t, pair[1].Local_intf, pair[0].Peer_intf)
+		}
+	}
+	return degree
+}
+
+func TestCreateLinearVswitches(t *testing.T) {
+	topo, err := handler.Create_linear_vswitches(10, 4, 3, "10.200.0.0/16")
+	assert.Nil(t, err)
+
+	degree := checkLinks(t, topo)
+
+	var vhosts, vswitches int
+	for _, node := range topo.Vnodes {
+		switch node.Type {
+		case "vhost":
+			vhosts++
+			assert.Equal(t, 1, degree[node.Name])
+		case "vswitch":
+			vswitches++
+			assert.Equal(t, len(node.Nics), degree[node.Name], node.Name)
+		}
+	}
+	assert.Equal(t, 10, vhosts)
+	assert.Equal(t, 4, vswitches)
+
+	// 3 + 3 + 2 + 2 vhosts, plus the ports to the neighbours in the line
+	assert.Equal(t, 4, degree["vs-1"])
+	assert.Equal(t, 5, degree["vs-2"])
+	assert.Equal(t, 4, degree["vs-3"])
+	assert.Equal(t, 3, degree["vs-4"])
+}
+
+func TestCreateLinearVswitchesTooManyVhosts(t *testing.T) {
+	_, err := handler.Create_linear_vswitches(13, 4, 3, "10.200.0.0/16")
+	assert.Error(t, err)
+}
+
+func meshDegrees(topo database.TopologyData) map[string]int {
+	degree := make(map[string]int)
+	for _, node := range topo.Vnodes {
+		if node.Type != "vswitch" {
+			continue
+		}
+		for _, link := range node.Flinks {
+			if link.Local_pod == node.Name && len(link.Peer_pod) > 2 && link.Peer_pod[:3] == "vs-" {
+				degree[node.Name]++
+			}
+		}
+	}
+	return degree
+}
+
+func TestCreateMeshVswitches(t *testing.T) {
+	// 8 racks with 2 ports per vswitch make 4 vswitches
+	topo, err := handler.Create_mesh_vswitches(16, 8, 2, 2, 0, "10.200.0.0/16")
+	assert.Nil(t, err)
+
+	degree := checkLinks(t, topo)
+	mesh := meshDegrees(topo)
+	assert.Len(t, mesh, 4)
+	for name, d := range mesh {
+		assert.Equal(t, 3, d, name)
+	}
+
+	for _, node := range topo.Vnodes {
+		if node.Type == "vswitch" {
+			// 2 racks and 3 other vswitches, no port is left unused
+			assert.Equal(t, 5, len(node.Nics), node.Name)
+			assert.Equal(t, 5, degree[node.Name], node.Name)
+		}
+	}
+}
+
+func TestCreatePartialMeshVswitches(t *testing.T) {
+	// 6 vswitches
+	for _, d := range []int{2, 3, 4} {
+		topo, err := handler.Create_mesh_vswitches(12, 6, 2, 1, d, "10.200.0.0/16")
+		assert.Nil(t, err)
+
+		checkLinks(t, topo)
+		mesh := meshDegrees(topo)
+		assert.Len(t, mesh, 6)
+		for name, got := range mesh {
+			assert.Equal(t, d, got, "degree %v %v", d, name)
+		}
+	}
+}
+
+func TestCreateMeshVswitchesSingleVswitch(t *testing.T) {
+	_, err := handler.Create_mesh_vswitches(4, 2, 2, 3, 0, "10.200.0.0/16")
+	assert.Error(t, err)
+}
+
+func customVnodes() []*pb.InternalVNodeInfo {
+	return []*pb.InternalVNodeInfo{
+		{Name: "a1", Type: pb.VNodeType_VHOST, Vnics: []*pb.InternalVNicInfo{{Name: "a1-eth1", Ip: "10.0.1.10/24"}}},
+		{Name: "a2", Type: pb.VNodeType_VHOST, Vnics: []*pb.InternalVNicInfo{{Name: "a2-eth1", Ip: "10.0.2.10/24"}}},
+		{Name: "r1", Type: pb.VNodeType_VROUTER, Vnics: []*pb.InternalVNicInfo{{Name: "r1-eth1", Ip: "10.0.1.1/24"}, {Name: "r1-eth2", Ip: "10.0.2.1/24"}}},
+	}
+}
+
+func TestCreateCustomTopology(t *testing.T) {
+	vlinks := []*pb.InternalVLinkInfo{
+		{Name: "link1", Src: "a1:a1-eth1", Dst: "r1:r1-eth1"},
+		{Name: "link2", Src: "r1:r1-eth2", Dst: "a2:a2-eth1"},
+	}
+
+	topo, err := handler.Create_custom_topology(customVnodes(), vlinks)
+	assert.Nil(t, err)
+
+	degree := checkLinks(t, topo)
+	assert.Equal(t, map[string]int{"a1": 1, "a2": 1, "r1": 2}, degree)
+
+	for _, node := range topo.Vnodes {
+		switch node.Name {
+		case "r1":
+			assert.Equal(t, "vrouter", node.Type)
+			assert.Equal(t, "10.0.1.1/24", node.Flinks[0].Local_ip)
+			assert.Equal(t, "10.0.1.10/24", node.Flinks[0].Peer_ip)
+		default:
+			assert.Equal(t, "vhost", node.Type)
+		}
+	}
+}
+
+func TestCreateCustomTopologyInvalid(t *testing.T) {
+	tests := []struct {
+		description string
+		vlinks      []*pb.InternalVLinkInfo
+	}{
+		{"unknown node", []*pb.InternalVLinkInfo{{Src: "a1:a1-eth1", Dst: "r2:r1-eth1"}, {Src: "r1:r1-eth2", Dst: "a2:a2-eth1"}}},
+		{"unknown nic", []*pb.InternalVLinkInfo{{Src: "a1:a1-eth2", Dst: "r1:r1-eth1"}, {Src: "r1:r1-eth2", Dst: "a2:a2-eth1"}}},
+		{"bad format", []*pb.InternalVLinkInfo{{Src: "a1", Dst: "r1:r1-eth1"}, {Src: "r1:r1-eth2", Dst: "a2:a2-eth1"}}},
+		{"nic used twice", []*pb.InternalVLinkInfo{{Src: "a1:a1-eth1", Dst: "r1:r1-eth1"}, {Src: "a1:a1-eth1", Dst: "a2:a2-eth1"}}},
+		{"nic not linked", []*pb.InternalVLinkInfo{{Src: "a1:a1-eth1", Dst: "r1:r1-eth1"}}},
+	}
+
+	for _, test := range tests {
+		_, err := handler.Create_custom_topology(customVnodes(), test.vlinks)
+		assert.Error(t, err, test.description)
+	}
+
+	vnodes := customVnodes()
+	vnodes[0].Vnics[0].Ip = "10.0.1.10"
+	_, err := handler.Create_custom_topology(vnodes, []*pb.InternalVLinkInfo{{Src: "a1:a1-eth1", Dst: "r1:r1-eth1"}, {Src: "r1:r1-eth2", Dst: "a2:a2-eth1"}})
+	assert.Error(t, err, "ip without prefix")
+
+	vnodes = customVnodes()
+	vnodes[2].Vnics[1].Name = "r1-eth2;reboot"
+	_, err = handler.Create_custom_topology(vnodes, []*pb.InternalVLinkInfo{{Src: "a1:a1-eth1", Dst: "r1:r1-eth1"}, {Src: "r1:r1-eth2;reboot", Dst: "a2:a2-eth1"}})
+	assert.Error(t, err, "shell in nic name")
+
+	vnodes = customVnodes()
+	vnodes[2].Vnics[1].Name = "r1-eth2-too-long"
+	_, err = handler.Create_custom_topology(vnodes, []*pb.InternalVLinkInfo{{Src: "a1:a1-eth1", Dst: "r1:r1-eth1"}, {Src: "r1:r1-eth2-too-long", Dst: "a2:a2-eth1"}})
+	assert.Error(t, err, "nic name too long")
+
+	vnodes = customVnodes()
+	vnodes[1].Vnics[0].Ip = ""
+	_, err = handler.Create_custom_topology(vnodes, []*pb.InternalVLinkInfo{{Src: "a1:a1-eth1", Dst: "r1:r1-eth1"}, {Src: "r1:r1-eth2", Dst: "a2:a2-eth1"}})
+	assert.Error(t, err, "vhost nic without ip")
+}
+
+func TestCreateCustomTopologyVhostWithoutNic(t *testing.T) {
+	vnodes := customVnodes()
+	vnodes = append(vnodes, &pb.InternalVNodeInfo{Name: "a3", Type: pb.VNodeType_VHOST})
+	_, err := handler.Create_custom_topology(vnodes, []*pb.InternalVLinkInfo{{Src: "a1:a1-eth1", Dst: "r1:r1-eth1"}, {Src: "r1:r1-eth2", Dst: "a2:a2-eth1"}})
+	assert.Error(t, err)
+}
+
+func TestCreateFatTree(t *testing.T) {
+	// k = 4 with 2:1 oversubscription has 8 edges with 4 vhost ports each
+	topo, err := handler.Create_fat_tree(30, 4, 2, "10.200.0.0/16")
+	assert.Nil(t, err)
+
+	degree := checkLinks(t, topo)
+
+	count := make(map[string]int)
+	for _, node := range topo.Vnodes {
+		count[node.Type]++
+		switch node.Type {
+		case "core":
+			// one link to an aggregation in every pod
+			assert.Equal(t, 4, degree[node.Name], node.Name)
+		case "vswitch":
+			// 2 cores and 2 edges
+			assert.Equal(t, 4, degree[node.Name], node.Name)
+		case "rack":
+			// 2 aggregations plus 3 or 4 vhosts
+			assert.Contains(t, []int{5, 6}, degree[node.Name], node.Name)
+		}
+		assert.Equal(t, len(node.Nics), degree[node.Name], node.Name)
+	}
+	assert.Equal(t, map[string]int{"vhost": 30, "rack": 8, "vswitch": 8, "core": 4}, count)
+}
+
+func TestCreateFatTreeDefaultK(t *testing.T) {
+	// k = 4 holds 16 vhosts, so 17 needs k = 6
+	topo, err := handler.Create_fat_tree(17, 0, 0, "10.200.0.0/16")
+	assert.Nil(t, err)
+
+	count := make(map[string]int)
+	for _, node := range topo.Vnodes {
+		count[node.Type]++
+	}
+	assert.Equal(t, map[string]int{"vhost": 17, "rack": 18, "vswitch": 18, "core": 9}, count)
+}
+
+func TestCreateFatTreeInvalid(t *testing.T) {
+	_, err := handler.Create_fat_tree(10, 3, 1, "10.200.0.0/16")
+	assert.Error(t, err, "odd k")
+
+	_, err = handler.Create_fat_tree(17, 4, 1, "10.200.0.0/16")
+	assert.Error(t, err, "too many vhosts")
+}
@@ -208,6 +208,68 @@ const docTemplate = `{
                 }
             }
         },
+        "/api/jobs/{id}": {
+            "get": {
+                "description": "Get the progress and result of a scenario action",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "job"
+                ],
+                "summary": "Get a job from database",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JobId",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "job data with success message",
+                        "schema": {
+                            "$ref": "#/definitions/entities.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "job data with null and error message"
+                    }
+                }
+            },
+            "delete": {
+                "description": "Cancel a scenario action which is still running",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "job"
+                ],
+                "summary": "Cancel a running job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "JobId",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "job data with success message",
+                        "schema": {
+                            "$ref": "#/definitions/entities.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "job data with null and error message"
+                    }
+                }
+            }
+        },
         "/api/network-config": {
             "get": {
                 "description": "Get all network-config",
@@ -403,7 +465,7 @@ const docTemplate = `{
         },
         "/api/scenarios/actions": {
             "post": {
-                "description": "Take an action on a scenario",
+                "description": "Start an action on a scenario in the background, poll /api/jobs/{id} for its result.\nService 'all' deploys, checks or deletes every service of the scenario in order.",
                 "consumes": [
                     "application/json"
                 ],
@@ -423,18 +485,83 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "scenario action data with success message",
+                    "202": {
+                        "description": "job of the scenario action with success message",
                         "schema": {
-                            "$ref": "#/definitions/entities.ScenarioAction"
+                            "$ref": "#/definitions/entities.Job"
                         }
                     },
-                    "500": {
+                    "400": {
                         "description": "scenario action null with failure message"
                     }
                 }
             }
         },
+        "/api/scenarios/{id}/vms": {
+            "get": {
+                "description": "List the VMs of the scenario's compute config with their status and failure reason.\nStatus takes a comma separated list such as ERROR,DEPLOYING, host matches the node name or IP.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "scenario"
+                ],
+                "summary": "Get the VMs deployed by a scenario",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ScenarioId",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "VM status",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Compute node name or IP",
+                        "name": "host",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "VPC ID",
+                        "name": "vpc_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Subnet ID",
+                        "name": "subnet_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of matching VMs to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of VMs returned, 1000 by default",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "total number of matching VMs and a page of them with success message"
+                    },
+                    "400": {
+                        "description": "invalid query with failure message"
+                    }
+                }
+            }
+        },
         "/api/senarios": {
             "get": {
                 "description": "Get all scenario",
@@ -1044,6 +1171,9 @@ const docTemplate = `{
         "entities.ComputeConfig": {
             "type": "object",
             "properties": {
+                "hot_node_ratio": {
+                    "type": "number"
+                },
                 "name": {
                     "type": "string"
                 },
@@ -1056,9 +1186,24 @@ const docTemplate = `{
                 "number_of_vm_per_vpc": {
                     "type": "integer"
                 },
+                "rps": {
+                    "type": "number"
+                },
                 "scheduler": {
                     "type": "string"
                 },
+                "seed": {
+                    "type": "integer"
+                },
+                "skew": {
+                    "type": "number"
+                },
+                "vm_deploy_method": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/entities.VMPod"
+                    }
+                },
                 "vm_deploy_type": {
                     "type": "string"
                 },
@@ -1110,6 +1255,39 @@ const docTemplate = `{
                 }
             }
         },
+        "entities.Job": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "result": {},
+                "scenario_id": {
+                    "type": "string"
+                },
+                "service": {
+                    "$ref": "#/definitions/entities.ServiceAction"
+                },
+                "stages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/entities.Stage"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
         "entities.NetworkConfig": {
             "type": "object",
             "properties": {
@@ -1237,11 +1415,8 @@ const docTemplate = `{
                 "scenario_id": {
                     "type": "string"
                 },
-                "services": {
-                    "type": "array",
-                    "items": {
-                        "$ref": "#/definitions/entities.ServiceAction"
-                    }
+                "service": {
+                    "$ref": "#/definitions/entities.ServiceAction"
                 }
             }
         },
@@ -1317,6 +1492,9 @@ const docTemplate = `{
                 },
                 "service_name": {
                     "type": "string"
+                },
+                "status": {
+                    "type": "string"
                 }
             }
         },
@@ -1334,6 +1512,23 @@ const docTemplate = `{
                 }
             }
         },
+        "entities.Stage": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "service_name": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
         "entities.SubnetInfo": {
             "type": "object",
             "properties": {
@@ -1400,12 +1595,18 @@ const docTemplate = `{
                 "data_plane_cidr": {
                     "type": "string"
                 },
+                "fat_tree_k": {
+                    "type": "integer"
+                },
                 "images": {
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/entities.Image"
                     }
                 },
+                "mesh_degree": {
+                    "type": "integer"
+                },
                 "name": {
                     "type": "string"
                 },
@@ -1418,6 +1619,12 @@ const docTemplate = `{
                 "number_of_vhosts": {
                     "type": "integer"
                 },
+                "oversubscription": {
+                    "type": "integer"
+                },
+                "ports_per_vswitch": {
+                    "type": "integer"
+                },
                 "type": {
                     "type": "string"
                 },
@@ -1452,6 +1659,26 @@ const docTemplate = `{
                 }
             }
         },
+        "entities.VMPod": {
+            "type": "object",
+            "properties": {
+                "number_of_vms": {
+                    "type": "integer"
+                },
+                "pod_ip": {
+                    "type": "string"
+                },
+                "pod_name": {
+                    "type": "string"
+                },
+                "subnets": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
         "entities.VNode": {
             "type": "object",
             "properties": {
@@ -1486,6 +1713,9 @@ const docTemplate = `{
                 },
                 "tenant_id": {
                     "type": "string"
+                },
+                "vpc_cidr": {
+                    "type": "string"
                 }
             }
         }
@@ -25,6 +25,7 @@ type AppConfig struct {
 	LogLevel    string `yaml:"log_level"`
 	UseSyslog   bool   `yaml:"use_syslog"`
 	GrpcTimeout int64  `yaml:"grpc_timeout"`
+	TestTimeout int64  `yaml:"test_timeout"`
 }
 
 type ServiceStatus string
@@ -37,6 +38,7 @@ const (
 	STATUS_UPDATING  ServiceStatus = "UPDATING"
 	STATUS_FAILED    ServiceStatus = "FAILED"
 	STATUS_DONE      ServiceStatus = "DONE"
+	STATUS_CANCELLED ServiceStatus = "CANCELLED"
 )
 
 type EventName string
@@ -60,6 +62,27 @@ type ServiceAction struct {
 	Status      ServiceStatus `json:"status"`
 }
 
+// Job tracks a scenario action running in the background
+type Job struct {
+	Id         string        `json:"id"`
+	ScenarioId string        `json:"scenario_id"`
+	Service    ServiceAction `json:"service"`
+	Status     ServiceStatus `json:"status"`
+	Message    string        `json:"message"`
+	Result     interface{}   `json:"result"`
+	Stages     []Stage       `json:"stages,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+}
+
+// Stage records one service action taken by a job on all services
+type Stage struct {
+	ServiceName string        `json:"service_name"`
+	Action      EventName     `json:"action"`
+	Status      ServiceStatus `json:"status"`
+	Message     string        `json:"message"`
+}
+
 // Scenario
 type Scenario struct {
 	Id            string        `json:"id" swaggerignore:"true"`
@@ -105,6 +128,9 @@ type TopologyConfig struct {
 	NumberOfRacks    uint          `json:"number_of_racks"`
 	VhostsPerRack    uint          `json:"vhosts_per_rack"`
 	PortsPerVSwitch  uint          `json:"ports_per_vswitch"`
+	MeshDegree       uint          `json:"mesh_degree"`
+	FatTreeK         uint          `json:"fat_tree_k"`
+	Oversubscription uint          `json:"oversubscription"`
 	DataPlaneCidr    string        `json:"data_plane_cidr"`
 	NumberOfGateways uint          `json:"number_of_control_plane_gateways"`
 	GatewayIPs       []string      `json:"control_plane_gateway_ips"`
@@ -200,11 +226,25 @@ type ComputeConfig struct {
 	Scheduler            string        `json:"scheduler"`
 	NumberOfVmPerVpc     uint          `json:"number_of_vm_per_vpc"`
 	VPCInfo              []VPCInfo     `json:"vpc_info"`
+	HotNodeRatio         float64       `json:"hot_node_ratio"`
+	Skew                 float64       `json:"skew"`
+	Seed                 int64         `json:"seed"`
+	Rps                  float64       `json:"rps"`
+	VmDeployMethod       []VMPod       `json:"vm_deploy_method"`
 	Status               ServiceStatus `json:"status" swaggerignore:"true"`
 	CreatedAt            time.Time     `json:"created_at" swaggerignore:"true"`
 	UpdatedAt            time.Time     `json:"updated_at" swaggerignore:"true"`
 }
 
+// VMs put on one compute node by an ASSIGN deployment, the node is picked by
+// pod_ip or else pod_name and the subnets are given by CIDR
+type VMPod struct {
+	PodName     string   `json:"pod_name"`
+	PodIp       string   `json:"pod_ip"`
+	NumberOfVMs uint     `json:"number_of_vms"`
+	Subnets     []string `json:"subnets"`
+}
+
 type VPCInfo struct {
 	VpcId           string       `json:"vpc_id" swaggerignore:"true"`
 	TenantId        string       `json:"tenant_id"`
@@ -232,11 +272,13 @@ type TestConfig struct {
 }
 
 type Test struct {
-	Id         string   `json:"id" swaggerignore:"true"`
-	Name       string   `json:"name"`
-	Script     string   `json:"script"`
-	Cmd        string   `json:"cmd"`
-	Parameters []string `json:"parameters"`
-	WhenToRun  string   `json:"when_to_run"`
-	WhereToRun string   `json:"where_to_run"`
+	Id         string        `json:"id" swaggerignore:"true"`
+	Name       string        `json:"name"`
+	Script     string        `json:"script"`
+	Cmd        string        `json:"cmd"`
+	Parameters []string      `json:"parameters"`
+	WhenToRun  string        `json:"when_to_run"`
+	WhereToRun string        `json:"where_to_run"`
+	RunId      string        `json:"run_id" swaggerignore:"true"`
+	Status     ServiceStatus `json:"status" swaggerignore:"true"`
 }
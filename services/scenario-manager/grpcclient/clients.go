@@ -21,6 +21,7 @@ import (
 
 	compute_pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
 	network_pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	ntest_pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
 	topology_pb "github.com/futurewei-cloud/merak/api/proto/v1/topology"
 	constants "github.com/futurewei-cloud/merak/services/common"
 	"github.com/futurewei-cloud/merak/services/scenario-manager/logger"
@@ -41,7 +42,7 @@ func NewGrpcClient(conn *grpc.ClientConn, timeout time.Duration) GrpcClient {
 	}
 }
 
-func TopologyClient(topopb *topology_pb.InternalTopologyInfo) (*topology_pb.ReturnTopologyMessage, error) {
+func TopologyClient(ctx context.Context, topopb *topology_pb.InternalTopologyInfo) (*topology_pb.ReturnTopologyMessage, error) {
 	var conn *grpc.ClientConn
 
 	addr := constants.TOPLOGY_GRPC_SERVER_ADDRESS + ":" + strconv.Itoa(constants.TOPLOGY_GRPC_SERVER_PORT)
@@ -54,7 +55,7 @@ func TopologyClient(topopb *topology_pb.InternalTopologyInfo) (*topology_pb.Retu
 	}
 	defer conn.Close()
 
-	response, err := NewGrpcClient(conn, time.Second*time.Duration(utils.GetGrpcTimeout())).TopologyHandler(context.Background(), topopb)
+	response, err := NewGrpcClient(conn, time.Second*time.Duration(utils.GetGrpcTimeout())).TopologyHandler(ctx, topopb)
 
 	if err != nil {
 		logger.Log.Errorf("error return from grpc server: %s", err)
@@ -81,7 +82,7 @@ func (g GrpcClient) TopologyHandler(ctx context.Context, topopb *topology_pb.Int
 	return response, nil
 }
 
-func NetworkClient(netconfpb *network_pb.InternalNetConfigInfo) (*network_pb.ReturnNetworkMessage, error) {
+func NetworkClient(ctx context.Context, netconfpb *network_pb.InternalNetConfigInfo) (*network_pb.ReturnNetworkMessage, error) {
 	var conn *grpc.ClientConn
 
 	addr := constants.NETWORK_GRPC_SERVER_ADDRESS + ":" + strconv.Itoa(constants.NETWORK_GRPC_SERVER_PORT)
@@ -94,7 +95,7 @@ func NetworkClient(netconfpb *network_pb.InternalNetConfigInfo) (*network_pb.Ret
 	}
 	defer conn.Close()
 
-	response, err := NewGrpcClient(conn, time.Second*time.Duration(utils.GetGrpcTimeout())).NetConfigHandler(context.Background(), netconfpb)
+	response, err := NewGrpcClient(conn, time.Second*time.Duration(utils.GetGrpcTimeout())).NetConfigHandler(ctx, netconfpb)
 
 	if err != nil {
 		logger.Log.Errorf("error return from grpc server: %s", err)
@@ -121,7 +122,7 @@ func (g GrpcClient) NetConfigHandler(ctx context.Context, netconfpb *network_pb.
 	return response, nil
 }
 
-func ComputeClient(computepb *compute_pb.InternalComputeConfigInfo) (*compute_pb.ReturnComputeMessage, error) {
+func ComputeClient(ctx context.Context, computepb *compute_pb.InternalComputeConfigInfo) (*compute_pb.ReturnComputeMessage, error) {
 	var conn *grpc.ClientConn
 
 	addr := constants.COMPUTE_GRPC_SERVER_ADDRESS + ":" + strconv.Itoa(constants.COMPUTE_GRPC_SERVER_PORT)
@@ -133,7 +134,7 @@ func ComputeClient(computepb *compute_pb.InternalComputeConfigInfo) (*compute_pb
 	}
 	defer conn.Close()
 
-	response, err := NewGrpcClient(conn, time.Second*time.Duration(utils.GetGrpcTimeout())).ComputeHandler(context.Background(), computepb)
+	response, err := NewGrpcClient(conn, time.Second*time.Duration(utils.GetGrpcTimeout())).ComputeHandler(ctx, computepb)
 
 	if err != nil {
 		logger.Log.Errorf("error return from grpc server: %s", err)
@@ -159,3 +160,42 @@ func (g GrpcClient) ComputeHandler(ctx context.Context, computepb *compute_pb.In
 
 	return response, nil
 }
+
+func TestClient(ctx context.Context, testpb *ntest_pb.InternalTestConfiguration) (*ntest_pb.ReturnTestMessage, error) {
+	var conn *grpc.ClientConn
+
+	addr := constants.NTEST_GRPC_SERVER_ADDRESS + ":" + strconv.Itoa(constants.NTEST_GRPC_SERVER_PORT)
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(500*1024*1024), grpc.MaxCallSendMsgSize(500*1024*1024)))
+	if err != nil {
+		logger.Log.Errorf("can not connect to %s", err)
+		return nil, fmt.Errorf("cannot connect to merak-ntest grpc server: %s", err)
+	}
+	defer conn.Close()
+
+	response, err := NewGrpcClient(conn, time.Second*time.Duration(utils.GetGrpcTimeout())).TestHandler(ctx, testpb)
+
+	if err != nil {
+		logger.Log.Errorf("error return from grpc server: %s", err)
+		return nil, fmt.Errorf("error return from grpc server: %s", err.Error())
+	}
+
+	return response, nil
+}
+
+func (g GrpcClient) TestHandler(ctx context.Context, testpb *ntest_pb.InternalTestConfiguration) (*ntest_pb.ReturnTestMessage, error) {
+	client := ntest_pb.NewMeraknTestServiceClient(g.conn)
+
+	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(g.timeout))
+	defer cancel()
+
+	response, err := client.TestHandler(ctx, testpb)
+
+	if err != nil {
+		logger.Log.Errorf("Error when calling Merak-nTest: %s", err)
+		return nil, fmt.Errorf("error when calling merak-ntest grpc server: %s", err)
+	}
+	logger.Log.Debugf("Response from Merak-nTest grpc server: %s", response.GetReturnMessage())
+
+	return response, nil
+}
@@ -17,13 +17,16 @@ import (
 	"errors"
 	"log"
 	"net"
+	"os"
 	"testing"
 	"time"
 
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
 	compute_pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
 	network_pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	ntest_pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
 	topology_pb "github.com/futurewei-cloud/merak/api/proto/v1/topology"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/logger"
 	"github.com/futurewei-cloud/merak/services/scenario-manager/utils"
 	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
@@ -45,6 +48,17 @@ type mockMerakComputeServiceServer struct {
 	compute_pb.UnimplementedMerakComputeServiceServer
 }
 
+type mockMeraknTestServiceServer struct {
+	ntest_pb.UnimplementedMeraknTestServiceServer
+}
+
+func TestMain(m *testing.M) {
+	if err := logger.StartLogger("scenario-manager-test", false, "debug"); err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(m.Run())
+}
+
 func (*mockMerakTopologyServiceServer) TopologyHandler(ctx context.Context, req *topology_pb.InternalTopologyInfo) (*topology_pb.ReturnTopologyMessage, error) {
 	if req.Config.GetRequestId() == "" {
 		return nil, status.Errorf(codes.InvalidArgument, "request id cannot be empty %v", req.Config.GetRequestId())
@@ -279,3 +293,79 @@ func TestComputeClient(t *testing.T) {
 		})
 	}
 }
+
+func (*mockMeraknTestServiceServer) TestHandler(ctx context.Context, req *ntest_pb.InternalTestConfiguration) (*ntest_pb.ReturnTestMessage, error) {
+	if req.GetOperationType() == pb.OperationType_INFO && req.GetId() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "test id cannot be empty %v", req.GetId())
+	}
+
+	vm := &ntest_pb.InternalVMTestInfo{Name: "v000", Id: "1", Ip: "10.0.1.2", Results: ntest_pb.TestStatus_PASSED}
+	host := &ntest_pb.InternalVMHost{Name: "vhost-0", Ip: "10.244.0.1", Vms: []*ntest_pb.InternalVMTestInfo{vm}}
+	results := &ntest_pb.InternalTestInfo{Id: "1", TestType: req.GetTestType(), Hosts: []*ntest_pb.InternalVMHost{host}}
+
+	return &ntest_pb.ReturnTestMessage{ReturnCode: pb.ReturnCode_OK, ReturnMessage: "Test protobuf message received", Results: results}, nil
+}
+
+func ntestDialer() func(context.Context, string) (net.Conn, error) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+
+	ntest_pb.RegisterMeraknTestServiceServer(server, &mockMeraknTestServiceServer{})
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	return func(context.Context, string) (net.Conn, error) {
+		return listener.Dial()
+	}
+}
+
+func TestTestClient(t *testing.T) {
+	tests := []struct {
+		name          string
+		data          *ntest_pb.InternalTestConfiguration
+		response      *ntest_pb.ReturnTestMessage
+		expectedError bool
+	}{
+		{
+			"Test ntest grpc client create",
+			&ntest_pb.InternalTestConfiguration{OperationType: pb.OperationType_CREATE, TestType: ntest_pb.TestType_PINGALL},
+			&ntest_pb.ReturnTestMessage{ReturnCode: pb.ReturnCode_OK},
+			false,
+		},
+		{
+			"Test ntest grpc client info",
+			&ntest_pb.InternalTestConfiguration{OperationType: pb.OperationType_INFO, Id: "1"},
+			&ntest_pb.ReturnTestMessage{ReturnCode: pb.ReturnCode_OK},
+			false,
+		},
+		{
+			"Test ntest grpc client info without id",
+			&ntest_pb.InternalTestConfiguration{OperationType: pb.OperationType_INFO},
+			nil,
+			true,
+		},
+	}
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "", grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(ntestDialer()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := NewGrpcClient(conn, time.Second).TestHandler(context.Background(), test.data)
+
+			if (err != nil) != test.expectedError {
+				t.Error("error: expected", test.expectedError, "received", err)
+			}
+			if test.response != nil && res.GetReturnCode() != test.response.ReturnCode {
+				t.Error("error: expected", test.response.ReturnCode, "received", res.GetReturnCode())
+			}
+		})
+	}
+}
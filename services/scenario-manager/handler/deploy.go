@@ -14,12 +14,15 @@ Copyright(c) 2022 Futurewei Cloud
 package handler
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
 	compute_pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
 	network_pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	ntest_pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
 	topology_pb "github.com/futurewei-cloud/merak/api/proto/v1/topology"
 	"github.com/futurewei-cloud/merak/services/scenario-manager/database"
 	"github.com/futurewei-cloud/merak/services/scenario-manager/entities"
@@ -28,7 +31,7 @@ import (
 	"github.com/futurewei-cloud/merak/services/scenario-manager/utils"
 )
 
-func TopologyHandler(s *entities.Scenario, action entities.EventName) (*topology_pb.ReturnTopologyMessage, error) {
+func TopologyHandler(ctx context.Context, s *entities.Scenario, action entities.EventName) (*topology_pb.ReturnTopologyMessage, error) {
 	var topology entities.TopologyConfig
 	if err := database.FindEntity(s.TopologyId, utils.KEY_PREFIX_TOPOLOGY, &topology); err != nil {
 		return nil, fmt.Errorf("topology %s not found", s.TopologyId)
@@ -80,7 +83,7 @@ func TopologyHandler(s *entities.Scenario, action entities.EventName) (*topology
 		database.Set(utils.KEY_PREFIX_TOPOLOGY+topology.Id, &topology)
 	}
 
-	responseTopo, err := grpcclient.TopologyClient(&topoconf)
+	responseTopo, err := grpcclient.TopologyClient(ctx, &topoconf)
 
 	if err != nil || responseTopo.ReturnCode == pb.ReturnCode_FAILED {
 		if action != entities.EVENT_CHECK {
@@ -119,7 +122,7 @@ func actionToStatus(action entities.EventName) entities.ServiceStatus {
 	return entities.STATUS_FAILED
 }
 
-func NetworkHandler(s *entities.Scenario, action entities.EventName) (*network_pb.ReturnNetworkMessage, error) {
+func NetworkHandler(ctx context.Context, s *entities.Scenario, action entities.EventName) (*network_pb.ReturnNetworkMessage, error) {
 	var network entities.NetworkConfig
 	if err := database.FindEntity(s.NetworkConfId, utils.KEY_PREFIX_NETWORK, &network); err != nil {
 		return nil, fmt.Errorf("network config %s not found", s.NetworkConfId)
@@ -135,6 +138,13 @@ func NetworkHandler(s *entities.Scenario, action entities.EventName) (*network_p
 		}
 	}
 
+	// Only a deployed network can be updated, merak-network diffs the config
+	// against what it created before. That record is kept up to date when an
+	// update fails part way, so a failed network can be updated again.
+	if action == entities.EVENT_UPDATE && network.Status != entities.STATUS_FAILED && network.Status != entities.STATUS_READY {
+		return nil, fmt.Errorf("network '%s' is '%s' now", network.Id, network.Status)
+	}
+
 	var netconf network_pb.InternalNetConfigInfo
 	if action == entities.EVENT_CHECK {
 		if err := constructNetConfMessage(&network, nil, nil, &netconf, action); err != nil {
@@ -146,7 +156,8 @@ func NetworkHandler(s *entities.Scenario, action entities.EventName) (*network_p
 			return nil, fmt.Errorf("compute config '%s' not found", s.ComputeConfId)
 		}
 
-		if compute.Status != entities.STATUS_NONE {
+		// VMs may already be running on a network that is being updated
+		if action != entities.EVENT_UPDATE && compute.Status != entities.STATUS_NONE {
 			return nil, fmt.Errorf("compute config '%s' is '%s' now", s.ComputeConfId, compute.Status)
 		}
 
@@ -156,7 +167,7 @@ func NetworkHandler(s *entities.Scenario, action entities.EventName) (*network_p
 		}
 
 		var returnTopo *topology_pb.ReturnTopologyMessage
-		returnTopo, err := TopologyHandler(s, entities.EVENT_CHECK)
+		returnTopo, err := TopologyHandler(ctx, s, entities.EVENT_CHECK)
 		if err != nil {
 			return nil, fmt.Errorf("topology %s didn't return message", s.TopologyId)
 		}
@@ -177,7 +188,7 @@ func NetworkHandler(s *entities.Scenario, action entities.EventName) (*network_p
 		database.Set(utils.KEY_PREFIX_NETWORK+network.Id, &network)
 	}
 
-	responseNetwork, err := grpcclient.NetworkClient(&netconf)
+	responseNetwork, err := grpcclient.NetworkClient(ctx, &netconf)
 
 	if err != nil || responseNetwork.ReturnCode == pb.ReturnCode_FAILED {
 		if action != entities.EVENT_CHECK {
@@ -192,7 +203,7 @@ func NetworkHandler(s *entities.Scenario, action entities.EventName) (*network_p
 
 	logger.Log.Infof("responseNetworkMessage: %s", responseNetwork)
 
-	if action == entities.EVENT_DEPLOY {
+	if action == entities.EVENT_DEPLOY || action == entities.EVENT_UPDATE {
 		network.Status = entities.STATUS_READY
 	} else if action == entities.EVENT_DELETE {
 		network.Status = entities.STATUS_NONE
@@ -205,7 +216,7 @@ func NetworkHandler(s *entities.Scenario, action entities.EventName) (*network_p
 	return responseNetwork, nil
 }
 
-func ComputeHanlder(s *entities.Scenario, action entities.EventName) (*compute_pb.ReturnComputeMessage, error) {
+func ComputeHanlder(ctx context.Context, s *entities.Scenario, action entities.EventName) (*compute_pb.ReturnComputeMessage, error) {
 	var compute entities.ComputeConfig
 	if err := database.FindEntity(s.ComputeConfId, utils.KEY_PREFIX_COMPUTE, &compute); err != nil {
 		return nil, fmt.Errorf("compute config %s not found", s.ComputeConfId)
@@ -221,6 +232,13 @@ func ComputeHanlder(s *entities.Scenario, action entities.EventName) (*compute_p
 		}
 	}
 
+	// Scaling needs the VMs of an earlier deploy, merak-compute only creates
+	// or deletes the difference. A failed deploy or update can be scaled
+	// again from the VMs it left behind.
+	if action == entities.EVENT_UPDATE && compute.Status != entities.STATUS_FAILED && compute.Status != entities.STATUS_READY {
+		return nil, fmt.Errorf("compute '%s' is '%s' now", compute.Id, compute.Status)
+	}
+
 	var computeconf compute_pb.InternalComputeConfigInfo
 	if action == entities.EVENT_CHECK {
 		if err := constructComputeMessage(&compute, nil, nil, nil, &computeconf, action); err != nil {
@@ -233,7 +251,7 @@ func ComputeHanlder(s *entities.Scenario, action entities.EventName) (*compute_p
 		}
 
 		var returnTopo *topology_pb.ReturnTopologyMessage
-		returnTopo, topo_err := TopologyHandler(s, entities.EVENT_CHECK)
+		returnTopo, topo_err := TopologyHandler(ctx, s, entities.EVENT_CHECK)
 		if topo_err != nil {
 			return nil, fmt.Errorf("topology %s didn't return message", s.TopologyId)
 		}
@@ -243,7 +261,7 @@ func ComputeHanlder(s *entities.Scenario, action entities.EventName) (*compute_p
 		}
 
 		var returnNetwork *network_pb.ReturnNetworkMessage
-		returnNetwork, net_err := NetworkHandler(s, entities.EVENT_CHECK)
+		returnNetwork, net_err := NetworkHandler(ctx, s, entities.EVENT_CHECK)
 		if net_err != nil {
 			return nil, fmt.Errorf("network %s didn't return message", s.NetworkConfId)
 		}
@@ -266,7 +284,7 @@ func ComputeHanlder(s *entities.Scenario, action entities.EventName) (*compute_p
 		database.Set(utils.KEY_PREFIX_COMPUTE+compute.Id, &compute)
 	}
 
-	responseCompute, err := grpcclient.ComputeClient(&computeconf)
+	responseCompute, err := grpcclient.ComputeClient(ctx, &computeconf)
 
 	if err != nil || (responseCompute != nil && responseCompute.ReturnCode == pb.ReturnCode_FAILED) {
 		if action != entities.EVENT_CHECK {
@@ -281,7 +299,7 @@ func ComputeHanlder(s *entities.Scenario, action entities.EventName) (*compute_p
 
 	logger.Log.Infof("responseComputeMessage: %s", responseCompute)
 
-	if action == entities.EVENT_DEPLOY {
+	if action == entities.EVENT_DEPLOY || action == entities.EVENT_UPDATE {
 		compute.Status = entities.STATUS_READY
 	} else if action == entities.EVENT_DELETE {
 		compute.Status = entities.STATUS_NONE
@@ -293,3 +311,199 @@ func ComputeHanlder(s *entities.Scenario, action entities.EventName) (*compute_p
 
 	return responseCompute, nil
 }
+
+// Queries the VMs of the scenario's compute config, filtered and paged by query
+func ComputeVMs(ctx context.Context, s *entities.Scenario, query *compute_pb.InternalVMQuery) (*compute_pb.ReturnComputeMessage, error) {
+	var compute entities.ComputeConfig
+	if err := database.FindEntity(s.ComputeConfId, utils.KEY_PREFIX_COMPUTE, &compute); err != nil {
+		return nil, fmt.Errorf("compute config %s not found", s.ComputeConfId)
+	}
+
+	var computeconf compute_pb.InternalComputeConfigInfo
+	if err := constructComputeMessage(&compute, nil, nil, nil, &computeconf, entities.EVENT_CHECK); err != nil {
+		return nil, err
+	}
+	computeconf.Config.VmQuery = query
+
+	responseCompute, err := grpcclient.ComputeClient(ctx, &computeconf)
+	if err != nil {
+		return nil, fmt.Errorf("query compute failed, Error = '%s'", err.Error())
+	}
+	if responseCompute.ReturnCode == pb.ReturnCode_FAILED {
+		return nil, fmt.Errorf("query compute failed, return = '%s'", responseCompute.ReturnMessage)
+	}
+	return responseCompute, nil
+}
+
+func TestHandler(ctx context.Context, s *entities.Scenario, action entities.EventName) ([]*ntest_pb.ReturnTestMessage, error) {
+	var test entities.TestConfig
+	if err := database.FindEntity(s.TestConfId, utils.KEY_PREFIX_TEST, &test); err != nil {
+		return nil, fmt.Errorf("test config %s not found", s.TestConfId)
+	}
+
+	if action != entities.EVENT_CHECK && test.Status == entities.STATUS_DEPLOYING {
+		return nil, fmt.Errorf("test '%s' is '%s' now", test.Id, test.Status)
+	}
+
+	switch action {
+	case entities.EVENT_DEPLOY:
+		var compute entities.ComputeConfig
+		if err := database.FindEntity(s.ComputeConfId, utils.KEY_PREFIX_COMPUTE, &compute); err != nil {
+			return nil, fmt.Errorf("compute config '%s' not found", s.ComputeConfId)
+		}
+
+		if compute.Status != entities.STATUS_READY {
+			return nil, fmt.Errorf("compute config '%s' is '%s' now", s.ComputeConfId, compute.Status)
+		}
+
+		return runTests(ctx, &test, compute.Id)
+
+	case entities.EVENT_CHECK:
+		var responses []*ntest_pb.ReturnTestMessage
+		for i := range test.Tests {
+			if test.Tests[i].RunId == "" {
+				continue
+			}
+			var testPb ntest_pb.InternalTestConfiguration
+			if err := constructTestMessage(&test.Tests[i], &testPb, action); err != nil {
+				return nil, err
+			}
+			responseTest, err := grpcclient.TestClient(ctx, &testPb)
+			if err != nil {
+				return nil, fmt.Errorf("check test failed, Error = '%s'", err.Error())
+			}
+			responses = append(responses, responseTest)
+		}
+		return responses, nil
+
+	case entities.EVENT_DELETE:
+		for i := range test.Tests {
+			test.Tests[i].RunId = ""
+			test.Tests[i].Status = entities.STATUS_NONE
+		}
+		test.Status = entities.STATUS_NONE
+		test.UpdatedAt = time.Now()
+		database.Set(utils.KEY_PREFIX_TEST+test.Id, &test)
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("'%s' is not supported on test", action)
+}
+
+// Runs every test in the test config one after another, waiting for each to
+// finish on merak-ntest. A test which runs but doesn't pass marks the test
+// config FAILED without returning an error, so its results are still reported.
+// The tests only run against the VMs of the given compute config.
+func runTests(ctx context.Context, test *entities.TestConfig, computeConfigId string) ([]*ntest_pb.ReturnTestMessage, error) {
+	test.Status = entities.STATUS_DEPLOYING
+	database.Set(utils.KEY_PREFIX_TEST+test.Id, test)
+
+	var responses []*ntest_pb.ReturnTestMessage
+	status := entities.STATUS_DONE
+	for i := range test.Tests {
+		t := &test.Tests[i]
+		t.RunId = ""
+
+		var testPb ntest_pb.InternalTestConfiguration
+		if err := constructTestMessage(t, &testPb, entities.EVENT_DEPLOY); err != nil {
+			t.Status = entities.STATUS_FAILED
+			test.Status = entities.STATUS_FAILED
+			database.Set(utils.KEY_PREFIX_TEST+test.Id, test)
+			return responses, err
+		}
+		testPb.ComputeConfigId = computeConfigId
+		logger.Log.Infof("constructTestMessage: %s", &testPb)
+
+		responseTest, err := grpcclient.TestClient(ctx, &testPb)
+		if err != nil || responseTest.ReturnCode == pb.ReturnCode_FAILED {
+			t.Status = entities.STATUS_FAILED
+			test.Status = entities.STATUS_FAILED
+			database.Set(utils.KEY_PREFIX_TEST+test.Id, test)
+			if responseTest != nil {
+				return responses, fmt.Errorf("run test '%s' failed, return = '%s'", t.Name, responseTest.ReturnMessage)
+			}
+			return responses, fmt.Errorf("run test '%s' failed, Error = '%s'", t.Name, err.Error())
+		}
+
+		t.RunId = responseTest.GetResults().GetId()
+		t.Status = entities.STATUS_DEPLOYING
+		database.Set(utils.KEY_PREFIX_TEST+test.Id, test)
+
+		responseTest, err = waitForTest(ctx, t, &testPb)
+		if err != nil {
+			t.Status = entities.STATUS_FAILED
+			test.Status = entities.STATUS_FAILED
+			database.Set(utils.KEY_PREFIX_TEST+test.Id, test)
+			return responses, err
+		}
+		logger.Log.Infof("responseTestMessage: %s", responseTest)
+
+		t.Status = testResultToStatus(responseTest.GetResults())
+		if t.Status != entities.STATUS_DONE {
+			status = entities.STATUS_FAILED
+		}
+		responses = append(responses, responseTest)
+	}
+
+	test.Status = status
+	test.UpdatedAt = time.Now()
+	database.Set(utils.KEY_PREFIX_TEST+test.Id, test)
+
+	return responses, nil
+}
+
+// Polls merak-ntest until no VM in the test is still running
+func waitForTest(ctx context.Context, t *entities.Test, testPb *ntest_pb.InternalTestConfiguration) (*ntest_pb.ReturnTestMessage, error) {
+	testPb.OperationType = pb.OperationType_INFO
+	testPb.Id = t.RunId
+	deadline := time.Now().Add(time.Second * time.Duration(utils.GetTestTimeout()))
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(utils.TEST_POLL_INTERVAL):
+		}
+
+		responseTest, err := grpcclient.TestClient(ctx, testPb)
+		if err != nil {
+			return nil, fmt.Errorf("check test '%s' failed, Error = '%s'", t.Name, err.Error())
+		}
+		if responseTest.ReturnCode == pb.ReturnCode_FAILED {
+			return nil, fmt.Errorf("check test '%s' failed, return = '%s'", t.Name, responseTest.ReturnMessage)
+		}
+		if !testRunning(responseTest.GetResults()) {
+			return responseTest, nil
+		}
+	}
+
+	return nil, fmt.Errorf("test '%s' didn't finish in %d seconds", t.Name, utils.GetTestTimeout())
+}
+
+func testRunning(results *ntest_pb.InternalTestInfo) bool {
+	for _, host := range results.GetHosts() {
+		for _, vm := range host.GetVms() {
+			if vm.GetResults() == ntest_pb.TestStatus_RUNNING {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A test passes only if it reached at least one VM and every VM passed
+func testResultToStatus(results *ntest_pb.InternalTestInfo) entities.ServiceStatus {
+	total := 0
+	for _, host := range results.GetHosts() {
+		for _, vm := range host.GetVms() {
+			if vm.GetResults() != ntest_pb.TestStatus_PASSED {
+				return entities.STATUS_FAILED
+			}
+			total++
+		}
+	}
+	if total == 0 {
+		return entities.STATUS_FAILED
+	}
+	return entities.STATUS_DONE
+}
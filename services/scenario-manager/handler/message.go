@@ -15,11 +15,13 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
 	compute_pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
 	network_pb "github.com/futurewei-cloud/merak/api/proto/v1/network"
+	ntest_pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
 	topology_pb "github.com/futurewei-cloud/merak/api/proto/v1/topology"
 	"github.com/futurewei-cloud/merak/services/scenario-manager/entities"
 	"github.com/futurewei-cloud/merak/services/scenario-manager/utils"
@@ -39,6 +41,9 @@ func constructTopologyMessage(topo *entities.TopologyConfig, serviceConf *entiti
 	conf.NumberOfRacks = uint32(topo.NumberOfRacks)
 	conf.VhostPerRack = uint32(topo.VhostsPerRack)
 	conf.PortsPerVswitch = uint32(topo.PortsPerVSwitch)
+	conf.MeshDegree = uint32(topo.MeshDegree)
+	conf.FatTreeK = uint32(topo.FatTreeK)
+	conf.Oversubscription = uint32(topo.Oversubscription)
 	conf.DataPlaneCidr = topo.DataPlaneCidr
 	conf.NumberOfGateways = uint32(topo.NumberOfGateways)
 	conf.GatewayIps = topo.GatewayIPs
@@ -87,6 +92,15 @@ func constructTopologyMessage(topo *entities.TopologyConfig, serviceConf *entiti
 		conf.Vnodes = append(conf.Vnodes, &vnodePb)
 	}
 
+	for _, vlink := range topo.VLinks {
+		var vlinkPb topology_pb.InternalVLinkInfo
+		vlinkPb.OperationType = actionToOperation(action)
+		vlinkPb.Name = vlink.Name
+		vlinkPb.Src = vlink.From
+		vlinkPb.Dst = vlink.To
+		conf.Vlinks = append(conf.Vlinks, &vlinkPb)
+	}
+
 	topoPb.Config = &conf
 
 	return nil
@@ -117,6 +131,8 @@ func getTopoloyType(topoType string) topology_pb.TopologyType {
 		return topology_pb.TopologyType_MESH
 	case "custom":
 		return topology_pb.TopologyType_CUSTOM
+	case "fattree":
+		return topology_pb.TopologyType_FATTREE
 	default:
 		return topology_pb.TopologyType_TREE
 	}
@@ -221,6 +237,7 @@ func constructNetConfMessage(netconf *entities.NetworkConfig, serviceConf *entit
 			sgRulePb.Name = rule.Name
 			sgRulePb.Description = rule.Description
 			sgRulePb.Ethertype = rule.EtherType
+			sgRulePb.Direction = rule.Direction
 			sgRulePb.Protocol = rule.Protocol
 			sgRulePb.PortRange = rule.PortRange
 			sgRulePb.RemoteGroupId = rule.RemoteGroupId
@@ -256,6 +273,19 @@ func constructComputeMessage(compute *entities.ComputeConfig, serviceConf *entit
 	vmDeployPb.OperationType = actionToOperation(action)
 	vmDeployPb.DeployType = getVMDeployType(compute.VmDeployType)
 	vmDeployPb.Scheduler = getVMDeployScheduler(compute.Scheduler)
+	vmDeployPb.HotNodeRatio = compute.HotNodeRatio
+	vmDeployPb.Skew = compute.Skew
+	vmDeployPb.Seed = compute.Seed
+	vmDeployPb.Rps = compute.Rps
+	for _, pod := range compute.VmDeployMethod {
+		vmDeployPb.DeployMethod = append(vmDeployPb.DeployMethod, &compute_pb.InternalVMPod{
+			OperationType: actionToOperation(action),
+			PodName:       pod.PodName,
+			PodIp:         pod.PodIp,
+			NumOfVm:       uint32(pod.NumberOfVMs),
+			Subnets:       pod.Subnets,
+		})
+	}
 
 	if action != entities.EVENT_CHECK {
 		if netReturn != nil {
@@ -263,7 +293,7 @@ func constructComputeMessage(compute *entities.ComputeConfig, serviceConf *entit
 		} else {
 			return errors.New("construct compute message - virtual network is not ready yet")
 		}
-		if vmDeployPb.DeployType == compute_pb.VMDeployType_ASSIGN {
+		if vmDeployPb.DeployType == compute_pb.VMDeployType_ASSIGN && len(vmDeployPb.DeployMethod) == 0 {
 			if len(compute.VPCInfo) <= 0 {
 				return errors.New("construct compute message - please enter VPCInfo for creating VM")
 			}
@@ -294,7 +324,8 @@ func constructComputeMessage(compute *entities.ComputeConfig, serviceConf *entit
 					if compute.NumberOfComputeNodes != 0 && len(vpc.GetSubnets()) != 0 {
 						subnet.NumberVms = uint32(compute.NumberOfVmPerVpc) / uint32(compute.NumberOfComputeNodes) / uint32(len(vpc.GetSubnets()))
 					}
-					if subnet.NumberVms <= 0 {
+					// With a deploy method the number of VMs of each node is given explicitly
+					if subnet.NumberVms <= 0 && len(vmDeployPb.DeployMethod) == 0 {
 						return errors.New("construct compute message - number of VMs to be deployed in a VPC are zero")
 					}
 				}
@@ -342,13 +373,51 @@ func getVMDeployType(deploy string) compute_pb.VMDeployType {
 
 func getVMDeployScheduler(scheduler string) compute_pb.VMScheduleType {
 	switch strings.ToLower(scheduler) {
+	case "concurrent":
+		return compute_pb.VMScheduleType_CONCURRENT
 	case "sequential":
 		return compute_pb.VMScheduleType_SEQUENTIAL
-	case "skew":
+	case "rps", "skew":
 		return compute_pb.VMScheduleType_RPS
-	case "random":
+	case "random", "random_schedule":
 		return compute_pb.VMScheduleType_RANDOM_SCHEDULE
 	default:
-		return compute_pb.VMScheduleType_SEQUENTIAL
+		return compute_pb.VMScheduleType_CONCURRENT
+	}
+}
+
+func constructTestMessage(test *entities.Test, testPb *ntest_pb.InternalTestConfiguration, action entities.EventName) error {
+	testType, err := getTestType(test.Cmd)
+	if err != nil {
+		return err
+	}
+	// merak-ntest only runs its built-in tests, so a test asking for more
+	// than that must not quietly run as one of them
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"script", test.Script != ""},
+		{"parameters", strings.Join(test.Parameters, "") != ""},
+		{"when_to_run", test.WhenToRun != ""},
+		{"where_to_run", test.WhereToRun != ""},
+	} {
+		if field.set {
+			return fmt.Errorf("construct test message - test '%s' sets unsupported field '%s'", test.Name, field.name)
+		}
+	}
+	testPb.OperationType = actionToOperation(action)
+	testPb.TestType = testType
+	testPb.Id = test.RunId
+
+	return nil
+}
+
+func getTestType(testType string) (ntest_pb.TestType, error) {
+	switch strings.ToLower(testType) {
+	case "pingall":
+		return ntest_pb.TestType_PINGALL, nil
+	default:
+		return ntest_pb.TestType_PINGALL, fmt.Errorf("construct test message - unknown test '%s'", testType)
 	}
 }
@@ -0,0 +1,73 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package handler
+
+import (
+	"testing"
+
+	ntest_pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstructTestMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		test   entities.Test
+		expErr string
+	}{
+		{
+			name: "pingall",
+			test: entities.Test{Name: "t1", Cmd: "PingAll", RunId: "run1"},
+		},
+		{
+			name:   "unknown command",
+			test:   entities.Test{Name: "t1", Cmd: "iperf"},
+			expErr: "construct test message - unknown test 'iperf'",
+		},
+		{
+			name:   "script",
+			test:   entities.Test{Name: "t1", Cmd: "pingall", Script: "check.sh"},
+			expErr: "construct test message - test 't1' sets unsupported field 'script'",
+		},
+		{
+			name:   "parameters",
+			test:   entities.Test{Name: "t1", Cmd: "pingall", Parameters: []string{"-c", "10"}},
+			expErr: "construct test message - test 't1' sets unsupported field 'parameters'",
+		},
+		{
+			name:   "when to run",
+			test:   entities.Test{Name: "t1", Cmd: "pingall", WhenToRun: "after"},
+			expErr: "construct test message - test 't1' sets unsupported field 'when_to_run'",
+		},
+		{
+			name:   "where to run",
+			test:   entities.Test{Name: "t1", Cmd: "pingall", WhereToRun: "vhost-0"},
+			expErr: "construct test message - test 't1' sets unsupported field 'where_to_run'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var testPb ntest_pb.InternalTestConfiguration
+			err := constructTestMessage(&tt.test, &testPb, entities.EVENT_DEPLOY)
+			if tt.expErr != "" {
+				assert.EqualError(t, err, tt.expErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, ntest_pb.TestType_PINGALL, testPb.TestType)
+			assert.Equal(t, "run1", testPb.Id)
+		})
+	}
+}
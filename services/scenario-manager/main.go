@@ -79,6 +79,10 @@ func Setup() *fiber.App {
 	}
 	logger.Log.Infoln("Database connected!")
 
+	if err := routes.RecoverJobs(); err != nil {
+		logger.Log.Errorf("recover jobs failed: %s", err.Error())
+	}
+
 	// Fiber instance
 	app := fiber.New()
 
@@ -129,10 +133,16 @@ func SetupRoutes(app *fiber.App) {
 	scenario.Post("/", routes.CreateScenario)
 	scenario.Get("/", routes.GetScenarios)
 	scenario.Get("/:id", routes.GetScenario)
+	scenario.Get("/:id/vms", routes.GetScenarioVMs)
 	scenario.Put("/:id", routes.UpdateScenario)
 	scenario.Delete("/:id", routes.DeleteScenario)
 	scenario.Post("/actions", routes.ScenarioActoins)
 
+	// Job
+	job := app.Group(apiURL + "/jobs")
+	job.Get("/:id", routes.GetJob)
+	job.Delete("/:id", routes.CancelJob)
+
 	// Topology
 	topology := app.Group(apiURL + "/topologies")
 	topology.Post("/", routes.CreateTopology)
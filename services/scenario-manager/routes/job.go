@@ -0,0 +1,191 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/futurewei-cloud/merak/services/scenario-manager/database"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/entities"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/logger"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cancel functions of the jobs running in this scenario-manager
+var runningJobs = struct {
+	sync.Mutex
+	cancels map[string]context.CancelFunc
+}{cancels: make(map[string]context.CancelFunc)}
+
+// Saves a new job for the scenario action and runs the action in the background
+func startJob(scenario *entities.Scenario, service entities.ServiceAction) (*entities.Job, error) {
+	job := entities.Job{
+		Id:         utils.GenUUID(),
+		ScenarioId: scenario.Id,
+		Service:    service,
+		Status:     entities.STATUS_DEPLOYING,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if err := database.Set(utils.KEY_PREFIX_JOB+job.Id, &job); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runningJobs.Lock()
+	runningJobs.cancels[job.Id] = cancel
+	runningJobs.Unlock()
+
+	go runJob(ctx, job, *scenario)
+
+	return &job, nil
+}
+
+func runJob(ctx context.Context, job entities.Job, scenario entities.Scenario) {
+	defer func() {
+		runningJobs.Lock()
+		cancel := runningJobs.cancels[job.Id]
+		delete(runningJobs.cancels, job.Id)
+		runningJobs.Unlock()
+		cancel()
+	}()
+
+	var scenarioStatus entities.ServiceStatus
+	var message string
+	var body interface{}
+	if strings.ToLower(job.Service.ServiceName) == SERVICE_ALL {
+		scenarioStatus, message = runPipeline(ctx, &job, &scenario)
+	} else {
+		scenarioStatus, message, body = doScenarioAction(ctx, &scenario, job.Service)
+	}
+
+	switch {
+	case ctx.Err() == context.Canceled:
+		// Part of the action may have been done already, so the scenario is left failed
+		job.Status = entities.STATUS_CANCELLED
+		job.Message = "Action has been cancelled."
+		scenarioStatus = entities.STATUS_FAILED
+	case scenarioStatus == entities.STATUS_FAILED:
+		job.Status = entities.STATUS_FAILED
+		job.Message = "Scenario Action Failed - " + message
+	default:
+		job.Status = entities.STATUS_DONE
+		job.Message = "Action successfully - " + message
+		job.Result = body
+	}
+	job.UpdatedAt = time.Now()
+	database.Set(utils.KEY_PREFIX_JOB+job.Id, &job)
+
+	scenario.Status = scenarioStatus
+	scenario.UpdatedAt = time.Now()
+	database.Set(utils.KEY_PREFIX_SCENARIO+scenario.Id, &scenario)
+
+	logger.Log.Infof("job %s for scenario %s is %s", job.Id, scenario.Id, job.Status)
+}
+
+// Fails the jobs which were left running by a previous scenario-manager,
+// since nothing is going to finish them anymore.
+func RecoverJobs() error {
+	values, err := database.GetAllValuesWithKeyPrefix(utils.KEY_PREFIX_JOB)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		var job entities.Job
+		if err := json.Unmarshal([]byte(value), &job); err != nil || job.Status != entities.STATUS_DEPLOYING {
+			continue
+		}
+		logger.Log.Warnf("job %s for scenario %s was interrupted", job.Id, job.ScenarioId)
+
+		job.Status = entities.STATUS_FAILED
+		job.Message = "Scenario Action Failed - scenario-manager restarted before the action finished."
+		job.UpdatedAt = time.Now()
+		database.Set(utils.KEY_PREFIX_JOB+job.Id, &job)
+
+		var scenario entities.Scenario
+		if err := database.FindEntity(job.ScenarioId, utils.KEY_PREFIX_SCENARIO, &scenario); err == nil && scenario.Status == entities.STATUS_DEPLOYING {
+			scenario.Status = entities.STATUS_FAILED
+			scenario.UpdatedAt = time.Now()
+			database.Set(utils.KEY_PREFIX_SCENARIO+scenario.Id, &scenario)
+		}
+	}
+	return nil
+}
+
+// Function for retrieving a job
+// @Summary Get a job from database
+// @Description Get the progress and result of a scenario action
+// @Tags job
+// @Accept json
+// @Product json
+// @Param id path string true "JobId"
+// @Success 200 {object} entities.Job "job data with success message"
+// @Failure 404 {object} nil "job data with null and error message"
+// @Router /api/jobs/{id} [get]
+func GetJob(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(http.StatusBadRequest).JSON(utils.ReturnResponseMessage("FAILED", "Job id is missing!", nil))
+	}
+
+	var job entities.Job
+	if err := database.FindEntity(id, utils.KEY_PREFIX_JOB, &job); err != nil {
+		return c.Status(http.StatusNotFound).JSON(utils.ReturnResponseMessage("FAILED", "Job not found!", nil))
+	}
+
+	return c.Status(http.StatusOK).JSON(utils.ReturnResponseMessage("OK", "OK", job))
+}
+
+// Function for cancelling a job
+// @Summary Cancel a running job
+// @Description Cancel a scenario action which is still running
+// @Tags job
+// @Accept json
+// @Product json
+// @Param id path string true "JobId"
+// @Success 200 {object} entities.Job "job data with success message"
+// @Failure 400 {object} nil "job data with null and error message"
+// @Router /api/jobs/{id} [delete]
+func CancelJob(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(http.StatusBadRequest).JSON(utils.ReturnResponseMessage("FAILED", "Job id is missing!", nil))
+	}
+
+	var job entities.Job
+	if err := database.FindEntity(id, utils.KEY_PREFIX_JOB, &job); err != nil {
+		return c.Status(http.StatusNotFound).JSON(utils.ReturnResponseMessage("FAILED", "Job not found!", nil))
+	}
+
+	if job.Status != entities.STATUS_DEPLOYING {
+		return c.Status(http.StatusBadRequest).JSON(utils.ReturnResponseMessage("FAILED", "Job is not running!", job))
+	}
+
+	runningJobs.Lock()
+	cancel, ok := runningJobs.cancels[id]
+	runningJobs.Unlock()
+	if !ok {
+		return c.Status(http.StatusConflict).JSON(utils.ReturnResponseMessage("FAILED", "Job is not running in this scenario-manager!", job))
+	}
+	cancel()
+
+	return c.Status(http.StatusOK).JSON(utils.ReturnResponseMessage("OK", "Job is being cancelled.", job))
+}
@@ -0,0 +1,169 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/database"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/entities"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/logger"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/utils"
+	"github.com/go-redis/redis/v8"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	if err := logger.StartLogger("scenario-manager-test", false, "debug"); err != nil {
+		log.Fatal(err)
+	}
+	mr, err := miniredis.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	database.Rdb = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	code := m.Run()
+	mr.Close()
+	os.Exit(code)
+}
+
+func newJobApp() *fiber.App {
+	app := fiber.New()
+	app.Post("/api/scenarios/actions", ScenarioActoins)
+	app.Get("/api/jobs/:id", GetJob)
+	app.Delete("/api/jobs/:id", CancelJob)
+	return app
+}
+
+func newScenario(t *testing.T) entities.Scenario {
+	scenario := entities.Scenario{
+		Id:            utils.GenUUID(),
+		TopologyId:    utils.GenUUID(),
+		ServiceConfId: utils.GenUUID(),
+		NetworkConfId: utils.GenUUID(),
+		ComputeConfId: utils.GenUUID(),
+		TestConfId:    utils.GenUUID(),
+		Status:        entities.STATUS_NONE,
+	}
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_SCENARIO+scenario.Id, &scenario))
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_TOPOLOGY+scenario.TopologyId, &entities.TopologyConfig{Id: scenario.TopologyId}))
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_SERVICE+scenario.ServiceConfId, &entities.ServiceConfig{Id: scenario.ServiceConfId}))
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_NETWORK+scenario.NetworkConfId, &entities.NetworkConfig{Id: scenario.NetworkConfId}))
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_COMPUTE+scenario.ComputeConfId, &entities.ComputeConfig{Id: scenario.ComputeConfId}))
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_TEST+scenario.TestConfId, &entities.TestConfig{Id: scenario.TestConfId}))
+	return scenario
+}
+
+func doJobRequest(t *testing.T, app *fiber.App, method string, route string, body interface{}) (int, entities.Job) {
+	reqbody, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, route, bytes.NewReader(reqbody))
+	req.Header.Set("Content-Type", "application/json")
+	res, err := app.Test(req, -1)
+	assert.Nil(t, err)
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	var response struct {
+		Data entities.Job `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal(resBody, &response))
+	return res.StatusCode, response.Data
+}
+
+func TestScenarioActionJob(t *testing.T) {
+	app := newJobApp()
+	scenario := newScenario(t)
+
+	// Checking a test config which never ran doesn't need merak-ntest
+	action := entities.ScenarioAction{
+		ScenarioId: scenario.Id,
+		Service:    entities.ServiceAction{ServiceName: "test", Action: entities.EVENT_CHECK},
+	}
+	code, job := doJobRequest(t, app, "POST", "/api/scenarios/actions", action)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.NotEmpty(t, job.Id)
+	assert.Equal(t, scenario.Id, job.ScenarioId)
+
+	assert.Eventually(t, func() bool {
+		code, job = doJobRequest(t, app, "GET", "/api/jobs/"+job.Id, nil)
+		return code == http.StatusOK && job.Status != entities.STATUS_DEPLOYING
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, entities.STATUS_DONE, job.Status)
+
+	var updated entities.Scenario
+	assert.Nil(t, database.FindEntity(scenario.Id, utils.KEY_PREFIX_SCENARIO, &updated))
+	assert.Equal(t, entities.STATUS_DONE, updated.Status)
+
+	code, _ = doJobRequest(t, app, "DELETE", "/api/jobs/"+job.Id, nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = doJobRequest(t, app, "GET", "/api/jobs/"+utils.GenUUID(), nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	action.Service.ServiceName = "unknown"
+	code, _ = doJobRequest(t, app, "POST", "/api/scenarios/actions", action)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestCancelJob(t *testing.T) {
+	app := newJobApp()
+	job := entities.Job{Id: utils.GenUUID(), Status: entities.STATUS_DEPLOYING}
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_JOB+job.Id, &job))
+
+	// The job isn't running in this scenario-manager
+	code, _ := doJobRequest(t, app, "DELETE", "/api/jobs/"+job.Id, nil)
+	assert.Equal(t, http.StatusConflict, code)
+
+	cancelled := make(chan struct{})
+	runningJobs.Lock()
+	runningJobs.cancels[job.Id] = func() { close(cancelled) }
+	runningJobs.Unlock()
+	defer func() {
+		runningJobs.Lock()
+		delete(runningJobs.cancels, job.Id)
+		runningJobs.Unlock()
+	}()
+
+	code, _ = doJobRequest(t, app, "DELETE", "/api/jobs/"+job.Id, nil)
+	assert.Equal(t, http.StatusOK, code)
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("job was not cancelled")
+	}
+}
+
+func TestRecoverJobs(t *testing.T) {
+	scenario := newScenario(t)
+	scenario.Status = entities.STATUS_DEPLOYING
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_SCENARIO+scenario.Id, &scenario))
+	job := entities.Job{Id: utils.GenUUID(), ScenarioId: scenario.Id, Status: entities.STATUS_DEPLOYING}
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_JOB+job.Id, &job))
+
+	assert.Nil(t, RecoverJobs())
+
+	assert.Nil(t, database.FindEntity(job.Id, utils.KEY_PREFIX_JOB, &job))
+	assert.Equal(t, entities.STATUS_FAILED, job.Status)
+	assert.Nil(t, database.FindEntity(scenario.Id, utils.KEY_PREFIX_SCENARIO, &scenario))
+	assert.Equal(t, entities.STATUS_FAILED, scenario.Status)
+}
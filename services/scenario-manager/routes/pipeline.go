@@ -0,0 +1,139 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/futurewei-cloud/merak/services/scenario-manager/database"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/entities"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/logger"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/utils"
+)
+
+const SERVICE_ALL string = "all"
+
+// Services of a scenario in the order they are deployed
+var pipelineServices = []string{"topology", "network", "compute", "test"}
+
+// Runs the action of a single stage, replaced in tests
+var stageAction = doScenarioAction
+
+// Runs an action on every service of the scenario, recording each step in the
+// job's stages. A failed deploy tears down the failed service and then the ones
+// already deployed, in reverse order.
+func runPipeline(ctx context.Context, job *entities.Job, scenario *entities.Scenario) (entities.ServiceStatus, string) {
+	action := job.Service.Action
+
+	switch action {
+	case entities.EVENT_DEPLOY:
+		for i, service := range pipelineServices {
+			if runStage(ctx, job, scenario, service, action) {
+				continue
+			}
+
+			// Cancelling the job shouldn't stop the rollback
+			rollbackCtx := context.Background()
+			if serviceStatus(scenario, service) == entities.STATUS_FAILED {
+				runStage(rollbackCtx, job, scenario, service, entities.EVENT_DELETE)
+			}
+			for j := i - 1; j >= 0; j-- {
+				runStage(rollbackCtx, job, scenario, pipelineServices[j], entities.EVENT_DELETE)
+			}
+			return entities.STATUS_FAILED, fmt.Sprintf("%s on %s failed, rolled back", action, service)
+		}
+		return entities.STATUS_DONE, fmt.Sprintf("%s on %s done", action, "all services")
+
+	case entities.EVENT_DELETE:
+		for i := len(pipelineServices) - 1; i >= 0; i-- {
+			service := pipelineServices[i]
+			if serviceStatus(scenario, service) == entities.STATUS_NONE {
+				continue
+			}
+			if !runStage(ctx, job, scenario, service, action) {
+				return entities.STATUS_FAILED, fmt.Sprintf("%s on %s failed", action, service)
+			}
+		}
+		return entities.STATUS_NONE, fmt.Sprintf("%s on %s done", action, "all services")
+
+	case entities.EVENT_CHECK:
+		status := entities.STATUS_DONE
+		for _, service := range pipelineServices {
+			if !runStage(ctx, job, scenario, service, action) {
+				status = entities.STATUS_FAILED
+			}
+		}
+		return status, fmt.Sprintf("%s on %s done", action, "all services")
+	}
+
+	return entities.STATUS_FAILED, fmt.Sprintf("'%s' is not supported on %s", action, "all services")
+}
+
+// Runs a single stage of the pipeline, returns false if it failed
+func runStage(ctx context.Context, job *entities.Job, scenario *entities.Scenario, service string, action entities.EventName) bool {
+	job.Stages = append(job.Stages, entities.Stage{
+		ServiceName: service,
+		Action:      action,
+		Status:      entities.STATUS_DEPLOYING,
+	})
+	stage := &job.Stages[len(job.Stages)-1]
+	job.UpdatedAt = time.Now()
+	database.Set(utils.KEY_PREFIX_JOB+job.Id, job)
+
+	status, message, _ := stageAction(ctx, scenario, entities.ServiceAction{ServiceName: service, Action: action})
+	if status == entities.STATUS_FAILED {
+		stage.Status = entities.STATUS_FAILED
+	} else {
+		stage.Status = entities.STATUS_DONE
+	}
+	stage.Message = message
+	job.UpdatedAt = time.Now()
+	database.Set(utils.KEY_PREFIX_JOB+job.Id, job)
+
+	logger.Log.Infof("job %s: '%s' %s is %s", job.Id, action, service, stage.Status)
+	return stage.Status == entities.STATUS_DONE
+}
+
+// Current status of a service of the scenario, NONE if its config is missing
+func serviceStatus(scenario *entities.Scenario, service string) entities.ServiceStatus {
+	var status entities.ServiceStatus
+	switch service {
+	case "topology":
+		var topology entities.TopologyConfig
+		if err := database.FindEntity(scenario.TopologyId, utils.KEY_PREFIX_TOPOLOGY, &topology); err == nil {
+			status = topology.Status
+		}
+	case "network":
+		var network entities.NetworkConfig
+		if err := database.FindEntity(scenario.NetworkConfId, utils.KEY_PREFIX_NETWORK, &network); err == nil {
+			status = network.Status
+		}
+	case "compute":
+		var compute entities.ComputeConfig
+		if err := database.FindEntity(scenario.ComputeConfId, utils.KEY_PREFIX_COMPUTE, &compute); err == nil {
+			status = compute.Status
+		}
+	case "test":
+		var test entities.TestConfig
+		if err := database.FindEntity(scenario.TestConfId, utils.KEY_PREFIX_TEST, &test); err == nil {
+			status = test.Status
+		}
+	}
+	if status == "" {
+		return entities.STATUS_NONE
+	}
+	return status
+}
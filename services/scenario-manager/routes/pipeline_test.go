@@ -0,0 +1,120 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package routes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/futurewei-cloud/merak/services/scenario-manager/database"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/entities"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// Replaces the stage actions with ones which only set the service status,
+// failing the given action on the given service.
+func fakeStages(t *testing.T, failService string, failAction entities.EventName) {
+	setStatus := func(s *entities.Scenario, service string, status entities.ServiceStatus) {
+		switch service {
+		case "topology":
+			database.Set(utils.KEY_PREFIX_TOPOLOGY+s.TopologyId, &entities.TopologyConfig{Id: s.TopologyId, Status: status})
+		case "network":
+			database.Set(utils.KEY_PREFIX_NETWORK+s.NetworkConfId, &entities.NetworkConfig{Id: s.NetworkConfId, Status: status})
+		case "compute":
+			database.Set(utils.KEY_PREFIX_COMPUTE+s.ComputeConfId, &entities.ComputeConfig{Id: s.ComputeConfId, Status: status})
+		case "test":
+			database.Set(utils.KEY_PREFIX_TEST+s.TestConfId, &entities.TestConfig{Id: s.TestConfId, Status: status})
+		}
+	}
+
+	stageAction = func(ctx context.Context, s *entities.Scenario, service entities.ServiceAction) (entities.ServiceStatus, string, interface{}) {
+		if service.ServiceName == failService && service.Action == failAction {
+			setStatus(s, service.ServiceName, entities.STATUS_FAILED)
+			return entities.STATUS_FAILED, "failed", nil
+		}
+		switch service.Action {
+		case entities.EVENT_DEPLOY:
+			setStatus(s, service.ServiceName, entities.STATUS_READY)
+		case entities.EVENT_DELETE:
+			setStatus(s, service.ServiceName, entities.STATUS_NONE)
+		}
+		return entities.STATUS_DONE, "done", nil
+	}
+	t.Cleanup(func() { stageAction = doScenarioAction })
+}
+
+func stagesOf(job *entities.Job) []entities.Stage {
+	var stages []entities.Stage
+	for _, stage := range job.Stages {
+		stages = append(stages, entities.Stage{ServiceName: stage.ServiceName, Action: stage.Action, Status: stage.Status})
+	}
+	return stages
+}
+
+func TestPipelineDeploy(t *testing.T) {
+	fakeStages(t, "", "")
+	scenario := newScenario(t)
+	job := entities.Job{Id: utils.GenUUID(), ScenarioId: scenario.Id, Service: entities.ServiceAction{ServiceName: SERVICE_ALL, Action: entities.EVENT_DEPLOY}}
+
+	status, _ := runPipeline(context.Background(), &job, &scenario)
+	assert.Equal(t, entities.STATUS_DONE, status)
+	assert.Equal(t, []entities.Stage{
+		{ServiceName: "topology", Action: entities.EVENT_DEPLOY, Status: entities.STATUS_DONE},
+		{ServiceName: "network", Action: entities.EVENT_DEPLOY, Status: entities.STATUS_DONE},
+		{ServiceName: "compute", Action: entities.EVENT_DEPLOY, Status: entities.STATUS_DONE},
+		{ServiceName: "test", Action: entities.EVENT_DEPLOY, Status: entities.STATUS_DONE},
+	}, stagesOf(&job))
+
+	// The stages are saved along with the job
+	var saved entities.Job
+	assert.Nil(t, database.FindEntity(job.Id, utils.KEY_PREFIX_JOB, &saved))
+	assert.Len(t, saved.Stages, 4)
+}
+
+func TestPipelineRollback(t *testing.T) {
+	fakeStages(t, "compute", entities.EVENT_DEPLOY)
+	scenario := newScenario(t)
+	job := entities.Job{Id: utils.GenUUID(), ScenarioId: scenario.Id, Service: entities.ServiceAction{ServiceName: SERVICE_ALL, Action: entities.EVENT_DEPLOY}}
+
+	status, _ := runPipeline(context.Background(), &job, &scenario)
+	assert.Equal(t, entities.STATUS_FAILED, status)
+	assert.Equal(t, []entities.Stage{
+		{ServiceName: "topology", Action: entities.EVENT_DEPLOY, Status: entities.STATUS_DONE},
+		{ServiceName: "network", Action: entities.EVENT_DEPLOY, Status: entities.STATUS_DONE},
+		{ServiceName: "compute", Action: entities.EVENT_DEPLOY, Status: entities.STATUS_FAILED},
+		{ServiceName: "compute", Action: entities.EVENT_DELETE, Status: entities.STATUS_DONE},
+		{ServiceName: "network", Action: entities.EVENT_DELETE, Status: entities.STATUS_DONE},
+		{ServiceName: "topology", Action: entities.EVENT_DELETE, Status: entities.STATUS_DONE},
+	}, stagesOf(&job))
+
+	for _, service := range pipelineServices {
+		assert.Equal(t, entities.STATUS_NONE, serviceStatus(&scenario, service), service)
+	}
+}
+
+func TestPipelineDelete(t *testing.T) {
+	fakeStages(t, "", "")
+	scenario := newScenario(t)
+	database.Set(utils.KEY_PREFIX_TOPOLOGY+scenario.TopologyId, &entities.TopologyConfig{Id: scenario.TopologyId, Status: entities.STATUS_READY})
+	database.Set(utils.KEY_PREFIX_NETWORK+scenario.NetworkConfId, &entities.NetworkConfig{Id: scenario.NetworkConfId, Status: entities.STATUS_READY})
+	job := entities.Job{Id: utils.GenUUID(), ScenarioId: scenario.Id, Service: entities.ServiceAction{ServiceName: SERVICE_ALL, Action: entities.EVENT_DELETE}}
+
+	// Services which were never deployed are skipped
+	status, _ := runPipeline(context.Background(), &job, &scenario)
+	assert.Equal(t, entities.STATUS_NONE, status)
+	assert.Equal(t, []entities.Stage{
+		{ServiceName: "network", Action: entities.EVENT_DELETE, Status: entities.STATUS_DONE},
+		{ServiceName: "topology", Action: entities.EVENT_DELETE, Status: entities.STATUS_DONE},
+	}, stagesOf(&job))
+}
@@ -14,14 +14,18 @@ Copyright(c) 2022 Futurewei Cloud
 package routes
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	compute_pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+	ntest_pb "github.com/futurewei-cloud/merak/api/proto/v1/ntest"
 	"github.com/futurewei-cloud/merak/services/scenario-manager/database"
 	"github.com/futurewei-cloud/merak/services/scenario-manager/entities"
 	"github.com/futurewei-cloud/merak/services/scenario-manager/handler"
@@ -29,17 +33,19 @@ import (
 	"github.com/futurewei-cloud/merak/services/scenario-manager/utils"
 	"github.com/gofiber/fiber/v2"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 //Function for doing some actions for a scenario
 //@Summary Do something on a scenario
-//@Description Take an action on a scenario
+//@Description Start an action on a scenario in the background, poll /api/jobs/{id} for its result.
+//@Description Service 'all' deploys, checks or deletes every service of the scenario in order.
 //@Tags scenario
 //@Accept json
 //@Product json
 //@Param scenario body entities.ScenarioAction true "ScenarioAction"
-//@Success 200 {object} entities.ScenarioAction "scenario action data with success message"
-//@Failure 500 {object} nil "scenario action null with failure message"
+//@Success 202 {object} entities.Job "job of the scenario action with success message"
+//@Failure 400 {object} nil "scenario action null with failure message"
 //@Router /api/scenarios/actions [post]
 func ScenarioActoins(c *fiber.Ctx) error {
 	var scenarioAction entities.ScenarioAction
@@ -48,6 +54,18 @@ func ScenarioActoins(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).JSON(utils.ReturnResponseMessage("FAILED", err.Error(), nil))
 	}
 
+	switch strings.ToLower(scenarioAction.Service.ServiceName) {
+	case "topology", "network", "compute", "test":
+	case SERVICE_ALL:
+		switch scenarioAction.Service.Action {
+		case entities.EVENT_DEPLOY, entities.EVENT_DELETE, entities.EVENT_CHECK:
+		default:
+			return c.Status(http.StatusBadRequest).JSON(utils.ReturnResponseMessage("FAILED", fmt.Sprintf("'%s' is not supported on all services", scenarioAction.Service.Action), scenarioAction))
+		}
+	default:
+		return c.Status(http.StatusBadRequest).JSON(utils.ReturnResponseMessage("FAILED", "Scenario Action Failed.", scenarioAction))
+	}
+
 	var scenario entities.Scenario
 	if err := database.FindEntity(scenarioAction.ScenarioId, utils.KEY_PREFIX_SCENARIO, &scenario); err != nil {
 		return c.Status(http.StatusNotFound).JSON(utils.ReturnResponseMessage("FAILED", "Scenario not found!", nil))
@@ -64,23 +82,37 @@ func ScenarioActoins(c *fiber.Ctx) error {
 	scenario.Status = entities.STATUS_DEPLOYING
 	database.Set(utils.KEY_PREFIX_SCENARIO+scenario.Id, &scenario)
 
+	job, err := startJob(&scenario, scenarioAction.Service)
+	if err != nil {
+		scenario.Status = entities.STATUS_FAILED
+		database.Set(utils.KEY_PREFIX_SCENARIO+scenario.Id, &scenario)
+		return c.Status(http.StatusInternalServerError).JSON(utils.ReturnResponseMessage("FAILED", err.Error(), nil))
+	}
+
+	return c.Status(http.StatusAccepted).JSON(utils.ReturnResponseMessage("OK", "Action has been started.", job))
+}
+
+// Runs a service action of a scenario, returning the scenario status after the
+// action along with a summary message and the body of the service's reply.
+func doScenarioAction(ctx context.Context, scenario *entities.Scenario, service entities.ServiceAction) (entities.ServiceStatus, string, interface{}) {
 	var returnBody interface{}
 	var scenarioStatus entities.ServiceStatus
 	var returnMessage string
 
-	if strings.ToLower(scenarioAction.Service.ServiceName) == "topology" {
-		returnTopo, err := handler.TopologyHandler(&scenario, scenarioAction.Service.Action)
+	if strings.ToLower(service.ServiceName) == "topology" {
+		returnTopo, err := handler.TopologyHandler(ctx, scenario, service.Action)
 		if err != nil || returnTopo.ReturnCode == pb.ReturnCode_FAILED {
 			scenarioStatus = entities.STATUS_FAILED
-			logger.Log.Errorf("'%s' topology failed: %s", scenarioAction.Service.Action, err.Error())
+			returnMessage = actionError(err, returnTopo.GetReturnMessage())
+			logger.Log.Errorf("'%s' topology failed: %s", service.Action, returnMessage)
 		} else {
-			if scenarioAction.Service.Action == entities.EVENT_DELETE {
+			if service.Action == entities.EVENT_DELETE {
 				scenarioStatus = entities.STATUS_NONE
 			} else {
 				scenarioStatus = entities.STATUS_DONE
 			}
-			logger.Log.Infof("'%s' topology done.", scenarioAction.Service.Action)
-			logger.Log.Infof("returnTopo for action %s : %s", scenarioAction.Service.Action, returnTopo)
+			logger.Log.Infof("'%s' topology done.", service.Action)
+			logger.Log.Infof("returnTopo for action %s : %s", service.Action, returnTopo)
 
 			var ready = 0
 			var deplolying = 0
@@ -104,47 +136,33 @@ func ScenarioActoins(c *fiber.Ctx) error {
 					others++
 				}
 			}
-			returnMessage = fmt.Sprintf("%s on %s got - DONE: %d, READY: %d, DEPLOYING: %d, DELETING: %d, ERROR: %d, Others: %d", scenarioAction.Service.Action, "Topology", done, ready, deplolying, deleting, errors, others)
-
-			ret, err := protojson.Marshal(returnTopo)
-			if err != nil {
-				logger.Log.Errorf("returnBody Error: %s", err.Error())
-			} else {
-				if err1 := json.Unmarshal(ret, &returnBody); err1 != nil {
-					logger.Log.Errorf("Unmarshal error: %s", err1.Error())
-				}
-			}
+			returnMessage = fmt.Sprintf("%s on %s got - DONE: %d, READY: %d, DEPLOYING: %d, DELETING: %d, ERROR: %d, Others: %d", service.Action, "Topology", done, ready, deplolying, deleting, errors, others)
+			returnBody = protoToBody(returnTopo)
 		}
-	} else if strings.ToLower(scenarioAction.Service.ServiceName) == "network" {
-		returnNetwork, err := handler.NetworkHandler(&scenario, scenarioAction.Service.Action)
+	} else if strings.ToLower(service.ServiceName) == "network" {
+		returnNetwork, err := handler.NetworkHandler(ctx, scenario, service.Action)
 		if err != nil || returnNetwork.ReturnCode == pb.ReturnCode_FAILED {
 			scenarioStatus = entities.STATUS_FAILED
-			logger.Log.Errorf("'%s' network failed: %s", scenarioAction.Service.Action, err.Error())
+			returnMessage = actionError(err, returnNetwork.GetReturnMessage())
+			logger.Log.Errorf("'%s' network failed: %s", service.Action, returnMessage)
 		} else {
 			scenarioStatus = entities.STATUS_DONE
-			logger.Log.Infof("'%s' network done.", scenarioAction.Service.Action)
-			logger.Log.Infof("returnNetwork for action %s : %s", scenarioAction.Service.Action, returnNetwork)
+			logger.Log.Infof("'%s' network done.", service.Action)
+			logger.Log.Infof("returnNetwork for action %s : %s", service.Action, returnNetwork)
 
-			returnMessage = fmt.Sprintf("%s on %s done", scenarioAction.Service.Action, "Network")
-
-			ret, err := protojson.Marshal(returnNetwork)
-			if err != nil {
-				logger.Log.Errorf("returnBody Error: %s", err.Error())
-			} else {
-				if err1 := json.Unmarshal(ret, &returnBody); err1 != nil {
-					logger.Log.Errorf("Unmarshal error: %s", err1.Error())
-				}
-			}
+			returnMessage = fmt.Sprintf("%s on %s done", service.Action, "Network")
+			returnBody = protoToBody(returnNetwork)
 		}
-	} else if strings.ToLower(scenarioAction.Service.ServiceName) == "compute" {
-		returnCompute, err := handler.ComputeHanlder(&scenario, scenarioAction.Service.Action)
+	} else if strings.ToLower(service.ServiceName) == "compute" {
+		returnCompute, err := handler.ComputeHanlder(ctx, scenario, service.Action)
 		if err != nil || returnCompute.ReturnCode == pb.ReturnCode_FAILED {
 			scenarioStatus = entities.STATUS_FAILED
-			logger.Log.Errorf("'%s' compute failed: %s", scenarioAction.Service.Action, err.Error())
+			returnMessage = actionError(err, returnCompute.GetReturnMessage())
+			logger.Log.Errorf("'%s' compute failed: %s", service.Action, returnMessage)
 		} else {
 			scenarioStatus = entities.STATUS_DONE
-			logger.Log.Infof("'%s' compute done.", scenarioAction.Service.Action)
-			logger.Log.Infof("returnCompute for action %s : %s", scenarioAction.Service.Action, returnCompute)
+			logger.Log.Infof("'%s' compute done.", service.Action)
+			logger.Log.Infof("returnCompute for action %s : %s", service.Action, returnCompute)
 
 			var ready = 0
 			var deplolying = 0
@@ -168,30 +186,84 @@ func ScenarioActoins(c *fiber.Ctx) error {
 					others++
 				}
 			}
-			returnMessage = fmt.Sprintf("%s on %s got - DONE: %d, READY: %d, DEPLOYING: %d, DELETING: %d, ERROR: %d, Others: %d", scenarioAction.Service.Action, "Compute", done, ready, deplolying, deleting, errors, others)
+			returnMessage = fmt.Sprintf("%s on %s got - DONE: %d, READY: %d, DEPLOYING: %d, DELETING: %d, ERROR: %d, Others: %d", service.Action, "Compute", done, ready, deplolying, deleting, errors, others)
+			returnBody = protoToBody(returnCompute)
+		}
+	} else if strings.ToLower(service.ServiceName) == "test" {
+		returnTests, err := handler.TestHandler(ctx, scenario, service.Action)
+		if err != nil {
+			scenarioStatus = entities.STATUS_FAILED
+			returnMessage = err.Error()
+			logger.Log.Errorf("'%s' test failed: %s", service.Action, returnMessage)
+		} else {
+			scenarioStatus = entities.STATUS_DONE
 
-			ret, err := protojson.Marshal(returnCompute)
-			if err != nil {
-				logger.Log.Errorf("returnBody Error: %s", err.Error())
-			} else {
-				if err1 := json.Unmarshal(ret, &returnBody); err1 != nil {
-					logger.Log.Errorf("Unmarshal error: %s", err1.Error())
+			var passed = 0
+			var failed = 0
+			var running = 0
+			var others = 0
+			var results []interface{}
+			for _, returnTest := range returnTests {
+				for _, host := range returnTest.GetResults().GetHosts() {
+					for _, vm := range host.GetVms() {
+						switch vm.Results {
+						case ntest_pb.TestStatus_PASSED:
+							passed++
+						case ntest_pb.TestStatus_FAILED:
+							failed++
+						case ntest_pb.TestStatus_RUNNING:
+							running++
+						default:
+							others++
+						}
+					}
 				}
+				results = append(results, protoToBody(returnTest))
+			}
+			returnMessage = fmt.Sprintf("%s on %s got - PASSED: %d, FAILED: %d, RUNNING: %d, Others: %d", service.Action, "Test", passed, failed, running, others)
+			returnBody = results
+
+			// A test which runs but doesn't pass isn't an error from the test
+			// handler, so check the results and the test config as well.
+			if failed > 0 || testConfigFailed(scenario.TestConfId) {
+				scenarioStatus = entities.STATUS_FAILED
+				logger.Log.Errorf("'%s' test failed: %s", service.Action, returnMessage)
+			} else {
+				logger.Log.Infof("'%s' test done.", service.Action)
 			}
 		}
-	} else {
-		return c.Status(http.StatusBadRequest).JSON(utils.ReturnResponseMessage("FAILED", "Scenario Action Failed.", scenarioAction))
 	}
 
-	scenario.Status = scenarioStatus
-	scenario.UpdatedAt = time.Now()
-	database.Set(utils.KEY_PREFIX_SCENARIO+scenario.Id, &scenario)
+	return scenarioStatus, returnMessage, returnBody
+}
 
-	if scenario.Status == entities.STATUS_FAILED {
-		return c.Status(http.StatusInternalServerError).JSON(utils.ReturnResponseMessage("FAILED", "Scenario Action Failed.", scenarioAction))
+func testConfigFailed(id string) bool {
+	var test entities.TestConfig
+	if err := database.FindEntity(id, utils.KEY_PREFIX_TEST, &test); err != nil {
+		return false
+	}
+	return test.Status == entities.STATUS_FAILED
+}
+
+func actionError(err error, returnMessage string) string {
+	if err != nil {
+		return err.Error()
 	}
+	return returnMessage
+}
 
-	return c.Status(http.StatusOK).JSON(utils.ReturnResponseMessage("OK", "Action successfully - "+returnMessage, returnBody))
+// Converts a service reply into a plain json body so it can be persisted in a job
+func protoToBody(m proto.Message) interface{} {
+	var body interface{}
+	ret, err := protojson.Marshal(m)
+	if err != nil {
+		logger.Log.Errorf("returnBody Error: %s", err.Error())
+		return nil
+	}
+	if err := json.Unmarshal(ret, &body); err != nil {
+		logger.Log.Errorf("Unmarshal error: %s", err.Error())
+	}
+	return body
 }
 
 //Function for creating a scenario
@@ -284,6 +356,74 @@ func GetScenario(c *fiber.Ctx) error {
 	return c.Status(http.StatusOK).JSON(utils.ReturnResponseMessage("OK", "OK", scenario))
 }
 
+//Function for listing the VMs of a scenario
+//@Summary Get the VMs deployed by a scenario
+//@Description List the VMs of the scenario's compute config with their status and failure reason.
+//@Description Status takes a comma separated list such as ERROR,DEPLOYING, host matches the node name or IP.
+//@Tags scenario
+//@Accept json
+//@Product json
+//@Param id path string true "ScenarioId"
+//@Param status query string false "VM status"
+//@Param host query string false "Compute node name or IP"
+//@Param vpc_id query string false "VPC ID"
+//@Param subnet_id query string false "Subnet ID"
+//@Param offset query int false "Number of matching VMs to skip"
+//@Param limit query int false "Maximum number of VMs returned, 1000 by default"
+//@Success 200 {object} nil "total number of matching VMs and a page of them with success message"
+//@Failure 400 {object} nil "invalid query with failure message"
+//@Router /api/scenarios/{id}/vms [get]
+func GetScenarioVMs(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if id == "" {
+		return c.Status(http.StatusBadRequest).JSON(utils.ReturnResponseMessage("FAILED", "Scenario id is missing!", nil))
+	}
+
+	query, err := vmQuery(c)
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(utils.ReturnResponseMessage("FAILED", err.Error(), nil))
+	}
+
+	var scenario entities.Scenario
+	if err := database.FindEntity(id, utils.KEY_PREFIX_SCENARIO, &scenario); err != nil {
+		return c.Status(http.StatusNotFound).JSON(utils.ReturnResponseMessage("FAILED", "Scenario not found!", nil))
+	}
+
+	returnCompute, err := handler.ComputeVMs(context.Background(), &scenario, query)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(utils.ReturnResponseMessage("FAILED", err.Error(), nil))
+	}
+
+	return c.Status(http.StatusOK).JSON(utils.ReturnResponseMessage("OK", returnCompute.ReturnMessage, protoToBody(returnCompute)))
+}
+
+func vmQuery(c *fiber.Ctx) (*compute_pb.InternalVMQuery, error) {
+	query := compute_pb.InternalVMQuery{
+		Host:     c.Query("host"),
+		VpcId:    c.Query("vpc_id"),
+		SubnetId: c.Query("subnet_id"),
+	}
+	if status := c.Query("status"); status != "" {
+		for _, name := range strings.Split(status, ",") {
+			value, ok := pb.Status_value[strings.ToUpper(strings.TrimSpace(name))]
+			if !ok {
+				return nil, fmt.Errorf("unknown VM status '%s'", name)
+			}
+			query.Status = append(query.Status, pb.Status(value))
+		}
+	}
+	for name, field := range map[string]*uint32{"offset": &query.Offset, "limit": &query.Limit} {
+		if value := c.Query(name); value != "" {
+			number, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s '%s'", name, value)
+			}
+			*field = uint32(number)
+		}
+	}
+	return &query, nil
+}
+
 //Function for updating a scenario
 //@Summary Update a scenario to database
 //@Description Update a scenario
@@ -0,0 +1,77 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+    Permission is hereby granted,
+    free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+    including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+    to whom the Software is furnished to do so, subject to the following conditions:
+    The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+    THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+    FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+    WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package routes
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	pb "github.com/futurewei-cloud/merak/api/proto/v1/common"
+	compute_pb "github.com/futurewei-cloud/merak/api/proto/v1/compute"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/database"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/entities"
+	"github.com/futurewei-cloud/merak/services/scenario-manager/utils"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestVMQuery(t *testing.T) {
+	var query *compute_pb.InternalVMQuery
+	app := fiber.New()
+	app.Get("/query", func(c *fiber.Ctx) error {
+		var err error
+		if query, err = vmQuery(c); err != nil {
+			return c.SendStatus(http.StatusBadRequest)
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+	get := func(url string) int {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		res, err := app.Test(req, -1)
+		assert.Nil(t, err)
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get("/query?status=error,%20Deploying&host=vhost-1&vpc_id=v1&subnet_id=s1&offset=20&limit=10"))
+	assert.True(t, proto.Equal(&compute_pb.InternalVMQuery{
+		Status:   []pb.Status{pb.Status_ERROR, pb.Status_DEPLOYING},
+		Host:     "vhost-1",
+		VpcId:    "v1",
+		SubnetId: "s1",
+		Offset:   20,
+		Limit:    10,
+	}, query))
+
+	assert.Equal(t, http.StatusBadRequest, get("/query?status=BROKEN"))
+	assert.Equal(t, http.StatusBadRequest, get("/query?limit=-1"))
+
+	// The scenario is looked up after the query is checked
+	app.Get("/api/scenarios/:id/vms", GetScenarioVMs)
+	assert.Equal(t, http.StatusNotFound, get("/api/scenarios/missing/vms?status=DONE"))
+	assert.Equal(t, http.StatusBadRequest, get("/api/scenarios/missing/vms?offset=x"))
+}
+
+func TestTestActionStatus(t *testing.T) {
+	scenario := newScenario(t)
+	check := entities.ServiceAction{ServiceName: "test", Action: entities.EVENT_CHECK}
+
+	status, _, _ := doScenarioAction(context.Background(), &scenario, check)
+	assert.Equal(t, entities.STATUS_DONE, status)
+
+	// Tests which ran but didn't pass fail the action, so a pipeline rolls back
+	assert.Nil(t, database.Set(utils.KEY_PREFIX_TEST+scenario.TestConfId, &entities.TestConfig{Id: scenario.TestConfId, Status: entities.STATUS_FAILED}))
+	status, _, _ = doScenarioAction(context.Background(), &scenario, check)
+	assert.Equal(t, entities.STATUS_FAILED, status)
+}
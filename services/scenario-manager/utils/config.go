@@ -74,3 +74,11 @@ func GetGrpcTimeout() int64 {
 	}
 	return cfg.GrpcTimeout
 }
+
+// Seconds to wait for a test to finish on merak-ntest
+func GetTestTimeout() int64 {
+	if cfg.TestTimeout <= 0 {
+		return 600
+	}
+	return cfg.TestTimeout
+}
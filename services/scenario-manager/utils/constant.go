@@ -13,6 +13,8 @@ Copyright(c) 2022 Futurewei Cloud
 
 package utils
 
+import "time"
+
 const CODE_SUCCESS uint16 = 200
 const CODE_FAILED uint16 = 500
 const CODE_NOT_FOUND uint16 = 400
@@ -23,8 +25,11 @@ const KEY_PREFIX_NETWORK string = "network:"
 const KEY_PREFIX_COMPUTE string = "compute:"
 const KEY_PREFIX_SERVICE string = "service:"
 const KEY_PREFIX_TEST string = "test:"
+const KEY_PREFIX_JOB string = "job:"
 
 const MERAK_TOPOLOGY string = "TOPOLOGY"
 const MERAK_NETWORK string = "NETWORK"
 const MERAK_COMPUTE string = "COMPUTE"
 const MERAK_AGENT string = "AGENT"
+
+const TEST_POLL_INTERVAL = 5 * time.Second
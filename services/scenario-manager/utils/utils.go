@@ -33,6 +33,16 @@ func UpdateChecker(src interface{}, upt interface{}) interface{} {
 			return upt
 		}
 		return src
+	case float64:
+		if upt.(float64) != 0 {
+			return upt
+		}
+		return src
+	case int64:
+		if upt.(int64) != 0 {
+			return upt
+		}
+		return src
 	case []string:
 		if len(upt.([]string)) > 0 {
 			return upt
@@ -63,6 +73,11 @@ func UpdateChecker(src interface{}, upt interface{}) interface{} {
 			return upt
 		}
 		return src
+	case []entities.VMPod:
+		if len(upt.([]entities.VMPod)) > 0 {
+			return upt
+		}
+		return src
 	case []entities.Router:
 		if len(upt.([]entities.Router)) > 0 {
 			return upt
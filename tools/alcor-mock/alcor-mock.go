@@ -0,0 +1,55 @@
+/*
+MIT License
+Copyright(c) 2022 Futurewei Cloud
+
+	Permission is hereby granted,
+	free of charge, to any person obtaining a copy of this software and associated documentation files(the "Software"), to deal in the Software without restriction,
+	including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense, and / or sell copies of the Software, and to permit persons
+	to whom the Software is furnished to do so, subject to the following conditions:
+	The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+	THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+	FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+	WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+package main
+
+import (
+	"flag"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/futurewei-cloud/merak/services/common/alcormock"
+)
+
+func main() {
+	host := flag.String("host", "0.0.0.0", "address to listen on")
+	ports := flag.String("ports", "", "comma separated ports to listen on, defaults to the Alcor service ports 30001-30008")
+	latency := flag.Duration("latency", 0, "delay added before every response, e.g. 50ms")
+	errorRate := flag.Float64("error-rate", 0, "fraction of requests, between 0 and 1, answered with a 500")
+	seed := flag.Int64("seed", 0, "seed for the error rate, 0 picks a random one")
+	flag.Parse()
+
+	listenPorts := alcormock.DefaultPorts
+	if *ports != "" {
+		listenPorts = nil
+		for _, port := range strings.Split(*ports, ",") {
+			p, err := strconv.Atoi(strings.TrimSpace(port))
+			if err != nil {
+				log.Fatalf("Invalid port %q", port)
+			}
+			listenPorts = append(listenPorts, p)
+		}
+	}
+	if *errorRate < 0 || *errorRate > 1 {
+		log.Fatalf("Invalid error rate %v", *errorRate)
+	}
+
+	server := alcormock.New(alcormock.Config{
+		Latency:   *latency,
+		ErrorRate: *errorRate,
+		Seed:      *seed,
+	})
+	log.Printf("Starting Alcor mock with latency %s and error rate %v", latency.String(), *errorRate)
+	log.Fatal(server.ListenAndServe(*host, listenPorts))
+}